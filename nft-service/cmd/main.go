@@ -6,16 +6,26 @@ import (
 	"fmt"
 	"golang.org/x/sync/errgroup"
 	"log"
+	"main/internal/auth/tools"
 	"main/internal/config"
+	"main/internal/lib/envelope"
+	"main/internal/lib/gads"
 	jwtManager "main/internal/lib/jwt"
+	"main/internal/lib/oidc"
+	"main/internal/lib/pwned"
+	"main/internal/lib/tron"
 	"main/internal/repository/postgresql"
 	"main/internal/server"
+	"main/internal/service"
 	rediscache "main/tools/pkg/cache/redis"
 	coreconfig "main/tools/pkg/core_config"
 	"main/tools/pkg/database"
 	"main/tools/pkg/logger"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"main/internal/handlers"
 )
@@ -65,39 +75,213 @@ func main() {
 	}()
 
 	// инициализируем репозитории
-	userRepository := postgresql.NewUserRepository(db, cfg.Secret)
+	passwordHasher := tools.NewPasswordHasher(tools.PasswordParams{
+		Algorithm:     cfg.Password.Algorithm,
+		Argon2Time:    cfg.Password.Argon2Time,
+		Argon2Memory:  cfg.Password.Argon2Memory,
+		Argon2Threads: cfg.Password.Argon2Threads,
+		Argon2KeyLen:  cfg.Password.Argon2KeyLen,
+		BcryptCost:    cfg.Password.BcryptCost,
+	}, cfg.Secret)
+	userRepository := postgresql.NewUserRepository(db, passwordHasher)
 	tokenRepository := postgresql.NewUserTokenRepository(db, cfg.App.Debug)
 	roleRepository := postgresql.NewRoleRepository(db)
+	sessionRepository := postgresql.NewSessionRepository(db)
 	nftDataRepository := postgresql.NewNftDataRepository(db)
 	nftImageRepository := postgresql.NewNftImageRepository(db)
-	jwt := jwtManager.NewJWTManager(&cfg.JWT)
+	ownershipRepository := postgresql.NewOwnershipRepository(db)
+	unlockableRepository := postgresql.NewUnlockableRepository(db)
+	driftRepository := postgresql.NewDriftRepository(db)
+	burnRepository := postgresql.NewBurnRepository(db)
+	indexerRepository := postgresql.NewIndexerRepository(db)
+	identityRepository := postgresql.NewIdentityRepository(db)
+	apiKeyRepository := postgresql.NewAPIKeyRepository(db)
+	inviteRepository := postgresql.NewInviteRepository(db)
+	jwt, err := jwtManager.NewJWTManager(&cfg.JWT)
+	if err != nil {
+		log.Panic("jwt keys error: ", err)
+	}
+
+	// одноразовые коды подтверждения телефона
+	var smsSender service.SMSSender = service.NewConsoleSMSSender(logger)
+	if cfg.OTP.SMSSender == "file" {
+		smsSender = service.NewFileSMSSender(cfg.OTP.SMSFilePath)
+	}
+	var mailer service.Mailer = service.NewConsoleMailer(logger)
+	if cfg.Mail.Sender == "smtp" {
+		mailer = service.NewSMTPMailer(&cfg.Mail)
+	}
+	otpService := service.NewOTPService(cacheClient, smsSender, mailer, cfg.Secret, &cfg.OTP)
+	throttle := service.NewThrottle(cacheClient, &cfg.RateLimit)
+	revocations := service.NewRevocationList(cacheClient, jwt.GetTokenTTL())
+
+	// даты последнего визита пишутся пачками в фоне, остаток дописывается при остановке сервиса
+	visits := service.NewVisitTracker(logger, userRepository, sessionRepository)
+	visitsDone := make(chan struct{})
+	if cfg.LastVisitFlush > 0 {
+		go func() {
+			defer close(visitsDone)
+			visits.Start(ctx, cfg.LastVisitFlush)
+		}()
+	} else {
+		close(visitsDone)
+	}
+
+	permissions := service.NewPermissionService(roleRepository, cfg.PermissionsTTL)
+	auditLog := service.NewAuditLog(logger, postgresql.NewAuditRepository(db))
+	invites := service.NewInviteService(inviteRepository, permissions)
+
+	// список утекших паролей загружается целиком, проверка идет без обращения к внешнему API
+	var breached service.BreachedPasswords
+	if cfg.Password.BreachedList != "" {
+		list, err := pwned.Open(cfg.Password.BreachedList)
+		if err != nil {
+			log.Panic("breached password list error: ", err)
+		}
+		logger.Info("Breached password list loaded", "hashes", list.Len())
+		breached = list
+	}
+	passwordPolicy := service.NewPasswordPolicy(&cfg.Password, passwordHasher, breached)
+
+	// удалённые пользователи стираются окончательно по истечении срока хранения
+	accountService := service.NewAccountService(logger, userRepository, sessionRepository, identityRepository,
+		apiKeyRepository, ownershipRepository, auditLog, cfg.UserRetention)
+	if cfg.PurgeInterval > 0 {
+		go accountService.Start(ctx, cfg.PurgeInterval)
+	}
+	mfaService := service.NewMFAService(postgresql.NewMFARepository(db), cacheClient, cfg.Secret, &cfg.MFA)
+
+	// провайдеры OpenID Connect, провайдер без client id выключен
+	oidcProviders := map[string]*oidc.Provider{}
+	oidcClient := &http.Client{Timeout: 10 * time.Second}
+	for name, provider := range map[string]config.OIDCProvider{"google": cfg.OIDC.Google} {
+		if provider.ClientID == "" {
+			continue
+		}
+		oidcProviders[name] = oidc.NewProvider(oidc.Config{
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		}, oidcClient)
+	}
+	oidcService := service.NewOIDCService(oidcProviders, cacheClient, cfg.OIDC.StateTTL)
+
+	// шифрование приватного контента токенов включается только при наличии мастер-ключей
+	var unlockableService *service.UnlockableService
+	if len(cfg.Unlockable.MasterKeys) > 0 {
+		keyring, err := envelope.NewKeyring(cfg.Unlockable.MasterKeys, cfg.Unlockable.ActiveKeyID)
+		if err != nil {
+			log.Panic("unlockable keyring error: ", err)
+		}
+		unlockableService = service.NewUnlockableService(unlockableRepository, ownershipRepository, keyring)
+	}
+
+	// клиент контракта коллекции (только чтение)
+	var contract *gads.Caller
+	if cfg.Tron.ContractAddress != "" {
+		contractAddress, err := tron.ParseAddress(cfg.Tron.ContractAddress)
+		if err != nil {
+			log.Panic("invalid contract address: ", err)
+		}
+		tronClient := tron.NewClient(cfg.Tron.APIURL, cfg.Tron.APIKey, cfg.Tron.Timeout)
+		contract = gads.NewCaller(tronClient, contractAddress)
+
+		// индексатор событий контракта: владельцы и сожжённые токены
+		if cfg.IndexerInterval > 0 {
+			indexer := service.NewIndexer(logger, tronClient, contractAddress, ownershipRepository, burnRepository,
+				indexerRepository, unlockableService, cacheClient, cfg.BurnUnpinAfter)
+			go indexer.Start(ctx, cfg.IndexerInterval)
+		}
+	}
+
+	// проверка расхождений метаданных между контрактом и каталогом
+	var driftDetector *service.DriftDetector
+	if contract != nil {
+		driftDetector = service.NewDriftDetector(logger, contract, nftDataRepository, ownershipRepository,
+			driftRepository, cfg.IPFS_GATEWAY_URL)
+		if cfg.DriftInterval > 0 {
+			go driftDetector.Start(ctx, cfg.DriftInterval)
+		}
+	}
 
 	logger.Info("Create server")
 
-	app := server.NewServer()
+	app := server.NewServer(&cfg)
 	logger.Info("Creating internal handlers")
-	authHandlers := handlers.NewAuthHandlers(logger, jwt, userRepository, tokenRepository, roleRepository, cacheClient, cfg.Secret)
-	kuboHandlers := handlers.NewKuboHandlers(logger)
-	nftDataHandlers := handlers.NewNftHandlers(logger, nftDataRepository, nftImageRepository)
+	authHandlers := handlers.NewAuthHandlers(logger, jwt, userRepository, tokenRepository, roleRepository, cacheClient,
+		handlers.AuthDeps{
+			Sessions:       sessionRepository,
+			Identities:     identityRepository,
+			OTP:            otpService,
+			Passwords:      passwordHasher,
+			PasswordPolicy: passwordPolicy,
+			Throttle:       throttle,
+			Revocations:    revocations,
+			Visits:         visits,
+			Permissions:    permissions,
+			MFA:            mfaService,
+			OIDC:           oidcService,
+			AuditLog:       auditLog,
+			Invites:        invites,
+			Telegram:       &cfg.Telegram,
+			InviteOnly:     cfg.InviteOnly,
+		})
+	kuboHandlers := handlers.NewKuboHandlers(logger, auditLog)
+	nftDataHandlers := handlers.NewNftHandlers(logger, nftDataRepository, nftImageRepository, ownershipRepository, contract,
+		permissions, auditLog)
+	unlockableHandlers := handlers.NewUnlockableHandlers(logger, unlockableService, nftDataRepository, permissions)
+	driftHandlers := handlers.NewDriftHandlers(logger, driftDetector, driftRepository)
+	auditHandlers := handlers.NewAuditHandlers(logger, auditLog)
+	accountHandlers := handlers.NewAccountHandlers(logger, accountService, auditLog)
+	impersonationHandlers := handlers.NewImpersonationHandlers(logger, jwt, userRepository, permissions, auditLog,
+		cfg.ImpersonationTTL)
+	inviteHandlers := handlers.NewInviteHandlers(logger, invites, userRepository, roleRepository, auditLog)
+	apiKeyHandlers := handlers.NewAPIKeyHandlers(logger,
+		service.NewAPIKeyService(apiKeyRepository, cfg.Secret), permissions, userRepository)
 
 	// добавляем роуты для экземпляра сервера
-	server.AddRoutes(app, authHandlers, kuboHandlers, nftDataHandlers, logger)
+	server.AddRoutes(app, &cfg, cacheClient, &server.Handlers{
+		Auth:          authHandlers,
+		Kubo:          kuboHandlers,
+		Nft:           nftDataHandlers,
+		Unlockable:    unlockableHandlers,
+		Drift:         driftHandlers,
+		APIKey:        apiKeyHandlers,
+		Audit:         auditHandlers,
+		Account:       accountHandlers,
+		Impersonation: impersonationHandlers,
+		Invite:        inviteHandlers,
+	}, permissions, logger)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	logger.Info("Service api gateway starts", "address", cfg.App.Addr)
-	if err = app.Listen(cfg.App.Addr); err != nil {
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(cfg.App.Addr)
+	}()
+
+	select {
+	case err = <-listenErr:
 		logger.Error("listen error", "error", err)
+	case <-quit:
 	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-
-	<-quit
-
 	if err = app.Shutdown(); err != nil {
-		logger.Info("api-gateway service shutdown")
-		return
+		logger.Error("api-gateway service shutdown error", "error", err)
 	}
 
-	logger.Info("api-gateway service was stopped")
+	// фоновые задачи останавливаются после сервера, чтобы визиты последних запросов тоже были записаны
+	cancel()
+	<-visitsDone
+	if cfg.LastVisitFlush <= 0 {
+		if err = visits.Flush(context.Background()); err != nil {
+			logger.Error("last visit flush failed", "error", err)
+		}
+	}
 
+	logger.Info("api-gateway service was stopped")
 }
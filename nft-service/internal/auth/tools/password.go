@@ -1,9 +1,19 @@
 package tools
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // SaltSize Define salt size
@@ -26,7 +36,8 @@ func GenerateRandomSalt(saltSize int) []byte {
 
 // HashPassword Combine password and salt then hash them using the SHA-512
 // hashing algorithm and then return the hashed password
-// as a hex string
+// as a hex string.
+// Deprecated: legacy format, kept to verify hashes created before PasswordHasher.
 func HashPassword(password, secret string, salt []byte) string {
 	// Convert password string to byte slice
 	var passwordBytes = []byte(password)
@@ -52,9 +63,136 @@ func HashPassword(password, secret string, salt []byte) string {
 	return hashedPasswordHex
 }
 
-// PasswordsMatch Check if two passwords match
+// PasswordsMatch Check if two passwords match (legacy SHA-512 format)
 func PasswordsMatch(hashedPassword, currPassword, secret string, salt []byte) bool {
 	var currPasswordHash = HashPassword(currPassword, secret, salt)
 
-	return hashedPassword == currPasswordHash
+	return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(currPasswordHash)) == 1
+}
+
+// Password hash algorithms
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordParams tunes the password hashing
+type PasswordParams struct {
+	Algorithm     string // argon2id or bcrypt
+	Argon2Time    uint32
+	Argon2Memory  uint32 // KiB
+	Argon2Threads uint8
+	Argon2KeyLen  uint32
+	BcryptCost    int
+}
+
+// PasswordHasher creates encoded, self-describing password hashes:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//	$2a$12$<bcrypt salt and hash>
+//
+// The password is peppered with HMAC-SHA256 over the application secret before hashing,
+// which also keeps long passwords within the bcrypt limit.
+// Hashes without a $ prefix are the legacy SHA-512 hex format with the salt stored separately.
+type PasswordHasher struct {
+	params PasswordParams
+	secret string
+}
+
+// NewPasswordHasher creates a new instance of PasswordHasher.
+func NewPasswordHasher(params PasswordParams, secret string) *PasswordHasher {
+	return &PasswordHasher{
+		params: params,
+		secret: secret,
+	}
+}
+
+// Hash encodes the password with the configured algorithm.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	peppered := h.pepper(password)
+
+	if h.params.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword(peppered, h.params.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := GenerateRandomSalt(SaltSize)
+	key := argon2.IDKey(peppered, salt, h.params.Argon2Time, h.params.Argon2Memory, h.params.Argon2Threads,
+		h.params.Argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.params.Argon2Memory,
+		h.params.Argon2Time, h.params.Argon2Threads, base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks the password against the encoded hash in constant time. salt is used only by the legacy format.
+// needsRehash reports that the hash is valid but was created with another algorithm or parameters.
+func (h *PasswordHasher) Verify(encoded, password string, salt []byte) (match bool, needsRehash bool) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, hashSalt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false
+		}
+		other := argon2.IDKey(h.pepper(password), hashSalt, params.Argon2Time, params.Argon2Memory,
+			params.Argon2Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false
+		}
+		return true, h.params.Algorithm != AlgorithmArgon2id || params.Argon2Time != h.params.Argon2Time ||
+			params.Argon2Memory != h.params.Argon2Memory || params.Argon2Threads != h.params.Argon2Threads ||
+			uint32(len(key)) != h.params.Argon2KeyLen
+	case strings.HasPrefix(encoded, "$2"):
+		if bcrypt.CompareHashAndPassword([]byte(encoded), h.pepper(password)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return true, err != nil || h.params.Algorithm != AlgorithmBcrypt || cost != h.params.BcryptCost
+	case strings.HasPrefix(encoded, "$"):
+		return false, false
+	default:
+		return PasswordsMatch(encoded, password, h.secret, salt), true
+	}
+}
+
+func (h *PasswordHasher) pepper(password string) []byte {
+	mac := hmac.New(sha256.New, []byte(h.secret))
+	mac.Write([]byte(password))
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// decodeArgon2id parses $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func decodeArgon2id(encoded string) (PasswordParams, []byte, []byte, error) {
+	var params PasswordParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time,
+		&params.Argon2Threads); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.Algorithm = AlgorithmArgon2id
+	params.Argon2KeyLen = uint32(len(key))
+	return params, salt, key, nil
 }
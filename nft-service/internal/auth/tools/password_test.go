@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+var testArgon2 = PasswordParams{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1,
+	Argon2KeyLen: 32, BcryptCost: 4}
+
+func TestPasswordHasherArgon2id(t *testing.T) {
+	hasher := NewPasswordHasher(testArgon2, "secret")
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, unexpected format", hash)
+	}
+
+	if match, rehash := hasher.Verify(hash, "correct horse", nil); !match || rehash {
+		t.Errorf("Verify() = %v, %v, expected true, false", match, rehash)
+	}
+	if match, _ := hasher.Verify(hash, "wrong horse", nil); match {
+		t.Error("Verify() of wrong password = true")
+	}
+	if match, _ := NewPasswordHasher(testArgon2, "other").Verify(hash, "correct horse", nil); match {
+		t.Error("Verify() with other secret = true")
+	}
+
+	stronger := testArgon2
+	stronger.Argon2Time = 2
+	if match, rehash := NewPasswordHasher(stronger, "secret").Verify(hash, "correct horse", nil); !match || !rehash {
+		t.Errorf("Verify() with new params = %v, %v, expected true, true", match, rehash)
+	}
+}
+
+func TestPasswordHasherBcrypt(t *testing.T) {
+	params := testArgon2
+	params.Algorithm = AlgorithmBcrypt
+	hasher := NewPasswordHasher(params, "secret")
+
+	hash, err := hasher.Hash(strings.Repeat("long password ", 10))
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if match, rehash := hasher.Verify(hash, strings.Repeat("long password ", 10), nil); !match || rehash {
+		t.Errorf("Verify() = %v, %v, expected true, false", match, rehash)
+	}
+	if match, rehash := NewPasswordHasher(testArgon2, "secret").Verify(hash, strings.Repeat("long password ", 10), nil); !match || !rehash {
+		t.Errorf("Verify() with argon2id configured = %v, %v, expected true, true", match, rehash)
+	}
+}
+
+func TestPasswordHasherLegacy(t *testing.T) {
+	hasher := NewPasswordHasher(testArgon2, "secret")
+	salt := GenerateRandomSalt(SaltSize)
+	legacy := HashPassword("123456", "secret", salt)
+
+	if match, rehash := hasher.Verify(legacy, "123456", salt); !match || !rehash {
+		t.Errorf("Verify() of legacy hash = %v, %v, expected true, true", match, rehash)
+	}
+	if match, _ := hasher.Verify(legacy, "1234567", salt); match {
+		t.Error("Verify() of legacy hash with wrong password = true")
+	}
+	if match, _ := hasher.Verify("$unknown$", "123456", nil); match {
+		t.Error("Verify() of unknown format = true")
+	}
+}
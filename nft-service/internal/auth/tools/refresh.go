@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
 
@@ -25,3 +26,14 @@ func GenerateRefreshToken() string {
 	// Convert the hashed bytes to a hexadecimal string
 	return hex.EncodeToString(hashBytes)
 }
+
+// HashRefreshToken returns the form of the refresh token stored in the database.
+func HashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// GenerateTokenFamily generates an id for the chain of refresh tokens issued by a single login.
+func GenerateTokenFamily() string {
+	return uuid.New().String()
+}
@@ -1,6 +1,10 @@
 package config
 
-import coreconfig "main/tools/pkg/core_config"
+import (
+	"time"
+
+	coreconfig "main/tools/pkg/core_config"
+)
 
 type Config struct {
 	App              coreconfig.App
@@ -8,7 +12,129 @@ type Config struct {
 	Logging          coreconfig.Logging
 	Redis            coreconfig.Redis
 	JWT              coreconfig.JWT
-	Secret           string `envconfig:"APP_SECRET"` // Secret of the application
-	IPFS_API_URL     string `envconfig:"IPFS_API_URL" default:"http://127.0.0.1:5001/api/v0"`
-	IPFS_GATEWAY_URL string `envconfig:"IPFS_GATEWAY_URL" default:"http://127.0.0.1:8080"`
+	Unlockable       Unlockable
+	Tron             Tron
+	OTP              OTP
+	Mail             Mail
+	Password         Password
+	RateLimit        RateLimit
+	MFA              MFA
+	Telegram         Telegram
+	OIDC             OIDC
+	Secret           string        `envconfig:"APP_SECRET"` // Secret of the application
+	IPFS_API_URL     string        `envconfig:"IPFS_API_URL" default:"http://127.0.0.1:5001/api/v0"`
+	IPFS_GATEWAY_URL string        `envconfig:"IPFS_GATEWAY_URL" default:"http://127.0.0.1:8080"`
+	OwnershipTTL     time.Duration `envconfig:"OWNERSHIP_CACHE_TTL" default:"30s"`       // How long ownership checks are cached
+	DriftInterval    time.Duration `envconfig:"DRIFT_CHECK_INTERVAL" default:"6h"`       // Metadata drift check period, 0 disables the job
+	IndexerInterval  time.Duration `envconfig:"INDEXER_INTERVAL" default:"30s"`          // Contract events polling period, 0 disables the indexer
+	BurnUnpinAfter   time.Duration `envconfig:"BURN_UNPIN_AFTER" default:"0"`            // Grace period before media of burned tokens is unpinned, 0 keeps it pinned
+	AuthMode         string        `envconfig:"AUTH_VERIFY_MODE" default:"session"`      // session checks tokens in Redis and Postgres, stateless verifies the JWT locally
+	LastVisitFlush   time.Duration `envconfig:"LAST_VISIT_FLUSH_INTERVAL" default:"30s"` // How often batched last visit times are written
+	PermissionsTTL   time.Duration `envconfig:"PERMISSIONS_CACHE_TTL" default:"1m"`      // How long role permissions are cached in memory
+	UserRetention    time.Duration `envconfig:"USER_RETENTION" default:"720h"`           // How long deleted users can be restored before they are purged
+	PurgeInterval    time.Duration `envconfig:"USER_PURGE_INTERVAL" default:"1h"`        // Purge job period, 0 disables the job
+	ImpersonationTTL time.Duration `envconfig:"IMPERSONATION_TTL" default:"15m"`         // Lifetime of tokens issued to admins acting as a user
+	InviteOnly       bool          `envconfig:"INVITE_ONLY" default:"false"`             // New users can register only with an invite code
+	TrustedProxies   []string      `envconfig:"TRUSTED_PROXIES"`                         // IPs or CIDRs of reverse proxies whose X-Forwarded-For is used as the client IP
+}
+
+// Режимы проверки токена доступа
+const (
+	AuthModeSession   = "session"
+	AuthModeStateless = "stateless"
+)
+
+// Unlockable конфигурация шифрования приватного контента токенов
+type Unlockable struct {
+	MasterKeys  map[string]string `envconfig:"UNLOCKABLE_MASTER_KEYS"` // id:base64 pairs of 32 byte keys
+	ActiveKeyID string            `envconfig:"UNLOCKABLE_ACTIVE_KEY"`  // id of the key used for new payloads
+}
+
+// Tron конфигурация доступа к сети TRON и контракту коллекции
+type Tron struct {
+	APIURL          string        `envconfig:"TRON_API_URL" default:"https://api.trongrid.io"`
+	APIKey          string        `envconfig:"TRON_API_KEY"`
+	Timeout         time.Duration `envconfig:"TRON_API_TIMEOUT" default:"10s"`
+	ContractAddress string        `envconfig:"GADS_CONTRACT_ADDRESS"` // base58 or hex address of the GADS contract
+}
+
+// OTP конфигурация одноразовых кодов подтверждения по SMS и email
+type OTP struct {
+	Length         int           `envconfig:"OTP_LENGTH" default:"6"`
+	TTL            time.Duration `envconfig:"OTP_TTL" default:"5m"`
+	MaxAttempts    int           `envconfig:"OTP_MAX_ATTEMPTS" default:"5"`
+	ResendCooldown time.Duration `envconfig:"OTP_RESEND_COOLDOWN" default:"60s"`
+	SMSSender      string        `envconfig:"SMS_SENDER" default:"console"` // console or file
+	SMSFilePath    string        `envconfig:"SMS_FILE_PATH" default:"sms.log"`
+	EmailVerifyURL string        `envconfig:"EMAIL_VERIFY_URL"` // frontend page posting email and code to /v1/auth/email/verify/, empty sends only the code
+}
+
+// Mail конфигурация отправки писем
+type Mail struct {
+	Sender       string `envconfig:"MAILER" default:"console"` // console or smtp
+	From         string `envconfig:"MAIL_FROM" default:"no-reply@localhost"`
+	SMTPHost     string `envconfig:"SMTP_HOST" default:"localhost"`
+	SMTPPort     int    `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD"`
+}
+
+// Password конфигурация хеширования паролей и требований к новым паролям
+type Password struct {
+	Algorithm     string `envconfig:"PASSWORD_HASH_ALGORITHM" default:"argon2id"` // argon2id or bcrypt
+	Argon2Time    uint32 `envconfig:"ARGON2_TIME" default:"3"`
+	Argon2Memory  uint32 `envconfig:"ARGON2_MEMORY" default:"65536"` // KiB
+	Argon2Threads uint8  `envconfig:"ARGON2_THREADS" default:"2"`
+	Argon2KeyLen  uint32 `envconfig:"ARGON2_KEY_LENGTH" default:"32"`
+	BcryptCost    int    `envconfig:"BCRYPT_COST" default:"12"`
+
+	MinLength    int    `envconfig:"PASSWORD_MIN_LENGTH" default:"8"`
+	MaxLength    int    `envconfig:"PASSWORD_MAX_LENGTH" default:"128"`
+	MinClasses   int    `envconfig:"PASSWORD_MIN_CLASSES" default:"2"`     // of lowercase, uppercase, digits and symbols
+	ForbidPhone  bool   `envconfig:"PASSWORD_FORBID_PHONE" default:"true"` // reject passwords containing the phone number of the user
+	History      int    `envconfig:"PASSWORD_HISTORY" default:"4"`         // previous passwords which can't be reused besides the current one
+	BreachedList string `envconfig:"PASSWORD_BREACHED_LIST"`               // file of leaked SHA-1 hashes in the HIBP format, empty disables the check
+}
+
+// RateLimit ограничения частоты запросов к публичным методам авторизации и блокировка при подборе пароля
+type RateLimit struct {
+	Window           time.Duration `envconfig:"RATE_LIMIT_WINDOW" default:"1m"`
+	PerIP            int           `envconfig:"RATE_LIMIT_PER_IP" default:"30"`     // requests per window from one IP, 0 disables the limit
+	PerPhone         int           `envconfig:"RATE_LIMIT_PER_PHONE" default:"10"`  // requests per window for one phone, 0 disables the limit
+	FailureWindow    time.Duration `envconfig:"LOGIN_FAILURE_WINDOW" default:"15m"` // failed logins older than this are forgotten
+	DelayBase        time.Duration `envconfig:"LOGIN_DELAY_BASE" default:"1s"`      // delay after the first failure, doubled on each next one
+	DelayMax         time.Duration `envconfig:"LOGIN_DELAY_MAX" default:"30s"`
+	LockoutThreshold int           `envconfig:"LOGIN_LOCKOUT_THRESHOLD" default:"10"` // failures before the account is locked, 0 disables lockout
+	LockoutDuration  time.Duration `envconfig:"LOGIN_LOCKOUT_DURATION" default:"30m"`
+}
+
+// MFA конфигурация двухфакторной аутентификации по TOTP
+type MFA struct {
+	Issuer        string        `envconfig:"MFA_ISSUER" default:"GADS NFT"`         // shown in authenticator apps
+	RequiredStaff bool          `envconfig:"MFA_REQUIRED_FOR_STAFF" default:"true"` // admins and moderators can't log in without 2FA
+	Skew          int           `envconfig:"MFA_SKEW" default:"1"`                  // accepted time steps around the current one
+	ChallengeTTL  time.Duration `envconfig:"MFA_CHALLENGE_TTL" default:"5m"`        // lifetime of the intermediate MFA token issued at login
+	MaxAttempts   int           `envconfig:"MFA_MAX_ATTEMPTS" default:"5"`          // wrong codes before the MFA token is dropped
+	RecoveryCodes int           `envconfig:"MFA_RECOVERY_CODES" default:"10"`
+}
+
+// Telegram конфигурация входа через Telegram Login Widget и Mini App
+type Telegram struct {
+	BotToken   string        `envconfig:"TELEGRAM_BOT_TOKEN"`                 // token of the bot signing auth data, empty disables Telegram login
+	AuthMaxAge time.Duration `envconfig:"TELEGRAM_AUTH_MAX_AGE" default:"5m"` // signed data older than this is rejected, each one is accepted once
+}
+
+// OIDC конфигурация входа через OpenID Connect провайдеров
+type OIDC struct {
+	StateTTL time.Duration `envconfig:"OIDC_STATE_TTL" default:"10m"` // time to complete the authorization at the provider
+	Google   OIDCProvider  // OIDC_GOOGLE_* variables
+}
+
+// OIDCProvider настройки одного провайдера, пустой ClientID отключает провайдера
+type OIDCProvider struct {
+	Issuer       string   `split_words:"true"`
+	ClientID     string   `split_words:"true"`
+	ClientSecret string   `split_words:"true"`
+	RedirectURL  string   `split_words:"true"` // frontend page passing code and state to the callback endpoint
+	Scopes       []string `split_words:"true"` // openid, email and profile when empty
 }
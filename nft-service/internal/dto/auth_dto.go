@@ -1,5 +1,11 @@
 package dto
 
+import (
+	"strconv"
+
+	"main/internal/models"
+)
+
 // ErrorResponse represents a JSON error response.
 type ErrorResponse struct {
 	Message string
@@ -27,26 +33,61 @@ type DigupUserResponse struct {
 
 // LoginRequest represents the structure of the login request
 type LoginRequest struct {
-	Phone    string `json:"phone" example:"79999999999"`
+	Phone    string `json:"phone,omitempty" example:"79999999999"`
+	Email    string `json:"email,omitempty" example:"test@test.com"` // used instead of the phone when set
 	Password string `json:"password" example:"123456"`
 }
 
-// LoginResponse represents the structure of the login response
+// LoginResponse represents the structure of the login response.
+// When the second factor is needed tokens are empty and MFAToken is passed to /login/mfa/.
 type LoginResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken           string `json:"access_token"`
+	RefreshToken          string `json:"refresh_token"`
+	MFARequired           bool   `json:"mfa_required,omitempty"`
+	MFAToken              string `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"` // the role requires 2FA which is not enrolled yet
 }
 
+// LoginTelegramRequest carries data signed by Telegram, either Mini App initData or Login Widget fields
 type LoginTelegramRequest struct {
-	Phone      string `json:"phone" example:"79999999999"`
-	TelegramId int64  `json:"telegram_id" example:"123"`
-	Timestamp  int64  `json:"timestamp" example:"1744985930"`
+	InitData string          `json:"init_data,omitempty" example:"query_id=AAH...&user=%7B%22id%22%3A123%7D&auth_date=1744985930&hash=c501..."`
+	Widget   *TelegramWidget `json:"widget,omitempty"`
 }
 
-// LoginTelegramResponse represents the structure of the login response
-type LoginTelegramResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+// TelegramWidget represents the user object passed to the Login Widget callback
+type TelegramWidget struct {
+	ID        int64  `json:"id" example:"123"`
+	FirstName string `json:"first_name,omitempty" example:"John"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+	PhotoURL  string `json:"photo_url,omitempty"`
+	AuthDate  int64  `json:"auth_date" example:"1744985930"`
+	Hash      string `json:"hash" example:"c501b71e775f74ce10e377dea85a7ea24ecd640b223ea86dfe453e0eaed2e2b2"`
+}
+
+// Fields returns the widget data as signed by Telegram, empty fields are not sent and not signed
+func (w *TelegramWidget) Fields() map[string]string {
+	fields := map[string]string{
+		"id":        strconv.FormatInt(w.ID, 10),
+		"auth_date": strconv.FormatInt(w.AuthDate, 10),
+		"hash":      w.Hash,
+	}
+	for key, value := range map[string]string{
+		"first_name": w.FirstName,
+		"last_name":  w.LastName,
+		"username":   w.Username,
+		"photo_url":  w.PhotoURL,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// TelegramLinkResponse represents the response structure for linking a Telegram account
+type TelegramLinkResponse struct {
+	Message string `json:"message" example:"Telegram account linked"`
 }
 
 // LogoutResponse represents the structure of the logout response
@@ -56,8 +97,9 @@ type LogoutResponse struct {
 
 // RecoveryRequest represents the request structure for password recovery.
 type RecoveryRequest struct {
-	Phone    string `json:"phone" example:"79999999999"`
-	Password string `json:"password" example:"123456"`
+	Phone    string `json:"phone,omitempty" example:"79999999999"`
+	Email    string `json:"email,omitempty" example:"test@test.com"` // used instead of the phone when set
+	Password string `json:"password" example:"Secret-42"`
 	Code     string `json:"code" example:"12345"`
 }
 
@@ -78,16 +120,29 @@ type RefreshResponse struct {
 }
 
 type RegisterRequest struct {
-	Phone    string `json:"phone" example:"79999999999"`
-	Password string `json:"password" example:"123456"`
-	Email    string `json:"email" example:"test@test.com"`
-	Code     string `json:"code" example:"12345"`
+	Phone      string `json:"phone,omitempty" example:"79999999999"`
+	Password   string `json:"password" example:"Secret-42"`
+	Email      string `json:"email,omitempty" example:"test@test.com"` // without phone the code is the one sent to the email
+	Code       string `json:"code" example:"12345"`
+	InviteCode string `json:"invite_code,omitempty" example:"spring-sale"`
 }
 
 type RegisterResponse struct {
 	Message string `json:"message" example:"User registration successful"`
 }
 
+// SendOTPRequest represents the request structure for sending a verification code.
+type SendOTPRequest struct {
+	Phone   string `json:"phone,omitempty" example:"79999999999"`
+	Email   string `json:"email,omitempty" example:"test@test.com"` // sends the code by email instead of SMS
+	Purpose string `json:"purpose" example:"registration" enums:"registration,recovery,phone_change,password_change,email_verify,email_change"`
+}
+
+// SendOTPResponse represents the response structure for sending a verification code.
+type SendOTPResponse struct {
+	Message string `json:"message"`
+}
+
 // ResetTokenRequest represents the structure of the request payload for resetting tokens associated with a user account.
 type ResetTokenRequest struct {
 	UserID int64 `json:"user_id,omitempty" example:"1"`
@@ -111,7 +166,7 @@ type ChangeRoleResponse struct {
 
 // UpdateUserRequest represents the structure of the request payload for changing phone number.
 type UpdateUserRequest struct {
-	Password string `json:"password,omitempty" example:"12345"`
+	Password string `json:"password,omitempty" example:"Secret-42"`
 	Phone    string `json:"phone,omitempty" example:"89999999999"`
 	Code     string `json:"code,omitempty" example:"45236"`
 }
@@ -127,6 +182,8 @@ type CheckTokenResponse struct {
 	UserId  int64
 	RoleId  int64
 	Phone   string
+	Email   string
+	ActorID int64 // admin impersonating the user
 }
 
 type CheckTokenRequest struct {
@@ -155,8 +212,16 @@ type RefreshTokenResponse struct {
 type UserListItem struct {
 	UserID        int64  `json:"user_id"`
 	Phone         string `json:"phone"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
 	Role          string `json:"role"`
+	CreatedAt     string `json:"created_at"`
 	LastVisitTime string `json:"last_visit_time"`
+	Locked        bool   `json:"locked"`
+	LockedUntil   string `json:"locked_until,omitempty"`
+	DeletedAt     string `json:"deleted_at,omitempty"`
+	TelegramID    int64  `json:"telegram_id,omitempty"`
+	models.UserProfile
 }
 
 // UserListResponse represents the response structure for the user list endpoint
@@ -164,3 +229,208 @@ type UserListResponse struct {
 	Users []UserListItem `json:"users"`
 	Total int            `json:"total"`
 }
+
+// SessionItem represents a single device (login) of the user
+type SessionItem struct {
+	ID         int64  `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	Current    bool   `json:"current"`
+}
+
+// SessionListResponse represents the response structure for the session list endpoints
+type SessionListResponse struct {
+	Sessions []SessionItem `json:"sessions"`
+}
+
+type RevokeSessionResponse struct {
+	Message string
+}
+
+type UnlockUserResponse struct {
+	Message string
+}
+
+// LoginMFARequest completes the login with a TOTP or recovery code
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" example:"123456"`
+}
+
+// LoginMFAResponse contains recovery codes once, when the login confirmed a new enrollment
+type LoginMFAResponse struct {
+	AccessToken   string   `json:"access_token"`
+	RefreshToken  string   `json:"refresh_token"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// MFAChallengeRequest enrolls 2FA during the login when the role requires it
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// MFAEnrollResponse contains the new TOTP secret, it is shown only once
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	QRCode string `json:"qr_png"` // base64 encoded PNG
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableMFAResponse struct {
+	Message string
+}
+
+// EmailCodeRequest confirms an email with the code sent to it
+type EmailCodeRequest struct {
+	Email string `json:"email" example:"test@test.com"`
+	Code  string `json:"code" example:"123456"`
+}
+
+type EmailResponse struct {
+	Message string `json:"message"`
+}
+
+// OIDCStartResponse carries the provider page the user is redirected to
+type OIDCStartResponse struct {
+	AuthURL string `json:"auth_url" example:"https://accounts.google.com/o/oauth2/v2/auth?client_id=..."`
+}
+
+// OIDCCallbackRequest carries the parameters the provider appended to the redirect URL
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// OIDCCallbackResponse is a login response, or only Linked when the identity was linked to the current user
+type OIDCCallbackResponse struct {
+	LoginResponse
+	Linked bool `json:"linked,omitempty"`
+}
+
+// APIKeyCreateRequest issues an API key acting on behalf of the user
+type APIKeyCreateRequest struct {
+	Name      string   `json:"name" example:"shop bot"`
+	UserID    int64    `json:"user_id" example:"1"`
+	Scopes    []string `json:"scopes" example:"nft:read,pins:write"`
+	ExpiresIn int64    `json:"expires_in" example:"2592000"` // lifetime in seconds, 0 - without expiry
+}
+
+// APIKeyItem represents an API key without the secret
+type APIKeyItem struct {
+	ID         int64    `json:"id"`
+	Prefix     string   `json:"prefix"`
+	Name       string   `json:"name"`
+	UserID     int64    `json:"user_id"`
+	Scopes     []string `json:"scopes"`
+	CreatedBy  int64    `json:"created_by"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	Revoked    bool     `json:"revoked"`
+}
+
+// APIKeyCreateResponse contains the key in plain text, it is shown only once
+type APIKeyCreateResponse struct {
+	Key    string     `json:"key"`
+	APIKey APIKeyItem `json:"api_key"`
+}
+
+// APIKeyListResponse represents the response structure for the API key list endpoint
+type APIKeyListResponse struct {
+	APIKeys []APIKeyItem `json:"api_keys"`
+}
+
+type RevokeAPIKeyResponse struct {
+	Message string
+}
+
+// AuditListResponse represents the response structure for the audit log endpoint
+type AuditListResponse struct {
+	Entries []models.AuditEntry `json:"entries"`
+	Total   int                 `json:"total"`
+}
+
+// MeResponse represents the account of the current user
+type MeResponse struct {
+	UserID         int64  `json:"user_id"`
+	Phone          string `json:"phone"`
+	Email          string `json:"email"`
+	EmailVerified  bool   `json:"email_verified"`
+	TelegramID     int64  `json:"telegram_id,omitempty"`
+	Role           string `json:"role"`
+	AvatarURL      string `json:"avatar_url,omitempty"`      // gateway URL of the avatar
+	ImpersonatedBy int64  `json:"impersonated_by,omitempty"` // admin acting as the user, the client should show a banner
+	models.UserProfile
+}
+
+// UpdateMeRequest changes the profile, omitted fields are kept and empty values clear them
+type UpdateMeRequest struct {
+	DisplayName *string `json:"display_name" example:"Crypto Shop"`
+	Locale      *string `json:"locale" example:"en-US"`
+}
+
+// ImpersonateRequest starts acting as a user, the reason is kept in the audit log
+type ImpersonateRequest struct {
+	Reason string `json:"reason" example:"ticket 1042: customer can't see their tokens"`
+}
+
+// ImpersonateResponse contains an access token of the user, there is no refresh token
+type ImpersonateResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// InviteCreateRequest describes an invite code to issue
+type InviteCreateRequest struct {
+	Code       string `json:"code,omitempty" example:"spring-sale"` // generated when empty
+	Role       string `json:"role,omitempty" example:"creator"`     // role of registered users, empty - the default role
+	MaxUses    int    `json:"max_uses" example:"50"`                // 0 - single use
+	ExpiresIn  int64  `json:"expires_in" example:"604800"`          // lifetime in seconds, 0 - without expiry
+	ReferrerID int64  `json:"referrer_id,omitempty" example:"12"`   // user credited with the registrations
+}
+
+// InviteItem represents an invite code
+type InviteItem struct {
+	ID         int64  `json:"id"`
+	Code       string `json:"code"`
+	Role       string `json:"role,omitempty"`
+	MaxUses    int    `json:"max_uses"`
+	Uses       int    `json:"uses"`
+	ReferrerID int64  `json:"referrer_id,omitempty"`
+	CreatedBy  int64  `json:"created_by"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	Revoked    bool   `json:"revoked"`
+}
+
+// InviteListResponse represents the response structure for the invite list endpoint
+type InviteListResponse struct {
+	Invites []InviteItem `json:"invites"`
+}
+
+type RevokeInviteResponse struct {
+	Message string
+}
+
+// ReferralItem counts users credited to a referrer
+type ReferralItem struct {
+	ReferrerID int64  `json:"referrer_id"`
+	Users      int    `json:"users"`
+	FirstAt    string `json:"first_at"`
+	LastAt     string `json:"last_at"`
+}
+
+// ReferralReportResponse represents the response structure for the referral report endpoint
+type ReferralReportResponse struct {
+	Referrals []ReferralItem `json:"referrals"`
+}
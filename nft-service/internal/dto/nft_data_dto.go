@@ -1,5 +1,7 @@
 package dto
 
+import "main/internal/models"
+
 type CreateNftDataRequest struct {
 	Description string `json:"description" example:"About this token"`
 	//ImageFile   *multipart.FileHeader `json:"file" form:"file" example:"pic12.png"`
@@ -13,6 +15,7 @@ type NftData struct {
 	CidV1       string `json:"cid_v1" example:"dss"`
 	FileName    string `json:"file_name" example:"pic12.png"`
 	FileSize    string `json:"file_size" example:"12kb"`
+	CreatedBy   int64  `json:"-"`
 }
 
 type CreateNftDataResponse struct {
@@ -27,6 +30,7 @@ type NftInfo struct {
 	CidV1         string `json:"cid_v1" example:"dss"`
 	Image         string `json:"image" example:"https://dsdsds"`
 	IpfsImageLink string `json:"ipfs_image_link" example:"http://bafy...dweb.link/"`
+	Burned        bool   `json:"burned,omitempty" example:"false"`
 }
 
 type ReadNftResponse struct {
@@ -37,8 +41,56 @@ type ReadNftResponse struct {
 	CidV1         string `json:"cid_v1" example:"dss"`
 	Image         string `json:"image" example:"/v1/api/nft/image/1"`
 	IpfsImageLink string `json:"ipfs_image_link" example:"http://bafy...dweb.link/"`
+	Burned        bool   `json:"burned,omitempty" example:"false"`
 }
 
 type ReadAllNftResponse struct {
 	Infos *[]NftInfo `json:"infos"`
 }
+
+// HolderResponse represents the response structure for the holder check endpoint.
+type HolderResponse struct {
+	TokenId      int64  `json:"token_id" example:"1"`
+	OwnerAddress string `json:"owner_address" example:"TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"`
+	IsHolder     bool   `json:"is_holder" example:"true"`
+}
+
+// SetUnlockableRequest represents the request structure for setting the private payload of a token.
+type SetUnlockableRequest struct {
+	Content string `json:"content" example:"login: ads@example.com; password: secret"`
+}
+
+// SetUnlockableResponse represents the response structure for setting the private payload of a token.
+type SetUnlockableResponse struct {
+	Message string `json:"message"`
+}
+
+// RevealUnlockableResponse represents the decrypted private payload of a token.
+type RevealUnlockableResponse struct {
+	TokenId int64  `json:"token_id" example:"1"`
+	Content string `json:"content" example:"login: ads@example.com; password: secret"`
+}
+
+// RotateUnlockableKeyResponse represents the response structure for master key rotation.
+type RotateUnlockableKeyResponse struct {
+	Rewrapped int `json:"rewrapped" example:"10"`
+}
+
+// ChainNftResponse represents the token state read from the contract.
+type ChainNftResponse struct {
+	TokenId         int64  `json:"token_id" example:"1"`
+	ContractAddress string `json:"contract_address" example:"TLuKAnxTLK99naFoKF7bQGE5c5sWiGubPu"`
+	OwnerAddress    string `json:"owner_address" example:"TJRabPrwbZy45sbavfcjinPJC18kjpRTv8"`
+	TokenURI        string `json:"token_uri" example:"ipfs://bafy.../1.json"`
+}
+
+// DriftReportResponse represents the latest metadata drift report.
+type DriftReportResponse struct {
+	Run    models.DriftRun     `json:"run"`
+	Issues []models.DriftIssue `json:"issues"`
+}
+
+// RunDriftResponse represents the response structure for starting a drift check.
+type RunDriftResponse struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/models"
+	"main/internal/service"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// AccountHandlers
+type AccountHandlers struct {
+	logger   *logger.Logger
+	accounts *service.AccountService
+	auditLog *service.AuditLog
+}
+
+// NewAccountHandlers конструктор для обработчиков выгрузки данных аккаунта
+func NewAccountHandlers(logger *logger.Logger, accounts *service.AccountService, auditLog *service.AuditLog) *AccountHandlers {
+	return &AccountHandlers{
+		logger:   logger,
+		accounts: accounts,
+		auditLog: auditLog,
+	}
+}
+
+// ExportMe returns all data tied to the current user as a JSON archive
+// @Summary Export my data
+// @Description Returns the account, profile, linked identities, sessions, API keys, audit entries, owned tokens,
+// @Description the invite of the registration and the password change times of the current user as a file download.
+// @Description Password hashes are not exported.
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} models.UserExport
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/me/export [get]
+func (h *AccountHandlers) ExportMe(c *fiber.Ctx) error {
+	userId, err := httputils.UserIDFromToken(c, "ExportMe", h.logger)
+	if err != nil {
+		return httputils.HandleError(c, fiber.StatusUnauthorized, tvoerrors.ErrCastClaims)
+	}
+
+	export, err := h.accounts.Export(c.Context(), userId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return httputils.HandleError(c, fiber.StatusNotFound, tvoerrors.ErrNotFound)
+		}
+		h.logger.Error("Error exporting user data", "user_id", userId, "error", err)
+		return httputils.HandleError(c, fiber.StatusInternalServerError, tvoerrors.ErrServerError)
+	}
+	audit(c, h.auditLog, models.AuditUserExport, models.AuditTargetUser, strconv.FormatInt(userId, 10), nil, nil)
+
+	c.Attachment("user_" + strconv.FormatInt(userId, 10) + "_" + time.Now().UTC().Format("20060102T150405") + ".json")
+	return c.JSON(export)
+}
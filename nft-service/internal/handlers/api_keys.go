@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/internal/service"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var ErrAPIKeyScope = tvoerrors.Wrap("scope is not granted to the user role", tvoerrors.ErrInvalidRequestData)
+
+// APIKeyHandlers
+type APIKeyHandlers struct {
+	logger         *logger.Logger
+	apiKeys        *service.APIKeyService
+	permissions    *service.PermissionService
+	userRepository repository.UserRepository
+}
+
+// NewAPIKeyHandlers конструктор для обработчиков API ключей машинных клиентов
+func NewAPIKeyHandlers(logger *logger.Logger, apiKeys *service.APIKeyService, permissions *service.PermissionService,
+	userRepository repository.UserRepository) *APIKeyHandlers {
+	return &APIKeyHandlers{
+		logger:         logger,
+		apiKeys:        apiKeys,
+		permissions:    permissions,
+		userRepository: userRepository,
+	}
+}
+
+// CreateAPIKey issues an API key acting on behalf of a user
+// Requires the api_keys:manage permission. Scopes have to be granted to the role of the user,
+// the key is returned only once.
+// @Summary Issue API key
+// @Tags API keys
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.APIKeyCreateRequest true "Request body"
+// @Success 200 {object} dto.APIKeyCreateResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/api_keys/ [post]
+func (h *APIKeyHandlers) CreateAPIKey(c *fiber.Ctx) (interface{}, error) {
+	var request dto.APIKeyCreateRequest
+
+	ctx := c.Context()
+
+	adminId, err := httputils.UserIDFromToken(c, "CreateAPIKey", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	if err = httputils.ParseRequestBody(c, &request, "CreateAPIKey", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || request.UserID == 0 || len(request.Scopes) == 0 || request.ExpiresIn < 0 {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	user, err := h.userRepository.UserById(ctx, request.UserID)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error getting user", "user_id", request.UserID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	// ключ не может дать больше, чем роль владельца
+	granted, err := h.permissions.Permissions(ctx, tvomodels.RoleId(user.RoleID))
+	if err != nil {
+		h.logger.Error("Error getting role permissions", "role_id", user.RoleID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(granted, scope) {
+			h.logger.Error("API key scope not granted", "user_id", user.ID, "scope", scope)
+			return nil, ErrAPIKeyScope
+		}
+	}
+
+	params := service.APIKeyParams{
+		Name:      request.Name,
+		UserID:    user.ID,
+		Scopes:    request.Scopes,
+		CreatedBy: adminId,
+	}
+	if request.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+		params.ExpiresAt = &expiresAt
+	}
+
+	raw, key, err := h.apiKeys.Issue(ctx, params)
+	if err != nil {
+		h.logger.Error("Error issuing API key", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	h.logger.Info("API key issued", "api_key_id", key.ID, "user_id", user.ID, "created_by", adminId)
+
+	return &dto.APIKeyCreateResponse{
+		Key:    raw,
+		APIKey: apiKeyItem(key),
+	}, nil
+}
+
+// ListAPIKeys returns API keys, of a single user when user_id is set
+// Requires the api_keys:manage permission.
+// @Summary List API keys
+// @Tags API keys
+// @Security ApiKeyAuth
+// @Produce json
+// @Param user_id query int false "User ID"
+// @Success 200 {object} dto.APIKeyListResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/api_keys/ [get]
+func (h *APIKeyHandlers) ListAPIKeys(c *fiber.Ctx) (interface{}, error) {
+	userId := int64(c.QueryInt("user_id", 0))
+
+	keys, err := h.apiKeys.List(c.Context(), userId)
+	if err != nil {
+		h.logger.Error("Error getting API keys", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	items := make([]dto.APIKeyItem, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, apiKeyItem(&key))
+	}
+
+	return &dto.APIKeyListResponse{
+		APIKeys: items,
+	}, nil
+}
+
+// RevokeAPIKey disables an API key immediately
+// Requires the api_keys:manage permission.
+// @Summary Revoke API key
+// @Tags API keys
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} dto.RevokeAPIKeyResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/api_keys/{id} [delete]
+func (h *APIKeyHandlers) RevokeAPIKey(c *fiber.Ctx) (interface{}, error) {
+	keyId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if err = h.apiKeys.Revoke(c.Context(), keyId); err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error revoking API key", "api_key_id", keyId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	h.logger.Info("API key revoked", "api_key_id", keyId)
+
+	return &dto.RevokeAPIKeyResponse{
+		Message: "API key revoked",
+	}, nil
+}
+
+// CheckAPIKey returns the token data of a valid API key for the auth middleware
+func (h *APIKeyHandlers) CheckAPIKey(ctx context.Context, apiKey string) (*tvomodels.TokenData, error) {
+	return h.apiKeys.Verify(ctx, apiKey)
+}
+
+func apiKeyItem(key *models.APIKey) dto.APIKeyItem {
+	item := dto.APIKeyItem{
+		ID:        key.ID,
+		Prefix:    key.Prefix,
+		Name:      key.Name,
+		UserID:    key.UserID,
+		Scopes:    key.Scopes,
+		CreatedBy: key.CreatedBy,
+		CreatedAt: key.CreatedAt.Format("2006-01-02 15:04:05"),
+		Revoked:   key.RevokedAt != nil,
+	}
+	if key.ExpiresAt != nil {
+		item.ExpiresAt = key.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+	if key.LastUsedAt != nil {
+		item.LastUsedAt = key.LastUsedAt.Format("2006-01-02 15:04:05")
+	}
+	return item
+}
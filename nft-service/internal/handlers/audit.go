@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	slogfiber "github.com/samber/slog-fiber"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/service"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+const (
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+	// auditExportMaxRows bounds the export, the whole file is built in memory before it is sent
+	auditExportMaxRows = 100_000
+)
+
+var ErrAuditExportTooLarge = tvoerrors.Wrap("too many audit entries to export, narrow the filter", tvoerrors.ErrInvalidRequestData)
+
+// AuditHandlers
+type AuditHandlers struct {
+	logger   *logger.Logger
+	auditLog *service.AuditLog
+}
+
+// NewAuditHandlers конструктор для обработчиков журнала аудита
+func NewAuditHandlers(logger *logger.Logger, auditLog *service.AuditLog) *AuditHandlers {
+	return &AuditHandlers{
+		logger:   logger,
+		auditLog: auditLog,
+	}
+}
+
+// audit records the action of the authorized user of the request with its IP and request id
+func audit(c *fiber.Ctx, auditLog *service.AuditLog, action, targetType, targetId string, before, after any) {
+	if auditLog == nil {
+		return
+	}
+
+	entry := &models.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetId,
+		IP:         c.IP(),
+		RequestID:  slogfiber.GetRequestID(c),
+	}
+	if tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData); ok {
+		entry.ActorID = tokenData.UserID
+		entry.APIKeyID = tokenData.APIKeyID
+		if tokenData.Impersonated() {
+			// действует администратор, пользователя видно в записи user.impersonated_request с тем же request id
+			entry.ActorID = tokenData.ActorID
+		}
+	}
+
+	auditLog.Record(c.Context(), entry, before, after)
+}
+
+// ImpersonatedRequest records a request made by an admin impersonating the user
+func (h *AuditHandlers) ImpersonatedRequest(c *fiber.Ctx, tokenData *tvomodels.TokenData) {
+	audit(c, h.auditLog, models.AuditImpersonatedRequest, models.AuditTargetUser, strconv.FormatInt(tokenData.UserID, 10),
+		nil, map[string]any{
+			"method": c.Method(),
+			"path":   c.Path(),
+			"status": c.Response().StatusCode(),
+		})
+}
+
+// ListAudit returns audit log entries, newest first
+// Requires the audit:read permission.
+// @Summary Audit log
+// @Tags Audit
+// @Security ApiKeyAuth
+// @Produce json
+// @Param actor_id query int false "Actor user ID"
+// @Param action query string false "Action, e.g. user.role_change"
+// @Param target_type query string false "Target type, e.g. user"
+// @Param target_id query string false "Target ID"
+// @Param from query string false "From time, RFC 3339, inclusive"
+// @Param to query string false "To time, RFC 3339, exclusive"
+// @Param limit query int false "Page size, 50 by default, at most 500"
+// @Param offset query int false "Page offset"
+// @Success 200 {object} dto.AuditListResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/audit/ [get]
+func (h *AuditHandlers) ListAudit(c *fiber.Ctx) (interface{}, error) {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, total, err := h.auditLog.List(c.Context(), filter)
+	if err != nil {
+		h.logger.Error("Error getting audit log", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.AuditListResponse{
+		Entries: entries,
+		Total:   total,
+	}, nil
+}
+
+// ExportAudit returns all matching audit log entries as CSV, oldest first
+// Requires the audit:read permission. Exports of more than 100000 entries are rejected.
+// @Summary Export audit log
+// @Tags Audit
+// @Security ApiKeyAuth
+// @Produce text/csv
+// @Param actor_id query int false "Actor user ID"
+// @Param action query string false "Action, e.g. user.role_change"
+// @Param target_type query string false "Target type, e.g. user"
+// @Param target_id query string false "Target ID"
+// @Param from query string false "From time, RFC 3339, inclusive"
+// @Param to query string false "To time, RFC 3339, exclusive"
+// @Success 200 {string} string "CSV"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/audit/export [get]
+func (h *AuditHandlers) ExportAudit(c *fiber.Ctx) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return httputils.HandleError(c, httputils.FiberStatusByErr(err), err)
+	}
+
+	// ответ копится в памяти и отправляется целиком, поэтому число строк ограничено,
+	// а ошибка посередине отдает только ошибку
+	w := csv.NewWriter(c.Response().BodyWriter())
+	_ = w.Write([]string{"id", "created_at", "actor_id", "api_key_id", "action", "target_type", "target_id", "before",
+		"after", "ip", "request_id"})
+	rows := 0
+	err = h.auditLog.Each(c.Context(), filter, func(entry *models.AuditEntry) error {
+		if rows++; rows > auditExportMaxRows {
+			return ErrAuditExportTooLarge
+		}
+		return w.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt.Format(time.RFC3339),
+			strconv.FormatInt(entry.ActorID, 10),
+			strconv.FormatInt(entry.APIKeyID, 10),
+			csvCell(entry.Action),
+			csvCell(entry.TargetType),
+			csvCell(entry.TargetID),
+			csvCell(string(entry.Before)),
+			csvCell(string(entry.After)),
+			csvCell(entry.IP),
+			csvCell(entry.RequestID),
+		})
+	})
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		h.logger.Error("Error exporting audit log", "error", err)
+		c.Response().ResetBody()
+		if errors.Is(err, ErrAuditExportTooLarge) {
+			return httputils.HandleError(c, fiber.StatusBadRequest, err)
+		}
+		return httputils.HandleError(c, fiber.StatusInternalServerError, tvoerrors.ErrServerError)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Attachment("audit_log_" + time.Now().UTC().Format("20060102T150405") + ".csv")
+	return nil
+}
+
+// csvCell keeps spreadsheets from running a cell as a formula, request ids and states come from clients
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func auditFilter(c *fiber.Ctx) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		ActorID:    int64(c.QueryInt("actor_id", 0)),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Limit:      c.QueryInt("limit", auditDefaultLimit),
+		Offset:     c.QueryInt("offset", 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > auditMaxLimit || filter.Offset < 0 {
+		return filter, tvoerrors.ErrInvalidRequestData
+	}
+
+	for name, field := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, tvoerrors.ErrInvalidRequestData
+			}
+			*field = &parsed
+		}
+	}
+
+	return filter, nil
+}
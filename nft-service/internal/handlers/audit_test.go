@@ -0,0 +1,24 @@
+package handlers
+
+import "testing"
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value, expected string
+	}{
+		{"", ""},
+		{"user.role_change", "user.role_change"},
+		{`=HYPERLINK("https://evil.example","x")`, `'=HYPERLINK("https://evil.example","x")`},
+		{"+1", "'+1"},
+		{"-1+2", "'-1+2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{`{"phone":"=1"}`, `{"phone":"=1"}`},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.value); got != tt.expected {
+			t.Errorf("csvCell(%q) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
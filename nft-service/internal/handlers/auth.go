@@ -3,6 +3,11 @@ package handlers
 import (
 	"context"
 	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"google.golang.org/grpc/codes"
@@ -11,11 +16,14 @@ import (
 	jwtManager "main/internal/lib/jwt"
 	"main/internal/models"
 	"main/internal/repository"
+	"main/internal/service"
 	"main/tools/pkg/cache"
+	"main/tools/pkg/constants"
 	"main/tools/pkg/helpers"
 	tvomodels "main/tools/pkg/tvo_models"
 	"main/tools/validator"
 
+	"main/internal/config"
 	"main/internal/dto"
 	httputils "main/tools/pkg/http_utils"
 	"main/tools/pkg/logger"
@@ -29,43 +37,100 @@ type AuthHandlers struct {
 	userRepository  repository.UserRepository
 	tokenRepository repository.UserTokenRepository
 	roleRepository  repository.RoleRepository
+	sessions        repository.SessionRepository
 	cache           cache.CacheClient
-	secret          string
+	otp             *service.OTPService
+	passwords       *tools.PasswordHasher
+	throttle        *service.Throttle
+	revocations     *service.RevocationList
+	visits          *service.VisitTracker
+	permissions     *service.PermissionService
+	mfa             *service.MFAService
+	telegram        *config.Telegram
+	oidc            *service.OIDCService
+	identities      repository.IdentityRepository
+	auditLog        *service.AuditLog
+	invites         *service.InviteService
+	inviteOnly      bool
+	passwordPolicy  *service.PasswordPolicy
 }
 
 var ErrNotAdmin = errors.New("available only to admin")
 var ErrInvalidPassword = errors.New("invalid password")
 var ErrPhoneTaken = errors.New("phone already taken")
+var ErrEmailTaken = errors.New("email already taken")
+var ErrRefreshReused = tvoerrors.Wrap("refresh token reuse detected", tvoerrors.ErrUnauthorized)
+var ErrAccountLocked = tvoerrors.Wrap("account is temporarily locked", tvoerrors.ErrForbidden)
+var ErrNoPasswordChangeAddress = tvoerrors.Wrap("no phone or verified email to send the code to",
+	tvoerrors.ErrInvalidRequestData)
+var ErrDigupConflict = tvoerrors.Wrap("phone, telegram or email of the user is taken by another user", tvoerrors.ErrConflict)
 var AuthHandler *AuthHandlers
 
+// AuthDeps services and settings of the auth handlers besides the user repositories
+type AuthDeps struct {
+	Sessions       repository.SessionRepository
+	Identities     repository.IdentityRepository
+	OTP            *service.OTPService
+	Passwords      *tools.PasswordHasher
+	PasswordPolicy *service.PasswordPolicy
+	Throttle       *service.Throttle
+	Revocations    *service.RevocationList
+	Visits         *service.VisitTracker
+	Permissions    *service.PermissionService
+	MFA            *service.MFAService
+	OIDC           *service.OIDCService
+	AuditLog       *service.AuditLog
+	Invites        *service.InviteService
+	Telegram       *config.Telegram
+	InviteOnly     bool // registration requires an invite code
+}
+
 // NewAuthHandlers конструктор для обработчиков IDM методов
 func NewAuthHandlers(logger *logger.Logger,
 	jwt *jwtManager.JWTManager,
 	userRepository repository.UserRepository,
 	tokenRepository repository.UserTokenRepository,
 	roleRepository repository.RoleRepository,
-	client cache.CacheClient, secret string) *AuthHandlers {
+	client cache.CacheClient, deps AuthDeps) *AuthHandlers {
 	AuthHandler = &AuthHandlers{
 		logger:          logger,
 		jwt:             jwt,
 		userRepository:  userRepository,
 		tokenRepository: tokenRepository,
 		roleRepository:  roleRepository,
+		sessions:        deps.Sessions,
 		cache:           client,
-		secret:          secret,
+		otp:             deps.OTP,
+		passwords:       deps.Passwords,
+		throttle:        deps.Throttle,
+		revocations:     deps.Revocations,
+		visits:          deps.Visits,
+		permissions:     deps.Permissions,
+		mfa:             deps.MFA,
+		telegram:        deps.Telegram,
+		oidc:            deps.OIDC,
+		identities:      deps.Identities,
+		auditLog:        deps.AuditLog,
+		invites:         deps.Invites,
+		inviteOnly:      deps.InviteOnly,
+		passwordPolicy:  deps.PasswordPolicy,
 	}
 	return AuthHandler
 }
 
 // Registration прокси метод для отправки его в сервис IDM
 // @Summary user Registration
-// @Description Register a new user
+// @Description Register a new user by phone, or by email when the phone is empty.
+// @Description With both the email is attached unverified and a verification code is sent to it.
+// @Description An invite code sets the role and the referrer of the user, it is required in invite only mode.
+// @Description The password must satisfy the password policy and must not appear in known data breaches.
 // @Tags User
 // @Accept json
 // @Produce json
 // @Param request body dto.RegisterRequest true "Registration Request Body"
 // @Success 200 {object} dto.RegisterResponse "Registration successful"
 // @Failure 400 {object} dto.ErrorResponse "Bad request"
+// @Failure 429 {object} dto.ErrorResponse "Too many registration attempts"
 // @Router /idm/registration [post]
 func (h *AuthHandlers) Registration(c *fiber.Ctx) (interface{}, error) {
 	var request dto.RegisterRequest
@@ -74,9 +139,40 @@ func (h *AuthHandlers) Registration(c *fiber.Ctx) (interface{}, error) {
 	if err := httputils.ParseRequestBody(c, &request, "Registration", h.logger); err != nil {
 		return nil, tvoerrors.ErrInvalidRequestData
 	}
-	if request.Code != "98765" {
-		return nil, status.Error(codes.InvalidArgument, "invalid code") //nolint
+
+	// ограничение идет первым: проверки инвайта и пароля не должны перебираться без лимита
+	login := request.Phone
+	if login == "" {
+		login = strings.ToLower(strings.TrimSpace(request.Email))
+	}
+	if err := h.throttle.Allow(ctx, "registration", c.IP(), login); err != nil {
+		log.Error("Registration throttled", "ip", c.IP(), "login", login, "error", err)
+		return nil, err
 	}
+
+	inviteCode, err := h.inviteCode(ctx, request.InviteCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.checkPassword(ctx, request.Password, request.Phone); err != nil {
+		return nil, err
+	}
+
+	var email string
+	if request.Email != "" {
+		var err error
+		if email, err = normalizeEmail(request.Email); err != nil {
+			return nil, err
+		}
+		if err = h.checkEmailFree(ctx, email); err != nil {
+			return nil, err
+		}
+		if request.Phone == "" {
+			return h.registerByEmail(c, email, request.Password, request.Code, inviteCode)
+		}
+	}
+
 	if err := validator.ValidPhone(request.Phone); err != nil {
 		log.Error("Invalid phone number", "error", err)
 		return nil, status.Error(codes.InvalidArgument, "invalid phone number") //nolint
@@ -94,12 +190,30 @@ func (h *AuthHandlers) Registration(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.InvalidArgument, "phone already taken") //nolint
 	}
 
-	_, err = h.userRepository.CreateUser(ctx, request.Phone, request.Password)
+	if err = h.otp.Verify(ctx, service.OTPRegistration, request.Phone, 0, request.Code); err != nil {
+		log.Error("Invalid registration code", "phone", request.Phone, "error", err)
+		return nil, err
+	}
+
+	user, err := h.userRepository.CreateUser(ctx, request.Phone, request.Password, inviteCode)
 	if err != nil {
 		log.Error("Error creating user ", "error", err)
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			// код израсходован параллельной регистрацией
+			return nil, service.ErrInvalidInvite
+		}
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	if email != "" {
+		// email не подтвержден кодом из SMS, до подтверждения по нему нельзя войти
+		if err = h.userRepository.SetEmail(ctx, user.ID, email, false); err != nil {
+			h.logger.Error("Error set email", "user_id", user.ID, "error", err)
+		} else if err = h.otp.SendEmail(ctx, service.OTPEmailVerify, email, 0); err != nil {
+			h.logger.Error("Error sending email verification", "user_id", user.ID, "error", err)
+		}
+	}
+
 	return &dto.RegistrationResponse{
 		Message: "User registration successful",
 	}, nil
@@ -107,7 +221,8 @@ func (h *AuthHandlers) Registration(c *fiber.Ctx) (interface{}, error) {
 
 // Login прокси метод для отправки его в сервис IDM
 // @Summary Logs in a user
-// @Description Logs in a user with the provided phone number and password
+// @Description Logs in a user with the provided phone number and password.
+// @Description With two-factor authentication an MFA token is returned instead of tokens, see /login/mfa/.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -126,40 +241,75 @@ func (h *AuthHandlers) Login(c *fiber.Ctx) (interface{}, error) {
 		return nil, tvoerrors.ErrInvalidRequestData
 	}
 
-	if err := validator.ValidPhone(request.Phone); err != nil {
-		log.Error("Validation failed", "error", tvoerrors.ErrInvalidPhone)
-		return nil, status.Error(codes.InvalidArgument, "invalid phone number") //nolint
+	identifier, byEmail, err := loginIdentifier(request.Phone, request.Email)
+	if err != nil {
+		log.Error("Validation failed", "error", err)
+		return nil, err
 	}
 
-	user, err := h.userRepository.UserByPhone(ctx, request.Phone)
+	if err = h.throttle.Allow(ctx, "login", c.IP(), identifier); err != nil {
+		log.Error("Login throttled", "ip", c.IP(), "login", identifier, "error", err)
+		return nil, err
+	}
+
+	var user *models.User
+	if byEmail {
+		user, err = h.userRepository.UserByEmail(ctx, identifier)
+	} else {
+		user, err = h.userRepository.UserByPhone(ctx, identifier)
+	}
 	if err != nil {
 		log.Error("Error finding user", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
-	if !tools.PasswordsMatch(user.Password, request.Password, h.secret, user.Salt) {
+	// задержка считается по основному идентификатору, чтобы вход по телефону и email делил один счетчик
+	if err = h.throttle.CheckDelay(ctx, user.LoginID()); err != nil {
+		log.Error("Login delayed", "login", user.LoginID(), "error", err)
+		return nil, err
+	}
+
+	if user.Locked(time.Now()) {
+		log.Error("Account locked", "user_id", user.ID, "locked_until", *user.LockedUntil)
+		return nil, ErrAccountLocked
+	}
+
+	match, needsRehash := h.passwords.Verify(user.Password, request.Password, user.Salt)
+	if !match {
 		log.Error("Invalid password", "error", ErrInvalidPassword)
+		h.loginFailed(ctx, user)
 		return nil, status.Error(codes.Unauthenticated, "Invalid Username or Password") //nolint
 	}
 
-	refreshToken := tools.GenerateRefreshToken()
-	accessToken, err := h.jwt.Generate(user)
+	// переводим хеш на текущий алгоритм и параметры, пока известен пароль
+	if needsRehash {
+		if hash, err := h.passwords.Hash(request.Password); err != nil {
+			log.Error("Error rehash password", "user_id", user.ID, "error", err)
+		} else if err = h.userRepository.UpdatePasswordHash(ctx, user.ID, hash); err != nil {
+			log.Error("Error update password hash", "user_id", user.ID, "error", err)
+		}
+	}
+
+	// при включенном втором факторе токены выдаются только после кода из /login/mfa/,
+	// неудачные попытки сбрасываются там же
+	challenge, err := h.startMFA(ctx, user)
 	if err != nil {
-		log.Error("Error generate token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
+	if challenge != nil {
+		return challenge, nil
+	}
+
+	if err = h.throttle.Reset(ctx, user.LoginID()); err != nil {
+		log.Error("Error reset failed logins", "user_id", user.ID, "error", err)
+	}
 
-	userToken, err := h.tokenRepository.Create(ctx, user.ID, accessToken, refreshToken, h.jwt.GetTokenTTL(), h.jwt.GetRefreshTTL())
+	userToken, err := h.issueTokens(c, user)
 	if err != nil {
 		log.Error("Error creating token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
-	data := helpers.JsonEncodeString(user)
-	if err = h.cache.Set(ctx, accessToken, data, h.jwt.GetTokenTTL()); err != nil {
-		log.Error("Error store token", "error", err)
-	}
-
 	return &dto.LoginResponse{
 		AccessToken:  userToken.Token,
 		RefreshToken: userToken.RefreshToken,
@@ -199,6 +349,12 @@ func (h *AuthHandlers) Refresh(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	// refresh токен одноразовый: повторное предъявление значит, что он утёк - отзываем всю цепочку
+	if userToken.RotatedAt != nil {
+		h.revokeTokenFamily(ctx, userToken)
+		return nil, ErrRefreshReused
+	}
+
 	user, err := h.userRepository.UserById(ctx, userToken.UserID)
 	if err != nil {
 		log.Error("Error getting user", "error", err)
@@ -206,19 +362,29 @@ func (h *AuthHandlers) Refresh(c *fiber.Ctx) (interface{}, error) {
 	}
 
 	refreshToken := tools.GenerateRefreshToken()
-	accessToken, err := h.jwt.Generate(user)
+	accessToken, err := h.jwt.Generate(user, userToken.FamilyID)
 	if err != nil {
 		log.Error("Error generate token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
-	userToken, err = h.tokenRepository.Create(ctx, user.ID, accessToken, refreshToken, h.jwt.GetTokenTTL(),
+	userToken, err = h.tokenRepository.Rotate(ctx, userToken, accessToken, refreshToken, h.jwt.GetTokenTTL(),
 		h.jwt.GetRefreshTTL())
 	if err != nil {
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			// токен обменяли параллельным запросом
+			parent, getErr := h.tokenRepository.GetRefreshToken(ctx, request.RefreshToken)
+			if getErr == nil {
+				h.revokeTokenFamily(ctx, parent)
+			}
+			return nil, ErrRefreshReused
+		}
 		log.Error("Error creating token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	h.visits.Track(user.ID, userToken.FamilyID)
+
 	data := helpers.JsonEncodeString(user)
 	if err = h.cache.Set(ctx, accessToken, data, h.jwt.GetTokenTTL()); err != nil {
 		log.Error("Error store token", "error", err)
@@ -233,6 +399,8 @@ func (h *AuthHandlers) Refresh(c *fiber.Ctx) (interface{}, error) {
 // Recovery прокси метод для отправки его в сервис IDM
 // @Summary Handles the password recovery request
 // @Description Handles the password recovery request by verifying the OTP and updating the user's password
+// @Description The new password must satisfy the password policy and differ from the recent passwords.
+// @Description A recently used password is rejected after the code is checked, a new code has to be requested then.
 // @Tags User
 // @Accept json
 // @Produce json
@@ -250,12 +418,52 @@ func (h *AuthHandlers) Recovery(c *fiber.Ctx) (interface{}, error) {
 		return nil, tvoerrors.ErrInvalidRequestData
 	}
 
-	user, err := h.userRepository.UserByPhone(ctx, request.Phone)
+	identifier, byEmail, err := loginIdentifier(request.Phone, request.Email)
+	if err != nil {
+		log.Error("Validation failed", "error", err)
+		return nil, err
+	}
+
+	if err = h.throttle.Allow(ctx, "recovery", c.IP(), identifier); err != nil {
+		log.Error("Recovery throttled", "ip", c.IP(), "login", identifier, "error", err)
+		return nil, err
+	}
+
+	// требования к паролю проверяются до кода, чтобы отказ не сжигал код. Повтор прошлого пароля
+	// проверяется только после кода, иначе по ответу можно подбирать пароли, такой отказ код сжигает
+	var phone string
+	if !byEmail {
+		phone = identifier
+	}
+	if err = h.checkPassword(ctx, request.Password, phone); err != nil {
+		return nil, err
+	}
+
+	if err = h.otp.Verify(ctx, service.OTPRecovery, identifier, 0, request.Code); err != nil {
+		log.Error("Invalid recovery code", "login", identifier, "error", err)
+		return nil, err
+	}
+
+	var user *models.User
+	if byEmail {
+		user, err = h.userRepository.UserByEmail(ctx, identifier)
+	} else {
+		user, err = h.userRepository.UserByPhone(ctx, identifier)
+	}
 	if err != nil {
 		log.Error("Error getting user", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	if byEmail && user.Phone != "" {
+		if err = h.checkPassword(ctx, request.Password, user.Phone); err != nil {
+			return nil, err
+		}
+	}
+	if err = h.checkPasswordReuse(ctx, user.ID, request.Password); err != nil {
+		return nil, err
+	}
+
 	if err = h.tokenRepository.TokenReset(ctx, user.ID); err != nil {
 		log.Error("Error resetting token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
@@ -266,7 +474,7 @@ func (h *AuthHandlers) Recovery(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
-	if err = h.userRepository.UpdatePassword(ctx, user.ID, request.Password); err != nil {
+	if err = h.userRepository.UpdatePassword(ctx, user.ID, request.Password, h.passwordPolicy.HistorySize()); err != nil {
 		log.Error("Error updating password", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
@@ -300,6 +508,13 @@ func (h *AuthHandlers) Logout(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	if claims, err := h.jwt.Verify(tokenData.RawToken); err == nil {
+		if err = h.revocations.RevokeToken(ctx, claims.RegisteredClaims.ID); err != nil {
+			log.Error("Error revoke token", "error", err)
+			return nil, status.Error(codes.Internal, "something went wrong") //nolint
+		}
+	}
+
 	if _, err = h.cache.Del(ctx, tokenData.RawToken); err != nil {
 		log.Error("Error caching token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
@@ -344,9 +559,13 @@ func (h *AuthHandlers) DeleteUser(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
-	isAdmin := tokenData.UserRoleID == tvomodels.ADMIN
+	canManage, err := h.permissions.Can(ctx, tokenData.UserRoleID, models.PermUsersManage)
+	if err != nil {
+		log.Error("Error check permission", "error", err)
+		return nil, status.Error(codes.Internal, "something went wrong") //nolint
+	}
 
-	if (isAdmin && tokenData.UserID == request.UserID) || (!isAdmin && tokenData.UserID != request.UserID) {
+	if (canManage && tokenData.UserID == request.UserID) || (!canManage && tokenData.UserID != request.UserID) {
 		log.Error("Delete user not allowed")
 		return nil, status.Error(codes.PermissionDenied, "not allowed") //nolint
 	}
@@ -356,6 +575,8 @@ func (h *AuthHandlers) DeleteUser(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	audit(c, h.auditLog, models.AuditUserDelete, models.AuditTargetUser, strconv.FormatInt(user.ID, 10), nil, nil)
+
 	if err = h.removeUserTokens(ctx, user.ID); err != nil {
 		log.Error("Error removing tokens", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
@@ -367,9 +588,10 @@ func (h *AuthHandlers) DeleteUser(c *fiber.Ctx) (interface{}, error) {
 }
 
 // DigupUser прокси метод для отправки его в сервис IDM
-// Only administrators are allowed to perform this action.
+// Requires the users:manage permission.
 // @Summary Dig up a user
-// @Description Dig up a user from the database
+// @Description Dig up a deleted user from the database. Users deleted longer than USER_RETENTION ago are purged and can't be restored.
+// @Description A user whose phone, Telegram account or verified email was taken meanwhile can't be restored either.
 // @Tags User
 // @Accept json
 // @Produce json
@@ -379,6 +601,7 @@ func (h *AuthHandlers) DeleteUser(c *fiber.Ctx) (interface{}, error) {
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Security ApiKeyAuth
 // @Router /idm/digup_user [post]
@@ -389,22 +612,20 @@ func (h *AuthHandlers) DigupUser(c *fiber.Ctx) (interface{}, error) {
 		return nil, tvoerrors.ErrInvalidRequestData
 	}
 
+	// право users:manage проверяется в роутинге
 	ctx := httputils.CtxWithAuthToken(c)
-	tokenData, err := httputils.GetTokenDataFromCtx(ctx)
-	if err != nil {
-		log.Error("Failed to get token data", "error", err)
-		return nil, status.Error(codes.Internal, "Failed to get claims from token") //nolint
-	}
-
-	if tokenData.UserRoleID != tvomodels.ADMIN {
-		log.Error("Only admin can dig up", "error", ErrNotAdmin)
-		return nil, status.Error(codes.PermissionDenied, "something went wrong") //nolint
-	}
-	_, err = h.userRepository.DigUpUser(ctx, request.UserID)
+	_, err := h.userRepository.DigUpUser(ctx, request.UserID)
 	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, ErrDigupConflict
+		}
 		log.Error("Error digup user", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
+	audit(c, h.auditLog, models.AuditUserDigup, models.AuditTargetUser, strconv.FormatInt(request.UserID, 10), nil, nil)
 
 	return &dto.DigupUserResponse{
 		Message: "User digup successful",
@@ -414,6 +635,9 @@ func (h *AuthHandlers) DigupUser(c *fiber.Ctx) (interface{}, error) {
 // UpdateUser прокси метод для отправки его в сервис IDM
 // @Summary Change user's password or phone number
 // @Description This endpoint allows users to change their password or phone number by providing either a new password or a new phone number along with a verification code.
+// @Description The password change code is sent to the phone of the account, or to its verified email when it has no phone.
+// @Description The new password must satisfy the password policy and differ from the recent passwords.
+// @Description A recently used password is rejected after the code is checked, a new code has to be requested then.
 // @Tags User
 // @Security ApiKeyAuth
 // @Accept json
@@ -433,7 +657,7 @@ func (h *AuthHandlers) UpdateUser(c *fiber.Ctx) (interface{}, error) {
 
 	ctx := httputils.CtxWithAuthToken(c)
 
-	if (request.Phone == "" || request.Code == "") && request.Password == "" {
+	if (request.Phone == "" && request.Password == "") || request.Code == "" {
 		log.Error("Request are empty", "error", tvoerrors.ErrInvalidRequestData)
 		return nil, status.Error(codes.InvalidArgument, "Request are empty") //nolint
 	}
@@ -444,7 +668,38 @@ func (h *AuthHandlers) UpdateUser(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "Failed to get claims from token") //nolint
 	}
 
-	if request.Phone != "" && request.Code != "" {
+	// телефон в токене мог устареть, правила пароля и адрес кода берутся из аккаунта
+	user, err := h.userRepository.UserById(ctx, tokenData.UserID)
+	if err != nil {
+		log.Error("Error getting user", "user_id", tokenData.UserID, "error", err)
+		return nil, status.Error(codes.Internal, "something went wrong") //nolint
+	}
+
+	if request.Password != "" {
+		// с новым телефоном пароль не должен содержать ни один из номеров
+		if err = h.checkPassword(ctx, request.Password, user.Phone); err != nil {
+			return nil, err
+		}
+		if request.Phone != "" {
+			if err = h.checkPassword(ctx, request.Password, request.Phone); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// код подтверждает новый телефон, а при смене только пароля - текущий телефон или подтвержденный email
+	if request.Phone == "" {
+		address := passwordChangeAddress(user)
+		if address == "" {
+			return nil, ErrNoPasswordChangeAddress
+		}
+		if err = h.otp.Verify(ctx, service.OTPPasswordChange, address, tokenData.UserID, request.Code); err != nil {
+			log.Error("Invalid password change code", "user_id", tokenData.UserID, "error", err)
+			return nil, err
+		}
+	}
+
+	if request.Phone != "" {
 		if err = validator.ValidPhone(request.Phone); err != nil {
 			log.Error("Invalid phone number", "error", tvoerrors.ErrInvalidPhone)
 			return nil, status.Error(codes.InvalidArgument, "Invalid phone number") //nolint
@@ -463,6 +718,20 @@ func (h *AuthHandlers) UpdateUser(c *fiber.Ctx) (interface{}, error) {
 			return nil, status.Error(codes.InvalidArgument, "phone already taken") //nolint
 		}
 
+		if err = h.otp.Verify(ctx, service.OTPPhoneChange, request.Phone, tokenData.UserID, request.Code); err != nil {
+			log.Error("Invalid phone change code", "user_id", tokenData.UserID, "error", err)
+			return nil, err
+		}
+	}
+
+	// сверка с прошлыми паролями только после кода: иначе по ответу можно подбирать текущий пароль
+	if request.Password != "" {
+		if err = h.checkPasswordReuse(ctx, tokenData.UserID, request.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Phone != "" {
 		if err = h.userRepository.UpdatePhone(ctx, request.Phone, tokenData.UserID); err != nil {
 			log.Error("Error updating phone", "error", err)
 			return nil, status.Error(codes.Internal, "something went wrong") //nolint
@@ -470,7 +739,7 @@ func (h *AuthHandlers) UpdateUser(c *fiber.Ctx) (interface{}, error) {
 	}
 
 	if request.Password != "" {
-		if err = h.userRepository.UpdatePassword(ctx, tokenData.UserID, request.Password); err != nil {
+		if err = h.userRepository.UpdatePassword(ctx, tokenData.UserID, request.Password, h.passwordPolicy.HistorySize()); err != nil {
 			log.Error("Error updating password", "error", err)
 			return nil, status.Error(codes.Internal, "something went wrong") //nolint
 		}
@@ -519,21 +788,24 @@ func (h *AuthHandlers) ChangeRole(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.InvalidArgument, "can't change your role") //nolint
 	}
 
-	if tokenData.UserRoleID != tvomodels.ADMIN {
-		log.Error("Failed to change role", "error", ErrNotAdmin)
-		return nil, status.Error(codes.PermissionDenied, "can't change role") //nolint
-	}
-
 	role, err := h.roleRepository.RoleByName(ctx, req.Role)
 	if err != nil {
 		log.Error("Error get role", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	user, err := h.userRepository.UserById(ctx, req.UserID)
+	if err != nil {
+		log.Error("Error fetching user", "error", err)
+		return nil, status.Error(codes.Internal, "something went wrong") //nolint
+	}
+
 	if err = h.userRepository.ChangeRole(ctx, req.UserID, int64(role.ID)); err != nil {
 		log.Error("Error filed to change role", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
+	audit(c, h.auditLog, models.AuditRoleChange, models.AuditTargetUser, strconv.FormatInt(req.UserID, 10),
+		map[string]any{"role_id": user.RoleID}, map[string]any{"role_id": role.ID, "role": role.Name})
 
 	if err = h.removeUserTokens(ctx, req.UserID); err != nil {
 		log.Error("Error removing tokens", "error", err)
@@ -576,7 +848,13 @@ func (h *AuthHandlers) ResetToken(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "Failed to get claims from token") //nolint
 	}
 
-	if tokenData.UserRoleID == tvomodels.ADMIN {
+	canManage, err := h.permissions.Can(ctx, tokenData.UserRoleID, models.PermUsersManage)
+	if err != nil {
+		log.Error("Error check permission", "error", err)
+		return nil, status.Error(codes.Internal, "something went wrong") //nolint
+	}
+
+	if canManage && req.UserID != 0 {
 		userId = req.UserID
 	} else {
 		userId = tokenData.UserID
@@ -586,6 +864,7 @@ func (h *AuthHandlers) ResetToken(c *fiber.Ctx) (interface{}, error) {
 		log.Error("Error resetting token", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
+	audit(c, h.auditLog, models.AuditTokenReset, models.AuditTargetUser, strconv.FormatInt(userId, 10), nil, nil)
 
 	if err = h.removeUserTokens(ctx, userId); err != nil {
 		log.Error("Error removing tokens", "error", err)
@@ -606,6 +885,143 @@ func (h *AuthHandlers) ResetToken(c *fiber.Ctx) (interface{}, error) {
 	//}
 }
 
+// SendOTP sends a one-time code by SMS
+// @Summary Send verification code
+// @Description Sends a one-time code for registration, recovery, phone_change or password_change.
+// @Description phone_change and password_change require authorization, password_change uses the phone of the account,
+// @Description or its verified email when it has no phone.
+// @Description With email set the code is sent by email for registration, recovery, email_verify or email_change.
+// @Description email_verify and email_change require authorization, email_verify uses the unverified email of the account.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body dto.SendOTPRequest true "Request body"
+// @Success 200 {object} dto.SendOTPResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /auth/otp [post]
+func (h *AuthHandlers) SendOTP(c *fiber.Ctx) (interface{}, error) {
+	var request dto.SendOTPRequest
+
+	if err := httputils.ParseRequestBody(c, &request, "SendOTP", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	ctx := httputils.CtxWithAuthToken(c)
+	purpose := service.OTPPurpose(request.Purpose)
+	if purpose == service.OTPPasswordChange {
+		return h.sendPasswordChangeOTP(c)
+	}
+	if request.Email != "" || purpose == service.OTPEmailVerify {
+		return h.sendEmailOTP(c, purpose, request.Email)
+	}
+
+	phone := request.Phone
+	var userId int64
+
+	switch purpose {
+	case service.OTPPhoneChange:
+		tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		if !ok {
+			return nil, tvoerrors.ErrUnauthorized
+		}
+		userId = tokenData.UserID
+	case service.OTPRegistration, service.OTPRecovery:
+	default:
+		return nil, tvoerrors.Wrap("unknown purpose", tvoerrors.ErrInvalidRequestData)
+	}
+
+	if err := validator.ValidPhone(phone); err != nil {
+		log.Error("Invalid phone number", "error", err)
+		return nil, tvoerrors.ErrInvalidPhone
+	}
+
+	if err := h.throttle.Allow(ctx, "otp", c.IP(), phone); err != nil {
+		log.Error("OTP throttled", "ip", c.IP(), "phone", phone, "error", err)
+		return nil, err
+	}
+
+	exists, err := h.userRepository.PhoneExists(ctx, phone)
+	if err != nil && !errors.Is(err, tvoerrors.ErrNotFound) {
+		log.Error("Find phone error", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	switch {
+	case exists && purpose != service.OTPRecovery:
+		return nil, tvoerrors.Wrap(ErrPhoneTaken.Error(), tvoerrors.ErrConflict)
+	case !exists && purpose == service.OTPRecovery:
+		// не раскрываем, зарегистрирован ли номер
+		return &dto.SendOTPResponse{Message: "Code sent"}, nil
+	}
+
+	if err = h.otp.Send(ctx, purpose, phone, userId); err != nil {
+		if errors.Is(err, tvoerrors.ErrTooManyRequests) {
+			return nil, err
+		}
+		log.Error("Error sending code", "purpose", purpose, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.SendOTPResponse{Message: "Code sent"}, nil
+}
+
+// sendPasswordChangeOTP sends the password change code of SendOTP by SMS, or by email to users without a phone
+func (h *AuthHandlers) sendPasswordChangeOTP(c *fiber.Ctx) (*dto.SendOTPResponse, error) {
+	ctx := httputils.CtxWithAuthToken(c)
+
+	tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+	if !ok {
+		return nil, tvoerrors.ErrUnauthorized
+	}
+
+	user, err := h.userRepository.UserById(ctx, tokenData.UserID)
+	if err != nil {
+		h.logger.Error("Error getting user", "user_id", tokenData.UserID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	address := passwordChangeAddress(user)
+	if address == "" {
+		return nil, ErrNoPasswordChangeAddress
+	}
+
+	if err = h.throttle.Allow(ctx, "otp", c.IP(), address); err != nil {
+		h.logger.Error("OTP throttled", "ip", c.IP(), "user_id", user.ID, "error", err)
+		return nil, err
+	}
+
+	if user.Phone != "" {
+		err = h.otp.Send(ctx, service.OTPPasswordChange, address, user.ID)
+	} else {
+		err = h.otp.SendEmail(ctx, service.OTPPasswordChange, address, user.ID)
+	}
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrTooManyRequests) {
+			return nil, err
+		}
+		h.logger.Error("Error sending code", "purpose", service.OTPPasswordChange, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.SendOTPResponse{Message: "Code sent"}, nil
+}
+
+// passwordChangeAddress returns where the password change code of the user is sent: the phone,
+// or the verified email of users registered by email, Telegram or OIDC. Empty when there is neither.
+func passwordChangeAddress(user *models.User) string {
+	switch {
+	case user.Phone != "":
+		return user.Phone
+	case user.Email != "" && user.EmailVerifiedAt != nil:
+		return user.Email
+	default:
+		return ""
+	}
+}
+
 func (h *AuthHandlers) Ping(c *fiber.Ctx) (interface{}, error) {
 	return &dto.PingResponse{
 		Status:  true,
@@ -613,15 +1029,26 @@ func (h *AuthHandlers) Ping(c *fiber.Ctx) (interface{}, error) {
 	}, nil
 }
 
-// ListUsers returns a paginated list of users with their roles and last visit time
+// ListUsers returns a paginated list of users matching the filters with their roles and last visit time
 // @Summary Get list of users
-// @Description Get a paginated list of users with user ID, phone, role, and last visit time
+// @Description Get a paginated list of users with user ID, phone, role, last visit time and profile.
+// @Description Total is the count of users matching the filters.
 // @Tags User
 // @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param limit query int false "Number of users per page" default(20)
 // @Param offset query int false "Offset for pagination" default(0)
+// @Param role_id query int false "Role ID"
+// @Param phone query string false "Phone substring"
+// @Param email query string false "Email substring, case insensitive"
+// @Param created_from query string false "Registered from, RFC 3339, inclusive"
+// @Param created_to query string false "Registered before, RFC 3339"
+// @Param visited_from query string false "Last visit from, RFC 3339, inclusive"
+// @Param visited_to query string false "Last visit before, RFC 3339"
+// @Param state query string false "User state" Enums(active, deleted, all) default(active)
+// @Param sort query string false "Sort field" Enums(id, created_at, last_visited_at, phone, email) default(id)
+// @Param order query string false "Sort order" Enums(asc, desc) default(asc)
 // @Success 200 {object} dto.UserListResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
@@ -629,61 +1056,47 @@ func (h *AuthHandlers) Ping(c *fiber.Ctx) (interface{}, error) {
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /auth/users [get]
 func (h *AuthHandlers) ListUsers(c *fiber.Ctx) (interface{}, error) {
+	// право users:list проверяется в роутинге
 	ctx := httputils.CtxWithAuthToken(c)
 
-	// Check if user is authenticated and has proper role
-	roleId, err := httputils.RoleIDFromToken(c, "CreateNftData", h.logger)
+	filter, err := userFilter(c)
 	if err != nil {
-		return nil, tvoerrors.ErrCastClaims
+		return nil, err
 	}
 
-	// Only admin users can list users
-	if roleId != 100 {
-		h.logger.Error("Access denied for non-admin user", "role_id", roleId)
-		return nil, tvoerrors.ErrForbidden
-	}
-
-	// Parse pagination parameters
-	limit := c.QueryInt("limit", 20)  // Default to 20 users per page
-	offset := c.QueryInt("offset", 0) // Default to first page
-
-	// Validate pagination parameters
-	if limit <= 0 || limit > 100 {
-		limit = 20 // Reset to default if invalid
-	}
-	if offset < 0 {
-		offset = 0 // Reset to first page if invalid
-	}
-
-	// Get users from repository
-	users, totalCount, err := h.userRepository.ListUsers(ctx, limit, offset)
+	users, totalCount, err := h.userRepository.ListUsers(ctx, filter)
 	if err != nil {
 		h.logger.Error("Error getting users list", "error", err)
-		return nil, tvoerrors.ErrNotFound
+		return nil, tvoerrors.ErrServerError
 	}
 
 	// Convert users to response format
+	now := time.Now()
 	userItems := make([]dto.UserListItem, 0, len(users))
 	for _, user := range users {
-		// Get role name
-		role, err := h.roleRepository.RoleById(ctx, int64(user.RoleID))
-		if err != nil {
-			h.logger.Error("Error getting role for user", "user_id", user.ID, "role_id", user.RoleID, "error", err)
-			continue // Skip user if we can't get role info
+		item := dto.UserListItem{
+			UserID:        user.ID,
+			Phone:         user.Phone,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerifiedAt != nil,
+			Role:          user.RoleName,
+			TelegramID:    user.TelegramID,
+			UserProfile:   user.Profile,
+		}
+		if !user.CreatedAt.IsZero() {
+			item.CreatedAt = user.CreatedAt.Format("2006-01-02 15:04:05")
 		}
-
-		// Format last visit time
-		lastVisitTime := ""
 		if !user.LastVisitedAt.IsZero() {
-			lastVisitTime = user.LastVisitedAt.Format("2006-01-02 15:04:05")
+			item.LastVisitTime = user.LastVisitedAt.Format("2006-01-02 15:04:05")
 		}
-
-		userItems = append(userItems, dto.UserListItem{
-			UserID:        user.ID,
-			Phone:         user.Phone,
-			Role:          role.Name,
-			LastVisitTime: lastVisitTime,
-		})
+		if user.Locked(now) {
+			item.Locked = true
+			item.LockedUntil = user.LockedUntil.Format("2006-01-02 15:04:05")
+		}
+		if !user.DeletedAt.IsZero() {
+			item.DeletedAt = user.DeletedAt.Format("2006-01-02 15:04:05")
+		}
+		userItems = append(userItems, item)
 	}
 
 	return &dto.UserListResponse{
@@ -692,6 +1105,105 @@ func (h *AuthHandlers) ListUsers(c *fiber.Ctx) (interface{}, error) {
 	}, nil
 }
 
+// userFilter parses the query of ListUsers, invalid pagination falls back to the first page
+func userFilter(c *fiber.Ctx) (models.UserFilter, error) {
+	filter := models.UserFilter{
+		RoleID: models.RoleId(c.QueryInt("role_id", 0)),
+		Phone:  strings.TrimSpace(c.Query("phone")),
+		Email:  strings.TrimSpace(c.Query("email")),
+		State:  c.Query("state", models.UserStateActive),
+		Sort:   c.Query("sort", models.UserSortID),
+		Limit:  c.QueryInt("limit", 20),
+		Offset: c.QueryInt("offset", 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	switch c.Query("order", "asc") {
+	case "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, tvoerrors.ErrInvalidRequestData
+	}
+	if !slices.Contains(models.UserSortFields, filter.Sort) || filter.RoleID < 0 ||
+		!slices.Contains([]string{models.UserStateActive, models.UserStateDeleted, models.UserStateAll}, filter.State) {
+		return filter, tvoerrors.ErrInvalidRequestData
+	}
+
+	for name, field := range map[string]**time.Time{"created_from": &filter.CreatedFrom, "created_to": &filter.CreatedTo,
+		"visited_from": &filter.VisitedFrom, "visited_to": &filter.VisitedTo} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, tvoerrors.ErrInvalidRequestData
+			}
+			*field = &parsed
+		}
+	}
+
+	return filter, nil
+}
+
+// JWKS returns the public keys verifying access tokens
+// @Summary JSON Web Key Set
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} lib.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandlers) JWKS(c *fiber.Ctx) (interface{}, error) {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return h.jwt.JWKS(), nil
+}
+
+// UnlockUser removes the lockout set after failed logins
+// Requires the users:unlock permission.
+// @Summary Unlock user
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} dto.UnlockUserResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/users/{id}/unlock [post]
+func (h *AuthHandlers) UnlockUser(c *fiber.Ctx) (interface{}, error) {
+	ctx := c.Context()
+
+	userId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	user, err := h.userRepository.UserById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	if err = h.userRepository.Unlock(ctx, user.ID); err != nil {
+		h.logger.Error("Error unlock user", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	if err = h.throttle.Reset(ctx, user.LoginID()); err != nil {
+		h.logger.Error("Error reset failed logins", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.UnlockUserResponse{
+		Message: "User unlocked",
+	}, nil
+}
+
 // CheckToken checks if the provided token is valid
 func (s *AuthHandlers) CheckToken(ctx context.Context, request *dto.CheckTokenRequest) (*dto.CheckTokenResponse, error) {
 	token := request.Token
@@ -699,9 +1211,15 @@ func (s *AuthHandlers) CheckToken(ctx context.Context, request *dto.CheckTokenRe
 		return nil, status.Error(codes.InvalidArgument, "invalid request") //nolint
 	}
 
+	// токены имперсонации не хранятся в БД, они проверяются по подписи как в режиме stateless
+	if claims, err := s.jwt.Verify(token); err == nil && claims.Actor != nil {
+		return s.VerifyToken(ctx, request)
+	}
+
 	user := &models.User{}
 	var err error
 	var errorMessage string
+	var familyId string
 	emptyCache := false
 
 	// проверяем токен в кеше
@@ -724,6 +1242,7 @@ func (s *AuthHandlers) CheckToken(ctx context.Context, request *dto.CheckTokenRe
 			errorMessage = "invalid token"
 			log.Error("get user by token error", "error", err, "token", token)
 		} else {
+			familyId = userToken.FamilyID
 			user, err = s.userRepository.UserById(ctx, userToken.UserID)
 			if err != nil {
 				errorMessage = "invalid token data"
@@ -749,9 +1268,7 @@ func (s *AuthHandlers) CheckToken(ctx context.Context, request *dto.CheckTokenRe
 
 	// обновляем дату последнего визита пользователя
 	if errorMessage == "" && user.ID > 0 {
-		if err := s.userRepository.UpdateLastVisit(ctx, user.ID); err != nil {
-			log.Error("can't update user last visit date", "user_id", user.ID, "error", err)
-		}
+		s.visits.Track(user.ID, familyId)
 	}
 
 	log.Debug("ChekToken success", "user", user, "error", errorMessage)
@@ -763,11 +1280,234 @@ func (s *AuthHandlers) CheckToken(ctx context.Context, request *dto.CheckTokenRe
 		UserId:  user.ID,
 		RoleId:  int64(user.RoleID),
 		Phone:   user.Phone,
+		Email:   user.VerifiedEmail(),
 	}, nil
 }
 
+// VerifyToken checks the token without Postgres: the signature and claims are verified locally
+// and only the revocation list is consulted in the cache.
+func (s *AuthHandlers) VerifyToken(ctx context.Context, request *dto.CheckTokenRequest) (*dto.CheckTokenResponse, error) {
+	if request.Token == "" {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	claims, err := s.jwt.Verify(request.Token)
+	if err != nil {
+		log.Debug("invalid token", "error", err)
+		return &dto.CheckTokenResponse{Error: "invalid token"}, nil
+	}
+
+	revoked, err := s.revocations.Revoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &dto.CheckTokenResponse{Error: "token revoked"}, nil
+	}
+
+	if claims.Actor != nil {
+		allowed, err := s.impersonationAllowed(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return &dto.CheckTokenResponse{Error: "impersonation no longer allowed"}, nil
+		}
+	}
+
+	response := &dto.CheckTokenResponse{
+		IsValid: true,
+		UserId:  claims.ID,
+		RoleId:  claims.Role,
+		Phone:   claims.Phone,
+		Email:   claims.Email,
+	}
+	if claims.Actor != nil {
+		// визит администратора не считается визитом пользователя
+		response.ActorID = claims.Actor.ID
+	} else {
+		s.visits.Track(claims.ID, claims.SessionID)
+	}
+
+	return response, nil
+}
+
+// impersonationAllowed checks the admin of the act claim against its current role: the token stops working
+// once the admin loses users:impersonate or a permission of the impersonated user, or the admin account is gone.
+// Impersonated requests are rare and each one is written to the audit log anyway, so Postgres is asked every time.
+func (s *AuthHandlers) impersonationAllowed(ctx context.Context, claims *jwtManager.UserClaims) (bool, error) {
+	actor, err := s.userRepository.UserById(ctx, claims.Actor.ID)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return false, nil
+		}
+		return false, tvoerrors.Wrap("error getting impersonation actor", err)
+	}
+	if actor.Locked(time.Now()) {
+		return false, nil
+	}
+
+	canImpersonate, err := s.permissions.Can(ctx, tvomodels.RoleId(actor.RoleID), models.PermUsersImpersonate)
+	if err != nil || !canImpersonate {
+		return false, err
+	}
+	return s.permissions.CanActAs(ctx, tvomodels.RoleId(actor.RoleID), tvomodels.RoleId(claims.Role))
+}
+
+// loginFailed records a failed login and locks the account once the threshold is reached.
+func (s *AuthHandlers) loginFailed(ctx context.Context, user *models.User) {
+	lock, err := s.throttle.Failure(ctx, user.LoginID())
+	if err != nil {
+		s.logger.Error("Error record failed login", "user_id", user.ID, "error", err)
+		return
+	}
+	if !lock {
+		return
+	}
+
+	until := s.throttle.LockoutUntil()
+	if err = s.userRepository.LockUntil(ctx, user.ID, until); err != nil {
+		s.logger.Error("Error lock account", "user_id", user.ID, "error", err)
+		return
+	}
+	s.logger.Warn("account locked after failed logins", "user_id", user.ID, "locked_until", until)
+
+	// после блокировки счетчик начинается заново
+	if err = s.throttle.Reset(ctx, user.LoginID()); err != nil {
+		s.logger.Error("Error reset failed logins", "user_id", user.ID, "error", err)
+	}
+}
+
+// startMFA returns the challenge response when the user has to pass the second factor, nil otherwise.
+// Users of roles requiring MFA without an enrolled factor get a challenge to enroll one, see EnrollMFAOnLogin.
+func (s *AuthHandlers) startMFA(ctx context.Context, user *models.User) (*dto.LoginResponse, error) {
+	mfaEnabled, err := s.mfa.Enabled(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("Error check mfa", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	if !mfaEnabled && !s.mfa.Required(user.RoleID) {
+		return nil, nil
+	}
+
+	mfaToken, err := s.mfa.StartChallenge(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("Error start mfa challenge", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.LoginResponse{
+		MFARequired:           true,
+		MFAToken:              mfaToken,
+		MFAEnrollmentRequired: !mfaEnabled,
+	}, nil
+}
+
+// issueTokens starts a new session of the user: creates a token family with the first pair and caches the access token.
+func (s *AuthHandlers) issueTokens(c *fiber.Ctx, user *models.User) (*models.UserToken, error) {
+	ctx := c.Context()
+
+	familyId := tools.GenerateTokenFamily()
+	refreshToken := tools.GenerateRefreshToken()
+	accessToken, err := s.jwt.Generate(user, familyId)
+	if err != nil {
+		return nil, tvoerrors.Wrap("Error generate token", err)
+	}
+
+	userToken, err := s.tokenRepository.Create(ctx, user.ID, familyId, accessToken, refreshToken, s.jwt.GetTokenTTL(),
+		s.jwt.GetRefreshTTL())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessions.Create(ctx, &models.UserSession{
+		UserID:    user.ID,
+		FamilyID:  userToken.FamilyID,
+		UserAgent: helpers.Truncate(c.Get(fiber.HeaderUserAgent), 512),
+		IP:        c.IP(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := helpers.JsonEncodeString(user)
+	if err = s.cache.Set(ctx, accessToken, data, s.jwt.GetTokenTTL()); err != nil {
+		s.logger.Error("Error store token", "error", err)
+	}
+
+	return userToken, nil
+}
+
+// revokeTokenFamily revokes every token issued from the same login as userToken and drops cached access tokens.
+func (s *AuthHandlers) revokeTokenFamily(ctx context.Context, userToken *models.UserToken) {
+	s.logger.Warn("refresh token reuse, revoking token family", "user_id", userToken.UserID,
+		"family_id", userToken.FamilyID)
+
+	if err := s.revokeFamily(ctx, userToken.FamilyID); err != nil {
+		s.logger.Error("Error revoking token family", "family_id", userToken.FamilyID, "error", err)
+		return
+	}
+
+	if err := s.removeUserTokens(ctx, userToken.UserID); err != nil {
+		s.logger.Error("Error removing tokens", "user_id", userToken.UserID, "error", err)
+	}
+}
+
+// revokeFamily revokes the tokens of the family and removes its access tokens from the cache.
+func (s *AuthHandlers) revokeFamily(ctx context.Context, familyId string) error {
+	if err := s.tokenRepository.RevokeFamily(ctx, familyId); err != nil {
+		return err
+	}
+
+	if err := s.revocations.RevokeSession(ctx, familyId); err != nil {
+		return err
+	}
+
+	familyTokens, err := s.tokenRepository.FamilyTokens(ctx, familyId)
+	if err != nil {
+		return err
+	}
+	if len(familyTokens) == 0 {
+		return nil
+	}
+
+	if _, err = s.cache.Del(ctx, familyTokens...); err != nil {
+		return tvoerrors.Wrap("Error remove token", err)
+	}
+	return nil
+}
+
+// checkPassword validates a new password against the policy, phone is the phone of the account and may be empty.
+func (h *AuthHandlers) checkPassword(ctx context.Context, password, phone string) error {
+	if err := h.passwordPolicy.Check(ctx, password, phone); err != nil {
+		if errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			return err
+		}
+		h.logger.Error("Error checking password", "error", err)
+		return tvoerrors.ErrServerError
+	}
+	return nil
+}
+
+// checkPasswordReuse rejects the current and the recent passwords of the user.
+func (h *AuthHandlers) checkPasswordReuse(ctx context.Context, userId int64, password string) error {
+	history, err := h.userRepository.PasswordHistory(ctx, userId, h.passwordPolicy.HistorySize())
+	if err != nil {
+		h.logger.Error("Error getting password history", "user_id", userId, "error", err)
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return tvoerrors.Wrap("user not found", tvoerrors.ErrNotFound)
+		}
+		return tvoerrors.ErrServerError
+	}
+	return h.passwordPolicy.CheckReuse(password, history)
+}
+
 // removeUserTokens removes active tokens associated with the given user ID.
 func (s *AuthHandlers) removeUserTokens(ctx context.Context, userId int64) error {
+	if err := s.revocations.RevokeUser(ctx, userId); err != nil {
+		return err
+	}
+
 	tokens, err := s.tokenRepository.ActiveTokens(ctx, userId)
 	if err != nil {
 		return tvoerrors.Wrap("Error fetching active tokens", err)
@@ -0,0 +1,655 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/config"
+	"main/internal/dto"
+	jwtManager "main/internal/lib/jwt"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/internal/service"
+	"main/tools/pkg/constants"
+	coreconfig "main/tools/pkg/core_config"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// memoryCache is a cache.CacheClient for one test
+type memoryCache map[string][]byte
+
+func (m memoryCache) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	switch v := value.(type) {
+	case string:
+		m[key] = []byte(v)
+	case []byte:
+		m[key] = v
+	}
+	return nil
+}
+
+func (m memoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	if v, ok := m[key]; ok {
+		return v, nil
+	}
+	return nil, errors.New("redis: nil")
+}
+
+func (m memoryCache) GetDel(ctx context.Context, key string) ([]byte, error) {
+	v, err := m.Get(ctx, key)
+	delete(m, key)
+	return v, err
+}
+
+func (m memoryCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if _, ok := m[key]; ok {
+		return false, nil
+	}
+	return true, m.Set(ctx, key, value, ttl)
+}
+
+func (m memoryCache) Exists(_ context.Context, keys ...string) (uint64, error) {
+	var n uint64
+	for _, key := range keys {
+		if _, ok := m[key]; ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m memoryCache) Del(ctx context.Context, keys ...string) (uint64, error) {
+	n, _ := m.Exists(ctx, keys...)
+	for _, key := range keys {
+		delete(m, key)
+	}
+	return n, nil
+}
+
+func (m memoryCache) Incr(_ context.Context, key string) (int64, error) {
+	n, _ := strconv.ParseInt(string(m[key]), 10, 64)
+	n++
+	m[key] = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (m memoryCache) Expire(_ context.Context, key string, _ time.Duration) (bool, error) {
+	_, ok := m[key]
+	return ok, nil
+}
+
+func (m memoryCache) Close() error { return nil }
+
+// memoryUsers answers UserById, Unlock, DigUpUser and password changes, other methods of the repository are not used by the tests
+type memoryUsers struct {
+	repository.UserRepository
+	users   map[int64]*models.User
+	deleted map[int64]*models.User
+}
+
+// DigUpUser restores the deleted user unless an active user has the same Telegram account
+func (m *memoryUsers) DigUpUser(_ context.Context, id int64) (*models.User, error) {
+	user, ok := m.deleted[id]
+	if !ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	for _, active := range m.users {
+		if user.TelegramID != 0 && active.TelegramID == user.TelegramID {
+			return nil, tvoerrors.ErrConflict
+		}
+	}
+	delete(m.deleted, id)
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *memoryUsers) Unlock(_ context.Context, id int64) error {
+	user, ok := m.users[id]
+	if !ok {
+		return tvoerrors.ErrNotFound
+	}
+	user.LockedUntil = nil
+	return nil
+}
+
+// PasswordHistory is empty, reuse of passwords is checked by the PasswordPolicy tests
+func (m *memoryUsers) PasswordHistory(_ context.Context, id int64, _ int) ([]models.PasswordHash, error) {
+	if _, ok := m.users[id]; !ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	return nil, nil
+}
+
+func (m *memoryUsers) UpdatePassword(_ context.Context, id int64, password string, _ int) error {
+	user, ok := m.users[id]
+	if !ok {
+		return tvoerrors.ErrNotFound
+	}
+	user.Password = password
+	return nil
+}
+
+func (m *memoryUsers) UserById(_ context.Context, id int64) (*models.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	return user, nil
+}
+
+// memoryTokens keeps user tokens like the repository: a revoked token loses its refresh token,
+// a refresh token is rotated only once
+type memoryTokens struct {
+	tokens []*models.UserToken
+}
+
+func (m *memoryTokens) Create(_ context.Context, id int64, familyId, accessToken, refreshToken string,
+	tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error) {
+	return m.insert(&models.UserToken{UserID: id, FamilyID: familyId, Token: accessToken, RefreshToken: refreshToken,
+		ExpiredAt: time.Now().Add(tokenTTL), RefreshExpiredAt: time.Now().Add(refreshTokenTTL)}), nil
+}
+
+func (m *memoryTokens) insert(userToken *models.UserToken) *models.UserToken {
+	userToken.ID = int64(len(m.tokens) + 1)
+	m.tokens = append(m.tokens, userToken)
+	copied := *userToken
+	return &copied
+}
+
+func (m *memoryTokens) GetRefreshToken(_ context.Context, refresh string) (*models.UserToken, error) {
+	for _, userToken := range m.tokens {
+		if userToken.RefreshToken != "" && userToken.RefreshToken == refresh {
+			copied := *userToken
+			return &copied, nil
+		}
+	}
+	return nil, tvoerrors.ErrNotFound
+}
+
+func (m *memoryTokens) Rotate(_ context.Context, parent *models.UserToken, accessToken, refreshToken string,
+	tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error) {
+	stored := m.tokens[parent.ID-1]
+	if stored.RotatedAt != nil || stored.RefreshToken == "" {
+		return nil, tvoerrors.ErrConflict
+	}
+	now := time.Now()
+	stored.RotatedAt = &now
+	return m.insert(&models.UserToken{UserID: parent.UserID, FamilyID: parent.FamilyID, ParentID: parent.ID,
+		Token: accessToken, RefreshToken: refreshToken, ExpiredAt: now.Add(tokenTTL),
+		RefreshExpiredAt: now.Add(refreshTokenTTL)}), nil
+}
+
+func (m *memoryTokens) RevokeFamily(_ context.Context, familyId string) error {
+	for _, userToken := range m.tokens {
+		if userToken.FamilyID == familyId {
+			userToken.RefreshToken = ""
+		}
+	}
+	return nil
+}
+
+func (m *memoryTokens) FamilyTokens(_ context.Context, familyId string) ([]string, error) {
+	tokens := make([]string, 0)
+	for _, userToken := range m.tokens {
+		if userToken.FamilyID == familyId {
+			tokens = append(tokens, userToken.Token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *memoryTokens) DeleteRefreshToken(_ context.Context, token string) error {
+	for _, userToken := range m.tokens {
+		if userToken.Token == token {
+			userToken.RefreshToken = ""
+			return nil
+		}
+	}
+	return tvoerrors.ErrUpdateFailed
+}
+
+func (m *memoryTokens) TokenReset(_ context.Context, userID int64) error {
+	for _, userToken := range m.tokens {
+		if userToken.UserID == userID {
+			userToken.RefreshToken = ""
+		}
+	}
+	return nil
+}
+
+func (m *memoryTokens) ActiveTokens(_ context.Context, userID int64) ([]models.UserToken, error) {
+	var tokens []models.UserToken
+	for _, userToken := range m.tokens {
+		if userToken.UserID == userID && userToken.RefreshToken != "" {
+			tokens = append(tokens, *userToken)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *memoryTokens) GetUserIdByToken(_ context.Context, token string) (*models.UserToken, error) {
+	for _, userToken := range m.tokens {
+		if userToken.Token == token && userToken.RefreshToken != "" {
+			copied := *userToken
+			return &copied, nil
+		}
+	}
+	return nil, tvoerrors.ErrNotFound
+}
+
+// newTestAuthHandlers builds AuthHandlers over in-memory repositories with the users 7 and 8,
+// the user 9 is registered by email only
+func newTestAuthHandlers(t *testing.T) (*AuthHandlers, *memoryTokens, *memorySessions, memoryCache) {
+	t.Helper()
+
+	jwt, err := jwtManager.NewJWTManager(&coreconfig.JWT{Secret: "secret", Method: "HS256",
+		AuthExpired: time.Minute, RefreshExpired: time.Hour})
+	if err != nil {
+		t.Fatalf("NewJWTManager() error = %v", err)
+	}
+	log := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	users := &memoryUsers{users: map[int64]*models.User{
+		7: {ID: 7, RoleID: 1, Phone: "79990000000"},
+		8: {ID: 8, RoleID: 1, Phone: "79990000001"},
+		9: {ID: 9, RoleID: 1, Email: "user@example.com"},
+	}, deleted: map[int64]*models.User{}}
+	tokens := &memoryTokens{}
+	sessions := &memorySessions{tokens: tokens}
+	cacheClient := memoryCache{}
+
+	h := NewAuthHandlers(log, jwt, users, tokens, nil, cacheClient, AuthDeps{
+		Sessions: sessions,
+		PasswordPolicy: service.NewPasswordPolicy(&config.Password{MinLength: 8, MaxLength: 128, MinClasses: 2,
+			ForbidPhone: true}, nil, nil),
+		Throttle:    service.NewThrottle(cacheClient, &config.RateLimit{Window: time.Minute, PerIP: 100, PerPhone: 100}),
+		Revocations: service.NewRevocationList(cacheClient, time.Minute),
+		Visits:      service.NewVisitTracker(log, users, sessions),
+	})
+	return h, tokens, sessions, cacheClient
+}
+
+// refresh exchanges the refresh token through the Refresh handler
+func refresh(t *testing.T, app *fiber.App, refreshToken string) (int, dto.RefreshTokenResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(dto.RefreshRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest(fiber.MethodPost, "/idm/refresh", strings.NewReader(string(body)))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("refresh request error = %v", err)
+	}
+
+	var pair dto.RefreshTokenResponse
+	if resp.StatusCode == fiber.StatusOK {
+		if err = json.NewDecoder(resp.Body).Decode(&pair); err != nil {
+			t.Fatalf("refresh response error = %v", err)
+		}
+	}
+	return resp.StatusCode, pair
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	h, tokens, _, cacheClient := newTestAuthHandlers(t)
+	app := fiber.New()
+	app.Post("/idm/refresh", httputils.FiberJSONWrapper(h.Refresh))
+
+	login, _ := tokens.Create(ctx, 7, "family", "access-0", "refresh-0", time.Minute, time.Hour)
+	other, _ := tokens.Create(ctx, 7, "other", "access-other", "refresh-other", time.Minute, time.Hour)
+	_ = cacheClient.Set(ctx, login.Token, "{}", time.Minute)
+
+	status, rotated := refresh(t, app, login.RefreshToken)
+	if status != fiber.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("Refresh() = %d %+v, expected a new pair", status, rotated)
+	}
+	if _, err := cacheClient.Get(ctx, rotated.AccessToken); err != nil {
+		t.Errorf("rotated access token is not cached")
+	}
+
+	// повторное предъявление обмененного токена - утечка, отзывается вся цепочка
+	if status, _ = refresh(t, app, login.RefreshToken); status != fiber.StatusUnauthorized {
+		t.Fatalf("Refresh() with a used token status = %d, expected %d", status, fiber.StatusUnauthorized)
+	}
+	if status, _ = refresh(t, app, rotated.RefreshToken); status == fiber.StatusOK {
+		t.Errorf("Refresh() with the token rotated before reuse succeeded, expected the family to be revoked")
+	}
+	for _, accessToken := range []string{login.Token, rotated.AccessToken} {
+		if _, err := cacheClient.Get(ctx, accessToken); err == nil {
+			t.Errorf("access token %q is still cached", accessToken)
+		}
+	}
+	if _, err := cacheClient.Get(ctx, constants.REVOKED_CACHE_PREFIX+"sid:family"); err != nil {
+		t.Errorf("session of the family is not revoked")
+	}
+
+	// у другого входа пользователя сбрасываются только access токены, refresh токен остается
+	if _, err := tokens.GetRefreshToken(ctx, other.RefreshToken); err != nil {
+		t.Errorf("refresh token of another login is revoked: %v", err)
+	}
+}
+
+// parseUserFilter runs userFilter on a request with the query
+func parseUserFilter(t *testing.T, query string) (models.UserFilter, error) {
+	t.Helper()
+
+	var (
+		filter models.UserFilter
+		err    error
+	)
+	app := fiber.New()
+	app.Get("/users", func(c *fiber.Ctx) error {
+		filter, err = userFilter(c)
+		return nil
+	})
+	if _, testErr := app.Test(httptest.NewRequest(fiber.MethodGet, "/users?"+query, nil)); testErr != nil {
+		t.Fatalf("%q: request error = %v", query, testErr)
+	}
+	return filter, err
+}
+
+func TestUserFilter(t *testing.T) {
+	filter, err := parseUserFilter(t, "")
+	if err != nil {
+		t.Fatalf("userFilter() error = %v", err)
+	}
+	if filter.State != models.UserStateActive || filter.Sort != models.UserSortID || filter.Desc ||
+		filter.Limit != 20 || filter.Offset != 0 {
+		t.Errorf("userFilter() defaults = %+v", filter)
+	}
+
+	filter, err = parseUserFilter(t, "role_id=2&phone=+%2079&email=%20A@B.C&state=all&sort=last_visited_at&order=desc"+
+		"&limit=50&offset=10&created_from=2025-11-01T03:00:00%2B03:00&visited_to=2025-11-30T00:00:00Z")
+	if err != nil {
+		t.Fatalf("userFilter() error = %v", err)
+	}
+	if filter.RoleID != 2 || filter.Phone != "79" || filter.Email != "A@B.C" || filter.State != models.UserStateAll ||
+		filter.Sort != models.UserSortLastVisit || !filter.Desc || filter.Limit != 50 || filter.Offset != 10 {
+		t.Errorf("userFilter() = %+v", filter)
+	}
+	if expected := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC); filter.CreatedFrom == nil ||
+		!filter.CreatedFrom.Equal(expected) {
+		t.Errorf("userFilter() created_from = %v, expected %v", filter.CreatedFrom, expected)
+	}
+	if filter.CreatedTo != nil || filter.VisitedFrom != nil || filter.VisitedTo == nil {
+		t.Errorf("userFilter() bounds = %v %v %v, expected only visited_to", filter.CreatedTo, filter.VisitedFrom,
+			filter.VisitedTo)
+	}
+
+	// неверная пагинация сбрасывается на первую страницу
+	for _, query := range []string{"limit=0", "limit=101", "limit=-5&offset=-1", "limit=abc"} {
+		filter, err = parseUserFilter(t, query)
+		if err != nil || filter.Limit != 20 || filter.Offset != 0 {
+			t.Errorf("%q: userFilter() = %+v, %v, expected the first page", query, filter, err)
+		}
+	}
+
+	for _, query := range []string{
+		"order=up",
+		"sort=password",
+		"state=locked",
+		"role_id=-1",
+		"created_from=2025-11-01",
+		"visited_to=yesterday",
+	} {
+		if _, err = parseUserFilter(t, query); !errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			t.Errorf("%q: userFilter() error = %v, expected %v", query, err, tvoerrors.ErrInvalidRequestData)
+		}
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	ctx := context.Background()
+	h, _, _, cacheClient := newTestAuthHandlers(t)
+	app := fiber.New()
+	app.Post("/users/:id/unlock", httputils.FiberJSONWrapper(h.UnlockUser))
+
+	lockedUntil := time.Now().Add(time.Hour)
+	for _, id := range []int64{7, 9} {
+		user, _ := h.userRepository.UserById(ctx, id)
+		user.LockedUntil = &lockedUntil
+		// счетчики неудачных входов ведутся по идентификатору входа: телефону, email или Telegram
+		_ = cacheClient.Set(ctx, constants.LOGIN_FAILURES_CACHE_PREFIX+user.LoginID(), "9", time.Minute)
+		_ = cacheClient.Set(ctx, constants.LOGIN_DELAY_CACHE_PREFIX+user.LoginID(), "1", time.Minute)
+
+		path := "/users/" + strconv.FormatInt(id, 10) + "/unlock"
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, path, nil))
+		if err != nil {
+			t.Fatalf("POST %s: request error = %v", path, err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("POST %s: status = %d, expected %d", path, resp.StatusCode, fiber.StatusOK)
+		}
+		if user.Locked(time.Now()) {
+			t.Errorf("user %d is still locked", id)
+		}
+		if n, _ := cacheClient.Exists(ctx, constants.LOGIN_FAILURES_CACHE_PREFIX+user.LoginID(),
+			constants.LOGIN_DELAY_CACHE_PREFIX+user.LoginID()); n != 0 {
+			t.Errorf("user %d: failed logins of %q are kept", id, user.LoginID())
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/users/100/unlock", nil))
+	if err != nil {
+		t.Fatalf("unlock of an unknown user: request error = %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unlock of an unknown user status = %d, expected %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+}
+
+func TestDigupUser(t *testing.T) {
+	h, _, _, _ := newTestAuthHandlers(t)
+	users := h.userRepository.(*memoryUsers)
+	users.users[8].TelegramID = 500
+	// Telegram удаленного пользователя 10 привязали к пользователю 8, пользователь 11 восстанавливается
+	users.deleted[10] = &models.User{ID: 10, TelegramID: 500}
+	users.deleted[11] = &models.User{ID: 11, TelegramID: 501}
+
+	app := fiber.New()
+	app.Post("/idm/digup_user", httputils.FiberJSONWrapper(h.DigupUser))
+
+	tests := []struct {
+		userId int64
+		status int
+	}{
+		{10, fiber.StatusConflict},
+		{11, fiber.StatusOK},
+		{11, fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		body := `{"user_id":` + strconv.FormatInt(tt.userId, 10) + `}`
+		req := httptest.NewRequest(fiber.MethodPost, "/idm/digup_user", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("digup of %d: request error = %v", tt.userId, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("digup of %d: status = %d, expected %d", tt.userId, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+// memorySMS keeps the last message sent to each phone
+type memorySMS map[string]string
+
+func (m memorySMS) Send(_ context.Context, phone, message string) error {
+	m[phone] = message
+	return nil
+}
+
+// memoryMail keeps the last email body sent to each address
+type memoryMail map[string]string
+
+func (m memoryMail) Send(_ context.Context, to, _, body string) error {
+	m[to] = body
+	return nil
+}
+
+// sentCode extracts the code from the message of OTPService
+func sentCode(t *testing.T, message string) string {
+	t.Helper()
+
+	code, ok := strings.CutPrefix(message, "Your verification code: ")
+	if !ok {
+		t.Fatalf("no code in the message %q", message)
+	}
+	return code
+}
+
+func TestPasswordChange(t *testing.T) {
+	h, _, _, cacheClient := newTestAuthHandlers(t)
+	sms, mail := memorySMS{}, memoryMail{}
+	h.otp = service.NewOTPService(cacheClient, sms, mail, "secret", &config.OTP{Length: 6, TTL: time.Minute,
+		MaxAttempts: 3})
+	users := h.userRepository.(*memoryUsers)
+	verifiedAt := time.Now()
+	users.users[9].EmailVerifiedAt = &verifiedAt
+	users.users[10] = &models.User{ID: 10, RoleID: 1, TelegramID: 500}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		userId, _ := strconv.ParseInt(c.Get("X-User"), 10, 64)
+		// телефон в токене выпущен до смены номера и не совпадает с телефоном аккаунта
+		c.Locals(constants.TOKEN_DATA_KEY, tvomodels.TokenData{UserID: userId, UserPhone: "70000000000"})
+		return c.Next()
+	})
+	app.Post("/auth/otp/", httputils.FiberJSONWrapper(h.SendOTP))
+	app.Post("/auth/update/", httputils.FiberJSONWrapper(h.UpdateUser))
+
+	request := func(method, path string, userId int64, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set("X-User", strconv.FormatInt(userId, 10))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: request error = %v", method, path, err)
+		}
+		return resp.StatusCode
+	}
+	sendCode := `{"purpose":"password_change"}`
+
+	// у пользователя без телефона код приходит на подтвержденный email
+	if status := request(fiber.MethodPost, "/auth/otp/", 9, sendCode); status != fiber.StatusOK {
+		t.Fatalf("SendOTP() for the email user status = %d, expected %d", status, fiber.StatusOK)
+	}
+	code := sentCode(t, mail["user@example.com"])
+	body := `{"password":"n3w-Secret","code":"` + code + `"}`
+	if status := request(fiber.MethodPost, "/auth/update/", 9, body); status != fiber.StatusOK {
+		t.Fatalf("UpdateUser() for the email user status = %d, expected %d", status, fiber.StatusOK)
+	}
+	if users.users[9].Password != "n3w-Secret" {
+		t.Errorf("password of the email user is not changed")
+	}
+
+	// пользователю только с Telegram некуда отправить код
+	if status := request(fiber.MethodPost, "/auth/otp/", 10, sendCode); status != fiber.StatusBadRequest {
+		t.Errorf("SendOTP() for the Telegram user status = %d, expected %d", status, fiber.StatusBadRequest)
+	}
+	body = `{"password":"n3w-Secret","code":"000000"}`
+	if status := request(fiber.MethodPost, "/auth/update/", 10, body); status != fiber.StatusBadRequest {
+		t.Errorf("UpdateUser() for the Telegram user status = %d, expected %d", status, fiber.StatusBadRequest)
+	}
+
+	// код идет на телефон аккаунта, а не из токена, и пароль не может содержать этот телефон
+	if status := request(fiber.MethodPost, "/auth/otp/", 7, sendCode); status != fiber.StatusOK {
+		t.Fatalf("SendOTP() for the phone user status = %d, expected %d", status, fiber.StatusOK)
+	}
+	code = sentCode(t, sms["79990000000"])
+	body = `{"password":"pass79990000000","code":"` + code + `"}`
+	if status := request(fiber.MethodPost, "/auth/update/", 7, body); status != fiber.StatusBadRequest {
+		t.Errorf("UpdateUser() with the phone in the password status = %d, expected %d", status, fiber.StatusBadRequest)
+	}
+	body = `{"password":"n3w-Secret","code":"` + code + `"}`
+	if status := request(fiber.MethodPost, "/auth/update/", 7, body); status != fiber.StatusOK {
+		t.Errorf("UpdateUser() for the phone user status = %d, expected %d", status, fiber.StatusOK)
+	}
+}
+
+func TestRegistrationThrottled(t *testing.T) {
+	h, _, _, cacheClient := newTestAuthHandlers(t)
+	h.throttle = service.NewThrottle(cacheClient, &config.RateLimit{Window: time.Minute, PerPhone: 2})
+	app := fiber.New()
+	app.Post("/auth/registration/", httputils.FiberJSONWrapper(h.Registration))
+
+	// перебор слабых паролей ограничивается так же, как попытки с кодом
+	for i, expected := range []int{fiber.StatusBadRequest, fiber.StatusBadRequest, fiber.StatusTooManyRequests} {
+		body := `{"email":"new@example.com","password":"weak","code":"000000"}`
+		req := httptest.NewRequest(fiber.MethodPost, "/auth/registration/", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("registration %d: request error = %v", i, err)
+		}
+		if resp.StatusCode != expected {
+			t.Errorf("registration %d: status = %d, expected %d", i, resp.StatusCode, expected)
+		}
+	}
+}
+
+// memoryRolePermissions is the service.RolePermissionSource of the tests
+type memoryRolePermissions map[models.RoleId][]string
+
+func (m memoryRolePermissions) RolePermissions(context.Context) (map[models.RoleId][]string, error) {
+	return m, nil
+}
+
+func TestVerifyImpersonation(t *testing.T) {
+	ctx := context.Background()
+	h, _, _, _ := newTestAuthHandlers(t)
+	h.permissions = service.NewPermissionService(memoryRolePermissions{
+		1:   {models.PermNftCreate},
+		98:  {models.PermUsersImpersonate},
+		99:  {models.PermNftCreate, models.PermUsersImpersonate},
+		100: {models.PermNftCreate},
+	}, 0)
+	users := h.userRepository.(*memoryUsers)
+	users.users[20] = &models.User{ID: 20, RoleID: 99}
+	user, _ := h.userRepository.UserById(ctx, 7)
+	token, err := h.jwt.GenerateImpersonation(user, 20, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GenerateImpersonation() error = %v", err)
+	}
+
+	verify := func() *dto.CheckTokenResponse {
+		t.Helper()
+		response, err := h.VerifyToken(ctx, &dto.CheckTokenRequest{Token: token})
+		if err != nil {
+			t.Fatalf("VerifyToken() error = %v", err)
+		}
+		return response
+	}
+
+	if response := verify(); !response.IsValid || response.ActorID != 20 {
+		t.Fatalf("VerifyToken() = %+v, expected a valid token of the actor 20", response)
+	}
+
+	// право проверяется по текущей роли администратора, а не на момент выдачи токена
+	users.users[20].RoleID = 100
+	if response := verify(); response.IsValid {
+		t.Errorf("VerifyToken() after the actor lost users:impersonate is valid")
+	}
+	users.users[20].RoleID = 98
+	if response := verify(); response.IsValid {
+		t.Errorf("VerifyToken() after the actor lost a permission of the user is valid")
+	}
+	users.users[20].RoleID = 99
+	delete(users.users, 20)
+	if response := verify(); response.IsValid {
+		t.Errorf("VerifyToken() after the actor was deleted is valid")
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+
+	"main/internal/dto"
+	"main/internal/repository"
+	"main/internal/service"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// DriftHandlers
+type DriftHandlers struct {
+	logger          *logger.Logger
+	detector        *service.DriftDetector
+	driftRepository repository.DriftRepository
+}
+
+// NewDriftHandlers конструктор для обработчиков отчета о расхождении метаданных
+func NewDriftHandlers(logger *logger.Logger, detector *service.DriftDetector, driftRepository repository.DriftRepository) *DriftHandlers {
+	return &DriftHandlers{
+		logger:          logger,
+		detector:        detector,
+		driftRepository: driftRepository,
+	}
+}
+
+// DriftReport returns the latest metadata drift report
+// Requires the drift:read permission.
+// @Summary Metadata drift report
+// @Tags NFT
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.DriftReportResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /api/drift [get]
+func (h *DriftHandlers) DriftReport(c *fiber.Ctx) (interface{}, error) {
+	ctx := c.Context()
+
+	run, err := h.driftRepository.LatestRun(ctx)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		log.Error("Error getting drift run", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	issues, err := h.driftRepository.IssuesByRun(ctx, run.ID)
+	if err != nil {
+		log.Error("Error getting drift issues", "run_id", run.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.DriftReportResponse{
+		Run:    *run,
+		Issues: issues,
+	}, nil
+}
+
+// RunDrift starts the metadata drift check in background
+// Requires the drift:run permission.
+// @Summary Start metadata drift check
+// @Tags NFT
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.RunDriftResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /api/drift/run [post]
+func (h *DriftHandlers) RunDrift(c *fiber.Ctx) (interface{}, error) {
+	if h.detector == nil {
+		return nil, ErrChainDisabled
+	}
+
+	if err := h.detector.RunInBackground(); err != nil {
+		return nil, err
+	}
+
+	return &dto.RunDriftResponse{
+		Message: "Drift check started",
+	}, nil
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/service"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+	"main/tools/validator"
+)
+
+// VerifyEmail confirms the email of an account with the code sent to it
+// @Summary Verify email
+// @Description Confirms the email set at registration with the code sent by email_verify.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body dto.EmailCodeRequest true "Request body"
+// @Success 200 {object} dto.EmailResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /v1/auth/email/verify/ [post]
+func (h *AuthHandlers) VerifyEmail(c *fiber.Ctx) (interface{}, error) {
+	var request dto.EmailCodeRequest
+
+	ctx := c.Context()
+
+	if err := httputils.ParseRequestBody(c, &request, "VerifyEmail", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.throttle.Allow(ctx, "email_verify", c.IP(), email); err != nil {
+		h.logger.Error("Email verification throttled", "ip", c.IP(), "email", email, "error", err)
+		return nil, err
+	}
+
+	if err = h.otp.Verify(ctx, service.OTPEmailVerify, email, 0, request.Code); err != nil {
+		h.logger.Error("Invalid email verification code", "email", email, "error", err)
+		return nil, err
+	}
+
+	if err = h.userRepository.VerifyEmail(ctx, email); err != nil {
+		h.logger.Error("Error verify email", "email", email, "error", err)
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, err
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.EmailResponse{
+		Message: "Email verified",
+	}, nil
+}
+
+// ChangeEmail sets a new verified email for the current user
+// @Summary Change email
+// @Description The code is sent to the new email by /auth/otp with the email_change purpose.
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.EmailCodeRequest true "Request body"
+// @Success 200 {object} dto.EmailResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/auth/email/change/ [post]
+func (h *AuthHandlers) ChangeEmail(c *fiber.Ctx) (interface{}, error) {
+	var request dto.EmailCodeRequest
+
+	ctx := c.Context()
+
+	if err := httputils.ParseRequestBody(c, &request, "ChangeEmail", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	userId, err := httputils.UserIDFromToken(c, "ChangeEmail", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.otp.Verify(ctx, service.OTPEmailChange, email, userId, request.Code); err != nil {
+		h.logger.Error("Invalid email change code", "user_id", userId, "error", err)
+		return nil, err
+	}
+
+	if err = h.userRepository.SetEmail(ctx, userId, email, true); err != nil {
+		h.logger.Error("Error set email", "user_id", userId, "error", err)
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, tvoerrors.Wrap(ErrEmailTaken.Error(), tvoerrors.ErrConflict)
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.EmailResponse{
+		Message: "Email changed",
+	}, nil
+}
+
+// normalizeEmail validates a bare address and lowercases it, emails are unique case-insensitively
+func normalizeEmail(raw string) (string, error) {
+	email := strings.TrimSpace(raw)
+	if err := validator.ValidEmail(email); err != nil {
+		return "", tvoerrors.Wrap(tvoerrors.ErrInvalidEmail.Error(), tvoerrors.ErrInvalidRequestData)
+	}
+
+	// ParseAddress accepts "Name <addr>", only the address itself is allowed
+	addr, _ := mail.ParseAddress(email)
+	if addr.Address != email {
+		return "", tvoerrors.Wrap(tvoerrors.ErrInvalidEmail.Error(), tvoerrors.ErrInvalidRequestData)
+	}
+
+	return strings.ToLower(email), nil
+}
+
+// loginIdentifier picks the email when it is set and the phone otherwise,
+// byEmail tells which of them was returned
+func loginIdentifier(phone, email string) (identifier string, byEmail bool, err error) {
+	if email != "" {
+		identifier, err = normalizeEmail(email)
+		return identifier, true, err
+	}
+
+	if err = validator.ValidPhone(phone); err != nil {
+		return "", false, tvoerrors.Wrap(tvoerrors.ErrInvalidPhone.Error(), tvoerrors.ErrInvalidRequestData)
+	}
+
+	return phone, false, nil
+}
+
+func (h *AuthHandlers) registerByEmail(c *fiber.Ctx, email, password, code,
+	inviteCode string) (*dto.RegistrationResponse, error) {
+	ctx := c.Context()
+
+	if err := h.otp.Verify(ctx, service.OTPRegistration, email, 0, code); err != nil {
+		h.logger.Error("Invalid registration code", "email", email, "error", err)
+		return nil, err
+	}
+
+	if _, err := h.userRepository.CreateUserByEmail(ctx, email, password, inviteCode); err != nil {
+		h.logger.Error("Error creating user", "email", email, "error", err)
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, tvoerrors.Wrap(ErrEmailTaken.Error(), tvoerrors.ErrConflict)
+		}
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, service.ErrInvalidInvite
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.RegistrationResponse{
+		Message: "User registration successful",
+	}, nil
+}
+
+// sendEmailOTP is the email channel of SendOTP
+func (h *AuthHandlers) sendEmailOTP(c *fiber.Ctx, purpose service.OTPPurpose, rawEmail string) (*dto.SendOTPResponse, error) {
+	ctx := httputils.CtxWithAuthToken(c)
+
+	var userId int64
+	switch purpose {
+	case service.OTPEmailChange, service.OTPEmailVerify:
+		tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		if !ok {
+			return nil, tvoerrors.ErrUnauthorized
+		}
+		userId = tokenData.UserID
+	case service.OTPRegistration, service.OTPRecovery:
+	default:
+		return nil, tvoerrors.Wrap("unknown purpose", tvoerrors.ErrInvalidRequestData)
+	}
+
+	if purpose == service.OTPEmailVerify {
+		user, err := h.userRepository.UserById(ctx, userId)
+		if err != nil {
+			h.logger.Error("Error getting user", "user_id", userId, "error", err)
+			return nil, tvoerrors.ErrServerError
+		}
+		if user.Email == "" || user.EmailVerifiedAt != nil {
+			return nil, tvoerrors.Wrap("no email to verify", tvoerrors.ErrInvalidRequestData)
+		}
+		rawEmail = user.Email
+		// код подтверждения проверяется без авторизации, по ссылке из письма
+		userId = 0
+	}
+
+	email, err := normalizeEmail(rawEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.throttle.Allow(ctx, "otp", c.IP(), email); err != nil {
+		h.logger.Error("OTP throttled", "ip", c.IP(), "email", email, "error", err)
+		return nil, err
+	}
+
+	switch purpose {
+	case service.OTPRegistration, service.OTPEmailChange:
+		if err = h.checkEmailFree(ctx, email); err != nil {
+			return nil, err
+		}
+	case service.OTPRecovery:
+		if _, err = h.userRepository.UserByEmail(ctx, email); err != nil {
+			if !errors.Is(err, tvoerrors.ErrNotFound) {
+				h.logger.Error("Error getting user", "error", err)
+				return nil, tvoerrors.ErrServerError
+			}
+			// не раскрываем, зарегистрирован ли email
+			return &dto.SendOTPResponse{Message: "Code sent"}, nil
+		}
+	}
+
+	if err = h.otp.SendEmail(ctx, purpose, email, userId); err != nil {
+		if errors.Is(err, tvoerrors.ErrTooManyRequests) {
+			return nil, err
+		}
+		h.logger.Error("Error sending code", "purpose", purpose, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.SendOTPResponse{Message: "Code sent"}, nil
+}
+
+func (h *AuthHandlers) checkEmailFree(ctx context.Context, email string) error {
+	exists, err := h.userRepository.EmailExists(ctx, email)
+	if err != nil && !errors.Is(err, tvoerrors.ErrNotFound) {
+		h.logger.Error("Find email error", "error", err)
+		return tvoerrors.ErrServerError
+	}
+	if exists {
+		return tvoerrors.Wrap(ErrEmailTaken.Error(), tvoerrors.ErrConflict)
+	}
+
+	return nil
+}
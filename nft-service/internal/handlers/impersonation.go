@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	jwtManager "main/internal/lib/jwt"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/internal/service"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var ErrImpersonatePrivileged = tvoerrors.Wrap("users managing accounts or having more permissions can't be impersonated",
+	tvoerrors.ErrForbidden)
+
+// ImpersonationHandlers
+type ImpersonationHandlers struct {
+	logger         *logger.Logger
+	jwt            *jwtManager.JWTManager
+	userRepository repository.UserRepository
+	permissions    *service.PermissionService
+	auditLog       *service.AuditLog
+	ttl            time.Duration
+}
+
+// NewImpersonationHandlers конструктор для обработчиков входа администратора под пользователем
+func NewImpersonationHandlers(logger *logger.Logger, jwt *jwtManager.JWTManager, userRepository repository.UserRepository,
+	permissions *service.PermissionService, auditLog *service.AuditLog, ttl time.Duration) *ImpersonationHandlers {
+	return &ImpersonationHandlers{
+		logger:         logger,
+		jwt:            jwt,
+		userRepository: userRepository,
+		permissions:    permissions,
+		auditLog:       auditLog,
+		ttl:            ttl,
+	}
+}
+
+// Impersonate issues a short-lived access token of a user to support staff
+// Requires the users:impersonate permission. Users managing accounts or having permissions the admin lacks
+// can't be impersonated. The token carries the admin in the act claim, every request made with it is audited
+// and logout, credential, MFA, session, profile and content changes are forbidden.
+// The token stops working once the admin is no longer allowed to impersonate the user, e.g. after a role change.
+// @Summary Log in as a user
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body dto.ImpersonateRequest true "Request body"
+// @Success 200 {object} dto.ImpersonateResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/users/{id}/impersonate [post]
+func (h *ImpersonationHandlers) Impersonate(c *fiber.Ctx) (interface{}, error) {
+	var request dto.ImpersonateRequest
+
+	adminId, err := httputils.UserIDFromToken(c, "Impersonate", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	userId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil || userId == adminId {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if err = httputils.ParseRequestBody(c, &request, "Impersonate", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Reason == "" {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	user, err := h.userRepository.UserById(c.Context(), userId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	adminRoleId, err := httputils.RoleIDFromToken(c, "Impersonate", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	// под аккаунтом с большими правами можно было бы обойти проверку прав самого администратора
+	allowed, err := h.permissions.CanActAs(c.Context(), tvomodels.RoleId(adminRoleId), tvomodels.RoleId(user.RoleID))
+	if err != nil {
+		h.logger.Error("Error checking permissions", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	if !allowed {
+		h.logger.Warn("impersonation of privileged user denied", "user_id", user.ID, "actor_id", adminId)
+		return nil, ErrImpersonatePrivileged
+	}
+
+	expiresAt := time.Now().Add(h.ttl)
+	token, err := h.jwt.GenerateImpersonation(user, adminId, expiresAt)
+	if err != nil {
+		h.logger.Error("Error creating impersonation token", "user_id", user.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	h.logger.Warn("impersonation started", "user_id", user.ID, "actor_id", adminId, "expires_at", expiresAt)
+	audit(c, h.auditLog, models.AuditUserImpersonate, models.AuditTargetUser, strconv.FormatInt(user.ID, 10), nil,
+		map[string]any{"reason": request.Reason, "expires_at": expiresAt.UTC()})
+
+	return &dto.ImpersonateResponse{
+		AccessToken: token,
+		ExpiresAt:   expiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/internal/service"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var ErrInviteRequired = tvoerrors.Wrap("registration requires an invite code", tvoerrors.ErrForbidden)
+
+// InviteHandlers
+type InviteHandlers struct {
+	logger         *logger.Logger
+	invites        *service.InviteService
+	userRepository repository.UserRepository
+	roleRepository repository.RoleRepository
+	auditLog       *service.AuditLog
+}
+
+// NewInviteHandlers конструктор для обработчиков кодов приглашения
+func NewInviteHandlers(logger *logger.Logger, invites *service.InviteService, userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository, auditLog *service.AuditLog) *InviteHandlers {
+	return &InviteHandlers{
+		logger:         logger,
+		invites:        invites,
+		userRepository: userRepository,
+		roleRepository: roleRepository,
+		auditLog:       auditLog,
+	}
+}
+
+// CreateInvite issues a registration invite code
+// Requires the invites:manage permission. The code may preassign a role not managing users or roles and
+// not having permissions the issuer lacks, users registered with it are credited to the referrer.
+// @Summary Issue invite code
+// @Tags Invites
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.InviteCreateRequest true "Request body"
+// @Success 200 {object} dto.InviteItem
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/auth/invites/ [post]
+func (h *InviteHandlers) CreateInvite(c *fiber.Ctx) (interface{}, error) {
+	var request dto.InviteCreateRequest
+
+	ctx := c.Context()
+
+	adminId, err := httputils.UserIDFromToken(c, "CreateInvite", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+	adminRoleId, err := httputils.RoleIDFromToken(c, "CreateInvite", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	if err = httputils.ParseRequestBody(c, &request, "CreateInvite", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+	if request.MaxUses == 0 {
+		request.MaxUses = 1
+	}
+	if request.ExpiresIn < 0 {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	params := service.InviteParams{
+		Code:       request.Code,
+		MaxUses:    request.MaxUses,
+		ReferrerID: request.ReferrerID,
+		CreatedBy:  adminId,
+		IssuerRole: tvomodels.RoleId(adminRoleId),
+	}
+	roleName := ""
+	if request.Role != "" {
+		role, err := h.roleRepository.RoleByName(ctx, strings.ToLower(request.Role))
+		if err != nil {
+			h.logger.Error("Error getting role", "role", request.Role, "error", err)
+			return nil, tvoerrors.Wrap("unknown role", tvoerrors.ErrInvalidRequestData)
+		}
+		params.RoleID = role.ID
+		roleName = role.Name
+	}
+	if request.ReferrerID != 0 {
+		if _, err = h.userRepository.UserById(ctx, request.ReferrerID); err != nil {
+			if errors.Is(err, tvoerrors.ErrNotFound) {
+				return nil, tvoerrors.ErrNotFound
+			}
+			h.logger.Error("Error getting referrer", "user_id", request.ReferrerID, "error", err)
+			return nil, tvoerrors.ErrServerError
+		}
+	}
+	if request.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+		params.ExpiresAt = &expiresAt
+	}
+
+	invite, err := h.invites.Issue(ctx, params)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			return nil, err
+		}
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, tvoerrors.Wrap("invite code already exists", tvoerrors.ErrConflict)
+		}
+		h.logger.Error("Error issuing invite", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	invite.RoleName = roleName
+	h.logger.Info("Invite issued", "invite_id", invite.ID, "created_by", adminId)
+	audit(c, h.auditLog, models.AuditInviteCreate, models.AuditTargetInvite, strconv.FormatInt(invite.ID, 10), nil,
+		invite)
+
+	return inviteItem(invite), nil
+}
+
+// ListInvites returns all invite codes, newest first
+// Requires the invites:manage permission.
+// @Summary List invite codes
+// @Tags Invites
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.InviteListResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/invites/ [get]
+func (h *InviteHandlers) ListInvites(c *fiber.Ctx) (interface{}, error) {
+	invites, err := h.invites.List(c.Context())
+	if err != nil {
+		h.logger.Error("Error getting invites", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	items := make([]dto.InviteItem, 0, len(invites))
+	for _, invite := range invites {
+		items = append(items, inviteItem(&invite))
+	}
+
+	return &dto.InviteListResponse{
+		Invites: items,
+	}, nil
+}
+
+// RevokeInvite disables an invite code immediately
+// Requires the invites:manage permission. Users registered with the code keep their role and referrer.
+// @Summary Revoke invite code
+// @Tags Invites
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Invite ID"
+// @Success 200 {object} dto.RevokeInviteResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/invites/{id} [delete]
+func (h *InviteHandlers) RevokeInvite(c *fiber.Ctx) (interface{}, error) {
+	inviteId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if err = h.invites.Revoke(c.Context(), inviteId); err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error revoking invite", "invite_id", inviteId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	h.logger.Info("Invite revoked", "invite_id", inviteId)
+	audit(c, h.auditLog, models.AuditInviteRevoke, models.AuditTargetInvite, strconv.FormatInt(inviteId, 10), nil, nil)
+
+	return &dto.RevokeInviteResponse{
+		Message: "Invite revoked",
+	}, nil
+}
+
+// ReferralReport counts users credited to each referrer for commission reports
+// Requires the invites:manage permission. Deleted users are counted until they are purged.
+// @Summary Referral report
+// @Tags Invites
+// @Security ApiKeyAuth
+// @Produce json
+// @Param from query string false "Registered from, RFC 3339, inclusive"
+// @Param to query string false "Registered before, RFC 3339"
+// @Success 200 {object} dto.ReferralReportResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/referrals/ [get]
+func (h *InviteHandlers) ReferralReport(c *fiber.Ctx) (interface{}, error) {
+	var from, to *time.Time
+	for name, field := range map[string]**time.Time{"from": &from, "to": &to} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, tvoerrors.ErrInvalidRequestData
+			}
+			*field = &parsed
+		}
+	}
+
+	stats, err := h.invites.Referrals(c.Context(), from, to)
+	if err != nil {
+		h.logger.Error("Error getting referrals", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	items := make([]dto.ReferralItem, 0, len(stats))
+	for _, stat := range stats {
+		items = append(items, dto.ReferralItem{
+			ReferrerID: stat.ReferrerID,
+			Users:      stat.Users,
+			FirstAt:    stat.FirstAt.Format("2006-01-02 15:04:05"),
+			LastAt:     stat.LastAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return &dto.ReferralReportResponse{
+		Referrals: items,
+	}, nil
+}
+
+func inviteItem(invite *models.Invite) dto.InviteItem {
+	item := dto.InviteItem{
+		ID:         invite.ID,
+		Code:       invite.Code,
+		Role:       invite.RoleName,
+		MaxUses:    invite.MaxUses,
+		Uses:       invite.Uses,
+		ReferrerID: invite.ReferrerID,
+		CreatedBy:  invite.CreatedBy,
+		CreatedAt:  invite.CreatedAt.Format("2006-01-02 15:04:05"),
+		Revoked:    invite.RevokedAt != nil,
+	}
+	if invite.ExpiresAt != nil {
+		item.ExpiresAt = invite.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+	return item
+}
+
+// inviteCode checks the invite code of a registration and returns it as stored, empty without a code
+func (h *AuthHandlers) inviteCode(ctx context.Context, code string) (string, error) {
+	if strings.TrimSpace(code) == "" {
+		if h.inviteOnly {
+			return "", ErrInviteRequired
+		}
+		return "", nil
+	}
+
+	invite, err := h.invites.Check(ctx, code)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInvite) {
+			h.logger.Warn("Invalid invite code", "error", err)
+			return "", err
+		}
+		h.logger.Error("Error checking invite", "error", err)
+		return "", tvoerrors.ErrServerError
+	}
+
+	return invite.Code, nil
+}
@@ -1,21 +1,26 @@
 package handlers
 
 import (
+	"io"
+
 	"github.com/gofiber/fiber/v2"
+
+	"main/internal/models"
 	"main/internal/service"
 	"main/tools/pkg/logger"
-	"io"
 )
 
 // KuboHandlers
 type KuboHandlers struct {
-	logger *logger.Logger
+	logger   *logger.Logger
+	auditLog *service.AuditLog
 }
 
 // NewAuthHandlers конструктор для обработчиков IDM методов
-func NewKuboHandlers(logger *logger.Logger) *KuboHandlers {
+func NewKuboHandlers(logger *logger.Logger, auditLog *service.AuditLog) *KuboHandlers {
 	return &KuboHandlers{
-		logger: logger,
+		logger:   logger,
+		auditLog: auditLog,
 	}
 }
 
@@ -62,7 +67,7 @@ func UploadFileHandler(c *fiber.Ctx) error {
 }
 
 // PinCidHandler обрабатывает закрепление CID.
-func PinCidHandler(c *fiber.Ctx) error {
+func (h *KuboHandlers) PinCidHandler(c *fiber.Ctx) error {
 	cid := c.Params("cid")
 	if cid == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "CID не указан"})
@@ -72,12 +77,13 @@ func PinCidHandler(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	audit(c, h.auditLog, models.AuditPinAdd, models.AuditTargetPin, cid, nil, nil)
 
 	return c.JSON(pinResponse)
 }
 
 // UnpinCidHandler обрабатывает открепление CID.
-func UnpinCidHandler(c *fiber.Ctx) error {
+func (h *KuboHandlers) UnpinCidHandler(c *fiber.Ctx) error {
 	cid := c.Params("cid")
 	if cid == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "CID не указан"})
@@ -87,6 +93,7 @@ func UnpinCidHandler(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	audit(c, h.auditLog, models.AuditPinRemove, models.AuditTargetPin, cid, nil, nil)
 
 	return c.JSON(unpinResponse)
 }
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/service"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// LoginMFA completes the login with the second factor and issues tokens
+// @Summary Complete login with the second factor
+// @Description Accepts a TOTP code or a recovery code for the MFA token returned by login.
+// @Description When the login enrolled 2FA, the first code confirms it and recovery codes are returned once.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.LoginMFARequest true "Request body"
+// @Success 200 {object} dto.LoginMFAResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /v1/auth/login/mfa/ [post]
+func (h *AuthHandlers) LoginMFA(c *fiber.Ctx) (interface{}, error) {
+	var request dto.LoginMFARequest
+
+	ctx := c.Context()
+
+	if err := httputils.ParseRequestBody(c, &request, "LoginMFA", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if err := h.throttle.Allow(ctx, "login_mfa", c.IP(), ""); err != nil {
+		h.logger.Error("Login mfa throttled", "ip", c.IP(), "error", err)
+		return nil, err
+	}
+
+	userId, err := h.mfa.ChallengeUser(ctx, request.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepository.UserById(ctx, userId)
+	if err != nil {
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	if user.Locked(time.Now()) {
+		h.logger.Error("Account locked", "user_id", user.ID, "locked_until", *user.LockedUntil)
+		return nil, ErrAccountLocked
+	}
+
+	_, recoveryCodes, err := h.mfa.CompleteChallenge(ctx, request.MFAToken, request.Code)
+	if err != nil {
+		// неверные коды считаются неудачными входами, как и неверный пароль
+		if errors.Is(err, service.ErrMFAInvalidCode) || errors.Is(err, service.ErrMFAAttempts) {
+			h.loginFailed(ctx, user)
+		}
+		h.logger.Error("Invalid mfa code", "user_id", user.ID, "error", err)
+		return nil, err
+	}
+
+	if err = h.throttle.Reset(ctx, user.LoginID()); err != nil {
+		h.logger.Error("Error reset failed logins", "user_id", user.ID, "error", err)
+	}
+
+	userToken, err := h.issueTokens(c, user)
+	if err != nil {
+		h.logger.Error("Error creating token", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.LoginMFAResponse{
+		AccessToken:   userToken.Token,
+		RefreshToken:  userToken.RefreshToken,
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// EnrollMFAOnLogin generates a TOTP secret for a user whose role requires 2FA which is not enrolled yet
+// @Summary Enroll 2FA during login
+// @Description The secret is confirmed by the first code passed to /login/mfa/ with the same MFA token.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.MFAChallengeRequest true "Request body"
+// @Success 200 {object} dto.MFAEnrollResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/auth/login/mfa/enroll/ [post]
+func (h *AuthHandlers) EnrollMFAOnLogin(c *fiber.Ctx) (interface{}, error) {
+	var request dto.MFAChallengeRequest
+
+	ctx := c.Context()
+
+	if err := httputils.ParseRequestBody(c, &request, "EnrollMFAOnLogin", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	userId, err := h.mfa.ChallengeUser(ctx, request.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepository.UserById(ctx, userId)
+	if err != nil {
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return h.enrollMFA(c, user.ID, user.LoginID())
+}
+
+// EnrollMFA generates a TOTP secret for the current user
+// @Summary Enroll 2FA
+// @Description The secret is confirmed by the first code passed to /mfa/confirm/.
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.MFAEnrollResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/auth/mfa/enroll/ [post]
+func (h *AuthHandlers) EnrollMFA(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "EnrollMFA", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	// в токене нет идентификатора входа для аккаунтов из Telegram, берем его у пользователя
+	user, err := h.userRepository.UserById(c.Context(), userId)
+	if err != nil {
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return h.enrollMFA(c, user.ID, user.LoginID())
+}
+
+// ConfirmMFA enables the enrolled secret with the first code and returns recovery codes
+// @Summary Confirm 2FA
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "Request body"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/mfa/confirm/ [post]
+func (h *AuthHandlers) ConfirmMFA(c *fiber.Ctx) (interface{}, error) {
+	var request dto.MFACodeRequest
+
+	if err := httputils.ParseRequestBody(c, &request, "ConfirmMFA", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	userId, err := httputils.UserIDFromToken(c, "ConfirmMFA", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	recoveryCodes, err := h.mfa.Confirm(c.Context(), userId, request.Code)
+	if err != nil {
+		h.logger.Error("Error confirm mfa", "user_id", userId, "error", err)
+		return nil, err
+	}
+
+	return &dto.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// DisableMFA removes 2FA of the current user
+// Not allowed for roles which require 2FA.
+// @Summary Disable 2FA
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "Request body"
+// @Success 200 {object} dto.DisableMFAResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/mfa/disable/ [post]
+func (h *AuthHandlers) DisableMFA(c *fiber.Ctx) (interface{}, error) {
+	var request dto.MFACodeRequest
+
+	if err := httputils.ParseRequestBody(c, &request, "DisableMFA", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	tokenData, err := httputils.GetTokenDataFromCtx(httputils.CtxWithAuthToken(c))
+	if err != nil {
+		h.logger.Error("Failed to get token data", "error", err)
+		return nil, tvoerrors.ErrCastClaims
+	}
+	if h.mfa.Required(models.RoleId(tokenData.UserRoleID)) {
+		return nil, service.ErrMFARequiredForRole
+	}
+
+	if err = h.mfa.Disable(c.Context(), tokenData.UserID, request.Code); err != nil {
+		h.logger.Error("Error disable mfa", "user_id", tokenData.UserID, "error", err)
+		return nil, err
+	}
+
+	return &dto.DisableMFAResponse{
+		Message: "Two-factor authentication disabled",
+	}, nil
+}
+
+// RegenerateRecoveryCodes replaces recovery codes of the current user
+// @Summary Regenerate 2FA recovery codes
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "Request body"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/mfa/recovery_codes/ [post]
+func (h *AuthHandlers) RegenerateRecoveryCodes(c *fiber.Ctx) (interface{}, error) {
+	var request dto.MFACodeRequest
+
+	if err := httputils.ParseRequestBody(c, &request, "RegenerateRecoveryCodes", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	userId, err := httputils.UserIDFromToken(c, "RegenerateRecoveryCodes", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	recoveryCodes, err := h.mfa.RegenerateRecoveryCodes(c.Context(), userId, request.Code)
+	if err != nil {
+		h.logger.Error("Error regenerate recovery codes", "user_id", userId, "error", err)
+		return nil, err
+	}
+
+	return &dto.RecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+func (h *AuthHandlers) enrollMFA(c *fiber.Ctx, userId int64, account string) (*dto.MFAEnrollResponse, error) {
+	enrollment, err := h.mfa.Enroll(c.Context(), userId, account)
+	if err != nil {
+		h.logger.Error("Error enroll mfa", "user_id", userId, "error", err)
+		if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+			return nil, err
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.MFAEnrollResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+		QRCode: base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	}, nil
+}
@@ -1,17 +1,23 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"main/internal/dto"
+	"main/internal/lib/gads"
+	"main/internal/lib/tron"
 	"main/internal/repository"
 	"main/internal/service"
+	httpmiddlewares "main/tools/pkg/http_middlewares"
 	httputils "main/tools/pkg/http_utils"
 	"main/tools/pkg/logger"
 	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
 	"strconv"
 	"main/internal/models"
 )
@@ -20,16 +26,28 @@ const publicAPIBaseURL = "http://45.140.147.83:3010"
 
 // NftHandlers
 type NftHandlers struct {
-	logger             *logger.Logger
-	nftDataRepository  repository.NftDataRepository
-	nftImageRepository repository.NftImageRepository
+	logger              *logger.Logger
+	nftDataRepository   repository.NftDataRepository
+	nftImageRepository  repository.NftImageRepository
+	ownershipRepository repository.OwnershipRepository
+	contract            *gads.Caller
+	permissions         *service.PermissionService
+	auditLog            *service.AuditLog
 }
 
-func NewNftHandlers(logger *logger.Logger, nftRepository repository.NftDataRepository, nftImageRepository repository.NftImageRepository) *NftHandlers {
+var ErrChainDisabled = errors.New("contract address is not configured")
+
+func NewNftHandlers(logger *logger.Logger, nftRepository repository.NftDataRepository, nftImageRepository repository.NftImageRepository,
+	ownershipRepository repository.OwnershipRepository, contract *gads.Caller, permissions *service.PermissionService,
+	auditLog *service.AuditLog) *NftHandlers {
 	return &NftHandlers{
-		logger:             logger,
-		nftDataRepository:  nftRepository,
-		nftImageRepository: nftImageRepository,
+		logger:              logger,
+		nftDataRepository:   nftRepository,
+		nftImageRepository:  nftImageRepository,
+		ownershipRepository: ownershipRepository,
+		contract:            contract,
+		permissions:         permissions,
+		auditLog:            auditLog,
 	}
 }
 
@@ -52,7 +70,7 @@ func (h *NftHandlers) CreateNftData(c *fiber.Ctx) (interface{}, error) {
 	
 	// Set default description if empty
 	if description == "" {
-		description = "GOOGLE ADS ACCOUNT STORE"
+		description = models.DefaultNftDescription
 	}
 
 	// Шаг 3: Теперь, когда тело запроса не "потреблено", получаем файл.
@@ -79,16 +97,13 @@ func (h *NftHandlers) CreateNftData(c *fiber.Ctx) (interface{}, error) {
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
 
+	// право nft:create проверяется в роутинге
 	ctx := httputils.CtxWithAuthToken(c)
-	roleId, err := httputils.RoleIDFromToken(c, "CreateNftData", h.logger)
+	userId, err := httputils.UserIDFromToken(c, "CreateNftData", h.logger)
 	if err != nil {
 		return nil, tvoerrors.ErrCastClaims
 	}
 
-	if roleId != 100 {
-		log.Error("Wrong user role")
-		return nil, tvoerrors.ErrForbidden
-	}
 	isExist, err := h.nftDataRepository.TokenIdExists(ctx, tokenId)
 	if err != nil {
 		log.Error("Error accessing to DB", "error", err)
@@ -111,6 +126,7 @@ func (h *NftHandlers) CreateNftData(c *fiber.Ctx) (interface{}, error) {
 		CidV1:       cidV1,
 		FileName:    addResponse.Name,
 		FileSize:    addResponse.Size,
+		CreatedBy:   userId,
 	}
 
 	err = h.nftDataRepository.CreateNftData(ctx, nftData)
@@ -130,6 +146,7 @@ func (h *NftHandlers) CreateNftData(c *fiber.Ctx) (interface{}, error) {
 		log.Error("Error creating nft image", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
 	}
+	audit(c, h.auditLog, models.AuditNftCreate, models.AuditTargetNft, strId, nil, nftData)
 
 	return &dto.CreateNftDataResponse{
 		Message: "NFT data created successful",
@@ -164,7 +181,7 @@ func (h *NftHandlers) ReadNft(c *fiber.Ctx) (interface{}, error) {
 	// Set default description if empty
 	description := nft.Description
 	if description == "" {
-		description = "GOOGLE ADS ACCOUNT STORE"
+		description = models.DefaultNftDescription
 	}
 	
 	return &dto.ReadNftResponse{
@@ -175,6 +192,7 @@ func (h *NftHandlers) ReadNft(c *fiber.Ctx) (interface{}, error) {
 		CidV1:         nft.CidV1,
 		Image:         fmt.Sprintf("%s/v1/api/nft/image/%d", publicAPIBaseURL, nft.TokenId),
 		IpfsImageLink: fmt.Sprintf(service.KuboGatewayUrlTemplate, nft.CidV1),
+		Burned:        nft.BurnedAt != nil,
 	}, nil
 }
 
@@ -193,7 +211,24 @@ func (h *NftHandlers) ReadAllNft(c *fiber.Ctx) (interface{}, error) {
 
 	ctx := c.Context()
 
-	nfts, err := h.nftDataRepository.ReadAllNftData(ctx, int(limit))
+	// burned tokens are listed only with the nft:read_burned permission
+	includeBurned := c.QueryBool("include_burned")
+	if includeBurned {
+		roleId, err := httputils.RoleIDFromToken(c, "ReadAllNft", h.logger)
+		if err != nil {
+			return nil, tvoerrors.ErrForbidden
+		}
+		allowed, err := h.permissions.Can(ctx, tvomodels.RoleId(roleId), models.PermNftReadBurned)
+		if err != nil {
+			log.Error("Error check permission", "error", err)
+			return nil, tvoerrors.ErrServerError
+		}
+		if !allowed {
+			return nil, tvoerrors.ErrForbidden
+		}
+	}
+
+	nfts, err := h.nftDataRepository.ReadAllNftData(ctx, int(limit), includeBurned)
 	if err != nil {
 		log.Error("Error accessing to DB", "error", err)
 		return nil, status.Error(codes.Internal, "something went wrong") //nolint
@@ -205,7 +240,7 @@ func (h *NftHandlers) ReadAllNft(c *fiber.Ctx) (interface{}, error) {
 			// Set default description if empty
 			description := nft.Description
 			if description == "" {
-				description = "GOOGLE ADS ACCOUNT STORE"
+				description = models.DefaultNftDescription
 			}
 			
 			infos = append(infos, dto.NftInfo{
@@ -216,6 +251,7 @@ func (h *NftHandlers) ReadAllNft(c *fiber.Ctx) (interface{}, error) {
 				CidV1:         nft.CidV1,
 				Image:         fmt.Sprintf("%s/v1/api/nft/image/%d", publicAPIBaseURL, nft.TokenId),
 				IpfsImageLink: fmt.Sprintf(service.KuboGatewayUrlTemplate, nft.CidV1),
+				Burned:        nft.BurnedAt != nil,
 			})
 		}
 	}
@@ -253,3 +289,73 @@ func (h *NftHandlers) ReadNftImage(c *fiber.Ctx) error {
 	c.Set("Content-Type", image.ContentType)
 	return c.Send(image.ImageData)
 }
+
+// CheckOwnership checks via the indexed ownership tables if the user holds the token
+// (or any token of the collection for httpmiddlewares.AnyToken)
+func (h *NftHandlers) CheckOwnership(ctx context.Context, userId, tokenId int64) (bool, error) {
+	if tokenId == httpmiddlewares.AnyToken {
+		return h.ownershipRepository.UserOwnsAny(ctx, userId)
+	}
+	return h.ownershipRepository.UserOwnsToken(ctx, userId, tokenId)
+}
+
+// HolderCheck returns the indexed owner of the token; reachable only by the holder
+func (h *NftHandlers) HolderCheck(c *fiber.Ctx) (interface{}, error) {
+	tokenId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Error("Error parsing nft id", "error", err)
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	owner, err := h.ownershipRepository.OwnerOf(c.Context(), tokenId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		log.Error("Error accessing to DB", "error", err)
+		return nil, status.Error(codes.Internal, "something went wrong") //nolint
+	}
+
+	return &dto.HolderResponse{
+		TokenId:      owner.TokenId,
+		OwnerAddress: owner.OwnerAddress,
+		IsHolder:     true,
+	}, nil
+}
+
+// ReadNftOnChain returns the owner and the metadata URI of the token read directly from the contract
+func (h *NftHandlers) ReadNftOnChain(c *fiber.Ctx) (interface{}, error) {
+	tokenId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil || tokenId <= 0 {
+		log.Error("Error parsing nft id", "error", err)
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if h.contract == nil {
+		return nil, ErrChainDisabled
+	}
+
+	ctx := c.Context()
+
+	owner, err := h.contract.OwnerOf(ctx, tokenId)
+	if err != nil {
+		if errors.Is(err, tron.ErrReverted) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		log.Error("Error calling ownerOf", "token_id", tokenId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	tokenURI, err := h.contract.TokenURI(ctx, tokenId)
+	if err != nil {
+		log.Error("Error calling tokenURI", "token_id", tokenId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.ChainNftResponse{
+		TokenId:         tokenId,
+		ContractAddress: h.contract.Contract().Base58(),
+		OwnerAddress:    owner.Base58(),
+		TokenURI:        tokenURI,
+	}, nil
+}
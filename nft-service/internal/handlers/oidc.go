@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/service"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var ErrIdentityTaken = tvoerrors.Wrap("identity is linked to another user", tvoerrors.ErrConflict)
+
+// StartOIDC returns the provider page to log in with
+// @Summary Log in with an OpenID provider
+// @Description Returns the authorization URL of the provider, e.g. google. The provider redirects back
+// @Description with code and state which are passed to /oidc/{provider}/callback/.
+// @Tags Authentication
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.OIDCStartResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /v1/auth/oidc/{provider}/ [get]
+func (h *AuthHandlers) StartOIDC(c *fiber.Ctx) (interface{}, error) {
+	if err := h.throttle.Allow(c.Context(), "oidc", c.IP(), ""); err != nil {
+		h.logger.Error("OIDC login throttled", "ip", c.IP(), "error", err)
+		return nil, err
+	}
+
+	return h.startOIDC(c, 0)
+}
+
+// LinkOIDC returns the provider page to link an identity to the current user
+// @Summary Link an OpenID provider identity
+// @Description The callback links the identity instead of logging in, afterwards the user can log in with the provider.
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.OIDCStartResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/oidc/{provider}/link/ [post]
+func (h *AuthHandlers) LinkOIDC(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "LinkOIDC", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	return h.startOIDC(c, userId)
+}
+
+// OIDCCallback completes the authorization at the provider
+// @Summary Complete OpenID provider login
+// @Description An unknown identity is linked to the user with the same verified email, otherwise a new user is created.
+// @Description With two-factor authentication an MFA token is returned instead of tokens, see /login/mfa/.
+// @Description A callback of /link/ must be sent with the token of the user who started linking.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param request body dto.OIDCCallbackRequest true "Request body"
+// @Success 200 {object} dto.OIDCCallbackResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/auth/oidc/{provider}/callback/ [post]
+func (h *AuthHandlers) OIDCCallback(c *fiber.Ctx) (interface{}, error) {
+	var request dto.OIDCCallbackRequest
+
+	ctx := c.Context()
+
+	if err := httputils.ParseRequestBody(c, &request, "OIDCCallback", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if err := h.throttle.Allow(ctx, "oidc", c.IP(), ""); err != nil {
+		h.logger.Error("OIDC callback throttled", "ip", c.IP(), "error", err)
+		return nil, err
+	}
+
+	// маршрут публичный, токен есть только у колбэка привязки
+	var callerId int64
+	if tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData); ok && !tokenData.Impersonated() {
+		callerId = tokenData.UserID
+	}
+
+	result, err := h.oidc.Finish(ctx, c.Params("provider"), request.State, request.Code, callerId)
+	if err != nil {
+		h.logger.Error("OIDC authorization failed", "provider", c.Params("provider"), "error", err)
+		if errors.Is(err, tvoerrors.ErrNotFound) || errors.Is(err, tvoerrors.ErrUnauthorized) ||
+			errors.Is(err, tvoerrors.ErrForbidden) {
+			return nil, err
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	identity := &models.UserIdentity{
+		UserID:   result.UserID,
+		Provider: result.Provider,
+		Subject:  result.Claims.Subject,
+		Email:    strings.ToLower(result.Claims.Email),
+	}
+
+	if result.UserID != 0 {
+		if err = h.linkIdentity(ctx, identity); err != nil {
+			return nil, err
+		}
+		return &dto.OIDCCallbackResponse{Linked: true}, nil
+	}
+
+	user, err := h.identityUser(ctx, identity, result.Claims.EmailVerified)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Locked(time.Now()) {
+		h.logger.Error("Account locked", "user_id", user.ID, "locked_until", *user.LockedUntil)
+		return nil, ErrAccountLocked
+	}
+
+	challenge, err := h.startMFA(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &dto.OIDCCallbackResponse{LoginResponse: *challenge}, nil
+	}
+
+	userToken, err := h.issueTokens(c, user)
+	if err != nil {
+		h.logger.Error("Error creating token", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.OIDCCallbackResponse{
+		LoginResponse: dto.LoginResponse{
+			AccessToken:  userToken.Token,
+			RefreshToken: userToken.RefreshToken,
+		},
+	}, nil
+}
+
+func (h *AuthHandlers) startOIDC(c *fiber.Ctx, userId int64) (*dto.OIDCStartResponse, error) {
+	authURL, err := h.oidc.Start(c.Context(), c.Params("provider"), userId)
+	if err != nil {
+		h.logger.Error("Error start oidc", "provider", c.Params("provider"), "error", err)
+		if errors.Is(err, service.ErrOIDCUnknownProvider) {
+			return nil, err
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.OIDCStartResponse{
+		AuthURL: authURL,
+	}, nil
+}
+
+// linkIdentity attaches the identity to identity.UserID, linking the same identity twice is not an error
+func (h *AuthHandlers) linkIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	err := h.identities.Link(ctx, identity)
+	if errors.Is(err, tvoerrors.ErrConflict) {
+		existing, findErr := h.identities.ByProviderSubject(ctx, identity.Provider, identity.Subject)
+		if findErr == nil && existing.UserID == identity.UserID {
+			return nil
+		}
+		return ErrIdentityTaken
+	}
+	if err != nil {
+		h.logger.Error("Error link identity", "user_id", identity.UserID, "provider", identity.Provider, "error", err)
+		return tvoerrors.ErrServerError
+	}
+
+	return nil
+}
+
+// identityUser finds the user of the identity. An unknown identity is linked to the user with the same
+// verified email, the provider has to report the email as verified too. Otherwise a new user is created.
+func (h *AuthHandlers) identityUser(ctx context.Context, identity *models.UserIdentity, emailVerified bool) (*models.User, error) {
+	existing, err := h.identities.ByProviderSubject(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		return h.userById(ctx, existing.UserID)
+	case !errors.Is(err, tvoerrors.ErrNotFound):
+		h.logger.Error("Error getting identity", "provider", identity.Provider, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	email := ""
+	if emailVerified && identity.Email != "" {
+		user, err := h.userRepository.UserByEmail(ctx, identity.Email)
+		switch {
+		case err == nil:
+			identity.UserID = user.ID
+			if err = h.linkIdentity(ctx, identity); err != nil {
+				return nil, err
+			}
+			h.logger.Info("Identity linked by email", "user_id", user.ID, "provider", identity.Provider)
+			return user, nil
+		case !errors.Is(err, tvoerrors.ErrNotFound):
+			h.logger.Error("Error getting user by email", "error", err)
+			return nil, tvoerrors.ErrServerError
+		}
+
+		// адрес может быть подтвержден у удаленного аккаунта, тогда новый аккаунт создается без email.
+		// неподтвержденный адрес другого аккаунта освобождается при создании
+		exists, err := h.userRepository.EmailExists(ctx, identity.Email)
+		if err != nil && !errors.Is(err, tvoerrors.ErrNotFound) {
+			h.logger.Error("Find email error", "error", err)
+			return nil, tvoerrors.ErrServerError
+		}
+		if !exists {
+			email = identity.Email
+		}
+	}
+
+	if h.inviteOnly {
+		h.logger.Warn("Identity registration without invite", "provider", identity.Provider)
+		return nil, ErrInviteRequired
+	}
+
+	user, err := h.identities.CreateUser(ctx, email, identity)
+	if errors.Is(err, tvoerrors.ErrConflict) {
+		// параллельный вход уже создал пользователя
+		if existing, err = h.identities.ByProviderSubject(ctx, identity.Provider, identity.Subject); err == nil {
+			return h.userById(ctx, existing.UserID)
+		}
+	}
+	if err != nil {
+		h.logger.Error("Error creating user by identity", "provider", identity.Provider, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	h.logger.Info("User created by identity", "user_id", user.ID, "provider", identity.Provider)
+
+	return user, nil
+}
+
+func (h *AuthHandlers) userById(ctx context.Context, userId int64) (*models.User, error) {
+	user, err := h.userRepository.UserById(ctx, userId)
+	if err != nil {
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	return user, nil
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/service"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+	"main/tools/validator"
+)
+
+// maxAvatarSize limits avatar uploads
+const maxAvatarSize = 2 << 20
+
+// avatarTypes are the image types accepted as avatars, detected by content
+var avatarTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true}
+
+var ErrInvalidAvatar = tvoerrors.Wrap("avatar must be a png, jpeg, gif or webp image up to 2 MB", tvoerrors.ErrInvalidRequestData)
+
+// GetMe returns the account of the current user
+// @Summary My account
+// @Description Returns contacts, role and profile of the current user. Wallets are linked separately and are read only here.
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.MeResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/me [get]
+func (h *AuthHandlers) GetMe(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "GetMe", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	return h.me(c, userId)
+}
+
+// UpdateMe changes the profile of the current user
+// @Summary Update my profile
+// @Description Omitted fields are kept, an empty value clears the field. The locale is a BCP 47 tag like ru or en-US.
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.UpdateMeRequest true "Request body"
+// @Success 200 {object} dto.MeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/me [patch]
+func (h *AuthHandlers) UpdateMe(c *fiber.Ctx) (interface{}, error) {
+	var request dto.UpdateMeRequest
+
+	userId, err := httputils.UserIDFromToken(c, "UpdateMe", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	if err = httputils.ParseRequestBody(c, &request, "UpdateMe", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if request.DisplayName != nil {
+		*request.DisplayName = strings.TrimSpace(*request.DisplayName)
+		if err = validator.ValidDisplayName(*request.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+	if request.Locale != nil && *request.Locale != "" {
+		if err = validator.ValidLocale(*request.Locale); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := c.Context()
+	if err = h.userRepository.UpdateProfile(ctx, userId, request.DisplayName, request.Locale); err != nil {
+		h.logger.Error("Error updating profile", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return h.me(c, userId)
+}
+
+// UploadAvatar stores the avatar of the current user on IPFS
+// @Summary Upload my avatar
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Image, png, jpeg, gif or webp up to 2 MB"
+// @Success 200 {object} dto.MeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/me/avatar [post]
+func (h *AuthHandlers) UploadAvatar(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "UploadAvatar", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	file, err := c.FormFile("avatar")
+	if err != nil || file.Size > maxAvatarSize {
+		return nil, ErrInvalidAvatar
+	}
+	opened, err := file.Open()
+	if err != nil {
+		h.logger.Error("Error opening avatar", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	defer func() { _ = opened.Close() }()
+
+	image, err := io.ReadAll(io.LimitReader(opened, maxAvatarSize+1))
+	if err != nil {
+		h.logger.Error("Error reading avatar", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	// тип определяется по содержимому, заголовку клиента не доверяем
+	contentType := http.DetectContentType(image)
+	if len(image) > maxAvatarSize || !avatarTypes[contentType] {
+		return nil, ErrInvalidAvatar
+	}
+
+	_, cid, _, err := service.AddFileToIPFS(image, fmt.Sprintf("avatar_%d", userId))
+	if err != nil {
+		h.logger.Error("Error uploading avatar to IPFS", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	// прежний аватар не открепляется: тот же CID может принадлежать токену или другому пользователю
+	ctx := c.Context()
+	if err = h.userRepository.SetAvatar(ctx, userId, cid); err != nil {
+		h.logger.Error("Error saving avatar", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return h.me(c, userId)
+}
+
+// DeleteAvatar removes the avatar of the current user
+// @Summary Remove my avatar
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.MeResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/me/avatar [delete]
+func (h *AuthHandlers) DeleteAvatar(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "DeleteAvatar", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	ctx := c.Context()
+	if err = h.userRepository.SetAvatar(ctx, userId, ""); err != nil {
+		h.logger.Error("Error removing avatar", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return h.me(c, userId)
+}
+
+func (h *AuthHandlers) me(c *fiber.Ctx, userId int64) (*dto.MeResponse, error) {
+	ctx := c.Context()
+
+	user, err := h.userRepository.UserById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error getting user", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	role, err := h.roleRepository.RoleById(ctx, int64(user.RoleID))
+	if err != nil {
+		h.logger.Error("Error getting role", "role_id", user.RoleID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	response := meResponse(user, role)
+	if tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData); ok {
+		response.ImpersonatedBy = tokenData.ActorID
+	}
+	return response, nil
+}
+
+func meResponse(user *models.User, role *models.Role) *dto.MeResponse {
+	response := &dto.MeResponse{
+		UserID:        user.ID,
+		Phone:         user.Phone,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		TelegramID:    user.TelegramID,
+		Role:          role.Name,
+		UserProfile:   user.Profile,
+	}
+	if user.Profile.AvatarCID != "" {
+		response.AvatarURL = fmt.Sprintf(service.KuboGatewayUrlTemplate, user.Profile.AvatarCID)
+	}
+	return response
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// ListSessions returns active sessions (devices) of the current user
+// @Summary List my sessions
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.SessionListResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/sessions/ [get]
+func (h *AuthHandlers) ListSessions(c *fiber.Ctx) (interface{}, error) {
+	ctx := httputils.CtxWithAuthToken(c)
+
+	tokenData, err := httputils.GetTokenDataFromCtx(ctx)
+	if err != nil {
+		h.logger.Error("Failed to get token data", "error", err)
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	// текущая сессия определяется по семейству токена запроса
+	currentFamily := ""
+	if userToken, err := h.tokenRepository.GetUserIdByToken(ctx, tokenData.RawToken); err == nil {
+		currentFamily = userToken.FamilyID
+	}
+
+	return h.listSessions(ctx, tokenData.UserID, currentFamily)
+}
+
+// RevokeSession logs the current user out of a single device
+// @Summary Revoke my session
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Session ID"
+// @Success 200 {object} dto.RevokeSessionResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/sessions/{id} [delete]
+func (h *AuthHandlers) RevokeSession(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "RevokeSession", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	sessionId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	return h.revokeSession(c.Context(), userId, sessionId)
+}
+
+// ListUserSessions returns active sessions of any user
+// Requires the users:list permission.
+// @Summary List user sessions
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} dto.SessionListResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Router /v1/auth/users/{id}/sessions [get]
+func (h *AuthHandlers) ListUserSessions(c *fiber.Ctx) (interface{}, error) {
+	userId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	return h.listSessions(c.Context(), userId, "")
+}
+
+// RevokeUserSession logs any user out of a single device
+// Requires the users:manage permission.
+// @Summary Revoke user session
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "User ID"
+// @Param sid path int true "Session ID"
+// @Success 200 {object} dto.RevokeSessionResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /v1/auth/users/{id}/sessions/{sid} [delete]
+func (h *AuthHandlers) RevokeUserSession(c *fiber.Ctx) (interface{}, error) {
+	userId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+	sessionId, err := strconv.ParseInt(c.Params("sid"), 10, 64)
+	if err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	return h.revokeSession(c.Context(), userId, sessionId)
+}
+
+func (h *AuthHandlers) listSessions(ctx context.Context, userId int64, currentFamily string) (*dto.SessionListResponse, error) {
+	sessions, err := h.sessions.ActiveByUser(ctx, userId)
+	if err != nil {
+		h.logger.Error("Error getting sessions", "user_id", userId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	items := make([]dto.SessionItem, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, sessionItem(&session, currentFamily))
+	}
+
+	return &dto.SessionListResponse{
+		Sessions: items,
+	}, nil
+}
+
+func (h *AuthHandlers) revokeSession(ctx context.Context, userId, sessionId int64) (*dto.RevokeSessionResponse, error) {
+	session, err := h.sessions.ActiveByID(ctx, userId, sessionId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		h.logger.Error("Error getting session", "session_id", sessionId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	if err = h.revokeFamily(ctx, session.FamilyID); err != nil {
+		h.logger.Error("Error revoking session tokens", "session_id", sessionId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	if err = h.sessions.Revoke(ctx, session.ID); err != nil {
+		h.logger.Error("Error revoking session", "session_id", sessionId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.RevokeSessionResponse{
+		Message: "Session revoked",
+	}, nil
+}
+
+func sessionItem(session *models.UserSession, currentFamily string) dto.SessionItem {
+	return dto.SessionItem{
+		ID:         session.ID,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt.Format("2006-01-02 15:04:05"),
+		LastUsedAt: session.LastUsedAt.Format("2006-01-02 15:04:05"),
+		Current:    currentFamily != "" && session.FamilyID == currentFamily,
+	}
+}
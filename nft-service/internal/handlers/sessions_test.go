@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// memorySessions keeps sessions like the repository: a session is active while its family has an unused refresh token
+type memorySessions struct {
+	tokens   *memoryTokens
+	sessions []*models.UserSession
+}
+
+func (m *memorySessions) active(session *models.UserSession) bool {
+	if session.RevokedAt != nil {
+		return false
+	}
+	for _, userToken := range m.tokens.tokens {
+		if userToken.FamilyID == session.FamilyID && userToken.RefreshToken != "" && userToken.RotatedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memorySessions) Create(_ context.Context, session *models.UserSession) error {
+	session.ID = int64(len(m.sessions) + 1)
+	session.CreatedAt, session.LastUsedAt = time.Now(), time.Now()
+	m.sessions = append(m.sessions, session)
+	return nil
+}
+
+func (m *memorySessions) Touch(context.Context, string) error {
+	return nil
+}
+
+func (m *memorySessions) TouchMany(context.Context, map[string]time.Time) error {
+	return nil
+}
+
+func (m *memorySessions) ActiveByUser(_ context.Context, userId int64) ([]models.UserSession, error) {
+	sessions := make([]models.UserSession, 0)
+	for _, session := range m.sessions {
+		if session.UserID == userId && m.active(session) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memorySessions) ActiveByID(_ context.Context, userId, id int64) (*models.UserSession, error) {
+	for _, session := range m.sessions {
+		if session.ID == id && session.UserID == userId && m.active(session) {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, tvoerrors.ErrNotFound
+}
+
+func (m *memorySessions) AllByUser(_ context.Context, userId int64) ([]models.UserSession, error) {
+	sessions := make([]models.UserSession, 0)
+	for _, session := range m.sessions {
+		if session.UserID == userId {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memorySessions) Revoke(_ context.Context, id int64) error {
+	for _, session := range m.sessions {
+		if session.ID == id {
+			now := time.Now()
+			session.RevokedAt = &now
+			return nil
+		}
+	}
+	return tvoerrors.ErrNotFound
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	h, tokens, sessions, cacheClient := newTestAuthHandlers(t)
+
+	// вход пользователя: цепочка токенов и сессия устройства
+	login := func(userId int64, familyId, userAgent string) *models.UserSession {
+		userToken, _ := tokens.Create(ctx, userId, familyId, "access-"+familyId, "refresh-"+familyId, time.Minute,
+			time.Hour)
+		_ = cacheClient.Set(ctx, userToken.Token, "{}", time.Minute)
+		session := &models.UserSession{UserID: userId, FamilyID: familyId, UserAgent: userAgent, IP: "10.0.0.1"}
+		_ = sessions.Create(ctx, session)
+		return session
+	}
+	phone := login(7, "phone", "Phone")
+	laptop := login(7, "laptop", "Laptop")
+	foreign := login(8, "foreign", "Tablet")
+	// сессия с отозванным refresh токеном уже не активна
+	expired := login(7, "expired", "Old phone")
+	_ = tokens.RevokeFamily(ctx, expired.FamilyID)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(constants.TOKEN_DATA_KEY, tvomodels.TokenData{UserID: 7, RawToken: "access-phone"})
+		return c.Next()
+	})
+	app.Get("/sessions", httputils.FiberJSONWrapper(h.ListSessions))
+	app.Delete("/sessions/:id", httputils.FiberJSONWrapper(h.RevokeSession))
+	app.Get("/users/:id/sessions", httputils.FiberJSONWrapper(h.ListUserSessions))
+	app.Delete("/users/:id/sessions/:sid", httputils.FiberJSONWrapper(h.RevokeUserSession))
+
+	request := func(method, path string) (int, dto.SessionListResponse) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(method, path, nil))
+		if err != nil {
+			t.Fatalf("%s %s: request error = %v", method, path, err)
+		}
+		var list dto.SessionListResponse
+		if method == fiber.MethodGet && resp.StatusCode == fiber.StatusOK {
+			if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+				t.Fatalf("%s %s: response error = %v", method, path, err)
+			}
+		}
+		return resp.StatusCode, list
+	}
+	sessionPath := func(session *models.UserSession) string {
+		return "/sessions/" + strconv.FormatInt(session.ID, 10)
+	}
+
+	status, list := request(fiber.MethodGet, "/sessions")
+	if status != fiber.StatusOK || len(list.Sessions) != 2 {
+		t.Fatalf("ListSessions() = %d %+v, expected the phone and the laptop", status, list)
+	}
+	for _, item := range list.Sessions {
+		if item.Current != (item.ID == phone.ID) {
+			t.Errorf("ListSessions() session %d current = %v", item.ID, item.Current)
+		}
+	}
+
+	// чужую, неактивную и неизвестную сессию отозвать нельзя
+	for _, path := range []string{sessionPath(foreign), sessionPath(expired), "/sessions/100"} {
+		if status, _ = request(fiber.MethodDelete, path); status != fiber.StatusNotFound {
+			t.Errorf("DELETE %s status = %d, expected %d", path, status, fiber.StatusNotFound)
+		}
+	}
+	if status, _ = request(fiber.MethodDelete, "/sessions/laptop"); status != fiber.StatusBadRequest {
+		t.Errorf("RevokeSession() with a bad id status = %d, expected %d", status, fiber.StatusBadRequest)
+	}
+
+	if status, _ = request(fiber.MethodDelete, sessionPath(laptop)); status != fiber.StatusOK {
+		t.Fatalf("RevokeSession() status = %d, expected %d", status, fiber.StatusOK)
+	}
+	if _, err := tokens.GetRefreshToken(ctx, "refresh-laptop"); err == nil {
+		t.Errorf("refresh token of the revoked session still works")
+	}
+	if _, err := cacheClient.Get(ctx, "access-laptop"); err == nil {
+		t.Errorf("access token of the revoked session is still cached")
+	}
+	if _, err := cacheClient.Get(ctx, constants.REVOKED_CACHE_PREFIX+"sid:laptop"); err != nil {
+		t.Errorf("revoked session is not on the revocation list")
+	}
+	if _, err := cacheClient.Get(ctx, "access-phone"); err != nil {
+		t.Errorf("access token of the current session is dropped")
+	}
+	if status, list = request(fiber.MethodGet, "/sessions"); len(list.Sessions) != 1 || list.Sessions[0].ID != phone.ID {
+		t.Errorf("ListSessions() after revoke = %d %+v, expected only the phone", status, list)
+	}
+	if status, _ = request(fiber.MethodDelete, sessionPath(laptop)); status != fiber.StatusNotFound {
+		t.Errorf("second RevokeSession() status = %d, expected %d", status, fiber.StatusNotFound)
+	}
+
+	// администратор видит и отзывает сессии любого пользователя
+	foreignPath := "/users/8/sessions"
+	if status, list = request(fiber.MethodGet, foreignPath); len(list.Sessions) != 1 || list.Sessions[0].Current {
+		t.Errorf("ListUserSessions() = %d %+v, expected the tablet", status, list)
+	}
+	if status, _ = request(fiber.MethodDelete, "/users/7"+sessionPath(foreign)); status != fiber.StatusNotFound {
+		t.Errorf("RevokeUserSession() of another user status = %d, expected %d", status, fiber.StatusNotFound)
+	}
+	if status, _ = request(fiber.MethodDelete, foreignPath+"/"+strconv.FormatInt(foreign.ID, 10)); status != fiber.StatusOK {
+		t.Errorf("RevokeUserSession() status = %d, expected %d", status, fiber.StatusOK)
+	}
+	if status, list = request(fiber.MethodGet, foreignPath); len(list.Sessions) != 0 {
+		t.Errorf("ListUserSessions() after revoke = %d %+v, expected none", status, list)
+	}
+}
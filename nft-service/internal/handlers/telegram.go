@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/internal/dto"
+	"main/internal/lib/telegram"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+var ErrTelegramDisabled = tvoerrors.Wrap("telegram login is disabled", tvoerrors.ErrNotFound)
+var ErrTelegramTaken = tvoerrors.Wrap("telegram account is linked to another user", tvoerrors.ErrConflict)
+var ErrTelegramReplayed = tvoerrors.Wrap("telegram data was already used", tvoerrors.ErrUnauthorized)
+
+// LoginTelegram logs in by Telegram, a new user is created for an unknown Telegram account
+// @Summary Log in with Telegram
+// @Description Accepts Mini App initData or Login Widget fields signed with the bot token.
+// @Description Signed data is accepted once and within TELEGRAM_AUTH_MAX_AGE, 5 minutes by default.
+// @Description With two-factor authentication an MFA token is returned instead of tokens, see /login/mfa/.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body dto.LoginTelegramRequest true "Request body"
+// @Success 200 {object} dto.LoginResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Router /v1/auth/telegram/ [post]
+func (h *AuthHandlers) LoginTelegram(c *fiber.Ctx) (interface{}, error) {
+	ctx := c.Context()
+
+	if err := h.throttle.Allow(ctx, "telegram", c.IP(), ""); err != nil {
+		h.logger.Error("Telegram login throttled", "ip", c.IP(), "error", err)
+		return nil, err
+	}
+
+	tgUser, err := h.telegramUser(c, "LoginTelegram")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepository.UserByTelegramId(ctx, tgUser.ID)
+	if errors.Is(err, tvoerrors.ErrNotFound) {
+		if h.inviteOnly {
+			h.logger.Warn("Telegram registration without invite", "telegram_id", tgUser.ID)
+			return nil, ErrInviteRequired
+		}
+		user, err = h.userRepository.CreateUserByTelegram(ctx, tgUser.ID)
+		switch {
+		case errors.Is(err, tvoerrors.ErrConflict):
+			// параллельный вход уже создал пользователя
+			user, err = h.userRepository.UserByTelegramId(ctx, tgUser.ID)
+		case err == nil:
+			h.logger.Info("User created by telegram", "user_id", user.ID, "telegram_id", tgUser.ID)
+		}
+	}
+	if err != nil {
+		h.logger.Error("Error getting user by telegram", "telegram_id", tgUser.ID, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	if user.Locked(time.Now()) {
+		h.logger.Error("Account locked", "user_id", user.ID, "locked_until", *user.LockedUntil)
+		return nil, ErrAccountLocked
+	}
+
+	// подпись Telegram заменяет пароль, второй фактор проверяется так же, как при обычном входе
+	challenge, err := h.startMFA(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return challenge, nil
+	}
+
+	userToken, err := h.issueTokens(c, user)
+	if err != nil {
+		h.logger.Error("Error creating token", "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.LoginResponse{
+		AccessToken:  userToken.Token,
+		RefreshToken: userToken.RefreshToken,
+	}, nil
+}
+
+// LinkTelegram links a Telegram account to the current user
+// @Summary Link Telegram account
+// @Description Accepts the same signed data as /v1/auth/telegram/, afterwards the account can log in with Telegram.
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.LoginTelegramRequest true "Request body"
+// @Success 200 {object} dto.TelegramLinkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/auth/telegram/link/ [post]
+func (h *AuthHandlers) LinkTelegram(c *fiber.Ctx) (interface{}, error) {
+	userId, err := httputils.UserIDFromToken(c, "LinkTelegram", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	tgUser, err := h.telegramUser(c, "LinkTelegram")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.userRepository.UpdateTelegramId(c.Context(), userId, tgUser.ID); err != nil {
+		h.logger.Error("Error link telegram", "user_id", userId, "telegram_id", tgUser.ID, "error", err)
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, ErrTelegramTaken
+		}
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.TelegramLinkResponse{
+		Message: "Telegram account linked",
+	}, nil
+}
+
+// telegramUser parses the request and checks the Telegram signature
+func (h *AuthHandlers) telegramUser(c *fiber.Ctx, method string) (*telegram.User, error) {
+	if h.telegram.BotToken == "" {
+		return nil, ErrTelegramDisabled
+	}
+
+	var request dto.LoginTelegramRequest
+	if err := httputils.ParseRequestBody(c, &request, method, h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	var (
+		tgUser *telegram.User
+		err    error
+	)
+	now := time.Now()
+	switch {
+	case request.InitData != "":
+		tgUser, err = telegram.ValidateInitData(request.InitData, h.telegram.BotToken, h.telegram.AuthMaxAge, now)
+	case request.Widget != nil:
+		tgUser, err = telegram.ValidateWidget(request.Widget.Fields(), h.telegram.BotToken, h.telegram.AuthMaxAge, now)
+	default:
+		return nil, tvoerrors.Wrap("init_data or widget is required", tvoerrors.ErrInvalidRequestData)
+	}
+	if err != nil {
+		h.logger.Error("Invalid telegram data", "method", method, "error", err)
+		return nil, tvoerrors.Wrap(err.Error(), tvoerrors.ErrUnauthorized)
+	}
+
+	// подпись запоминается до истечения срока данных, перехваченные данные нельзя предъявить повторно
+	fresh, err := h.cache.SetNX(c.Context(), constants.TELEGRAM_AUTH_CACHE_PREFIX+tgUser.Hash, "1",
+		h.telegram.AuthMaxAge+time.Minute)
+	if err != nil {
+		h.logger.Error("Error store telegram data hash", "method", method, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+	if !fresh {
+		h.logger.Warn("Telegram data replayed", "method", method, "telegram_id", tgUser.ID)
+		return nil, ErrTelegramReplayed
+	}
+
+	return tgUser, nil
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+
+	"main/internal/dto"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/internal/service"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var ErrUnlockableDisabled = tvoerrors.Wrap("unlockable content is not configured", tvoerrors.ErrNotFound)
+
+// UnlockableHandlers
+type UnlockableHandlers struct {
+	logger            *logger.Logger
+	service           *service.UnlockableService
+	nftDataRepository repository.NftDataRepository
+	permissions       *service.PermissionService
+}
+
+// NewUnlockableHandlers конструктор для обработчиков приватного контента токенов
+func NewUnlockableHandlers(logger *logger.Logger, unlockableService *service.UnlockableService,
+	nftDataRepository repository.NftDataRepository, permissions *service.PermissionService) *UnlockableHandlers {
+	return &UnlockableHandlers{
+		logger:            logger,
+		service:           unlockableService,
+		nftDataRepository: nftDataRepository,
+		permissions:       permissions,
+	}
+}
+
+// SetUnlockable stores the encrypted private payload of the token
+// Requires the nft:manage_any permission, or nft:manage_own for tokens created by the user.
+// @Summary Set unlockable content
+// @Tags NFT
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Token id"
+// @Param request body dto.SetUnlockableRequest true "Request body"
+// @Success 200 {object} dto.SetUnlockableResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/nft/{id}/unlockable [post]
+func (h *UnlockableHandlers) SetUnlockable(c *fiber.Ctx) (interface{}, error) {
+	var request dto.SetUnlockableRequest
+
+	if err := httputils.ParseRequestBody(c, &request, "SetUnlockable", h.logger); err != nil {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	tokenId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil || request.Content == "" {
+		log.Error("Invalid unlockable request", "error", err)
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	if err = h.checkManage(c, tokenId); err != nil {
+		return nil, err
+	}
+
+	if h.service == nil {
+		return nil, ErrUnlockableDisabled
+	}
+
+	if err = h.service.Set(c.Context(), tokenId, []byte(request.Content)); err != nil {
+		log.Error("Error saving unlockable content", "token_id", tokenId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.SetUnlockableResponse{
+		Message: "Unlockable content saved",
+	}, nil
+}
+
+// RevealUnlockable decrypts the private payload for the current holder of the token
+// @Summary Reveal unlockable content
+// @Tags NFT
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path int true "Token id"
+// @Success 200 {object} dto.RevealUnlockableResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/holder/nft/{id}/unlockable [get]
+func (h *UnlockableHandlers) RevealUnlockable(c *fiber.Ctx) (interface{}, error) {
+	tokenId, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		log.Error("Error parsing nft id", "error", err)
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	userId, err := httputils.UserIDFromToken(c, "RevealUnlockable", h.logger)
+	if err != nil {
+		return nil, tvoerrors.ErrCastClaims
+	}
+
+	if h.service == nil {
+		return nil, ErrUnlockableDisabled
+	}
+
+	content, err := h.service.Reveal(c.Context(), &models.NftUnlockableAccess{
+		TokenId:   tokenId,
+		UserID:    userId,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	})
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		log.Error("Error revealing unlockable content", "token_id", tokenId, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	h.logger.Info("unlockable content revealed", "token_id", tokenId, "user_id", userId, "ip", c.IP())
+
+	return &dto.RevealUnlockableResponse{
+		TokenId: tokenId,
+		Content: string(content),
+	}, nil
+}
+
+// RotateUnlockableKey rewraps all data keys with the active master key
+// Requires the unlockable:rotate permission.
+// @Summary Rotate unlockable master key
+// @Tags NFT
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} dto.RotateUnlockableKeyResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/unlockable/rotate [post]
+func (h *UnlockableHandlers) RotateUnlockableKey(c *fiber.Ctx) (interface{}, error) {
+	if h.service == nil {
+		return nil, ErrUnlockableDisabled
+	}
+
+	count, err := h.service.RotateMasterKey(c.Context())
+	if err != nil {
+		log.Error("Error rotating master key", "rewrapped", count, "error", err)
+		return nil, tvoerrors.ErrServerError
+	}
+
+	return &dto.RotateUnlockableKeyResponse{
+		Rewrapped: count,
+	}, nil
+}
+
+// checkManage allows managing any token with nft:manage_any and own tokens with nft:manage_own
+func (h *UnlockableHandlers) checkManage(c *fiber.Ctx, tokenId int64) error {
+	ctx := c.Context()
+
+	tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+	if !ok {
+		return tvoerrors.ErrCastClaims
+	}
+
+	permissions, err := h.permissions.Permissions(ctx, tokenData.UserRoleID)
+	if err != nil {
+		log.Error("Error getting permissions", "error", err)
+		return tvoerrors.ErrServerError
+	}
+	if slices.Contains(permissions, models.PermNftManageAny) {
+		return nil
+	}
+	if !slices.Contains(permissions, models.PermNftManageOwn) {
+		log.Error("Set unlockable not allowed", "user_id", tokenData.UserID, "role_id", tokenData.UserRoleID)
+		return tvoerrors.ErrForbidden
+	}
+
+	nft, err := h.nftDataRepository.ReadNftData(ctx, tokenId)
+	if err != nil {
+		log.Error("Error reading nft data", "token_id", tokenId, "error", err)
+		return tvoerrors.ErrServerError
+	}
+	if nft.TokenId == 0 {
+		return tvoerrors.ErrNotFound
+	}
+	if nft.CreatedBy != tokenData.UserID {
+		log.Error("Set unlockable not allowed for foreign token", "user_id", tokenData.UserID, "token_id", tokenId)
+		return tvoerrors.ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+const keySize = 32
+
+var (
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrInvalidKey = errors.New("master key must be 32 bytes base64 encoded")
+)
+
+// Sealed is a payload encrypted with its own data key, which is in turn encrypted with a master key
+type Sealed struct {
+	Ciphertext  []byte
+	Nonce       []byte
+	WrappedKey  []byte
+	KeyNonce    []byte
+	MasterKeyID string
+}
+
+// Keyring holds master keys by id. New payloads are sealed with the active key,
+// old keys stay available for opening until everything is rewrapped.
+type Keyring struct {
+	keys     map[string][]byte
+	activeID string
+}
+
+// NewKeyring creates a keyring from base64 encoded 32 byte master keys.
+func NewKeyring(keys map[string]string, activeID string) (*Keyring, error) {
+	kr := &Keyring{
+		keys:     make(map[string][]byte, len(keys)),
+		activeID: activeID,
+	}
+
+	for id, encoded := range keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, tvoerrors.Wrap(id, ErrInvalidKey)
+		}
+		kr.keys[id] = key
+	}
+
+	if _, ok := kr.keys[activeID]; !ok {
+		return nil, tvoerrors.Wrap(activeID, ErrUnknownKey)
+	}
+
+	return kr, nil
+}
+
+// ActiveID returns the id of the master key used for new payloads.
+func (kr *Keyring) ActiveID() string {
+	return kr.activeID
+}
+
+// Seal encrypts the plaintext with a fresh data key wrapped by the active master key.
+func (kr *Keyring) Seal(plaintext []byte) (*Sealed, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, tvoerrors.Wrap("generate data key", err)
+	}
+
+	ciphertext, nonce, err := encrypt(dataKey, plaintext)
+	if err != nil {
+		return nil, tvoerrors.Wrap("encrypt payload", err)
+	}
+
+	sealed := &Sealed{
+		Ciphertext: ciphertext,
+		Nonce:      nonce,
+	}
+	if err = kr.wrap(sealed, dataKey); err != nil {
+		return nil, err
+	}
+
+	return sealed, nil
+}
+
+// Open decrypts the payload.
+func (kr *Keyring) Open(sealed *Sealed) ([]byte, error) {
+	dataKey, err := kr.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(dataKey, sealed.Ciphertext, sealed.Nonce)
+	if err != nil {
+		return nil, tvoerrors.Wrap("decrypt payload", err)
+	}
+
+	return plaintext, nil
+}
+
+// Rewrap re-encrypts the data key with the active master key, the payload itself is untouched.
+func (kr *Keyring) Rewrap(sealed *Sealed) (*Sealed, error) {
+	dataKey, err := kr.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrapped := &Sealed{
+		Ciphertext: sealed.Ciphertext,
+		Nonce:      sealed.Nonce,
+	}
+	if err = kr.wrap(rewrapped, dataKey); err != nil {
+		return nil, err
+	}
+
+	return rewrapped, nil
+}
+
+func (kr *Keyring) wrap(sealed *Sealed, dataKey []byte) error {
+	wrapped, nonce, err := encrypt(kr.keys[kr.activeID], dataKey)
+	if err != nil {
+		return tvoerrors.Wrap("wrap data key", err)
+	}
+
+	sealed.WrappedKey = wrapped
+	sealed.KeyNonce = nonce
+	sealed.MasterKeyID = kr.activeID
+	return nil
+}
+
+func (kr *Keyring) unwrap(sealed *Sealed) ([]byte, error) {
+	masterKey, ok := kr.keys[sealed.MasterKeyID]
+	if !ok {
+		return nil, tvoerrors.Wrap(sealed.MasterKeyID, ErrUnknownKey)
+	}
+
+	dataKey, err := decrypt(masterKey, sealed.WrappedKey, sealed.KeyNonce)
+	if err != nil {
+		return nil, tvoerrors.Wrap("unwrap data key", err)
+	}
+
+	return dataKey, nil
+}
+
+func encrypt(key, plaintext []byte) ([]byte, []byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return gcm.Seal(nil, nonce, plaintext, nil), nonce, nil
+}
+
+func decrypt(key, ciphertext, nonce []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
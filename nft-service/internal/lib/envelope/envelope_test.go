@@ -0,0 +1,72 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+func TestSealOpen(t *testing.T) {
+	kr, err := NewKeyring(map[string]string{"k1": testKey(1)}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	sealed, err := kr.Seal([]byte("login:password"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if bytes.Contains(sealed.Ciphertext, []byte("password")) {
+		t.Errorf("Seal() ciphertext contains plaintext")
+	}
+
+	plaintext, err := kr.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if string(plaintext) != "login:password" {
+		t.Errorf("Open() = %q, expected %q", plaintext, "login:password")
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old, _ := NewKeyring(map[string]string{"k1": testKey(1)}, "k1")
+	sealed, _ := old.Seal([]byte("secret"))
+
+	rotated, err := NewKeyring(map[string]string{"k1": testKey(1), "k2": testKey(2)}, "k2")
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+
+	rewrapped, err := rotated.Rewrap(sealed)
+	if err != nil {
+		t.Fatalf("Rewrap() error = %v", err)
+	}
+	if rewrapped.MasterKeyID != "k2" {
+		t.Errorf("Rewrap() master key = %q, expected k2", rewrapped.MasterKeyID)
+	}
+
+	next, _ := NewKeyring(map[string]string{"k2": testKey(2)}, "k2")
+	plaintext, err := next.Open(rewrapped)
+	if err != nil || string(plaintext) != "secret" {
+		t.Errorf("Open() = %q, %v, expected %q", plaintext, err, "secret")
+	}
+
+	if _, err = next.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open() with retired key error = %v, expected %v", err, ErrUnknownKey)
+	}
+}
+
+func TestNewKeyringInvalid(t *testing.T) {
+	if _, err := NewKeyring(map[string]string{"k1": "c2hvcnQ="}, "k1"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("NewKeyring() short key error = %v, expected %v", err, ErrInvalidKey)
+	}
+	if _, err := NewKeyring(map[string]string{"k1": testKey(1)}, "k2"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("NewKeyring() missing active key error = %v, expected %v", err, ErrUnknownKey)
+	}
+}
@@ -0,0 +1,255 @@
+package gads
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/lib/tron"
+)
+
+// ABI-encoded fixtures
+const (
+	contractHex    = "4177ecde50c4eb5e455e9529068f7f21a3f5d1f5fd"
+	contractBase58 = "TLuKAnxTLK99naFoKF7bQGE5c5sWiGubPu"
+
+	addressWord = "00000000000000000000000077ecde50c4eb5e455e9529068f7f21a3f5d1f5fd"
+	zeroWord    = "0000000000000000000000000000000000000000000000000000000000000000"
+	supplyWord  = "000000000000000000000000000000000000000000000000000000000000002a"
+	tokenWord   = "0000000000000000000000000000000000000000000000000000000000000007"
+
+	nameOut = "0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"4741445300000000000000000000000000000000000000000000000000000000"
+	tokenURIOut = "0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000049" +
+		"697066733a2f2f62616679626569676479727a74357366703775646d37687537" +
+		"367568377932366e6633656675796c71616266336f636c67747179353566627a" +
+		"64692f372e6a736f6e0000000000000000000000000000000000000000000000"
+	tokenURI = "ipfs://bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi/7.json"
+
+	transferTopic = "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	revertOut     = "08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000014" +
+		"546f6b656e20646f6573206e6f74206578697374000000000000000000000000"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad fixture %q: %v", s, err)
+	}
+	return b
+}
+
+// TestBindingsMatchABI checks that every signature used by the bindings exists in the committed ABI.
+func TestBindingsMatchABI(t *testing.T) {
+	var entries []struct {
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Inputs []struct {
+			Type string `json:"type"`
+		} `json:"inputs"`
+	}
+	if err := json.Unmarshal(ABI, &entries); err != nil {
+		t.Fatalf("can't parse abi.json: %v", err)
+	}
+
+	known := map[string]bool{}
+	for _, e := range entries {
+		types := make([]string, 0, len(e.Inputs))
+		for _, in := range e.Inputs {
+			types = append(types, in.Type)
+		}
+		known[fmt.Sprintf("%s %s(%s)", e.Type, e.Name, strings.Join(types, ","))] = true
+	}
+
+	for _, sig := range []string{SigName, SigSymbol, SigTotalSupply, SigBalanceOf, SigOwnerOf, SigTokenURI} {
+		if !known["function "+sig] {
+			t.Errorf("function %s is not in the ABI", sig)
+		}
+	}
+	for _, sig := range []string{EventTransfer, EventApproval, EventApprovalForAll, EventTokenBurned, EventBaseURIChanged} {
+		if !known["event "+sig] {
+			t.Errorf("event %s is not in the ABI", sig)
+		}
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	tests := map[string]string{
+		SigName:        "06fdde03",
+		SigSymbol:      "95d89b41",
+		SigTotalSupply: "18160ddd",
+		SigBalanceOf:   "70a08231",
+		SigOwnerOf:     "6352211e",
+		SigTokenURI:    "c87b56dd",
+	}
+
+	for sig, expected := range tests {
+		if result := hex.EncodeToString(tron.Selector(sig)); result != expected {
+			t.Errorf("Selector(%q) = %s, expected %s", sig, result, expected)
+		}
+	}
+
+	if result := hex.EncodeToString(tron.EventTopic(EventTransfer)); result != transferTopic {
+		t.Errorf("EventTopic(%q) = %s, expected %s", EventTransfer, result, transferTopic)
+	}
+}
+
+func TestPackUnpack(t *testing.T) {
+	owner, _ := tron.AddressFromHex(contractHex)
+
+	if result := hex.EncodeToString(PackBalanceOf(owner)); result != addressWord {
+		t.Errorf("PackBalanceOf() = %s, expected %s", result, addressWord)
+	}
+	if result := hex.EncodeToString(PackTokenId(7)); result != tokenWord {
+		t.Errorf("PackTokenId() = %s, expected %s", result, tokenWord)
+	}
+
+	addr, err := UnpackAddress(mustHex(t, addressWord))
+	if err != nil || addr.Base58() != contractBase58 {
+		t.Errorf("UnpackAddress() = %s, %v, expected %s", addr, err, contractBase58)
+	}
+
+	supply, err := UnpackUint(mustHex(t, supplyWord))
+	if err != nil || supply != 42 {
+		t.Errorf("UnpackUint() = %d, %v, expected 42", supply, err)
+	}
+
+	name, err := UnpackString(mustHex(t, nameOut))
+	if err != nil || name != "GADS" {
+		t.Errorf("UnpackString() = %q, %v, expected GADS", name, err)
+	}
+
+	uri, err := UnpackString(mustHex(t, tokenURIOut))
+	if err != nil || uri != tokenURI {
+		t.Errorf("UnpackString() = %q, %v, expected %q", uri, err, tokenURI)
+	}
+
+	if _, err = UnpackString(mustHex(t, nameOut)[:64]); !errors.Is(err, tron.ErrShortData) {
+		t.Errorf("UnpackString() truncated error = %v, expected %v", err, tron.ErrShortData)
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	mint := &Log{Topics: [][]byte{
+		mustHex(t, transferTopic), mustHex(t, zeroWord), mustHex(t, addressWord), mustHex(t, tokenWord),
+	}}
+
+	name, err := EventName(mint)
+	if err != nil || name != EventTransfer {
+		t.Fatalf("EventName() = %q, %v, expected %q", name, err, EventTransfer)
+	}
+
+	transfer, err := ParseTransfer(mint)
+	if err != nil {
+		t.Fatalf("ParseTransfer() error = %v", err)
+	}
+	if !transfer.From.IsZero() || transfer.To.Base58() != contractBase58 || transfer.TokenId != 7 {
+		t.Errorf("ParseTransfer() = %+v", transfer)
+	}
+
+	burn := &Log{Topics: [][]byte{tron.EventTopic(EventTokenBurned), mustHex(t, tokenWord), mustHex(t, addressWord)}}
+	burned, err := ParseTokenBurned(burn)
+	if err != nil || burned.TokenId != 7 || burned.Owner.Base58() != contractBase58 {
+		t.Errorf("ParseTokenBurned() = %+v, %v", burned, err)
+	}
+
+	if _, err = ParseTransfer(burn); !errors.Is(err, ErrWrongEvent) {
+		t.Errorf("ParseTransfer() of TokenBurned error = %v, expected %v", err, ErrWrongEvent)
+	}
+
+	baseURI := &Log{Topics: [][]byte{tron.EventTopic(EventBaseURIChanged)}, Data: mustHex(t, nameOut)}
+	changed, err := ParseBaseURIChanged(baseURI)
+	if err != nil || changed.BaseURI != "GADS" {
+		t.Errorf("ParseBaseURIChanged() = %+v, %v", changed, err)
+	}
+}
+
+func TestCallerWithClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ContractAddress  string `json:"contract_address"`
+			FunctionSelector string `json:"function_selector"`
+			Parameter        string `json:"parameter"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		if r.URL.Path != "/wallet/triggerconstantcontract" || req.ContractAddress != contractHex {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		out := ""
+		switch {
+		case req.FunctionSelector == SigOwnerOf && req.Parameter == tokenWord:
+			out = addressWord
+		case req.FunctionSelector == SigOwnerOf:
+			out = revertOut
+		case req.FunctionSelector == SigTokenURI:
+			out = tokenURIOut
+		}
+		_, _ = fmt.Fprintf(w, `{"result":{"result":true},"constant_result":["%s"]}`, out)
+	}))
+	defer server.Close()
+
+	contract, _ := tron.AddressFromBase58(contractBase58)
+	caller := NewCaller(tron.NewClient(server.URL, "", time.Second), contract)
+	ctx := context.Background()
+
+	owner, err := caller.OwnerOf(ctx, 7)
+	if err != nil || owner.Base58() != contractBase58 {
+		t.Errorf("OwnerOf(7) = %s, %v, expected %s", owner, err, contractBase58)
+	}
+
+	uri, err := caller.TokenURI(ctx, 7)
+	if err != nil || uri != tokenURI {
+		t.Errorf("TokenURI(7) = %q, %v, expected %q", uri, err, tokenURI)
+	}
+
+	if _, err = caller.OwnerOf(ctx, 8); !errors.Is(err, tron.ErrReverted) {
+		t.Errorf("OwnerOf(8) error = %v, expected %v", err, tron.ErrReverted)
+	} else if !strings.Contains(err.Error(), "Token does not exist") {
+		t.Errorf("OwnerOf(8) error = %v, expected revert reason", err)
+	}
+
+	// отрицательный id не должен кодироваться как id существующего токена
+	for _, tokenId := range []int64{0, -7} {
+		if _, err = caller.OwnerOf(ctx, tokenId); !errors.Is(err, ErrTokenId) {
+			t.Errorf("OwnerOf(%d) error = %v, expected %v", tokenId, err, ErrTokenId)
+		}
+		if _, err = caller.TokenURI(ctx, tokenId); !errors.Is(err, ErrTokenId) {
+			t.Errorf("TokenURI(%d) error = %v, expected %v", tokenId, err, ErrTokenId)
+		}
+	}
+}
+
+func TestDecodeEvents(t *testing.T) {
+	transfer, err := DecodeTransfer(&tron.Event{EventName: NameTransfer, Result: map[string]string{
+		"from": "0x0000000000000000000000000000000000000000", "to": "0x" + contractHex[2:], "tokenId": "7",
+	}})
+	if err != nil || !transfer.From.IsZero() || transfer.To.Base58() != contractBase58 || transfer.TokenId != 7 {
+		t.Errorf("DecodeTransfer() = %+v, %v", transfer, err)
+	}
+
+	burned, err := DecodeTokenBurned(&tron.Event{EventName: NameTokenBurned, Result: map[string]string{
+		"tokenId": "7", "owner": contractBase58,
+	}})
+	if err != nil || burned.TokenId != 7 || burned.Owner.Base58() != contractBase58 {
+		t.Errorf("DecodeTokenBurned() = %+v, %v", burned, err)
+	}
+
+	if _, err = DecodeTransfer(&tron.Event{EventName: NameTokenBurned}); !errors.Is(err, ErrWrongEvent) {
+		t.Errorf("DecodeTransfer() of TokenBurned error = %v, expected %v", err, ErrWrongEvent)
+	}
+}
@@ -0,0 +1,74 @@
+package gads
+
+import (
+	"fmt"
+	"strconv"
+
+	"main/internal/lib/tron"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// Event names as returned by the TronGrid event API
+const (
+	NameTransfer    = "Transfer"
+	NameTokenBurned = "TokenBurned"
+)
+
+// DecodeTransfer converts a Transfer event decoded by the TronGrid event API.
+func DecodeTransfer(event *tron.Event) (*TransferEvent, error) {
+	if event.EventName != NameTransfer {
+		return nil, tvoerrors.Wrap(EventTransfer, ErrWrongEvent)
+	}
+
+	var result TransferEvent
+	var err error
+	if result.From, err = resultAddress(event, "from"); err != nil {
+		return nil, err
+	}
+	if result.To, err = resultAddress(event, "to"); err != nil {
+		return nil, err
+	}
+	if result.TokenId, err = resultInt64(event, "tokenId"); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DecodeTokenBurned converts a TokenBurned event decoded by the TronGrid event API.
+func DecodeTokenBurned(event *tron.Event) (*TokenBurnedEvent, error) {
+	if event.EventName != NameTokenBurned {
+		return nil, tvoerrors.Wrap(EventTokenBurned, ErrWrongEvent)
+	}
+
+	var result TokenBurnedEvent
+	var err error
+	if result.TokenId, err = resultInt64(event, "tokenId"); err != nil {
+		return nil, err
+	}
+	if result.Owner, err = resultAddress(event, "owner"); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func resultAddress(event *tron.Event, name string) (tron.Address, error) {
+	value, ok := event.Result[name]
+	if !ok {
+		return tron.Address{}, fmt.Errorf("%s: missing %q", event.EventName, name)
+	}
+	return tron.ParseAddress(value)
+}
+
+func resultInt64(event *tron.Event, name string) (int64, error) {
+	value, ok := event.Result[name]
+	if !ok {
+		return 0, fmt.Errorf("%s: missing %q", event.EventName, name)
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, tvoerrors.Wrap(event.EventName, tron.ErrOverflow)
+	}
+	return number, nil
+}
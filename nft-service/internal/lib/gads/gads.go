@@ -0,0 +1,321 @@
+// Package gads contains typed bindings for the GADS (SGAA_NFT) TRC-721 contract.
+// The ABI is a copy of blockchain/build/contracts/SGAA_NFT.json, abi_test.go checks
+// that every binding below matches it.
+package gads
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+
+	"main/internal/lib/tron"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+//go:embed abi.json
+var ABI []byte
+
+// Function signatures
+const (
+	SigName        = "name()"
+	SigSymbol      = "symbol()"
+	SigTotalSupply = "totalSupply()"
+	SigBalanceOf   = "balanceOf(address)"
+	SigOwnerOf     = "ownerOf(uint256)"
+	SigTokenURI    = "tokenURI(uint256)"
+)
+
+// Event signatures
+const (
+	EventTransfer       = "Transfer(address,address,uint256)"
+	EventApproval       = "Approval(address,address,uint256)"
+	EventApprovalForAll = "ApprovalForAll(address,address,bool)"
+	EventTokenBurned    = "TokenBurned(uint256,address)"
+	EventBaseURIChanged = "BaseURIChanged(string)"
+)
+
+var (
+	ErrUnknownEvent = errors.New("unknown event")
+	ErrWrongEvent   = errors.New("log is not of the requested event")
+	ErrTopics       = errors.New("unexpected number of topics")
+	ErrTokenId      = errors.New("token id must be positive")
+)
+
+var eventsByTopic = map[string]string{}
+
+func init() {
+	for _, signature := range []string{EventTransfer, EventApproval, EventApprovalForAll, EventTokenBurned, EventBaseURIChanged} {
+		eventsByTopic[hex.EncodeToString(tron.EventTopic(signature))] = signature
+	}
+}
+
+// ConstantCaller executes read-only contract calls, implemented by tron.Client.
+type ConstantCaller interface {
+	TriggerConstant(ctx context.Context, contract tron.Address, signature string, params []byte) ([]byte, error)
+}
+
+// Caller is a read-only binding to a deployed GADS contract.
+type Caller struct {
+	client   ConstantCaller
+	contract tron.Address
+}
+
+// NewCaller creates a binding to the contract deployed at the given address.
+func NewCaller(client ConstantCaller, contract tron.Address) *Caller {
+	return &Caller{
+		client:   client,
+		contract: contract,
+	}
+}
+
+// Contract returns the address of the bound contract.
+func (c *Caller) Contract() tron.Address {
+	return c.contract
+}
+
+// Name returns the collection name.
+func (c *Caller) Name(ctx context.Context) (string, error) {
+	out, err := c.client.TriggerConstant(ctx, c.contract, SigName, nil)
+	if err != nil {
+		return "", err
+	}
+	return UnpackString(out)
+}
+
+// Symbol returns the collection symbol.
+func (c *Caller) Symbol(ctx context.Context) (string, error) {
+	out, err := c.client.TriggerConstant(ctx, c.contract, SigSymbol, nil)
+	if err != nil {
+		return "", err
+	}
+	return UnpackString(out)
+}
+
+// TotalSupply returns the number of existing tokens.
+func (c *Caller) TotalSupply(ctx context.Context) (int64, error) {
+	out, err := c.client.TriggerConstant(ctx, c.contract, SigTotalSupply, nil)
+	if err != nil {
+		return 0, err
+	}
+	return UnpackUint(out)
+}
+
+// BalanceOf returns the number of tokens held by the owner.
+func (c *Caller) BalanceOf(ctx context.Context, owner tron.Address) (int64, error) {
+	out, err := c.client.TriggerConstant(ctx, c.contract, SigBalanceOf, PackBalanceOf(owner))
+	if err != nil {
+		return 0, err
+	}
+	return UnpackUint(out)
+}
+
+// OwnerOf returns the owner of the token. The call reverts for burned and never minted tokens.
+func (c *Caller) OwnerOf(ctx context.Context, tokenId int64) (tron.Address, error) {
+	if tokenId <= 0 {
+		return tron.Address{}, ErrTokenId
+	}
+	out, err := c.client.TriggerConstant(ctx, c.contract, SigOwnerOf, PackTokenId(tokenId))
+	if err != nil {
+		return tron.Address{}, err
+	}
+	return UnpackAddress(out)
+}
+
+// TokenURI returns the metadata URI of the token.
+func (c *Caller) TokenURI(ctx context.Context, tokenId int64) (string, error) {
+	if tokenId <= 0 {
+		return "", ErrTokenId
+	}
+	out, err := c.client.TriggerConstant(ctx, c.contract, SigTokenURI, PackTokenId(tokenId))
+	if err != nil {
+		return "", err
+	}
+	return UnpackString(out)
+}
+
+// PackTokenId encodes arguments of ownerOf and tokenURI, the token id must be positive.
+func PackTokenId(tokenId int64) []byte {
+	return tron.EncodeInt64(tokenId)
+}
+
+// PackBalanceOf encodes arguments of balanceOf.
+func PackBalanceOf(owner tron.Address) []byte {
+	return tron.EncodeAddress(owner)
+}
+
+// UnpackString decodes a single string return value.
+func UnpackString(out []byte) (string, error) {
+	return tron.DecodeString(out, 0)
+}
+
+// UnpackUint decodes a single uint256 return value.
+func UnpackUint(out []byte) (int64, error) {
+	return tron.DecodeInt64(out, 0)
+}
+
+// UnpackAddress decodes a single address return value.
+func UnpackAddress(out []byte) (tron.Address, error) {
+	return tron.DecodeAddress(out, 0)
+}
+
+// Log is a raw contract event log
+type Log struct {
+	Address     tron.Address
+	Topics      [][]byte
+	Data        []byte
+	TxID        string
+	BlockNumber int64
+}
+
+// TransferEvent is emitted on mint (From is zero), transfer and burn (To is zero)
+type TransferEvent struct {
+	From    tron.Address
+	To      tron.Address
+	TokenId int64
+}
+
+// ApprovalEvent is emitted when an operator is approved for a single token
+type ApprovalEvent struct {
+	Owner    tron.Address
+	Approved tron.Address
+	TokenId  int64
+}
+
+// ApprovalForAllEvent is emitted when an operator is approved for all tokens of the owner
+type ApprovalForAllEvent struct {
+	Owner    tron.Address
+	Operator tron.Address
+	Approved bool
+}
+
+// TokenBurnedEvent is emitted by burn and burnBatch together with a Transfer to the zero address
+type TokenBurnedEvent struct {
+	TokenId int64
+	Owner   tron.Address
+}
+
+// BaseURIChangedEvent is emitted by setBaseURI
+type BaseURIChangedEvent struct {
+	BaseURI string
+}
+
+// EventName returns the signature of the event in the log.
+func EventName(log *Log) (string, error) {
+	if len(log.Topics) == 0 {
+		return "", ErrTopics
+	}
+
+	signature, ok := eventsByTopic[hex.EncodeToString(log.Topics[0])]
+	if !ok {
+		return "", tvoerrors.Wrap(hex.EncodeToString(log.Topics[0]), ErrUnknownEvent)
+	}
+
+	return signature, nil
+}
+
+// ParseTransfer decodes a Transfer event.
+func ParseTransfer(log *Log) (*TransferEvent, error) {
+	if err := checkEvent(log, EventTransfer, 4); err != nil {
+		return nil, err
+	}
+
+	var event TransferEvent
+	var err error
+	if event.From, err = tron.DecodeAddress(log.Topics[1], 0); err != nil {
+		return nil, err
+	}
+	if event.To, err = tron.DecodeAddress(log.Topics[2], 0); err != nil {
+		return nil, err
+	}
+	if event.TokenId, err = tron.DecodeInt64(log.Topics[3], 0); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// ParseApproval decodes an Approval event.
+func ParseApproval(log *Log) (*ApprovalEvent, error) {
+	if err := checkEvent(log, EventApproval, 4); err != nil {
+		return nil, err
+	}
+
+	var event ApprovalEvent
+	var err error
+	if event.Owner, err = tron.DecodeAddress(log.Topics[1], 0); err != nil {
+		return nil, err
+	}
+	if event.Approved, err = tron.DecodeAddress(log.Topics[2], 0); err != nil {
+		return nil, err
+	}
+	if event.TokenId, err = tron.DecodeInt64(log.Topics[3], 0); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// ParseApprovalForAll decodes an ApprovalForAll event.
+func ParseApprovalForAll(log *Log) (*ApprovalForAllEvent, error) {
+	if err := checkEvent(log, EventApprovalForAll, 3); err != nil {
+		return nil, err
+	}
+
+	var event ApprovalForAllEvent
+	var err error
+	if event.Owner, err = tron.DecodeAddress(log.Topics[1], 0); err != nil {
+		return nil, err
+	}
+	if event.Operator, err = tron.DecodeAddress(log.Topics[2], 0); err != nil {
+		return nil, err
+	}
+	if event.Approved, err = tron.DecodeBool(log.Data, 0); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// ParseTokenBurned decodes a TokenBurned event.
+func ParseTokenBurned(log *Log) (*TokenBurnedEvent, error) {
+	if err := checkEvent(log, EventTokenBurned, 3); err != nil {
+		return nil, err
+	}
+
+	var event TokenBurnedEvent
+	var err error
+	if event.TokenId, err = tron.DecodeInt64(log.Topics[1], 0); err != nil {
+		return nil, err
+	}
+	if event.Owner, err = tron.DecodeAddress(log.Topics[2], 0); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// ParseBaseURIChanged decodes a BaseURIChanged event.
+func ParseBaseURIChanged(log *Log) (*BaseURIChangedEvent, error) {
+	if err := checkEvent(log, EventBaseURIChanged, 1); err != nil {
+		return nil, err
+	}
+
+	baseURI, err := tron.DecodeString(log.Data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BaseURIChangedEvent{BaseURI: baseURI}, nil
+}
+
+func checkEvent(log *Log, signature string, topics int) error {
+	if len(log.Topics) == 0 || !bytes.Equal(log.Topics[0], tron.EventTopic(signature)) {
+		return tvoerrors.Wrap(signature, ErrWrongEvent)
+	}
+	if len(log.Topics) != topics {
+		return tvoerrors.Wrap(signature, ErrTopics)
+	}
+	return nil
+}
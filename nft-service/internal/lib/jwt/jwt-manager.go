@@ -2,9 +2,12 @@ package lib
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	go_jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 
 	"main/internal/models"
 	coreconfig "main/tools/pkg/core_config"
@@ -13,23 +16,82 @@ import (
 
 var ErrCastClaims = errors.New("failed to cast token claims to UserClaims")
 
+func init() {
+	// iat с долями секунды: токен, выпущенный в ту же секунду после отзыва токенов пользователя, остается валидным.
+	// Дата разбирается через float64, микросекунд хватает с запасом на его точность
+	go_jwt.TimePrecision = time.Microsecond
+}
+
 // JWTManager is a struct responsible for managing JWT tokens.
 type JWTManager struct {
-	cfg *coreconfig.JWT
+	cfg    *coreconfig.JWT
+	active *signingKey
+	keys   map[string]*signingKey
 }
 
 // UserClaims represents the claims stored in JWT tokens for users.
 type UserClaims struct {
-	ID   int64 `json:"uid"`
-	Role int64 `json:"role_id"`
+	ID        int64       `json:"uid"`
+	Role      int64       `json:"role_id"`
+	Phone     string      `json:"phone,omitempty"`
+	Email     string      `json:"email,omitempty"` // only a verified email
+	SessionID string      `json:"sid,omitempty"`   // token family of the session, used to revoke a single device
+	Actor     *ActorClaim `json:"act,omitempty"`   // set on impersonation tokens only
 	go_jwt.RegisteredClaims
 }
 
+// ActorClaim identifies the admin acting as the user of the token, the act claim of RFC 8693.
+type ActorClaim struct {
+	ID int64 `json:"uid"`
+}
+
 // NewJWTManager initializes a new JWTManager with the provided configuration.
-func NewJWTManager(cfg *coreconfig.JWT) *JWTManager {
-	return &JWTManager{
-		cfg: cfg,
+// HMAC methods sign with the shared secret, other methods sign with the key JWT_ACTIVE_KEY,
+// the rest of JWT_KEYS and the secret are kept to verify tokens issued before rotation.
+func NewJWTManager(cfg *coreconfig.JWT) (*JWTManager, error) {
+	method, err := signingMethod(cfg.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &JWTManager{
+		cfg:  cfg,
+		keys: make(map[string]*signingKey, len(cfg.Keys)+1),
 	}
+
+	if cfg.Secret != "" {
+		legacy := &signingKey{id: legacyKeyID, method: go_jwt.SigningMethodHS512, private: []byte(cfg.Secret)}
+		if isHMAC(method) {
+			legacy.method = method
+		}
+		legacy.public = legacy.private
+		manager.keys[legacyKeyID] = legacy
+	}
+
+	for id, path := range cfg.Keys {
+		key, err := loadKey(id, path, method)
+		if err != nil {
+			return nil, err
+		}
+		manager.keys[id] = key
+	}
+
+	activeId := cfg.ActiveKeyID
+	if isHMAC(method) {
+		activeId = legacyKeyID
+	}
+	active, ok := manager.keys[activeId]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: active key %q", ErrUnknownKey, activeId)
+	case active.private == nil:
+		return nil, fmt.Errorf("jwt key %s: private key is required to sign tokens", activeId)
+	case active.method.Alg() != method.Alg():
+		return nil, fmt.Errorf("%w: %s is used with %s", ErrKeyMismatch, activeId, method.Alg())
+	}
+	manager.active = active
+
+	return manager, nil
 }
 
 // GetTokenTTL returns the time-to-live (TTL) duration for authentication tokens.
@@ -42,20 +104,49 @@ func (manager *JWTManager) GetRefreshTTL() time.Duration {
 	return manager.cfg.RefreshExpired
 }
 
-// Generate creates new JWTManager token for given user and app.
-func (manager *JWTManager) Generate(user *models.User) (string, error) {
+// Generate creates new JWTManager token for given user and session.
+func (manager *JWTManager) Generate(user *models.User, sessionId string) (string, error) {
 	now := time.Now()
 
-	token := go_jwt.NewWithClaims(go_jwt.SigningMethodHS512, UserClaims{
-		ID:   user.ID,
-		Role: int64(user.RoleID),
+	return manager.sign(UserClaims{
+		ID:        user.ID,
+		Role:      int64(user.RoleID),
+		Phone:     user.Phone,
+		Email:     user.VerifiedEmail(),
+		SessionID: sessionId,
 		RegisteredClaims: go_jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: go_jwt.NewNumericDate(now.Add(manager.cfg.AuthExpired)),
 			IssuedAt:  go_jwt.NewNumericDate(now),
 		},
 	})
+}
+
+// GenerateImpersonation creates a token of the user for the admin actorId valid until expiresAt.
+// It belongs to no session and can't be refreshed.
+func (manager *JWTManager) GenerateImpersonation(user *models.User, actorId int64, expiresAt time.Time) (string, error) {
+	return manager.sign(UserClaims{
+		ID:    user.ID,
+		Role:  int64(user.RoleID),
+		Phone: user.Phone,
+		Email: user.VerifiedEmail(),
+		Actor: &ActorClaim{ID: actorId},
+		RegisteredClaims: go_jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: go_jwt.NewNumericDate(expiresAt),
+			IssuedAt:  go_jwt.NewNumericDate(time.Now()),
+		},
+	})
+}
 
-	tokenString, err := token.SignedString([]byte(manager.cfg.Secret))
+func (manager *JWTManager) sign(claims UserClaims) (string, error) {
+	token := go_jwt.NewWithClaims(manager.active.method, claims)
+
+	if manager.active.id != legacyKeyID {
+		token.Header["kid"] = manager.active.id
+	}
+
+	tokenString, err := token.SignedString(manager.active.private)
 	if err != nil {
 		return "", tvoerrors.Wrap("error signing token", err)
 	}
@@ -63,13 +154,22 @@ func (manager *JWTManager) Generate(user *models.User) (string, error) {
 	return tokenString, nil
 }
 
-// Verify parses the provided JWTManager token using the given secret and returns the corresponding UserClaims struct.
+// Verify parses the provided JWTManager token using the key named by its kid header and returns the corresponding UserClaims struct.
 func (manager *JWTManager) Verify(jwtToken string) (*UserClaims, error) {
 	token, err := go_jwt.ParseWithClaims(
 		jwtToken,
 		&UserClaims{},
 		func(token *go_jwt.Token) (interface{}, error) {
-			return []byte(manager.cfg.Secret), nil
+			kid, _ := token.Header["kid"].(string)
+			key, ok := manager.keys[kid]
+			if !ok {
+				return nil, ErrUnknownKey
+			}
+			// алгоритм токена должен совпадать с алгоритмом ключа, иначе публичный ключ можно выдать за HMAC секрет
+			if token.Method.Alg() != key.method.Alg() {
+				return nil, ErrKeyMismatch
+			}
+			return key.public, nil
 		},
 	)
 
@@ -84,3 +184,21 @@ func (manager *JWTManager) Verify(jwtToken string) (*UserClaims, error) {
 
 	return claims, nil
 }
+
+// JWKS returns the public verification keys, empty when tokens are signed with the shared secret.
+func (manager *JWTManager) JWKS() JWKSet {
+	ids := make([]string, 0, len(manager.keys))
+	for id := range manager.keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	set := JWKSet{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		if key, ok := manager.keys[id].jwk(); ok {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+
+	return set
+}
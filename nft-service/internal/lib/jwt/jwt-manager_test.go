@@ -0,0 +1,208 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	go_jwt "github.com/golang-jwt/jwt/v5"
+
+	"main/internal/models"
+	coreconfig "main/tools/pkg/core_config"
+)
+
+func writeKey(t *testing.T, key crypto.PrivateKey, public bool) string {
+	t.Helper()
+
+	var block *pem.Block
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(key.(crypto.Signer).Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWTManagerMethods(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	user := &models.User{ID: 7, RoleID: 100}
+
+	tests := []struct {
+		method string
+		key    crypto.PrivateKey
+		kty    string
+	}{
+		{method: "", kty: ""},
+		{method: "HS256", kty: ""},
+		{method: "RS256", key: rsaKey, kty: "RSA"},
+		{method: "PS384", key: rsaKey, kty: "RSA"},
+		{method: "ES256", key: ecKey, kty: "EC"},
+		{method: "EdDSA", key: edKey, kty: "OKP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			cfg := &coreconfig.JWT{Secret: "secret", Method: tt.method, AuthExpired: time.Minute}
+			if tt.key != nil {
+				cfg.Keys = map[string]string{"k1": writeKey(t, tt.key, false)}
+				cfg.ActiveKeyID = "k1"
+			}
+			manager, err := NewJWTManager(cfg)
+			if err != nil {
+				t.Fatalf("NewJWTManager() error = %v", err)
+			}
+
+			issuedFrom := time.Now().Truncate(time.Microsecond)
+			token, err := manager.Generate(user, "family")
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			claims, err := manager.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.ID != user.ID || claims.Role != int64(user.RoleID) || claims.SessionID != "family" ||
+				claims.RegisteredClaims.ID == "" {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+			// отзыв токенов пользователя сравнивает iat с долями секунды, float64 теряет не больше микросекунды
+			if claims.IssuedAt == nil || claims.IssuedAt.Before(issuedFrom.Add(-time.Microsecond)) {
+				t.Errorf("iat %v is truncated, expected not before %v", claims.IssuedAt, issuedFrom)
+			}
+
+			jwks := manager.JWKS()
+			if tt.kty == "" {
+				if len(jwks.Keys) != 0 {
+					t.Errorf("secret is published: %+v", jwks)
+				}
+				return
+			}
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != tt.kty || jwks.Keys[0].Kid != "k1" {
+				t.Errorf("unexpected jwks %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestJWTManagerRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	user := &models.User{ID: 1, RoleID: 1}
+
+	legacy, err := NewJWTManager(&coreconfig.JWT{Secret: "secret", AuthExpired: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyToken, _ := legacy.Generate(user, "")
+
+	before, err := NewJWTManager(&coreconfig.JWT{Secret: "secret", Method: "ES256", AuthExpired: time.Minute,
+		Keys: map[string]string{"old": writeKey(t, oldKey, false)}, ActiveKeyID: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := before.Generate(user, "")
+
+	after, err := NewJWTManager(&coreconfig.JWT{Secret: "secret", Method: "ES256", AuthExpired: time.Minute,
+		Keys:        map[string]string{"old": writeKey(t, oldKey, true), "new": writeKey(t, newKey, false)},
+		ActiveKeyID: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, _ := after.Generate(user, "")
+
+	for name, token := range map[string]string{"legacy": legacyToken, "old": oldToken, "new": newToken} {
+		if _, err = after.Verify(token); err != nil {
+			t.Errorf("%s token: Verify() error = %v", name, err)
+		}
+	}
+	if _, err = before.Verify(newToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify() with unknown kid error = %v, expected %v", err, ErrUnknownKey)
+	}
+	if keys := after.JWKS().Keys; len(keys) != 2 || keys[0].Kid != "new" || keys[1].Kid != "old" {
+		t.Errorf("unexpected jwks %+v", keys)
+	}
+
+	if _, err = NewJWTManager(&coreconfig.JWT{Method: "ES256", Keys: map[string]string{"old": writeKey(t, oldKey, true)},
+		ActiveKeyID: "old"}); err == nil {
+		t.Error("public key is accepted as the active key")
+	}
+	if _, err = NewJWTManager(&coreconfig.JWT{Method: "RS256", Keys: map[string]string{"old": writeKey(t, oldKey, false)},
+		ActiveKeyID: "old"}); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("NewJWTManager() with EC key for RS256 error = %v, expected %v", err, ErrKeyMismatch)
+	}
+}
+
+func TestJWTManagerAlgorithmConfusion(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	manager, err := NewJWTManager(&coreconfig.JWT{Method: "RS256", AuthExpired: time.Minute,
+		Keys: map[string]string{"k1": writeKey(t, key, false)}, ActiveKeyID: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// токен, подписанный публичным ключом как HMAC секретом
+	public, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	forged := go_jwt.NewWithClaims(go_jwt.SigningMethodHS256, UserClaims{ID: 1, Role: 100})
+	forged.Header["kid"] = "k1"
+	token, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+
+	if _, err = manager.Verify(token); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Verify() error = %v, expected %v", err, ErrKeyMismatch)
+	}
+}
+
+func TestJWTManagerImpersonation(t *testing.T) {
+	manager, err := NewJWTManager(&coreconfig.JWT{Secret: "secret", AuthExpired: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{ID: 7, RoleID: 1}
+
+	regular, _ := manager.Generate(user, "family")
+	if claims, err := manager.Verify(regular); err != nil || claims.Actor != nil {
+		t.Errorf("Verify() regular token = %+v, %v, expected no actor", claims, err)
+	}
+
+	expiresAt := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+	token, err := manager.GenerateImpersonation(user, 1, expiresAt)
+	if err != nil {
+		t.Fatalf("GenerateImpersonation() error = %v", err)
+	}
+	claims, err := manager.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.ID != 7 || claims.Actor == nil || claims.Actor.ID != 1 || claims.SessionID != "" ||
+		!claims.ExpiresAt.Time.Equal(expiresAt) {
+		t.Errorf("Verify() impersonation claims = %+v", claims)
+	}
+
+	expired, _ := manager.GenerateImpersonation(user, 1, time.Now().Add(-time.Minute))
+	if _, err = manager.Verify(expired); err == nil {
+		t.Error("expired impersonation token is accepted")
+	}
+}
@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	go_jwt "github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownMethod = errors.New("unsupported jwt signing method")
+	ErrUnknownKey    = errors.New("unknown jwt key id")
+	ErrKeyMismatch   = errors.New("key does not match the signing method")
+)
+
+// legacyKeyID identifies the shared secret, tokens signed with it before key rotation have no kid header
+const legacyKeyID = ""
+
+// signingKey is a single verification key, private is nil for keys kept only to verify tokens issued before rotation
+type signingKey struct {
+	id      string
+	method  go_jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// signingMethod returns the configured method, HS512 is used when the method is not set.
+func signingMethod(name string) (go_jwt.SigningMethod, error) {
+	switch {
+	case name == "":
+		return go_jwt.SigningMethodHS512, nil
+	case strings.EqualFold(name, go_jwt.SigningMethodEdDSA.Alg()):
+		return go_jwt.SigningMethodEdDSA, nil
+	}
+
+	method := go_jwt.GetSigningMethod(strings.ToUpper(name))
+	if method == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, name)
+	}
+	return method, nil
+}
+
+func isHMAC(method go_jwt.SigningMethod) bool {
+	_, ok := method.(*go_jwt.SigningMethodHMAC)
+	return ok
+}
+
+// loadKey reads a PEM encoded private (PKCS#1, PKCS#8, SEC 1) or public (PKIX) key.
+// The method of RSA keys is taken from the configuration, EC and Ed25519 keys define it themselves.
+func loadKey(id, path string, configured go_jwt.SigningMethod) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt key %s: no PEM data in %s", id, path)
+	}
+
+	key := &signingKey{id: id}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key.private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s: %w", id, err)
+	}
+
+	if signer, ok := key.private.(crypto.Signer); ok {
+		key.public = signer.Public()
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		key.method = configured
+		if _, ok := configured.(*go_jwt.SigningMethodRSA); !ok {
+			if _, ok = configured.(*go_jwt.SigningMethodRSAPSS); !ok {
+				key.method = go_jwt.SigningMethodRS256
+			}
+		}
+	case *ecdsa.PublicKey:
+		switch public.Curve {
+		case elliptic.P256():
+			key.method = go_jwt.SigningMethodES256
+		case elliptic.P384():
+			key.method = go_jwt.SigningMethodES384
+		case elliptic.P521():
+			key.method = go_jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("jwt key %s: unsupported curve %s", id, public.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		key.method = go_jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("jwt key %s: unsupported key type %T", id, key.public)
+	}
+
+	return key, nil
+}
+
+// jwk converts the public part of the key, HMAC secrets are never published.
+func (k *signingKey) jwk() (JWK, bool) {
+	key := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		key.Kty = "EC"
+		key.Crv = public.Curve.Params().Name
+		key.X = base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size)))
+		key.Y = base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = base64.RawURLEncoding.EncodeToString(public)
+	default:
+		return JWK{}, false
+	}
+
+	return key, true
+}
+
+// PublicKey parses the key published by another issuer, only RSA and EC signing keys are accepted.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(raw) == 0 {
+			return nil, fmt.Errorf("invalid jwk %s: bad encoding", k.Kid)
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid jwk %s: bad exponent", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("invalid jwk %s: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) { //nolint:staticcheck // crypto/ecdh has no ecdsa verification
+			return nil, fmt.Errorf("invalid jwk %s: point is not on the curve", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("invalid jwk %s: unsupported key type %q", k.Kid, k.Kty)
+	}
+}
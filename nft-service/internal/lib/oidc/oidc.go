@@ -0,0 +1,306 @@
+// Package oidc is a minimal OpenID Connect relying party: authorization code flow with PKCE
+// and ID token verification against the provider JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	go_jwt "github.com/golang-jwt/jwt/v5"
+
+	jwtManager "main/internal/lib/jwt"
+)
+
+const (
+	// keysRefreshInterval limits JWKS refetches caused by tokens with unknown key ids
+	keysRefreshInterval = time.Minute
+	// leeway tolerates clock drift between the provider and the service
+	leeway = time.Minute
+	// maxResponseSize caps provider responses
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid id token")
+	ErrNonce        = errors.New("id token nonce mismatch")
+	ErrExchange     = errors.New("authorization code exchange failed")
+)
+
+// Config describes a provider registered for the service.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the identity claims of a verified ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// idTokenClaims are the raw claims, Google has sent email_verified as a string in the past
+type idTokenClaims struct {
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified json.RawMessage `json:"email_verified"`
+	Name          string          `json:"name"`
+	go_jwt.RegisteredClaims
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one OpenID provider, discovery and keys are fetched lazily and cached.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *discovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+
+	now func() time.Time
+}
+
+// NewProvider creates a provider, a nil client means http.DefaultClient.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{cfg: cfg, client: client, now: time.Now}
+}
+
+// NewPKCE returns a code verifier and its S256 challenge (RFC 7636).
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns n random bytes encoded for use in URLs.
+func RandomString(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AuthURL returns the address the user is redirected to for authorization.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	meta, err := p.discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = p.do(req, &tokens); err != nil {
+		if tokens.Error != "" {
+			return "", fmt.Errorf("%w: %s", ErrExchange, tokens.Error)
+		}
+		return "", fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+
+	return tokens.IDToken, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of the ID token.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	meta, err := p.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	_, err = go_jwt.ParseWithClaims(rawToken, &claims, func(token *go_jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		go_jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		go_jwt.WithIssuer(meta.Issuer),
+		go_jwt.WithAudience(p.cfg.ClientID),
+		go_jwt.WithExpirationRequired(),
+		go_jwt.WithIssuedAt(),
+		go_jwt.WithLeeway(leeway),
+		go_jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, ErrNonce
+	}
+
+	return &Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: string(claims.EmailVerified) == "true" || string(claims.EmailVerified) == `"true"`,
+		Name:          claims.Name,
+	}, nil
+}
+
+// discovery loads the provider metadata once, the issuer has to match the configured one
+func (p *Provider) discovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta discovery
+	if err = p.do(req, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the verification key, unknown ids refetch the JWKS as providers rotate keys
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if !p.keysFetched.IsZero() && p.now().Sub(p.keysFetched) < keysRefreshInterval {
+		return nil, jwtManager.ErrUnknownKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwtManager.JWKSet
+	if err = p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// ключи неподдерживаемых типов пропускаются, ими нельзя подписать принимаемый токен
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetched = p.now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, jwtManager.ErrUnknownKey
+}
+
+func (p *Provider) do(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	// ошибки token endpoint тоже приходят в JSON, разбираем тело до проверки статуса
+	decodeErr := json.Unmarshal(body, out)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return decodeErr
+}
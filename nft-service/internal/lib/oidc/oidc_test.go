@@ -0,0 +1,125 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	go_jwt "github.com/golang-jwt/jwt/v5"
+
+	"main/internal/lib/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Provider) {
+	t.Helper()
+
+	idp := oidctest.NewProvider("client")
+	t.Cleanup(idp.Close)
+
+	return NewProvider(Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example/oidc/callback",
+	}, idp.Server.Client()), idp
+}
+
+func TestProviderCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	provider, idp := newTestProvider(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthURL(ctx, "state-1", "nonce-1", challenge)
+	if err != nil {
+		t.Fatalf("AuthURL() error = %v", err)
+	}
+	query, _ := url.Parse(authURL)
+	if query.Query().Get("code_challenge_method") != "S256" || query.Query().Get("scope") != "openid email profile" {
+		t.Errorf("AuthURL() = %s", authURL)
+	}
+
+	identity := oidctest.Identity{Subject: "108", Email: "buyer@gmail.com", EmailVerified: true}
+	code, state := idp.Authorize(authURL, identity)
+	if state != "state-1" {
+		t.Errorf("Authorize() state = %q", state)
+	}
+
+	if _, err = provider.Exchange(ctx, code, "wrong-verifier"); !errors.Is(err, ErrExchange) {
+		t.Errorf("Exchange() with wrong verifier error = %v, expected %v", err, ErrExchange)
+	}
+
+	code, _ = idp.Authorize(authURL, identity)
+	rawToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	if _, err = provider.VerifyIDToken(ctx, rawToken, "other-nonce"); !errors.Is(err, ErrNonce) {
+		t.Errorf("VerifyIDToken() with other nonce error = %v, expected %v", err, ErrNonce)
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, rawToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+	if claims.Subject != "108" || claims.Email != "buyer@gmail.com" || !claims.EmailVerified {
+		t.Errorf("VerifyIDToken() claims = %+v", claims)
+	}
+}
+
+func TestProviderVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	provider, idp := newTestProvider(t)
+	identity := oidctest.Identity{Subject: "108"}
+
+	tests := []struct {
+		name   string
+		claims go_jwt.MapClaims
+	}{
+		{name: "other audience", claims: go_jwt.MapClaims{"aud": "other-client"}},
+		{name: "other issuer", claims: go_jwt.MapClaims{"iss": "https://evil.example"}},
+		{name: "expired", claims: go_jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "no subject", claims: go_jwt.MapClaims{"sub": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := provider.VerifyIDToken(ctx, idp.Sign(identity, "n", tt.claims), "n"); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyIDToken() error = %v, expected %v", err, ErrInvalidToken)
+			}
+		})
+	}
+
+	// Google used to send email_verified as a string
+	claims, err := provider.VerifyIDToken(ctx, idp.Sign(identity, "n", go_jwt.MapClaims{"email_verified": "true"}), "n")
+	if err != nil || !claims.EmailVerified {
+		t.Errorf("VerifyIDToken() = %+v, %v", claims, err)
+	}
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	provider, idp := newTestProvider(t)
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+	identity := oidctest.Identity{Subject: "108"}
+
+	if _, err := provider.VerifyIDToken(ctx, idp.Sign(identity, "n", nil), "n"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+
+	// a new key id is refetched at most once per interval
+	idp.RotateKey("key-2")
+	if _, err := provider.VerifyIDToken(ctx, idp.Sign(identity, "n", nil), "n"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyIDToken() right after rotation error = %v, expected %v", err, ErrInvalidToken)
+	}
+
+	now = now.Add(keysRefreshInterval)
+	if _, err := provider.VerifyIDToken(ctx, idp.Sign(identity, "n", nil), "n"); err != nil {
+		t.Errorf("VerifyIDToken() after refresh interval error = %v", err)
+	}
+}
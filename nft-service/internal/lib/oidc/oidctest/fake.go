@@ -0,0 +1,187 @@
+// Package oidctest runs a local OpenID provider for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	go_jwt "github.com/golang-jwt/jwt/v5"
+
+	jwtManager "main/internal/lib/jwt"
+)
+
+// Identity is the account the fake provider signs in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type grant struct {
+	clientID  string
+	challenge string
+	nonce     string
+	identity  Identity
+}
+
+// Provider is a fake IdP supporting discovery, JWKS and the authorization code flow with PKCE.
+type Provider struct {
+	Server   *httptest.Server
+	ClientID string
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    string
+	grants map[string]grant
+}
+
+// NewProvider starts the fake provider, it is closed with the test server.
+func NewProvider(clientID string) *Provider {
+	p := &Provider{ClientID: clientID, grants: map[string]grant{}}
+	p.RotateKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+// Issuer returns the issuer URL of the provider.
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// Close stops the provider.
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// RotateKey replaces the signing key, the old key disappears from the JWKS.
+func (p *Provider) RotateKey(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key, p.kid = key, kid
+}
+
+// Authorize plays the user approving the request at authURL and returns the code for the redirect.
+func (p *Provider) Authorize(authURL string, identity Identity) (code, state string) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		panic(err)
+	}
+	query := parsed.Query()
+
+	code = base64.RawURLEncoding.EncodeToString([]byte(identity.Subject + query.Get("state")))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants[code] = grant{
+		clientID:  query.Get("client_id"),
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		identity:  identity,
+	}
+
+	return code, query.Get("state")
+}
+
+// Sign issues an ID token with the current key, claims override the defaults.
+func (p *Provider) Sign(identity Identity, nonce string, claims go_jwt.MapClaims) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	all := go_jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"aud":            p.ClientID,
+		"sub":            identity.Subject,
+		"email":          identity.Email,
+		"email_verified": identity.EmailVerified,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		all[name] = value
+	}
+
+	token := go_jwt.NewWithClaims(go_jwt.SigningMethodRS256, all)
+	token.Header["kid"] = p.kid
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	public := p.key.PublicKey
+	kid := p.kid
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, jwtManager.JWKSet{Keys: []jwtManager.JWK{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+	}}})
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || g.clientID != r.PostForm.Get("client_id") ||
+		g.challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     p.Sign(g.identity, g.nonce, nil),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,91 @@
+// Package pwned looks passwords up in a list of leaked SHA-1 hashes in the format of Have I Been Pwned,
+// see https://haveibeenpwned.com/Passwords. Lookups go by a hash prefix (k-anonymity range), so the
+// local list and the range API at https://api.pwnedpasswords.com/range/ are interchangeable.
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec // the leaked password lists are published as SHA-1
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PrefixLength is the number of hex characters of the hash sent to a range lookup
+const PrefixLength = 5
+
+// Hash returns the uppercase hex SHA-1 of the password split into the range prefix and the rest.
+func Hash(password string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(password)) //nolint:gosec
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return encoded[:PrefixLength], encoded[PrefixLength:]
+}
+
+// List keeps leaked hashes in memory grouped by range prefix.
+// The whole list lives in a Go map, about 100 bytes per hash, so the full HIBP corpus of about
+// a billion hashes can't be loaded. Use a top-N subset, e.g. hashes seen more than a few hundred times.
+type List struct {
+	ranges map[string][]string
+	size   int
+}
+
+// Load reads one hash per line, optionally followed by ":count" as in the downloaded HIBP files.
+// Empty lines and lines starting with # are skipped.
+func Load(r io.Reader) (*List, error) {
+	list := &List{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("pwned: line %d: invalid SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("pwned: line %d: invalid SHA-1 hash", line)
+		}
+
+		hash = strings.ToUpper(hash)
+		prefix := hash[:PrefixLength]
+		list.ranges[prefix] = append(list.ranges[prefix], hash[PrefixLength:])
+		list.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range list.ranges {
+		sort.Strings(suffixes)
+	}
+
+	return list, nil
+}
+
+// Open loads the list from a file.
+func Open(path string) (*List, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Range returns the sorted hash suffixes starting with the prefix.
+func (l *List) Range(_ context.Context, prefix string) ([]string, error) {
+	return l.ranges[strings.ToUpper(prefix)], nil
+}
+
+// Len returns the number of hashes in the list.
+func (l *List) Len() int {
+	return l.size
+}
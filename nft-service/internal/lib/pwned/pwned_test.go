@@ -0,0 +1,48 @@
+package pwned
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	prefix, suffix := Hash("password")
+	if prefix != "5BAA6" || suffix != "1E4C9B93F3F0682250B6CF8331B7EE68FD8" {
+		t.Errorf("Hash() = %s %s", prefix, suffix)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	list, err := Load(strings.NewReader(`# top leaked passwords
+5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:10434004
+
+7C4A8D09CA3762AF61E59520943DC26494F8941B:37359195
+5BAA6000000000000000000000000000000000FF
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if list.Len() != 3 {
+		t.Errorf("Len() = %d, expected 3", list.Len())
+	}
+
+	suffixes, _ := list.Range(context.Background(), "5baa6")
+	expected := []string{"000000000000000000000000000000000FF", "1E4C9B93F3F0682250B6CF8331B7EE68FD8"}
+	if strings.Join(suffixes, ",") != strings.Join(expected, ",") {
+		t.Errorf("Range() = %v, expected sorted %v", suffixes, expected)
+	}
+
+	if suffixes, _ = list.Range(context.Background(), "00000"); len(suffixes) != 0 {
+		t.Errorf("Range() of an unknown prefix = %v", suffixes)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, input := range []string{"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD", "ZZAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:1"} {
+		if _, err := Load(strings.NewReader(input)); err == nil {
+			t.Errorf("Load(%q) expected an error", input)
+		}
+	}
+}
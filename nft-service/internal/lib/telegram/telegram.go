@@ -0,0 +1,134 @@
+// Package telegram verifies authorization data signed by Telegram with the bot token,
+// see https://core.telegram.org/widgets/login and https://core.telegram.org/bots/webapps.
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockSkew tolerates auth_date slightly ahead of the local clock
+const clockSkew = time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("telegram data signature mismatch")
+	ErrExpired          = errors.New("telegram data expired")
+	ErrMalformed        = errors.New("telegram data malformed")
+)
+
+// User is the Telegram account which signed in.
+type User struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+	Hash      string `json:"-"` // signature of the data, identifies it for replay checks
+}
+
+// ValidateInitData checks the initData string of a Mini App, the key is HMAC of the bot token with "WebAppData".
+func ValidateInitData(initData, botToken string, maxAge time.Duration, now time.Time) (*User, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	fields := make(map[string]string, len(values))
+	for key := range values {
+		fields[key] = values.Get(key)
+	}
+
+	if err = validate(fields, webAppKey(botToken), maxAge, now); err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err = json.Unmarshal([]byte(fields["user"]), &user); err != nil || user.ID == 0 {
+		return nil, ErrMalformed
+	}
+	user.Hash = fields["hash"]
+
+	return &user, nil
+}
+
+// ValidateWidget checks the fields passed by the Login Widget, the key is SHA-256 of the bot token.
+func ValidateWidget(fields map[string]string, botToken string, maxAge time.Duration, now time.Time) (*User, error) {
+	if err := validate(fields, widgetKey(botToken), maxAge, now); err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(fields["id"], 10, 64)
+	if err != nil || id == 0 {
+		return nil, ErrMalformed
+	}
+
+	return &User{
+		ID:        id,
+		FirstName: fields["first_name"],
+		LastName:  fields["last_name"],
+		Username:  fields["username"],
+		Hash:      fields["hash"],
+	}, nil
+}
+
+// sign returns the hash Telegram puts next to the fields
+func sign(fields map[string]string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(dataCheckString(fields)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webAppKey(botToken string) []byte {
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(botToken))
+	return mac.Sum(nil)
+}
+
+func widgetKey(botToken string) []byte {
+	key := sha256.Sum256([]byte(botToken))
+	return key[:]
+}
+
+func validate(fields map[string]string, key []byte, maxAge time.Duration, now time.Time) error {
+	hash, err := hex.DecodeString(fields["hash"])
+	if err != nil || len(hash) == 0 {
+		return ErrMalformed
+	}
+
+	expected, _ := hex.DecodeString(sign(fields, key))
+	if !hmac.Equal(hash, expected) {
+		return ErrInvalidSignature
+	}
+
+	authDate, err := strconv.ParseInt(fields["auth_date"], 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+	signedAt := time.Unix(authDate, 0)
+	if signedAt.After(now.Add(clockSkew)) || now.Sub(signedAt) > maxAge {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// dataCheckString joins all fields except hash as sorted key=value lines
+func dataCheckString(fields map[string]string) string {
+	lines := make([]string, 0, len(fields))
+	for key, value := range fields {
+		if key == "hash" {
+			continue
+		}
+		lines = append(lines, key+"="+value)
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
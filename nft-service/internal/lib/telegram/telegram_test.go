@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const botToken = "123456:test-token"
+
+func TestValidateInitData(t *testing.T) {
+	now := time.Date(2025, 11, 20, 12, 0, 0, 0, time.UTC)
+
+	signed := func(authDate time.Time) url.Values {
+		fields := map[string]string{
+			"auth_date": strconv.FormatInt(authDate.Unix(), 10),
+			"query_id":  "AAHdF6IQAAAAAN0XohDhrOrc",
+			"user":      `{"id":279058397,"first_name":"Vladislav","username":"vdkfrost"}`,
+		}
+		values := url.Values{}
+		for key, value := range fields {
+			values.Set(key, value)
+		}
+		values.Set("hash", sign(fields, webAppKey(botToken)))
+		return values
+	}
+
+	data := signed(now.Add(-time.Minute))
+	user, err := ValidateInitData(data.Encode(), botToken, time.Hour, now)
+	if err != nil {
+		t.Fatalf("ValidateInitData() error = %v", err)
+	}
+	if user.ID != 279058397 || user.Username != "vdkfrost" || user.Hash != data.Get("hash") {
+		t.Errorf("ValidateInitData() user = %+v", user)
+	}
+
+	tampered := signed(now)
+	tampered.Set("user", `{"id":1,"first_name":"Mallory"}`)
+	if _, err = ValidateInitData(tampered.Encode(), botToken, time.Hour, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ValidateInitData() tampered error = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	if _, err = ValidateInitData(signed(now).Encode(), "other:token", time.Hour, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ValidateInitData() other bot error = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	if _, err = ValidateInitData(signed(now.Add(-2*time.Hour)).Encode(), botToken, time.Hour, now); !errors.Is(err, ErrExpired) {
+		t.Errorf("ValidateInitData() old error = %v, expected %v", err, ErrExpired)
+	}
+
+	if _, err = ValidateInitData("user=1", botToken, time.Hour, now); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ValidateInitData() without hash error = %v, expected %v", err, ErrMalformed)
+	}
+}
+
+func TestValidateWidget(t *testing.T) {
+	now := time.Date(2025, 11, 20, 12, 0, 0, 0, time.UTC)
+	fields := map[string]string{
+		"id":         "279058397",
+		"first_name": "Vladislav",
+		"auth_date":  strconv.FormatInt(now.Unix(), 10),
+	}
+	fields["hash"] = sign(fields, widgetKey(botToken))
+
+	user, err := ValidateWidget(fields, botToken, time.Hour, now)
+	if err != nil {
+		t.Fatalf("ValidateWidget() error = %v", err)
+	}
+	if user.ID != 279058397 || user.FirstName != "Vladislav" {
+		t.Errorf("ValidateWidget() user = %+v", user)
+	}
+
+	// the widget and Mini Apps use different keys
+	if _, err = ValidateInitData(url.Values{"hash": {fields["hash"]}, "id": {"279058397"},
+		"first_name": {"Vladislav"}, "auth_date": {fields["auth_date"]}}.Encode(), botToken, time.Hour, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ValidateInitData() with widget hash error = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	fields["id"] = "1"
+	if _, err = ValidateWidget(fields, botToken, time.Hour, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ValidateWidget() tampered error = %v, expected %v", err, ErrInvalidSignature)
+	}
+}
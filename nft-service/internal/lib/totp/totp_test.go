@@ -0,0 +1,80 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// last 6 digits of the 8 digit codes from RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("Code(%d) = %s, expected %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current, _ := Code(rfcSecret, Counter(now))
+	previous, _ := Code(rfcSecret, Counter(now)-1)
+	old, _ := Code(rfcSecret, Counter(now)-3)
+
+	if counter, ok := Validate(rfcSecret, current, now, 1); !ok || counter != Counter(now) {
+		t.Errorf("Validate(current) = %d, %v", counter, ok)
+	}
+	if counter, ok := Validate(rfcSecret, previous, now, 1); !ok || counter != Counter(now)-1 {
+		t.Errorf("Validate(previous) = %d, %v", counter, ok)
+	}
+	if _, ok := Validate(rfcSecret, previous, now, 0); ok {
+		t.Error("Validate() accepted the previous step without skew")
+	}
+	if _, ok := Validate(rfcSecret, old, now, 1); ok {
+		t.Error("Validate() accepted an expired code")
+	}
+	if _, ok := Validate("not base32!", current, now, 1); ok {
+		t.Error("Validate() accepted an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("GenerateSecret() length = %d, expected 32", len(secret))
+	}
+	if _, err = Code(secret, 1); err != nil {
+		t.Errorf("Code() error = %v for a generated secret", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("GADS NFT", "79999999999", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/GADS%20NFT:79999999999?") {
+		t.Errorf("URI() = %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=GADS+NFT") {
+		t.Errorf("URI() = %s", uri)
+	}
+}
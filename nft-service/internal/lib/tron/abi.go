@@ -0,0 +1,127 @@
+package tron
+
+import (
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// WordSize is the size of a single ABI slot
+const WordSize = 32
+
+var (
+	ErrShortData = errors.New("abi data too short")
+	ErrOverflow  = errors.New("abi value overflows int64")
+)
+
+// Keccak256 hashes data the same way the TVM/EVM does.
+func Keccak256(data ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hash.Write(d)
+	}
+	return hash.Sum(nil)
+}
+
+// Selector returns the 4 byte function selector for a canonical signature like "ownerOf(uint256)".
+func Selector(signature string) []byte {
+	return Keccak256([]byte(signature))[:4]
+}
+
+// EventTopic returns topic0 for a canonical event signature like "Transfer(address,address,uint256)".
+func EventTopic(signature string) []byte {
+	return Keccak256([]byte(signature))
+}
+
+// EncodeUint256 encodes a non-negative integer into an ABI slot.
+func EncodeUint256(value *big.Int) []byte {
+	word := make([]byte, WordSize)
+	value.FillBytes(word)
+	return word
+}
+
+// EncodeInt64 encodes a non-negative int64 into an ABI slot.
+func EncodeInt64(value int64) []byte {
+	return EncodeUint256(big.NewInt(value))
+}
+
+// EncodeAddress encodes an address into an ABI slot.
+func EncodeAddress(addr Address) []byte {
+	word := make([]byte, WordSize)
+	copy(word[WordSize-len(addr.EVM()):], addr.EVM())
+	return word
+}
+
+// Word returns the slot with the given index.
+func Word(data []byte, index int) ([]byte, error) {
+	start := index * WordSize
+	if index < 0 || len(data) < start+WordSize {
+		return nil, ErrShortData
+	}
+	return data[start : start+WordSize], nil
+}
+
+// DecodeUint256 decodes the slot with the given index as uint256.
+func DecodeUint256(data []byte, index int) (*big.Int, error) {
+	word, err := Word(data, index)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(word), nil
+}
+
+// DecodeInt64 decodes the slot with the given index as uint256 which must fit into int64.
+func DecodeInt64(data []byte, index int) (int64, error) {
+	value, err := DecodeUint256(data, index)
+	if err != nil {
+		return 0, err
+	}
+	if !value.IsInt64() {
+		return 0, tvoerrors.Wrap(value.String(), ErrOverflow)
+	}
+	return value.Int64(), nil
+}
+
+// DecodeAddress decodes the slot with the given index as address.
+func DecodeAddress(data []byte, index int) (Address, error) {
+	word, err := Word(data, index)
+	if err != nil {
+		return Address{}, err
+	}
+	return AddressFromBytes(word[WordSize-(AddressLength-1):])
+}
+
+// DecodeBool decodes the slot with the given index as bool.
+func DecodeBool(data []byte, index int) (bool, error) {
+	value, err := DecodeUint256(data, index)
+	if err != nil {
+		return false, err
+	}
+	return value.Sign() != 0, nil
+}
+
+// DecodeString decodes a dynamic string whose offset is stored in the slot with the given index.
+func DecodeString(data []byte, index int) (string, error) {
+	offset, err := DecodeInt64(data, index)
+	if err != nil {
+		return "", err
+	}
+	if offset%WordSize != 0 || offset >= int64(len(data)) {
+		return "", ErrShortData
+	}
+
+	length, err := DecodeInt64(data, int(offset/WordSize))
+	if err != nil {
+		return "", err
+	}
+
+	start := offset + WordSize
+	if length < 0 || int64(len(data)) < start+length {
+		return "", ErrShortData
+	}
+
+	return string(data[start : start+length]), nil
+}
@@ -0,0 +1,113 @@
+package tron
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/mr-tron/base58"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// AddressPrefix is the first byte of every mainnet and testnet TRON address
+const AddressPrefix byte = 0x41
+
+// AddressLength is the length of a TRON address in bytes (prefix + 20 bytes of EVM address)
+const AddressLength = 21
+
+var ErrInvalidAddress = errors.New("invalid tron address")
+
+// Address is a TRON account address in its raw 21 byte form
+type Address [AddressLength]byte
+
+// ZeroAddress is the address used as from/to in mint and burn events
+var ZeroAddress = Address{AddressPrefix}
+
+// AddressFromBase58 parses a base58check address like "TLuKAnxTLK99naFoKF7bQGE5c5sWiGubPu".
+func AddressFromBase58(s string) (Address, error) {
+	var addr Address
+
+	raw, err := base58.Decode(s)
+	if err != nil || len(raw) != AddressLength+4 {
+		return addr, tvoerrors.Wrap(s, ErrInvalidAddress)
+	}
+
+	payload, checksum := raw[:AddressLength], raw[AddressLength:]
+	if !bytes.Equal(doubleSha256(payload)[:4], checksum) || payload[0] != AddressPrefix {
+		return addr, tvoerrors.Wrap(s, ErrInvalidAddress)
+	}
+
+	copy(addr[:], payload)
+	return addr, nil
+}
+
+// AddressFromHex parses a hex address either in TRON form (41 + 20 bytes) or in EVM form (20 bytes), with optional 0x.
+func AddressFromHex(s string) (Address, error) {
+	var addr Address
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if err != nil {
+		return addr, tvoerrors.Wrap(s, ErrInvalidAddress)
+	}
+
+	return AddressFromBytes(raw)
+}
+
+// AddressFromBytes converts 21 byte TRON or 20 byte EVM address bytes.
+func AddressFromBytes(raw []byte) (Address, error) {
+	var addr Address
+
+	switch {
+	case len(raw) == AddressLength && raw[0] == AddressPrefix:
+		copy(addr[:], raw)
+	case len(raw) == AddressLength-1:
+		addr[0] = AddressPrefix
+		copy(addr[1:], raw)
+	default:
+		return addr, tvoerrors.Wrap(hex.EncodeToString(raw), ErrInvalidAddress)
+	}
+
+	return addr, nil
+}
+
+// ParseAddress accepts both base58 and hex notations.
+func ParseAddress(s string) (Address, error) {
+	if strings.HasPrefix(s, "T") {
+		return AddressFromBase58(s)
+	}
+	return AddressFromHex(s)
+}
+
+// Base58 returns the base58check notation used by wallets.
+func (a Address) Base58() string {
+	return base58.Encode(append(a[:], doubleSha256(a[:])[:4]...))
+}
+
+// Hex returns the TRON hex notation (41...).
+func (a Address) Hex() string {
+	return hex.EncodeToString(a[:])
+}
+
+// EVM returns the 20 byte address used inside ABI encoded data.
+func (a Address) EVM() []byte {
+	return a[1:]
+}
+
+// IsZero checks for the zero address.
+func (a Address) IsZero() bool {
+	return a == ZeroAddress || a == Address{}
+}
+
+// String implements fmt.Stringer.
+func (a Address) String() string {
+	return a.Base58()
+}
+
+func doubleSha256(b []byte) []byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
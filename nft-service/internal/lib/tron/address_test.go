@@ -0,0 +1,57 @@
+package tron
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddressConversion(t *testing.T) {
+	tests := []struct {
+		hex    string
+		base58 string
+	}{
+		{"4177ecde50c4eb5e455e9529068f7f21a3f5d1f5fd", "TLuKAnxTLK99naFoKF7bQGE5c5sWiGubPu"},
+		{"4183391e606712102ce67b15fe78467fbd86240258", "TMw3wrzYrDBq7tn87Svuv39GrfnhDxHBwh"},
+	}
+
+	for _, test := range tests {
+		fromHex, err := AddressFromHex(test.hex)
+		if err != nil {
+			t.Fatalf("AddressFromHex(%q) error = %v", test.hex, err)
+		}
+		if fromHex.Base58() != test.base58 {
+			t.Errorf("AddressFromHex(%q).Base58() = %q, expected %q", test.hex, fromHex.Base58(), test.base58)
+		}
+
+		fromBase58, err := AddressFromBase58(test.base58)
+		if err != nil {
+			t.Fatalf("AddressFromBase58(%q) error = %v", test.base58, err)
+		}
+		if fromBase58.Hex() != test.hex {
+			t.Errorf("AddressFromBase58(%q).Hex() = %q, expected %q", test.base58, fromBase58.Hex(), test.hex)
+		}
+
+		evm, err := AddressFromHex("0x" + test.hex[2:])
+		if err != nil || evm != fromHex {
+			t.Errorf("AddressFromHex(0x%s) = %v, %v, expected %v", test.hex[2:], evm, err, fromHex)
+		}
+
+		parsed, err := ParseAddress(test.base58)
+		if err != nil || parsed != fromHex {
+			t.Errorf("ParseAddress(%q) = %v, %v, expected %v", test.base58, parsed, err, fromHex)
+		}
+	}
+}
+
+func TestAddressInvalid(t *testing.T) {
+	for _, value := range []string{
+		"TLuKAnxTLK99naFoKF7bQGE5c5sWiGubPv", // broken checksum
+		"TLuKAnxTLK99naFoKF7bQGE5c5sWiG",
+		"0x1234",
+		"zz",
+	} {
+		if _, err := ParseAddress(value); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("ParseAddress(%q) error = %v, expected %v", value, err, ErrInvalidAddress)
+		}
+	}
+}
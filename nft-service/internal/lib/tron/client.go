@@ -0,0 +1,119 @@
+package tron
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// revertSelector is the selector of Error(string) returned by reverted calls
+const revertSelector = "08c379a0"
+
+var ErrReverted = errors.New("contract call reverted")
+
+// Client is a read-only client for the TRON full node HTTP API (TronGrid compatible).
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient creates a new TRON HTTP API client.
+func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+type triggerConstantRequest struct {
+	OwnerAddress     string `json:"owner_address"`
+	ContractAddress  string `json:"contract_address"`
+	FunctionSelector string `json:"function_selector"`
+	Parameter        string `json:"parameter"`
+	Visible          bool   `json:"visible"`
+}
+
+type triggerConstantResponse struct {
+	Result struct {
+		Result  bool   `json:"result"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"result"`
+	ConstantResult []string `json:"constant_result"`
+}
+
+// TriggerConstant calls a view function of the contract and returns the ABI encoded result.
+// signature is the canonical function signature, params are the ABI encoded arguments.
+func (c *Client) TriggerConstant(ctx context.Context, contract Address, signature string, params []byte) ([]byte, error) {
+	const op = "tron.Client.TriggerConstant"
+
+	var response triggerConstantResponse
+	if err := c.post(ctx, "/wallet/triggerconstantcontract", triggerConstantRequest{
+		OwnerAddress:     ZeroAddress.Hex(),
+		ContractAddress:  contract.Hex(),
+		FunctionSelector: signature,
+		Parameter:        hex.EncodeToString(params),
+	}, &response); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if !response.Result.Result || response.Result.Code != "" {
+		message, _ := hex.DecodeString(response.Result.Message)
+		return nil, tvoerrors.Wrap(op, tvoerrors.Wrap(fmt.Sprintf("%s %s: %s", signature, response.Result.Code, message), ErrReverted))
+	}
+	if len(response.ConstantResult) == 0 {
+		return nil, tvoerrors.Wrap(op, ErrShortData)
+	}
+
+	result, err := hex.DecodeString(response.ConstantResult[0])
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if strings.HasPrefix(response.ConstantResult[0], revertSelector) {
+		reason, _ := DecodeString(result[4:], 0)
+		return nil, tvoerrors.Wrap(op, tvoerrors.Wrap(signature+": "+reason, ErrReverted))
+	}
+
+	return result, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body, response interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("tron api error: %s, body: %s", resp.Status, string(bodyBytes))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
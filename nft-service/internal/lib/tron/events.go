@@ -0,0 +1,85 @@
+package tron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// Event is a contract event decoded by the TronGrid event API
+type Event struct {
+	TxID           string            `json:"transaction_id"`
+	BlockNumber    int64             `json:"block_number"`
+	BlockTimestamp int64             `json:"block_timestamp"`
+	EventName      string            `json:"event_name"`
+	Result         map[string]string `json:"result"`
+}
+
+// EventPage is a single page of contract events
+type EventPage struct {
+	Events      []Event
+	Fingerprint string // empty on the last page
+}
+
+type eventsResponse struct {
+	Data    []Event `json:"data"`
+	Success bool    `json:"success"`
+	Error   string  `json:"error"`
+	Meta    struct {
+		Fingerprint string `json:"fingerprint"`
+	} `json:"meta"`
+}
+
+// ContractEvents returns confirmed events of the contract starting at minTimestamp (ms, inclusive)
+// in ascending order. Pass the fingerprint of the previous page to continue.
+func (c *Client) ContractEvents(ctx context.Context, contract Address, minTimestamp int64, fingerprint string, limit int) (*EventPage, error) {
+	const op = "tron.Client.ContractEvents"
+
+	query := url.Values{}
+	query.Set("only_confirmed", "true")
+	query.Set("order_by", "block_timestamp,asc")
+	query.Set("min_block_timestamp", strconv.FormatInt(minTimestamp, 10))
+	query.Set("limit", strconv.Itoa(limit))
+	if fingerprint != "" {
+		query.Set("fingerprint", fingerprint)
+	}
+
+	link := fmt.Sprintf("%s/v1/contracts/%s/events?%s", c.baseURL, contract.Base58(), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, tvoerrors.Wrap(op, fmt.Errorf("tron api error: %s, body: %s", resp.Status, string(bodyBytes)))
+	}
+
+	var response eventsResponse
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if !response.Success && response.Error != "" {
+		return nil, tvoerrors.Wrap(op, fmt.Errorf("tron api error: %s", response.Error))
+	}
+
+	return &EventPage{
+		Events:      response.Data,
+		Fingerprint: response.Meta.Fingerprint,
+	}, nil
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// APIKey is a credential of a machine client acting on behalf of a user, limited to Scopes
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Name       string     `json:"name"`
+	UserID     int64      `json:"user_id"`
+	RoleID     RoleId     `json:"-"` // current role of the user, loaded with the key
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  int64      `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+
+	OwnerLockedUntil *time.Time `json:"-"` // lockout of the user, loaded with the key
+	OwnerDeletedAt   *time.Time `json:"-"` // soft deletion of the user, loaded with the key
+}
+
+// Active reports whether the key can be used at the moment
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(now))
+}
+
+// OwnerActive reports whether the user of the key is neither locked nor deleted at the moment
+func (k *APIKey) OwnerActive(now time.Time) bool {
+	return k.OwnerDeletedAt == nil && (k.OwnerLockedUntil == nil || !k.OwnerLockedUntil.After(now))
+}
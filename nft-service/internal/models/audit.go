@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audited actions, named <target type>.<verb>
+const (
+	AuditUserDelete = "user.delete"
+	AuditUserDigup  = "user.digup"
+	AuditRoleChange = "user.role_change"
+	AuditTokenReset = "user.token_reset"
+	AuditNftCreate  = "nft.create"
+	AuditPinAdd     = "pin.add"
+	AuditPinRemove  = "pin.remove"
+	AuditUserExport = "user.export"
+	AuditUserPurge  = "user.purge"
+
+	AuditUserImpersonate     = "user.impersonate"
+	AuditImpersonatedRequest = "user.impersonated_request"
+	AuditInviteCreate        = "invite.create"
+	AuditInviteRevoke        = "invite.revoke"
+)
+
+// Target types of audited actions
+const (
+	AuditTargetUser   = "user"
+	AuditTargetNft    = "nft"
+	AuditTargetPin    = "pin"
+	AuditTargetInvite = "invite"
+)
+
+// AuditEntry is a record of the append-only audit log
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id"`
+	APIKeyID   int64           `json:"api_key_id,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects audit entries, zero fields don't filter
+type AuditFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+	Limit      int
+	Offset     int
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Invite is a registration code issued by an admin. It may preassign a role to the registered users
+// and credit them to a referrer.
+type Invite struct {
+	ID         int64      `json:"id"`
+	Code       string     `json:"code"`
+	RoleID     RoleId     `json:"role_id"` // 0 - the default role
+	MaxUses    int        `json:"max_uses"`
+	Uses       int        `json:"uses"`
+	ReferrerID int64      `json:"referrer_id"`
+	CreatedBy  int64      `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	RoleName   string     `json:"role_name,omitempty"` // set by InviteRepository.List
+}
+
+// Usable reports whether a user can register with the code at the moment
+func (i *Invite) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && (i.ExpiresAt == nil || i.ExpiresAt.After(now)) && i.Uses < i.MaxUses
+}
+
+// ReferralStat counts users credited to a referrer
+type ReferralStat struct {
+	ReferrerID int64
+	Users      int
+	FirstAt    time.Time
+	LastAt     time.Time
+}
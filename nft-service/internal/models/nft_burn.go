@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// NftBurn represents a burn of a token observed by the indexer
+type NftBurn struct {
+	TokenId      int64      `json:"token_id"`
+	OwnerAddress string     `json:"owner_address"`
+	TxId         string     `json:"tx_id"`
+	BlockNumber  int64      `json:"block_number"`
+	BurnedAt     time.Time  `json:"burned_at"`
+	UnpinnedAt   *time.Time `json:"unpinned_at"`
+	UnpinError   string     `json:"unpin_error"`
+	CidV0        string     `json:"cid_v0"`
+}
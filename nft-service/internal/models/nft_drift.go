@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type DriftKind string
+
+const (
+	DriftMissingURI     DriftKind = "missing_uri"          // tokenURI is empty, setTokenURI/setBaseURI was never called
+	DriftUnreachable    DriftKind = "metadata_unreachable" // metadata referenced by tokenURI can't be fetched or parsed
+	DriftStaleCID       DriftKind = "stale_cid"            // image CID in the metadata differs from nft_data
+	DriftDescription    DriftKind = "description_mismatch" // description in the metadata differs from nft_data
+	DriftOnlyOnChain    DriftKind = "only_on_chain"        // token is minted but has no nft_data row
+	DriftOnlyInService  DriftKind = "only_in_service"      // nft_data row exists but the token is not minted or burned
+	DriftChainReadError DriftKind = "chain_read_error"     // contract call failed
+)
+
+// DriftRun represents a single run of the metadata drift detector
+type DriftRun struct {
+	ID            int64     `json:"id"`
+	TokensChecked int       `json:"tokens_checked"`
+	Issues        int       `json:"issues"`
+	Error         string    `json:"error"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+}
+
+// DriftIssue represents a mismatch between the contract and the service for a token
+type DriftIssue struct {
+	ID         int64     `json:"id"`
+	RunID      int64     `json:"run_id"`
+	TokenId    int64     `json:"token_id"`
+	Kind       DriftKind `json:"kind"`
+	OnChainURI string    `json:"on_chain_uri"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// NftOwner represents the indexed on-chain owner of a token
+type NftOwner struct {
+	TokenId      int64     `json:"token_id"`
+	OwnerAddress string    `json:"owner_address"`
+	BlockNumber  int64     `json:"block_number"`
+	TxId         string    `json:"tx_id"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserWallet represents a wallet address linked to a user
+type UserWallet struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Address   string    `json:"address"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// NftUnlockable represents the encrypted private payload of a token
+type NftUnlockable struct {
+	TokenId      int64     `json:"token_id"`
+	Ciphertext   []byte    `json:"-"`
+	Nonce        []byte    `json:"-"`
+	WrappedKey   []byte    `json:"-"`
+	KeyNonce     []byte    `json:"-"`
+	MasterKeyID  string    `json:"master_key_id"`
+	OwnerAddress string    `json:"owner_address"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// NftUnlockableAccess represents a single reveal of the private payload
+type NftUnlockableAccess struct {
+	ID        int64     `json:"id"`
+	TokenId   int64     `json:"token_id"`
+	UserID    int64     `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
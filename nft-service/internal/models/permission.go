@@ -0,0 +1,29 @@
+package models
+
+import "strings"
+
+// Permission names stored in the permissions table, roles are granted them via role_permissions
+const (
+	PermNftRead          = "nft:read"
+	PermNftCreate        = "nft:create"
+	PermNftManageOwn     = "nft:manage_own" // only tokens created by the user
+	PermNftManageAny     = "nft:manage_any"
+	PermNftReadBurned    = "nft:read_burned"
+	PermUnlockableRotate = "unlockable:rotate"
+	PermDriftRead        = "drift:read"
+	PermDriftRun         = "drift:run"
+	PermUsersList        = "users:list"
+	PermUsersUnlock      = "users:unlock"
+	PermUsersManage      = "users:manage"
+	PermRolesChange      = "roles:change"
+	PermPinsWrite        = "pins:write"
+	PermAPIKeysManage    = "api_keys:manage"
+	PermAuditRead        = "audit:read"
+	PermUsersImpersonate = "users:impersonate"
+	PermInvitesManage    = "invites:manage"
+)
+
+// ManagesAccounts reports whether the permission changes other users or roles, e.g. users:manage or roles:change
+func ManagesAccounts(permission string) bool {
+	return strings.HasPrefix(permission, "users:") || strings.HasPrefix(permission, "roles:")
+}
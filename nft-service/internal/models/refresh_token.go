@@ -6,10 +6,14 @@ import (
 
 // UserToken represents the structure of a user token
 type UserToken struct {
-	ID               int64     `json:"id"`
-	UserID           int64     `json:"user_id"`
-	Token            string    `json:"token"`
-	RefreshToken     string    `json:"refresh_token"`
-	ExpiredAt        time.Time `json:"expired_at"`
-	RefreshExpiredAt time.Time `json:"refresh_expired_at"`
+	ID               int64      `json:"id"`
+	UserID           int64      `json:"user_id"`
+	Token            string     `json:"token"`
+	RefreshToken     string     `json:"refresh_token"`
+	ExpiredAt        time.Time  `json:"expired_at"`
+	RefreshExpiredAt time.Time  `json:"refresh_expired_at"`
+	FamilyID         string     `json:"family_id"`  // all refresh tokens rotated from one login
+	ParentID         int64      `json:"parent_id"`  // token which was rotated into this one
+	RotatedAt        *time.Time `json:"rotated_at"` // refresh token was already exchanged
+	CreatedAt        time.Time  `json:"created_at"`
 }
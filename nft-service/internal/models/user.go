@@ -1,18 +1,98 @@
 package models
 
 import (
+	"strconv"
 	"time"
 )
 
 // User represents the structure of a user entity
 type User struct {
-	ID            int64     `json:"id"`
-	Phone         string    `json:"phone"`
-	Password      string    `json:"-"`
-	Salt          []byte    `json:"-"`
-	RoleID        RoleId    `json:"role_id"`
-	CreatedAt     time.Time `json:"-"`
-	UpdatedAt     time.Time `json:"-"`
-	DeletedAt     time.Time `json:"-"`
-	LastVisitedAt time.Time `json:"-"`
+	ID              int64       `json:"id"`
+	Phone           string      `json:"phone"` // empty for accounts registered by email
+	Email           string      `json:"email"`
+	Password        string      `json:"-"`
+	Salt            []byte      `json:"-"`
+	RoleID          RoleId      `json:"role_id"`
+	CreatedAt       time.Time   `json:"-"`
+	UpdatedAt       time.Time   `json:"-"`
+	DeletedAt       time.Time   `json:"-"`
+	LastVisitedAt   time.Time   `json:"-"`
+	LockedUntil     *time.Time  `json:"-"` // set while the account is locked after failed logins
+	EmailVerifiedAt *time.Time  `json:"-"`
+	TelegramID      int64       `json:"-"` // 0 when no Telegram account is linked
+	Profile         UserProfile `json:"-"` // loaded by UserById and ListUsers only
+	RoleName        string      `json:"-"` // loaded by ListUsers only
+}
+
+// PasswordHash is a stored password hash, Salt is set only for the legacy format
+type PasswordHash struct {
+	Hash string
+	Salt []byte
+}
+
+// User states the admin list is filtered by, an empty state lists active users
+const (
+	UserStateActive  = "active"
+	UserStateDeleted = "deleted"
+	UserStateAll     = "all"
+)
+
+// Fields the admin user list can be sorted by
+const (
+	UserSortID        = "id"
+	UserSortCreatedAt = "created_at"
+	UserSortLastVisit = "last_visited_at"
+	UserSortPhone     = "phone"
+	UserSortEmail     = "email"
+)
+
+var UserSortFields = []string{UserSortID, UserSortCreatedAt, UserSortLastVisit, UserSortPhone, UserSortEmail}
+
+// UserFilter selects users for the admin list, zero fields don't filter
+type UserFilter struct {
+	RoleID      RoleId
+	Phone       string     // substring
+	Email       string     // substring, case insensitive
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	VisitedFrom *time.Time // inclusive
+	VisitedTo   *time.Time // exclusive
+	State       string
+	Sort        string // one of UserSortFields, id by default
+	Desc        bool
+	Limit       int
+	Offset      int
+}
+
+// UserProfile is the data the user shows to others and edits in the account
+type UserProfile struct {
+	DisplayName string   `json:"display_name"`
+	AvatarCID   string   `json:"avatar_cid"`
+	Locale      string   `json:"locale"`
+	Wallets     []string `json:"wallets"` // linked wallet addresses, read only
+}
+
+// Locked reports whether the account is locked at the moment
+func (u *User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(now)
+}
+
+// VerifiedEmail returns the email if it is confirmed, unconfirmed addresses are never trusted
+func (u *User) VerifiedEmail() string {
+	if u.EmailVerifiedAt == nil {
+		return ""
+	}
+	return u.Email
+}
+
+// LoginID returns the identifier the user logs in with, it keys failed login counters
+func (u *User) LoginID() string {
+	switch {
+	case u.Phone != "":
+		return u.Phone
+	case u.Email != "":
+		return u.Email
+	default:
+		return "telegram:" + strconv.FormatInt(u.TelegramID, 10)
+	}
 }
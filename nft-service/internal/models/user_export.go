@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserExport is the archive of all data tied to a user, handed out on request of the user
+type UserExport struct {
+	ExportedAt      time.Time       `json:"exported_at"`
+	Account         ExportAccount   `json:"account"`
+	Identities      []UserIdentity  `json:"identities"`
+	Sessions        []UserSession   `json:"sessions"`
+	APIKeys         []APIKey        `json:"api_keys"`
+	AuditLog        []AuditEntry    `json:"audit_log"` // actions of the user and actions on the user
+	OwnedNfts       []NftOwner      `json:"owned_nfts"`
+	Referral        *ExportReferral `json:"referral"`         // nil for users registered without an invite
+	PasswordChanges []time.Time     `json:"password_changes"` // times previous passwords were replaced, hashes are not exported
+}
+
+// ExportReferral is the invite the user registered with and the user credited for the registration
+type ExportReferral struct {
+	ReferrerID int64  `json:"referrer_id,omitempty"`
+	InviteID   int64  `json:"invite_id,omitempty"`
+	InviteCode string `json:"invite_code,omitempty"`
+}
+
+// ExportAccount is the account part of UserExport
+type ExportAccount struct {
+	ID              int64       `json:"id"`
+	Phone           string      `json:"phone"`
+	Email           string      `json:"email"`
+	EmailVerifiedAt *time.Time  `json:"email_verified_at"`
+	TelegramID      int64       `json:"telegram_id,omitempty"`
+	RoleID          RoleId      `json:"role_id"`
+	Profile         UserProfile `json:"profile"`
+}
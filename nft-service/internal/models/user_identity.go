@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity links an account of an external OpenID provider to a user
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
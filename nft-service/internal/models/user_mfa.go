@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// UserMFA is the TOTP second factor of a user, it is pending until the first code is confirmed
+type UserMFA struct {
+	UserID      int64      `json:"user_id"`
+	Secret      string     `json:"-"` // encrypted, see service.MFAService
+	LastCounter int64      `json:"-"` // time step of the last accepted code
+	CreatedAt   time.Time  `json:"created_at"`
+	EnabledAt   *time.Time `json:"enabled_at"`
+}
+
+// Enabled reports whether the enrollment was confirmed
+func (m *UserMFA) Enabled() bool {
+	return m.EnabledAt != nil
+}
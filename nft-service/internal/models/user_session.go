@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserSession represents a single login of a user (a device), it owns a family of user tokens
+type UserSession struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	FamilyID   string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"` // loaded by AllByUser only
+}
@@ -12,42 +12,160 @@ import (
 type RoleRepository interface {
 	RoleByName(ctx context.Context, roleName string) (*models.Role, error)
 	RoleById(ctx context.Context, roleId int64) (*models.Role, error)
+	RolePermissions(ctx context.Context) (map[models.RoleId][]string, error)
 }
 
 // UserTokenRepository provides methods for managing user tokens.
 type UserTokenRepository interface {
-	Create(ctx context.Context, id int64, accessToken, refreshToken string, tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error)
+	Create(ctx context.Context, id int64, familyId, accessToken, refreshToken string, tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error)
 	GetRefreshToken(ctx context.Context, refresh string) (*models.UserToken, error)
+	Rotate(ctx context.Context, parent *models.UserToken, accessToken, refreshToken string, tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error)
+	RevokeFamily(ctx context.Context, familyId string) error
+	FamilyTokens(ctx context.Context, familyId string) ([]string, error)
 	DeleteRefreshToken(ctx context.Context, token string) error
 	TokenReset(ctx context.Context, userID int64) error
 	ActiveTokens(ctx context.Context, userID int64) ([]models.UserToken, error)
 	GetUserIdByToken(ctx context.Context, token string) (*models.UserToken, error)
 }
 
+// SessionRepository provides methods for managing user sessions (devices).
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.UserSession) error
+	Touch(ctx context.Context, familyId string) error
+	TouchMany(ctx context.Context, visits map[string]time.Time) error
+	ActiveByUser(ctx context.Context, userId int64) ([]models.UserSession, error)
+	ActiveByID(ctx context.Context, userId, id int64) (*models.UserSession, error)
+	AllByUser(ctx context.Context, userId int64) ([]models.UserSession, error)
+	Revoke(ctx context.Context, id int64) error
+}
+
+// MFARepository provides methods for managing TOTP second factors and recovery codes.
+type MFARepository interface {
+	ByUser(ctx context.Context, userId int64) (*models.UserMFA, error)
+	SavePending(ctx context.Context, userId int64, secret string) error
+	Enable(ctx context.Context, userId int64, codeHashes []string) error
+	UseCounter(ctx context.Context, userId, counter int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (bool, error)
+	Delete(ctx context.Context, userId int64) error
+}
+
+// APIKeyRepository provides methods for managing API keys of machine clients.
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	ByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	List(ctx context.Context, userId int64) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id int64) error
+	Touch(ctx context.Context, id int64, at time.Time) error
+}
+
+// InviteRepository provides access to registration invite codes and referrals.
+type InviteRepository interface {
+	Create(ctx context.Context, invite *models.Invite) error
+	ByCode(ctx context.Context, code string) (*models.Invite, error)
+	List(ctx context.Context) ([]models.Invite, error)
+	Revoke(ctx context.Context, id int64) error
+	Referrals(ctx context.Context, from, to *time.Time) ([]models.ReferralStat, error)
+}
+
+// AuditRepository provides methods for the append-only audit log.
+type AuditRepository interface {
+	Append(ctx context.Context, entry *models.AuditEntry) error
+	List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error)
+	Each(ctx context.Context, filter models.AuditFilter, fn func(entry *models.AuditEntry) error) error
+}
+
+// IdentityRepository provides methods for managing identities of external OpenID providers.
+type IdentityRepository interface {
+	ByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	ByUser(ctx context.Context, userId int64) ([]models.UserIdentity, error)
+	Link(ctx context.Context, identity *models.UserIdentity) error
+	CreateUser(ctx context.Context, email string, identity *models.UserIdentity) (*models.User, error)
+}
+
 // UserRepository provides methods for managing user-related operations.
 type UserRepository interface {
 	PhoneExists(ctx context.Context, phoneNumber string) (bool, error)
 	UserByPhone(ctx context.Context, phone string) (*models.User, error)
 	UserById(ctx context.Context, id int64) (*models.User, error)
 	UpdateTelegramId(ctx context.Context, id, telegramId int64) error
-	CreateUser(ctx context.Context, phone, password string) (*models.User, error)
-	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateProfile(ctx context.Context, id int64, displayName, locale *string) error
+	SetAvatar(ctx context.Context, id int64, cid string) error
+	UserByTelegramId(ctx context.Context, telegramId int64) (*models.User, error)
+	CreateUserByTelegram(ctx context.Context, telegramId int64) (*models.User, error)
+	CreateUser(ctx context.Context, phone, password, inviteCode string) (*models.User, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	UserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateUserByEmail(ctx context.Context, email, password, inviteCode string) (*models.User, error)
+	SetEmail(ctx context.Context, id int64, email string, verified bool) error
+	VerifyEmail(ctx context.Context, email string) error
+	UpdatePassword(ctx context.Context, id int64, password string, keep int) error
+	PasswordHistory(ctx context.Context, id int64, limit int) ([]models.PasswordHash, error)
+	UpdatePasswordHash(ctx context.Context, id int64, hash string) error
 	UpdateLastVisit(ctx context.Context, id int64) error
+	UpdateLastVisits(ctx context.Context, visits map[int64]time.Time) error
 	DeleteUser(ctx context.Context, id int64) error
 	DigUpUser(ctx context.Context, id int64) (*models.User, error)
 	UpdatePhone(ctx context.Context, phone string, id int64) error
 	ChangeRole(ctx context.Context, id, roleId int64) error
-	ListUsers(ctx context.Context, limit, offset int) ([]models.User, int, error)
+	ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int, error)
+	LockUntil(ctx context.Context, id int64, until time.Time) error
+	Unlock(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time, limit int) ([]int64, error)
 }
 
 type NftDataRepository interface {
 	CreateNftData(ctx context.Context, nftData *dto.NftData) error
 	ReadNftData(ctx context.Context, tokenId int64) (models.NftDataModel, error)
-	ReadAllNftData(ctx context.Context, limit int) ([]models.NftDataModel, error)
+	ReadAllNftData(ctx context.Context, limit int, includeBurned bool) ([]models.NftDataModel, error)
 	TokenIdExists(ctx context.Context, tokenId int64) (bool, error)
+	TokenIds(ctx context.Context) ([]int64, error)
 }
 
 type NftImageRepository interface {
 	Create(ctx context.Context, image *models.NftImage) error
 	GetByTokenID(ctx context.Context, tokenID int64) (*models.NftImage, error)
 }
+
+// OwnershipRepository provides access to the indexed on-chain ownership of tokens.
+type OwnershipRepository interface {
+	OwnerOf(ctx context.Context, tokenId int64) (*models.NftOwner, error)
+	UpsertOwner(ctx context.Context, owner *models.NftOwner) error
+	TokenIds(ctx context.Context) ([]int64, error)
+	UserOwnsToken(ctx context.Context, userId, tokenId int64) (bool, error)
+	UserOwnsAny(ctx context.Context, userId int64) (bool, error)
+	LinkWallet(ctx context.Context, userId int64, address string) error
+	UserByWallet(ctx context.Context, address string) (int64, error)
+	WalletsByUser(ctx context.Context, userId int64) ([]models.UserWallet, error)
+	TokensByUser(ctx context.Context, userId int64) ([]models.NftOwner, error)
+}
+
+// UnlockableRepository provides methods for managing encrypted token payloads.
+type UnlockableRepository interface {
+	Save(ctx context.Context, unlockable *models.NftUnlockable) error
+	GetByTokenID(ctx context.Context, tokenId int64) (*models.NftUnlockable, error)
+	ListByMasterKey(ctx context.Context, excludeKeyID string, limit int) ([]models.NftUnlockable, error)
+	LogAccess(ctx context.Context, access *models.NftUnlockableAccess) error
+}
+
+// DriftRepository provides methods for storing metadata drift reports.
+type DriftRepository interface {
+	CreateRun(ctx context.Context) (*models.DriftRun, error)
+	FinishRun(ctx context.Context, run *models.DriftRun) error
+	AddIssue(ctx context.Context, issue *models.DriftIssue) error
+	LatestRun(ctx context.Context) (*models.DriftRun, error)
+	IssuesByRun(ctx context.Context, runId int64) ([]models.DriftIssue, error)
+}
+
+// BurnRepository provides methods for reflecting on-chain burns in the catalogue.
+type BurnRepository interface {
+	MarkBurned(ctx context.Context, burn *models.NftBurn) error
+	PendingUnpin(ctx context.Context, burnedBefore time.Time, limit int) ([]models.NftBurn, error)
+	MarkUnpinned(ctx context.Context, tokenId int64, unpinErr string) error
+}
+
+// IndexerRepository stores the positions of the contract event indexer.
+type IndexerRepository interface {
+	Cursor(ctx context.Context, name string) (int64, error)
+	SaveCursor(ctx context.Context, name string, blockTimestamp int64) error
+}
@@ -0,0 +1,125 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// APIKeyRepository handles API keys of machine clients in PostgreSQL.
+type APIKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository with the given PostgreSQL connection pool.
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+	}
+}
+
+const apiKeyColumns = `k.id, k.prefix, k.key_hash, k.name, k.user_id, k.scopes, COALESCE(k.created_by, 0), k.created_at,
+	k.expires_at, k.last_used_at, k.revoked_at`
+
+func scanAPIKey(row pgx.Row, key *models.APIKey, extra ...any) error {
+	return row.Scan(append([]any{&key.ID, &key.Prefix, &key.KeyHash, &key.Name, &key.UserID, &key.Scopes,
+		&key.CreatedBy, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt}, extra...)...)
+}
+
+// Create saves a new key.
+func (ar *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	const op = "postgresql.APIKeyRepository.Create"
+
+	now := time.Now().UTC()
+	query := `INSERT INTO api_keys (prefix, key_hash, name, user_id, scopes, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8) RETURNING id;`
+	if err := ar.db.QueryRow(ctx, query, key.Prefix, key.KeyHash, key.Name, key.UserID, key.Scopes, key.CreatedBy, now,
+		key.ExpiresAt).Scan(&key.ID); err != nil {
+		if isUniqueViolation(err) {
+			return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
+		return tvoerrors.Wrap(op, err)
+	}
+	key.CreatedAt = now
+
+	return nil
+}
+
+// ByPrefix returns the key with the current role of its user, keys of deleted users are not found.
+func (ar *APIKeyRepository) ByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	const op = "postgresql.APIKeyRepository.ByPrefix"
+
+	var key models.APIKey
+	query := `SELECT ` + apiKeyColumns + `, u.role_id, u.locked_until, u.deleted_at FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.prefix = $1;`
+	if err := scanAPIKey(ar.db.QueryRow(ctx, query, prefix), &key, &key.RoleID, &key.OwnerLockedUntil,
+		&key.OwnerDeletedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &key, nil
+}
+
+// List returns keys of the user, or of all users when userId is 0, newest first.
+func (ar *APIKeyRepository) List(ctx context.Context, userId int64) ([]models.APIKey, error) {
+	const op = "postgresql.APIKeyRepository.List"
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys k WHERE $1 = 0 OR k.user_id = $1 ORDER BY k.id DESC;`
+	rows, err := ar.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		var key models.APIKey
+		if err = scanAPIKey(rows, &key); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return keys, nil
+}
+
+// Revoke disables the key, revoking it again is not found.
+func (ar *APIKeyRepository) Revoke(ctx context.Context, id int64) error {
+	const op = "postgresql.APIKeyRepository.Revoke"
+
+	query := "UPDATE api_keys SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL;"
+	result, err := ar.db.Exec(ctx, query, id, time.Now().UTC())
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// Touch updates the last used time of the key.
+func (ar *APIKeyRepository) Touch(ctx context.Context, id int64, at time.Time) error {
+	const op = "postgresql.APIKeyRepository.Touch"
+
+	query := "UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2);"
+	if _, err := ar.db.Exec(ctx, query, id, at.UTC()); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// AuditRepository handles the audit log in PostgreSQL.
+type AuditRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAuditRepository creates a new instance of AuditRepository with the given PostgreSQL connection pool.
+func NewAuditRepository(db *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+// auditWhere filters by the parameters $1..$6 of auditArgs, zero values don't filter
+const auditWhere = `WHERE ($1 = 0 OR actor_id = $1) AND ($2 = '' OR action = $2)
+	AND ($3::timestamp IS NULL OR created_at >= $3) AND ($4::timestamp IS NULL OR created_at < $4)
+	AND ($5 = '' OR target_type = $5) AND ($6 = '' OR target_id = $6)`
+
+func auditArgs(filter models.AuditFilter) []any {
+	var from, to *time.Time
+	if filter.From != nil {
+		utc := filter.From.UTC()
+		from = &utc
+	}
+	if filter.To != nil {
+		utc := filter.To.UTC()
+		to = &utc
+	}
+	return []any{filter.ActorID, filter.Action, from, to, filter.TargetType, filter.TargetID}
+}
+
+func scanAuditEntry(row pgx.Row, entry *models.AuditEntry) error {
+	return row.Scan(&entry.ID, &entry.ActorID, &entry.APIKeyID, &entry.Action, &entry.TargetType, &entry.TargetID,
+		&entry.Before, &entry.After, &entry.IP, &entry.RequestID, &entry.CreatedAt)
+}
+
+const auditColumns = `id, COALESCE(actor_id, 0), COALESCE(api_key_id, 0), action, target_type, target_id, before, after,
+	ip, request_id, created_at`
+
+// Append writes the entry to the log.
+func (ar *AuditRepository) Append(ctx context.Context, entry *models.AuditEntry) error {
+	const op = "postgresql.AuditRepository.Append"
+
+	entry.CreatedAt = time.Now().UTC()
+	query := `INSERT INTO audit_log (actor_id, api_key_id, action, target_type, target_id, before, after, ip, request_id,
+		created_at) VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;`
+	if err := ar.db.QueryRow(ctx, query, entry.ActorID, entry.APIKeyID, entry.Action, entry.TargetType, entry.TargetID,
+		entry.Before, entry.After, entry.IP, entry.RequestID, entry.CreatedAt).Scan(&entry.ID); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// List returns a page of matching entries, newest first, and the total count of matching entries.
+func (ar *AuditRepository) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	const op = "postgresql.AuditRepository.List"
+
+	args := auditArgs(filter)
+
+	var total int
+	if err := ar.db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log `+auditWhere, args...).Scan(&total); err != nil {
+		return nil, 0, tvoerrors.Wrap(op, err)
+	}
+
+	entries := make([]models.AuditEntry, 0)
+	err := ar.each(ctx, `SELECT `+auditColumns+` FROM audit_log `+auditWhere+` ORDER BY id DESC LIMIT $7 OFFSET $8`,
+		append(args, filter.Limit, filter.Offset), func(entry *models.AuditEntry) error {
+			entries = append(entries, *entry)
+			return nil
+		})
+	if err != nil {
+		return nil, 0, tvoerrors.Wrap(op, err)
+	}
+
+	return entries, total, nil
+}
+
+// Each streams all matching entries in chronological order, the filter limit is ignored.
+func (ar *AuditRepository) Each(ctx context.Context, filter models.AuditFilter, fn func(entry *models.AuditEntry) error) error {
+	const op = "postgresql.AuditRepository.Each"
+
+	if err := ar.each(ctx, `SELECT `+auditColumns+` FROM audit_log `+auditWhere+` ORDER BY id`, auditArgs(filter),
+		fn); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+func (ar *AuditRepository) each(ctx context.Context, query string, args []any, fn func(entry *models.AuditEntry) error) error {
+	rows, err := ar.db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err = scanAuditEntry(rows, &entry); err != nil {
+			return err
+		}
+		if err = fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,119 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// BurnRepository handles burned tokens in PostgreSQL.
+type BurnRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewBurnRepository creates a new instance of BurnRepository with the given PostgreSQL connection pool.
+func NewBurnRepository(db *pgxpool.Pool) *BurnRepository {
+	return &BurnRepository{
+		db: db,
+	}
+}
+
+// MarkBurned stores the burn transaction, hides the token from the catalogue and replaces its indexed owner
+// with a tombstone.
+// Repeated calls for the same token are no-ops.
+func (br *BurnRepository) MarkBurned(ctx context.Context, burn *models.NftBurn) error {
+	const op = "postgresql.BurnRepository.MarkBurned"
+
+	tx, err := br.db.Begin(ctx)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	query := `INSERT INTO nft_burns (token_id, owner_address, tx_id, block_number, burned_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (token_id) DO NOTHING;`
+	if _, err = tx.Exec(ctx, query, burn.TokenId, burn.OwnerAddress, burn.TxId, burn.BlockNumber, burn.BurnedAt); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	query = "UPDATE nft_data SET burned_at = $2, updated_at = now() WHERE token_id = $1 AND burned_at IS NULL;"
+	if _, err = tx.Exec(ctx, query, burn.TokenId, burn.BurnedAt); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	// владелец заменяется отметкой о сжигании, номер блока в ней не дает более старым переводам вернуть владельца
+	query = `INSERT INTO nft_owners (token_id, owner_address, block_number, tx_id, updated_at, burned_at)
+		VALUES ($1, '', $2, $3, now(), $4)
+		ON CONFLICT (token_id) DO UPDATE
+		SET owner_address = '', block_number = EXCLUDED.block_number, tx_id = EXCLUDED.tx_id,
+			updated_at = EXCLUDED.updated_at, burned_at = EXCLUDED.burned_at
+		WHERE nft_owners.block_number <= EXCLUDED.block_number;`
+	if _, err = tx.Exec(ctx, query, burn.TokenId, burn.BlockNumber, burn.TxId, burn.BurnedAt); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// PendingUnpin retrieves burns older than burnedBefore whose media is still pinned.
+func (br *BurnRepository) PendingUnpin(ctx context.Context, burnedBefore time.Time, limit int) ([]models.NftBurn, error) {
+	const op = "postgresql.BurnRepository.PendingUnpin"
+
+	query := `SELECT b.token_id, b.owner_address, b.tx_id, b.block_number, b.burned_at, b.unpin_error,
+			COALESCE(d.cidv0, '')
+		FROM nft_burns b LEFT JOIN nft_data d ON d.token_id = b.token_id
+		WHERE b.unpinned_at IS NULL AND b.burned_at < $1
+		ORDER BY b.burned_at LIMIT $2;`
+	rows, err := br.db.Query(ctx, query, burnedBefore, limit)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	burns := make([]models.NftBurn, 0)
+	for rows.Next() {
+		var burn models.NftBurn
+		if err = rows.Scan(&burn.TokenId, &burn.OwnerAddress, &burn.TxId, &burn.BlockNumber, &burn.BurnedAt,
+			&burn.UnpinError, &burn.CidV0); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		burns = append(burns, burn)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return burns, nil
+}
+
+// MarkUnpinned records the result of unpinning the media of a burned token.
+// A non-empty unpinErr keeps the burn pending so it is retried later.
+func (br *BurnRepository) MarkUnpinned(ctx context.Context, tokenId int64, unpinErr string) error {
+	const op = "postgresql.BurnRepository.MarkUnpinned"
+
+	query := "UPDATE nft_burns SET unpinned_at = now(), unpin_error = '' WHERE token_id = $1;"
+	args := []any{tokenId}
+	if unpinErr != "" {
+		query = "UPDATE nft_burns SET unpin_error = $2 WHERE token_id = $1;"
+		args = append(args, unpinErr)
+	}
+
+	res, err := br.db.Exec(ctx, query, args...)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrUpdateFailed)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// DriftRepository handles metadata drift reports in PostgreSQL.
+type DriftRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewDriftRepository creates a new instance of DriftRepository with the given PostgreSQL connection pool.
+func NewDriftRepository(db *pgxpool.Pool) *DriftRepository {
+	return &DriftRepository{
+		db: db,
+	}
+}
+
+// CreateRun starts a new drift report.
+func (dr *DriftRepository) CreateRun(ctx context.Context) (*models.DriftRun, error) {
+	const op = "postgresql.DriftRepository.CreateRun"
+	var run models.DriftRun
+
+	query := "INSERT INTO nft_drift_runs (started_at) VALUES ($1) RETURNING id, started_at;"
+	if err := dr.db.QueryRow(ctx, query, time.Now().UTC()).Scan(&run.ID, &run.StartedAt); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &run, nil
+}
+
+// FinishRun stores the totals of the drift report.
+func (dr *DriftRepository) FinishRun(ctx context.Context, run *models.DriftRun) error {
+	const op = "postgresql.DriftRepository.FinishRun"
+
+	run.FinishedAt = time.Now().UTC()
+	query := "UPDATE nft_drift_runs SET tokens_checked = $1, issues = $2, error = $3, finished_at = $4 WHERE id = $5;"
+
+	res, err := dr.db.Exec(ctx, query, run.TokensChecked, run.Issues, run.Error, run.FinishedAt, run.ID)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrUpdateFailed)
+	}
+
+	return nil
+}
+
+// AddIssue stores a single mismatch.
+func (dr *DriftRepository) AddIssue(ctx context.Context, issue *models.DriftIssue) error {
+	const op = "postgresql.DriftRepository.AddIssue"
+
+	query := "INSERT INTO nft_drift_issues (run_id, token_id, kind, on_chain_uri, details) VALUES ($1, $2, $3, $4, $5);"
+	res, err := dr.db.Exec(ctx, query, issue.RunID, issue.TokenId, issue.Kind, issue.OnChainURI, issue.Details)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrInsertFailed)
+	}
+
+	return nil
+}
+
+// LatestRun retrieves the last finished drift report.
+func (dr *DriftRepository) LatestRun(ctx context.Context) (*models.DriftRun, error) {
+	const op = "postgresql.DriftRepository.LatestRun"
+	var run models.DriftRun
+
+	query := `SELECT id, tokens_checked, issues, error, started_at, finished_at FROM nft_drift_runs
+		WHERE finished_at IS NOT NULL ORDER BY id DESC LIMIT 1;`
+	if err := dr.db.QueryRow(ctx, query).Scan(&run.ID, &run.TokensChecked, &run.Issues, &run.Error,
+		&run.StartedAt, &run.FinishedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &run, nil
+}
+
+// IssuesByRun retrieves mismatches found by the drift report.
+func (dr *DriftRepository) IssuesByRun(ctx context.Context, runId int64) ([]models.DriftIssue, error) {
+	const op = "postgresql.DriftRepository.IssuesByRun"
+
+	query := `SELECT id, run_id, token_id, kind, on_chain_uri, details, created_at FROM nft_drift_issues
+		WHERE run_id = $1 ORDER BY token_id, id;`
+	rows, err := dr.db.Query(ctx, query, runId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	issues := make([]models.DriftIssue, 0)
+	for rows.Next() {
+		var issue models.DriftIssue
+		if err = rows.Scan(&issue.ID, &issue.RunID, &issue.TokenId, &issue.Kind, &issue.OnChainURI,
+			&issue.Details, &issue.CreatedAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		issues = append(issues, issue)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,147 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// IdentityRepository handles identities of external OpenID providers in PostgreSQL.
+type IdentityRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewIdentityRepository creates a new instance of IdentityRepository with the given PostgreSQL connection pool.
+func NewIdentityRepository(db *pgxpool.Pool) *IdentityRepository {
+	return &IdentityRepository{
+		db: db,
+	}
+}
+
+// ByProviderSubject returns the identity of the provider account.
+func (ir *IdentityRepository) ByProviderSubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	const op = "postgresql.IdentityRepository.ByProviderSubject"
+
+	var identity models.UserIdentity
+	query := `SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at
+		FROM user_identities WHERE provider = $1 AND subject = $2;`
+	if err := ir.db.QueryRow(ctx, query, provider, subject).Scan(&identity.ID, &identity.UserID, &identity.Provider,
+		&identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &identity, nil
+}
+
+// ByUser returns the identities linked to the user.
+func (ir *IdentityRepository) ByUser(ctx context.Context, userId int64) ([]models.UserIdentity, error) {
+	const op = "postgresql.IdentityRepository.ByUser"
+
+	query := `SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at
+		FROM user_identities WHERE user_id = $1 ORDER BY id;`
+	rows, err := ir.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	identities := make([]models.UserIdentity, 0)
+	for rows.Next() {
+		var identity models.UserIdentity
+		if err = rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+			&identity.CreatedAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return identities, nil
+}
+
+// Link attaches the identity to identity.UserID, an identity linked to any user is a conflict.
+func (ir *IdentityRepository) Link(ctx context.Context, identity *models.UserIdentity) error {
+	const op = "postgresql.IdentityRepository.Link"
+
+	if err := insertIdentity(ctx, ir.db, identity); err != nil {
+		if isUniqueViolation(err) {
+			return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// CreateUser saves a new user without password together with the identity, email may be empty.
+func (ir *IdentityRepository) CreateUser(ctx context.Context, email string, identity *models.UserIdentity) (*models.User, error) {
+	const op = "postgresql.IdentityRepository.CreateUser"
+	var user models.User
+
+	tx, err := ir.db.Begin(ctx)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var emailValue, verifiedAt interface{}
+	if email != "" {
+		emailValue, verifiedAt = email, time.Now().UTC()
+		if err = releaseEmail(ctx, tx, email); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+	}
+
+	query := `INSERT INTO users (phone, email, email_verified_at, password, salt, role_id)
+		VALUES ('', $1, $2, $3, NULL, $4) RETURNING id, COALESCE(email, ''), email_verified_at, role_id`
+	if err = tx.QueryRow(ctx, query, emailValue, verifiedAt, noPassword, tvomodels.USER).
+		Scan(&user.ID, &user.Email, &user.EmailVerifiedAt, &user.RoleID); err != nil {
+		if isUniqueViolation(err) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	identity.UserID = user.ID
+	if err = insertIdentity(ctx, tx, identity); err != nil {
+		if isUniqueViolation(err) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &user, nil
+}
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertIdentity(ctx context.Context, db rowQuerier, identity *models.UserIdentity) error {
+	var email interface{}
+	if identity.Email != "" {
+		email = identity.Email
+	}
+
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	return db.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, email, time.Now().UTC()).
+		Scan(&identity.ID, &identity.CreatedAt)
+}
@@ -0,0 +1,52 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// IndexerRepository handles positions of the contract event indexer in PostgreSQL.
+type IndexerRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewIndexerRepository creates a new instance of IndexerRepository with the given PostgreSQL connection pool.
+func NewIndexerRepository(db *pgxpool.Pool) *IndexerRepository {
+	return &IndexerRepository{
+		db: db,
+	}
+}
+
+// Cursor retrieves the block timestamp (ms) the indexer has processed up to, 0 if it never ran.
+func (ir *IndexerRepository) Cursor(ctx context.Context, name string) (int64, error) {
+	const op = "postgresql.IndexerRepository.Cursor"
+	var blockTimestamp int64
+
+	query := "SELECT block_timestamp FROM indexer_cursors WHERE name = $1;"
+	if err := ir.db.QueryRow(ctx, query, name).Scan(&blockTimestamp); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, tvoerrors.Wrap(op, err)
+	}
+
+	return blockTimestamp, nil
+}
+
+// SaveCursor stores the block timestamp (ms) the indexer has processed up to.
+func (ir *IndexerRepository) SaveCursor(ctx context.Context, name string, blockTimestamp int64) error {
+	const op = "postgresql.IndexerRepository.SaveCursor"
+
+	query := `INSERT INTO indexer_cursors (name, block_timestamp, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE SET block_timestamp = EXCLUDED.block_timestamp, updated_at = EXCLUDED.updated_at;`
+	if _, err := ir.db.Exec(ctx, query, name, blockTimestamp); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
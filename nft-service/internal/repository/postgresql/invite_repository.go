@@ -0,0 +1,167 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// InviteRepository handles registration invite codes in PostgreSQL.
+type InviteRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewInviteRepository creates a new instance of InviteRepository with the given PostgreSQL connection pool.
+func NewInviteRepository(db *pgxpool.Pool) *InviteRepository {
+	return &InviteRepository{
+		db: db,
+	}
+}
+
+const inviteColumns = `i.id, i.code, COALESCE(i.role_id, 0), i.max_uses, i.uses, COALESCE(i.referrer_id, 0), COALESCE(i.created_by, 0),
+	i.created_at, i.expires_at, i.revoked_at`
+
+func scanInvite(row pgx.Row, invite *models.Invite) error {
+	return row.Scan(&invite.ID, &invite.Code, &invite.RoleID, &invite.MaxUses, &invite.Uses, &invite.ReferrerID,
+		&invite.CreatedBy, &invite.CreatedAt, &invite.ExpiresAt, &invite.RevokedAt)
+}
+
+// Create saves a new invite, an existing code is a conflict.
+func (ir *InviteRepository) Create(ctx context.Context, invite *models.Invite) error {
+	const op = "postgresql.InviteRepository.Create"
+
+	now := time.Now().UTC()
+	query := `INSERT INTO invite_codes (code, role_id, max_uses, referrer_id, created_by, created_at, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, 0), $5, $6, $7) RETURNING id;`
+	if err := ir.db.QueryRow(ctx, query, invite.Code, int64(invite.RoleID), invite.MaxUses, invite.ReferrerID,
+		invite.CreatedBy, now, utcTime(invite.ExpiresAt)).Scan(&invite.ID); err != nil {
+		if isUniqueViolation(err) {
+			return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
+		return tvoerrors.Wrap(op, err)
+	}
+	invite.CreatedAt = now
+
+	return nil
+}
+
+// ByCode returns the invite with the code, used up and revoked invites are returned too.
+func (ir *InviteRepository) ByCode(ctx context.Context, code string) (*models.Invite, error) {
+	const op = "postgresql.InviteRepository.ByCode"
+
+	var invite models.Invite
+	query := `SELECT ` + inviteColumns + ` FROM invite_codes i WHERE i.code = $1;`
+	if err := scanInvite(ir.db.QueryRow(ctx, query, code), &invite); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &invite, nil
+}
+
+// List returns all invites with names of their roles, newest first.
+func (ir *InviteRepository) List(ctx context.Context) ([]models.Invite, error) {
+	const op = "postgresql.InviteRepository.List"
+
+	query := `SELECT ` + inviteColumns + `, COALESCE(r.name, '') FROM invite_codes i
+		LEFT JOIN roles r ON r.id = i.role_id ORDER BY i.id DESC;`
+	rows, err := ir.db.Query(ctx, query)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	invites := make([]models.Invite, 0)
+	for rows.Next() {
+		var invite models.Invite
+		if err = rows.Scan(&invite.ID, &invite.Code, &invite.RoleID, &invite.MaxUses, &invite.Uses, &invite.ReferrerID,
+			&invite.CreatedBy, &invite.CreatedAt, &invite.ExpiresAt, &invite.RevokedAt, &invite.RoleName); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		invites = append(invites, invite)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return invites, nil
+}
+
+// Revoke disables the invite, revoking it again is not found.
+func (ir *InviteRepository) Revoke(ctx context.Context, id int64) error {
+	const op = "postgresql.InviteRepository.Revoke"
+
+	query := "UPDATE invite_codes SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL;"
+	result, err := ir.db.Exec(ctx, query, id, time.Now().UTC())
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// Referrals counts users credited to each referrer registered in [from, to), nil bounds don't filter.
+// Deleted users are counted as long as they are not purged.
+func (ir *InviteRepository) Referrals(ctx context.Context, from, to *time.Time) ([]models.ReferralStat, error) {
+	const op = "postgresql.InviteRepository.Referrals"
+
+	query := `SELECT referrer_id, COUNT(*), MIN(created_at), MAX(created_at) FROM users
+		WHERE referrer_id IS NOT NULL AND ($1::timestamp IS NULL OR created_at >= $1)
+			AND ($2::timestamp IS NULL OR created_at < $2)
+		GROUP BY referrer_id ORDER BY COUNT(*) DESC, referrer_id;`
+	rows, err := ir.db.Query(ctx, query, utcTime(from), utcTime(to))
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	stats := make([]models.ReferralStat, 0)
+	for rows.Next() {
+		var stat models.ReferralStat
+		if err = rows.Scan(&stat.ReferrerID, &stat.Users, &stat.FirstAt, &stat.LastAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		stats = append(stats, stat)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return stats, nil
+}
+
+// redeemInvite uses the code once and returns the invite, a missing or unusable code is not found.
+// It runs in the transaction creating the user, so a failed registration doesn't spend the code.
+func redeemInvite(ctx context.Context, db rowQuerier, code string) (*models.Invite, error) {
+	var invite models.Invite
+	query := `UPDATE invite_codes i SET uses = i.uses + 1
+		WHERE i.code = $1 AND i.revoked_at IS NULL AND (i.expires_at IS NULL OR i.expires_at > $2) AND i.uses < i.max_uses
+		RETURNING ` + inviteColumns
+	if err := scanInvite(db.QueryRow(ctx, query, code, time.Now().UTC()), &invite); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
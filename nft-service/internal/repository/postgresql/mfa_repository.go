@@ -0,0 +1,178 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// MFARepository handles TOTP second factors and recovery codes in PostgreSQL.
+type MFARepository struct {
+	db *pgxpool.Pool
+}
+
+// NewMFARepository creates a new instance of MFARepository with the given PostgreSQL connection pool.
+func NewMFARepository(db *pgxpool.Pool) *MFARepository {
+	return &MFARepository{
+		db: db,
+	}
+}
+
+// ByUser returns the second factor of the user.
+func (mr *MFARepository) ByUser(ctx context.Context, userId int64) (*models.UserMFA, error) {
+	const op = "postgresql.MFARepository.ByUser"
+
+	var mfa models.UserMFA
+	query := "SELECT user_id, secret, last_counter, created_at, enabled_at FROM user_mfa WHERE user_id = $1;"
+	if err := mr.db.QueryRow(ctx, query, userId).
+		Scan(&mfa.UserID, &mfa.Secret, &mfa.LastCounter, &mfa.CreatedAt, &mfa.EnabledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &mfa, nil
+}
+
+// SavePending stores a new secret waiting for confirmation, a previous pending secret is replaced.
+func (mr *MFARepository) SavePending(ctx context.Context, userId int64, secret string) error {
+	const op = "postgresql.MFARepository.SavePending"
+
+	// enabled factor is never overwritten, it has to be deleted first
+	query := `INSERT INTO user_mfa (user_id, secret, last_counter, created_at) VALUES ($1, $2, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_counter = 0, created_at = EXCLUDED.created_at
+		WHERE user_mfa.enabled_at IS NULL;`
+	result, err := mr.db.Exec(ctx, query, userId, secret, time.Now().UTC())
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+	}
+
+	return nil
+}
+
+// Enable confirms the pending secret and stores the first set of recovery codes.
+func (mr *MFARepository) Enable(ctx context.Context, userId int64, codeHashes []string) error {
+	const op = "postgresql.MFARepository.Enable"
+
+	tx, err := mr.db.Begin(ctx)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	query := "UPDATE user_mfa SET enabled_at = $2 WHERE user_id = $1 AND enabled_at IS NULL;"
+	result, err := tx.Exec(ctx, query, userId, time.Now().UTC())
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// UseCounter remembers the time step of an accepted code. It reports false when the step
+// was already used, so a code can't be replayed within its validity window.
+func (mr *MFARepository) UseCounter(ctx context.Context, userId, counter int64) (bool, error) {
+	const op = "postgresql.MFARepository.UseCounter"
+
+	query := "UPDATE user_mfa SET last_counter = $2 WHERE user_id = $1 AND last_counter < $2;"
+	result, err := mr.db.Exec(ctx, query, userId, counter)
+	if err != nil {
+		return false, tvoerrors.Wrap(op, err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// ReplaceRecoveryCodes drops all recovery codes of the user and stores new ones.
+func (mr *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userId int64, codeHashes []string) error {
+	const op = "postgresql.MFARepository.ReplaceRecoveryCodes"
+
+	tx, err := mr.db.Begin(ctx)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the recovery code as used, it reports false for unknown or used codes.
+func (mr *MFARepository) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) (bool, error) {
+	const op = "postgresql.MFARepository.UseRecoveryCode"
+
+	query := `UPDATE user_recovery_codes SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;`
+	result, err := mr.db.Exec(ctx, query, userId, codeHash, time.Now().UTC())
+	if err != nil {
+		return false, tvoerrors.Wrap(op, err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// Delete removes the second factor and recovery codes of the user.
+func (mr *MFARepository) Delete(ctx context.Context, userId int64) error {
+	const op = "postgresql.MFARepository.Delete"
+
+	tx, err := mr.db.Begin(ctx)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1;", userId); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if _, err = tx.Exec(ctx, "DELETE FROM user_mfa WHERE user_id = $1;", userId); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId int64, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1;", userId); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_recovery_codes (user_id, code_hash, created_at)
+		SELECT $1, code_hash, $3 FROM unnest($2::varchar[]) AS code_hash;`
+	if _, err := tx.Exec(ctx, query, userId, codeHashes, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -27,9 +27,10 @@ func (ur *NftDataRepository) CreateNftData(ctx context.Context, data *dto.NftDat
 	const op = "postgresql.NftDataRepository.CreateNftData"
 	var nft models.NftDataModel
 
-	query := "INSERT INTO nft_data (token_id, content, cidv0, cidv1, file_size, file_name) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
-	if err := ur.db.QueryRow(ctx, query, data.TokenId, data.Description, data.CidV0, data.CidV1, data.FileSize, data.FileName).
-		Scan(&nft.ID); err != nil {
+	query := `INSERT INTO nft_data (token_id, content, cidv0, cidv1, file_size, file_name, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0)) RETURNING id`
+	if err := ur.db.QueryRow(ctx, query, data.TokenId, data.Description, data.CidV0, data.CidV1, data.FileSize, data.FileName,
+		data.CreatedBy).Scan(&nft.ID); err != nil {
 		return tvoerrors.Wrap(op, err)
 	}
 	return nil
@@ -39,10 +40,10 @@ func (ur *NftDataRepository) CreateNftData(ctx context.Context, data *dto.NftDat
 func (ur *NftDataRepository) ReadNftData(ctx context.Context, tokenId int64) (models.NftDataModel, error) {
 	const op = "postgresql.NftDataRepository.ReadNftData"
 	var nft models.NftDataModel
-	query := "SELECT token_id, content, cidv0, cidv1  FROM nft_data where token_id = $1 LIMIT 1;"
+	query := "SELECT token_id, content, cidv0, cidv1, burned_at, COALESCE(created_by, 0) FROM nft_data where token_id = $1 LIMIT 1;"
 
 	if err := ur.db.QueryRow(ctx, query, tokenId).Scan(
-		&nft.TokenId, &nft.Description, &nft.CidV0, &nft.CidV1); err != nil {
+		&nft.TokenId, &nft.Description, &nft.CidV0, &nft.CidV1, &nft.BurnedAt, &nft.CreatedBy); err != nil {
 		if !errors.Is(err, pgx.ErrNoRows) {
 			return nft, tvoerrors.Wrap("postgresql.NftDataRepository.ReadNftData", err)
 		}
@@ -51,12 +52,12 @@ func (ur *NftDataRepository) ReadNftData(ctx context.Context, tokenId int64) (mo
 	return nft, nil
 }
 
-// ReadAllNftData takes all nft data
-func (ur *NftDataRepository) ReadAllNftData(ctx context.Context, limit int) ([]models.NftDataModel, error) {
+// ReadAllNftData takes all nft data, burned tokens are skipped unless includeBurned is set
+func (ur *NftDataRepository) ReadAllNftData(ctx context.Context, limit int, includeBurned bool) ([]models.NftDataModel, error) {
 	const op = "postgresql.NftDataRepository.ReadNftData"
-	query := "SELECT token_id, content, cidv0, cidv1  FROM nft_data LIMIT $1;"
+	query := "SELECT token_id, content, cidv0, cidv1, burned_at  FROM nft_data WHERE ($2 OR burned_at IS NULL) LIMIT $1;"
 
-	rows, err := ur.db.Query(ctx, query, limit)
+	rows, err := ur.db.Query(ctx, query, limit, includeBurned)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return []models.NftDataModel{}, nil
@@ -68,7 +69,7 @@ func (ur *NftDataRepository) ReadAllNftData(ctx context.Context, limit int) ([]m
 	var nfts []models.NftDataModel
 	for rows.Next() {
 		var nft models.NftDataModel
-		if err := rows.Scan(&nft.TokenId, &nft.Description, &nft.CidV0, &nft.CidV1); err != nil {
+		if err := rows.Scan(&nft.TokenId, &nft.Description, &nft.CidV0, &nft.CidV1, &nft.BurnedAt); err != nil {
 			return nil, tvoerrors.Wrap(op, err)
 		}
 		nfts = append(nfts, nft)
@@ -93,3 +94,29 @@ func (ur *NftDataRepository) TokenIdExists(ctx context.Context, tokenId int64) (
 	}
 	return exists, nil
 }
+
+// TokenIds retrieves ids of all not burned tokens which have nft data.
+func (ur *NftDataRepository) TokenIds(ctx context.Context) ([]int64, error) {
+	const op = "postgresql.NftDataRepository.TokenIds"
+
+	rows, err := ur.db.Query(ctx, "SELECT token_id FROM nft_data WHERE burned_at IS NULL ORDER BY token_id;")
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,207 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// OwnershipRepository handles indexed token ownership and linked wallets in PostgreSQL.
+type OwnershipRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewOwnershipRepository creates a new instance of OwnershipRepository with the given PostgreSQL connection pool.
+func NewOwnershipRepository(db *pgxpool.Pool) *OwnershipRepository {
+	return &OwnershipRepository{
+		db: db,
+	}
+}
+
+// OwnerOf retrieves the indexed owner of the token, burned tokens are not found.
+func (or *OwnershipRepository) OwnerOf(ctx context.Context, tokenId int64) (*models.NftOwner, error) {
+	const op = "postgresql.OwnershipRepository.OwnerOf"
+	var owner models.NftOwner
+
+	query := `SELECT token_id, owner_address, block_number, tx_id, updated_at FROM nft_owners
+		WHERE token_id = $1 AND burned_at IS NULL;`
+	if err := or.db.QueryRow(ctx, query, tokenId).Scan(&owner.TokenId, &owner.OwnerAddress,
+		&owner.BlockNumber, &owner.TxId, &owner.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &owner, nil
+}
+
+// UpsertOwner stores the owner of the token. Older blocks never overwrite newer ones, including burns.
+func (or *OwnershipRepository) UpsertOwner(ctx context.Context, owner *models.NftOwner) error {
+	const op = "postgresql.OwnershipRepository.UpsertOwner"
+
+	now := time.Now().UTC()
+	query := `INSERT INTO nft_owners (token_id, owner_address, block_number, tx_id, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (token_id) DO UPDATE
+		SET owner_address = EXCLUDED.owner_address, block_number = EXCLUDED.block_number,
+			tx_id = EXCLUDED.tx_id, updated_at = EXCLUDED.updated_at, burned_at = NULL
+		WHERE nft_owners.block_number <= EXCLUDED.block_number;`
+
+	if _, err := or.db.Exec(ctx, query, owner.TokenId, owner.OwnerAddress, owner.BlockNumber, owner.TxId, now); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// TokenIds retrieves ids of all indexed tokens except burned ones.
+func (or *OwnershipRepository) TokenIds(ctx context.Context) ([]int64, error) {
+	const op = "postgresql.OwnershipRepository.TokenIds"
+
+	rows, err := or.db.Query(ctx, "SELECT token_id FROM nft_owners WHERE burned_at IS NULL ORDER BY token_id;")
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return ids, nil
+}
+
+// UserOwnsToken checks if one of the user's linked wallets owns the token.
+func (or *OwnershipRepository) UserOwnsToken(ctx context.Context, userId, tokenId int64) (bool, error) {
+	const op = "postgresql.OwnershipRepository.UserOwnsToken"
+	var exists bool
+
+	query := `SELECT EXISTS (SELECT 1 FROM nft_owners o
+		JOIN user_wallets w ON w.address = o.owner_address
+		WHERE w.user_id = $1 AND o.token_id = $2);`
+	if err := or.db.QueryRow(ctx, query, userId, tokenId).Scan(&exists); err != nil {
+		return false, tvoerrors.Wrap(op, err)
+	}
+
+	return exists, nil
+}
+
+// UserOwnsAny checks if one of the user's linked wallets owns any token of the collection.
+func (or *OwnershipRepository) UserOwnsAny(ctx context.Context, userId int64) (bool, error) {
+	const op = "postgresql.OwnershipRepository.UserOwnsAny"
+	var exists bool
+
+	query := `SELECT EXISTS (SELECT 1 FROM nft_owners o
+		JOIN user_wallets w ON w.address = o.owner_address
+		WHERE w.user_id = $1);`
+	if err := or.db.QueryRow(ctx, query, userId).Scan(&exists); err != nil {
+		return false, tvoerrors.Wrap(op, err)
+	}
+
+	return exists, nil
+}
+
+// TokensByUser returns the indexed owners of tokens held by the user's linked wallets.
+func (or *OwnershipRepository) TokensByUser(ctx context.Context, userId int64) ([]models.NftOwner, error) {
+	const op = "postgresql.OwnershipRepository.TokensByUser"
+
+	query := `SELECT o.token_id, o.owner_address, o.block_number, o.tx_id, o.updated_at FROM nft_owners o
+		JOIN user_wallets w ON w.address = o.owner_address
+		WHERE w.user_id = $1 ORDER BY o.token_id;`
+	rows, err := or.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	owners := make([]models.NftOwner, 0)
+	for rows.Next() {
+		var owner models.NftOwner
+		if err = rows.Scan(&owner.TokenId, &owner.OwnerAddress, &owner.BlockNumber, &owner.TxId,
+			&owner.UpdatedAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		owners = append(owners, owner)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return owners, nil
+}
+
+// LinkWallet links the wallet address to the user.
+func (or *OwnershipRepository) LinkWallet(ctx context.Context, userId int64, address string) error {
+	const op = "postgresql.OwnershipRepository.LinkWallet"
+
+	query := "INSERT INTO user_wallets (user_id, address) VALUES ($1, $2) ON CONFLICT (address) DO NOTHING;"
+	res, err := or.db.Exec(ctx, query, userId, address)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+	}
+
+	return nil
+}
+
+// UserByWallet retrieves the id of the user the wallet is linked to.
+func (or *OwnershipRepository) UserByWallet(ctx context.Context, address string) (int64, error) {
+	const op = "postgresql.OwnershipRepository.UserByWallet"
+	var userId int64
+
+	query := "SELECT user_id FROM user_wallets WHERE address = $1;"
+	if err := or.db.QueryRow(ctx, query, address).Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return 0, tvoerrors.Wrap(op, err)
+	}
+
+	return userId, nil
+}
+
+// WalletsByUser retrieves the wallets linked to the user.
+func (or *OwnershipRepository) WalletsByUser(ctx context.Context, userId int64) ([]models.UserWallet, error) {
+	const op = "postgresql.OwnershipRepository.WalletsByUser"
+
+	query := "SELECT id, user_id, address, created_at FROM user_wallets WHERE user_id = $1 ORDER BY id;"
+	rows, err := or.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	wallets := make([]models.UserWallet, 0)
+	for rows.Next() {
+		var wallet models.UserWallet
+		if err = rows.Scan(&wallet.ID, &wallet.UserID, &wallet.Address, &wallet.CreatedAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return wallets, nil
+}
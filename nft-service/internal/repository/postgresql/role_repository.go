@@ -52,3 +52,32 @@ func (rr *RoleRepository) RoleById(ctx context.Context, roleId int64) (*models.R
 
 	return &role, nil
 }
+
+// RolePermissions retrieves the permission names granted to every role.
+func (rr *RoleRepository) RolePermissions(ctx context.Context) (map[models.RoleId][]string, error) {
+	const op = "postgresql.RoleRepository.RolePermissions"
+
+	query := `SELECT rp.role_id, p.name FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id ORDER BY rp.role_id, p.name;`
+	rows, err := rr.db.Query(ctx, query)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	permissions := make(map[models.RoleId][]string)
+	for rows.Next() {
+		var roleId models.RoleId
+		var name string
+		if err = rows.Scan(&roleId, &name); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		permissions[roleId] = append(permissions[roleId], name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return permissions, nil
+}
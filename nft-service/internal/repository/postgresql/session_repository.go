@@ -0,0 +1,172 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// SessionRepository handles user sessions in PostgreSQL.
+type SessionRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewSessionRepository creates a new instance of SessionRepository with the given PostgreSQL connection pool.
+func NewSessionRepository(db *pgxpool.Pool) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+	}
+}
+
+// activeSession is true while the family has a refresh token which is neither used nor expired
+const activeSession = `s.revoked_at IS NULL AND EXISTS (SELECT 1 FROM user_tokens t WHERE t.family_id = s.family_id
+	AND t.refresh_token IS NOT NULL AND t.rotated_at IS NULL AND t.refresh_expired_at > now())`
+
+// Create saves a new session.
+func (sr *SessionRepository) Create(ctx context.Context, session *models.UserSession) error {
+	const op = "postgresql.SessionRepository.Create"
+
+	now := time.Now().UTC()
+	query := `INSERT INTO user_sessions (user_id, family_id, user_agent, ip, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $5) RETURNING id;`
+	if err := sr.db.QueryRow(ctx, query, session.UserID, session.FamilyID, session.UserAgent, session.IP, now).
+		Scan(&session.ID); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	session.CreatedAt, session.LastUsedAt = now, now
+
+	return nil
+}
+
+// Touch updates the last used time of the session owning the token family.
+func (sr *SessionRepository) Touch(ctx context.Context, familyId string) error {
+	const op = "postgresql.SessionRepository.Touch"
+
+	// sessions created before this table existed have no row, nothing to update
+	query := "UPDATE user_sessions SET last_used_at = $2 WHERE family_id = $1;"
+	if _, err := sr.db.Exec(ctx, query, familyId, time.Now().UTC()); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// TouchMany updates the last used time of several sessions at once, used to flush batched updates.
+func (sr *SessionRepository) TouchMany(ctx context.Context, visits map[string]time.Time) error {
+	const op = "postgresql.SessionRepository.TouchMany"
+
+	families := make([]string, 0, len(visits))
+	times := make([]time.Time, 0, len(visits))
+	for familyId, at := range visits {
+		families = append(families, familyId)
+		times = append(times, at.UTC())
+	}
+
+	query := `UPDATE user_sessions s SET last_used_at = v.at
+		FROM unnest($1::varchar[], $2::timestamp[]) AS v(family_id, at)
+		WHERE s.family_id = v.family_id AND s.last_used_at < v.at;`
+	if _, err := sr.db.Exec(ctx, query, families, times); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// ActiveByUser retrieves not revoked sessions of the user, most recently used first.
+func (sr *SessionRepository) ActiveByUser(ctx context.Context, userId int64) ([]models.UserSession, error) {
+	const op = "postgresql.SessionRepository.ActiveByUser"
+
+	query := `SELECT s.id, s.user_id, s.family_id, s.user_agent, s.ip, s.created_at, s.last_used_at
+		FROM user_sessions s WHERE s.user_id = $1 AND ` + activeSession + `
+		ORDER BY s.last_used_at DESC;`
+	rows, err := sr.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	sessions := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		if err = rows.Scan(&session.ID, &session.UserID, &session.FamilyID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastUsedAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return sessions, nil
+}
+
+// ActiveByID retrieves a not revoked session of the user.
+func (sr *SessionRepository) ActiveByID(ctx context.Context, userId, id int64) (*models.UserSession, error) {
+	const op = "postgresql.SessionRepository.ActiveByID"
+	var session models.UserSession
+
+	query := `SELECT s.id, s.user_id, s.family_id, s.user_agent, s.ip, s.created_at, s.last_used_at
+		FROM user_sessions s WHERE s.id = $1 AND s.user_id = $2 AND ` + activeSession + `;`
+	if err := sr.db.QueryRow(ctx, query, id, userId).Scan(&session.ID, &session.UserID, &session.FamilyID,
+		&session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &session, nil
+}
+
+// Revoke marks the session as revoked, its tokens are revoked by UserTokenRepository.RevokeFamily.
+func (sr *SessionRepository) Revoke(ctx context.Context, id int64) error {
+	const op = "postgresql.SessionRepository.Revoke"
+
+	query := "UPDATE user_sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL;"
+	res, err := sr.db.Exec(ctx, query, id, time.Now().UTC())
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrUpdateFailed)
+	}
+
+	return nil
+}
+
+// AllByUser retrieves all sessions of the user including revoked and expired ones, oldest first.
+func (sr *SessionRepository) AllByUser(ctx context.Context, userId int64) ([]models.UserSession, error) {
+	const op = "postgresql.SessionRepository.AllByUser"
+
+	query := `SELECT s.id, s.user_id, s.family_id, s.user_agent, s.ip, s.created_at, s.last_used_at, s.revoked_at
+		FROM user_sessions s WHERE s.user_id = $1 ORDER BY s.id;`
+	rows, err := sr.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	sessions := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		if err = rows.Scan(&session.ID, &session.UserID, &session.FamilyID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastUsedAt, &session.RevokedAt); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,108 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// UnlockableRepository handles encrypted token payloads in PostgreSQL.
+type UnlockableRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewUnlockableRepository creates a new instance of UnlockableRepository with the given PostgreSQL connection pool.
+func NewUnlockableRepository(db *pgxpool.Pool) *UnlockableRepository {
+	return &UnlockableRepository{
+		db: db,
+	}
+}
+
+// Save creates or replaces the encrypted payload of the token.
+func (ur *UnlockableRepository) Save(ctx context.Context, u *models.NftUnlockable) error {
+	const op = "postgresql.UnlockableRepository.Save"
+
+	now := time.Now().UTC()
+	query := `INSERT INTO nft_unlockable (token_id, ciphertext, nonce, wrapped_key, key_nonce, master_key_id, owner_address, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (token_id) DO UPDATE
+		SET ciphertext = EXCLUDED.ciphertext, nonce = EXCLUDED.nonce, wrapped_key = EXCLUDED.wrapped_key,
+			key_nonce = EXCLUDED.key_nonce, master_key_id = EXCLUDED.master_key_id,
+			owner_address = EXCLUDED.owner_address, updated_at = EXCLUDED.updated_at;`
+
+	if _, err := ur.db.Exec(ctx, query, u.TokenId, u.Ciphertext, u.Nonce, u.WrappedKey, u.KeyNonce,
+		u.MasterKeyID, u.OwnerAddress, now); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// GetByTokenID retrieves the encrypted payload of the token.
+func (ur *UnlockableRepository) GetByTokenID(ctx context.Context, tokenId int64) (*models.NftUnlockable, error) {
+	const op = "postgresql.UnlockableRepository.GetByTokenID"
+	var u models.NftUnlockable
+
+	query := `SELECT token_id, ciphertext, nonce, wrapped_key, key_nonce, master_key_id, owner_address
+		FROM nft_unlockable WHERE token_id = $1;`
+	if err := ur.db.QueryRow(ctx, query, tokenId).Scan(&u.TokenId, &u.Ciphertext, &u.Nonce, &u.WrappedKey,
+		&u.KeyNonce, &u.MasterKeyID, &u.OwnerAddress); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &u, nil
+}
+
+// ListByMasterKey retrieves payloads which are not wrapped with the given master key.
+func (ur *UnlockableRepository) ListByMasterKey(ctx context.Context, excludeKeyID string, limit int) ([]models.NftUnlockable, error) {
+	const op = "postgresql.UnlockableRepository.ListByMasterKey"
+
+	query := `SELECT token_id, ciphertext, nonce, wrapped_key, key_nonce, master_key_id, owner_address
+		FROM nft_unlockable WHERE master_key_id <> $1 ORDER BY token_id LIMIT $2;`
+	rows, err := ur.db.Query(ctx, query, excludeKeyID, limit)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	result := make([]models.NftUnlockable, 0)
+	for rows.Next() {
+		var u models.NftUnlockable
+		if err = rows.Scan(&u.TokenId, &u.Ciphertext, &u.Nonce, &u.WrappedKey, &u.KeyNonce,
+			&u.MasterKeyID, &u.OwnerAddress); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		result = append(result, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return result, nil
+}
+
+// LogAccess stores a reveal of the payload.
+func (ur *UnlockableRepository) LogAccess(ctx context.Context, access *models.NftUnlockableAccess) error {
+	const op = "postgresql.UnlockableRepository.LogAccess"
+
+	query := "INSERT INTO nft_unlockable_access (token_id, user_id, ip, user_agent) VALUES ($1, $2, $3, $4);"
+	res, err := ur.db.Exec(ctx, query, access.TokenId, access.UserID, access.IP, access.UserAgent)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrInsertFailed)
+	}
+
+	return nil
+}
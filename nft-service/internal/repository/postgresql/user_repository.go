@@ -3,9 +3,11 @@ package postgresql
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"main/internal/auth/tools"
@@ -16,15 +18,22 @@ import (
 
 // UserRepository handles user-related operations in PostgreSQL.
 type UserRepository struct {
-	db     *pgxpool.Pool
-	secret string
+	db        *pgxpool.Pool
+	passwords *tools.PasswordHasher
 }
 
+// noPassword is stored for users without a password, a hash starting with $ of no known algorithm never matches
+const noPassword = "$none"
+
+// profileColumns selects models.UserProfile of the users row aliased u
+const profileColumns = `COALESCE(u.display_name, ''), COALESCE(u.avatar_cid, ''), COALESCE(u.locale, ''),
+	ARRAY(SELECT w.address FROM user_wallets w WHERE w.user_id = u.id ORDER BY w.id)`
+
 // NewUserRepository creates a new instance of UserRepository with the given PostgreSQL connection pool.
-func NewUserRepository(db *pgxpool.Pool, secret string) *UserRepository {
+func NewUserRepository(db *pgxpool.Pool, passwords *tools.PasswordHasher) *UserRepository {
 	return &UserRepository{
-		db:     db,
-		secret: secret,
+		db:        db,
+		passwords: passwords,
 	}
 }
 
@@ -49,10 +58,11 @@ func (ur *UserRepository) UserByPhone(ctx context.Context, phone string) (*model
 	const op = "postgresql.UserRepository.UserByPhone"
 	var user models.User
 
-	query := `SELECT id, phone, password, salt, role_id FROM users WHERE phone = $1 AND deleted_at IS NULL;`
+	query := `SELECT id, phone, COALESCE(email, ''), email_verified_at, password, salt, role_id, locked_until,
+		COALESCE(telegram_id, 0) FROM users WHERE phone = $1 AND deleted_at IS NULL;`
 
-	if err := ur.db.QueryRow(ctx, query, phone).Scan(&user.ID, &user.Phone,
-		&user.Password, &user.Salt, &user.RoleID); err != nil {
+	if err := ur.db.QueryRow(ctx, query, phone).Scan(&user.ID, &user.Phone, &user.Email, &user.EmailVerifiedAt,
+		&user.Password, &user.Salt, &user.RoleID, &user.LockedUntil, &user.TelegramID); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
 		}
@@ -67,10 +77,12 @@ func (ur *UserRepository) UserById(ctx context.Context, id int64) (*models.User,
 	const op = "postgresql.UserRepository.UserById"
 	var user models.User
 
-	query := `SELECT id, phone, password, salt, role_id FROM users WHERE id = $1 AND deleted_at IS NULL;`
+	query := `SELECT id, phone, COALESCE(email, ''), email_verified_at, password, salt, role_id, locked_until,
+		COALESCE(telegram_id, 0), ` + profileColumns + ` FROM users u WHERE id = $1 AND deleted_at IS NULL;`
 
-	if err := ur.db.QueryRow(ctx, query, id).Scan(&user.ID, &user.Phone,
-		&user.Password, &user.Salt, &user.RoleID); err != nil {
+	if err := ur.db.QueryRow(ctx, query, id).Scan(&user.ID, &user.Phone, &user.Email, &user.EmailVerifiedAt,
+		&user.Password, &user.Salt, &user.RoleID, &user.LockedUntil, &user.TelegramID, &user.Profile.DisplayName,
+		&user.Profile.AvatarCID, &user.Profile.Locale, &user.Profile.Wallets); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
 		}
@@ -80,39 +92,250 @@ func (ur *UserRepository) UserById(ctx context.Context, id int64) (*models.User,
 	return &user, nil
 }
 
-// CreateUser saves a new user to the database with the provided phone number, password, and salt.
-func (ur *UserRepository) CreateUser(ctx context.Context, phone, password string) (*models.User, error) {
+// CreateUser saves a new user to the database with the provided phone number and password.
+// A non-empty inviteCode is redeemed, see insertUser.
+func (ur *UserRepository) CreateUser(ctx context.Context, phone, password, inviteCode string) (*models.User, error) {
 	const op = "postgresql.UserRepository.CreateUser"
+
+	hashPassword, err := ur.passwords.Hash(password)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	user, err := ur.insertUser(ctx, phone, nil, nil, hashPassword, inviteCode)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return user, nil
+}
+
+// UserByTelegramId retrieves a user by the linked Telegram account.
+func (ur *UserRepository) UserByTelegramId(ctx context.Context, telegramId int64) (*models.User, error) {
+	const op = "postgresql.UserRepository.UserByTelegramId"
 	var user models.User
 
-	salt := tools.GenerateRandomSalt(tools.SaltSize)
-	hashPassword := tools.HashPassword(password, ur.secret, salt)
+	query := `SELECT id, phone, COALESCE(email, ''), email_verified_at, password, salt, role_id, locked_until,
+		COALESCE(telegram_id, 0) FROM users WHERE telegram_id = $1 AND deleted_at IS NULL;`
 
-	query := "INSERT INTO users (phone, password, salt, role_id) VALUES ($1, $2, $3, $4) RETURNING id, role_id"
-	if err := ur.db.QueryRow(ctx, query, phone, hashPassword, salt, tvomodels.USER).
-		Scan(&user.ID, &user.RoleID); err != nil {
+	if err := ur.db.QueryRow(ctx, query, telegramId).Scan(&user.ID, &user.Phone, &user.Email, &user.EmailVerifiedAt,
+		&user.Password, &user.Salt, &user.RoleID, &user.LockedUntil, &user.TelegramID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &user, nil
+}
+
+// CreateUserByTelegram saves a new user known only by the Telegram account.
+func (ur *UserRepository) CreateUserByTelegram(ctx context.Context, telegramId int64) (*models.User, error) {
+	const op = "postgresql.UserRepository.CreateUserByTelegram"
+	var user models.User
+
+	query := `INSERT INTO users (phone, password, salt, role_id, telegram_id)
+		VALUES ('', $1, NULL, $2, $3) RETURNING id, role_id, telegram_id`
+	if err := ur.db.QueryRow(ctx, query, noPassword, tvomodels.USER, telegramId).
+		Scan(&user.ID, &user.RoleID, &user.TelegramID); err != nil {
+		if isUniqueViolation(err) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
 		return nil, tvoerrors.Wrap(op, err)
 	}
 
 	return &user, nil
 }
 
-// UpdatePassword updates the password and salt of a user in the database.
-func (ur *UserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+// EmailExists checks if a user with the given verified email exists in the database.
+// An unverified email doesn't reserve the address, it is released when the owner verifies it, see releaseEmail.
+func (ur *UserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	const op = "postgresql.UserRepository.EmailExists"
+	var id int64
+
+	query := "SELECT id FROM users WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL;"
+
+	if err := ur.db.QueryRow(ctx, query, email).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return false, tvoerrors.Wrap(op, err)
+	}
+	return true, nil
+}
+
+// UserByEmail retrieves a user by the verified email, an unverified email can't be used to log in.
+func (ur *UserRepository) UserByEmail(ctx context.Context, email string) (*models.User, error) {
+	const op = "postgresql.UserRepository.UserByEmail"
+	var user models.User
+
+	query := `SELECT id, phone, email, email_verified_at, password, salt, role_id, locked_until, COALESCE(telegram_id, 0)
+		FROM users WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL AND deleted_at IS NULL;`
+
+	if err := ur.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Phone, &user.Email, &user.EmailVerifiedAt,
+		&user.Password, &user.Salt, &user.RoleID, &user.LockedUntil, &user.TelegramID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &user, nil
+}
+
+// CreateUserByEmail saves a new user registered with a confirmed email and without a phone number.
+// A non-empty inviteCode is redeemed, see insertUser.
+func (ur *UserRepository) CreateUserByEmail(ctx context.Context, email, password, inviteCode string) (*models.User, error) {
+	const op = "postgresql.UserRepository.CreateUserByEmail"
+
+	hashPassword, err := ur.passwords.Hash(password)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	verifiedAt := time.Now().UTC()
+	user, err := ur.insertUser(ctx, "", email, &verifiedAt, hashPassword, inviteCode)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return user, nil
+}
+
+// insertUser saves a user with the password hash. With an invite code the code is redeemed in the same transaction,
+// the user gets its role and referrer; an unusable code is not found and nothing is saved.
+func (ur *UserRepository) insertUser(ctx context.Context, phone string, email any, emailVerifiedAt *time.Time,
+	passwordHash, inviteCode string) (*models.User, error) {
+	var user models.User
+
+	tx, err := ur.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if address, ok := email.(string); ok && address != "" && emailVerifiedAt != nil {
+		if err = releaseEmail(ctx, tx, address); err != nil {
+			return nil, err
+		}
+	}
+
+	roleId := tvomodels.USER
+	var inviteId, referrerId int64
+	if inviteCode != "" {
+		invite, err := redeemInvite(ctx, tx, inviteCode)
+		if err != nil {
+			return nil, err
+		}
+		inviteId, referrerId = invite.ID, invite.ReferrerID
+		if invite.RoleID != 0 {
+			roleId = tvomodels.RoleId(invite.RoleID)
+		}
+	}
+
+	// соль хранится внутри хеша, колонка salt нужна только для старого формата
+	query := `INSERT INTO users (phone, email, email_verified_at, password, salt, role_id, invite_id, referrer_id)
+		VALUES ($1, $2, $3, $4, NULL, $5, NULLIF($6, 0), NULLIF($7, 0)) RETURNING id, role_id`
+	if err = tx.QueryRow(ctx, query, phone, email, emailVerifiedAt, passwordHash, roleId, inviteId, referrerId).
+		Scan(&user.ID, &user.RoleID); err != nil {
+		if isUniqueViolation(err) {
+			return nil, tvoerrors.ErrConflict
+		}
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SetEmail replaces the email of the user, verified tells whether the address is already confirmed.
+func (ur *UserRepository) SetEmail(ctx context.Context, id int64, email string, verified bool) error {
+	const op = "postgresql.UserRepository.SetEmail"
+	now := time.Now().UTC()
+
+	tx, err := ur.db.Begin(ctx)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var verifiedAt *time.Time
+	if verified {
+		verifiedAt = &now
+		if err = releaseEmail(ctx, tx, email); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+
+	query := "UPDATE users SET email = $1, email_verified_at = $2, updated_at = $3 WHERE id = $4 AND deleted_at IS NULL;"
+	result, err := tx.Exec(ctx, query, email, verifiedAt, now, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// releaseEmail takes the address from an account which set it without verifying. The address stays unique,
+// so one unverified holder could block the owner from registering with it or changing to it;
+// a verified claim proves the mailbox and wins. A verified holder is left as is and fails the unique index.
+func releaseEmail(ctx context.Context, tx pgx.Tx, email string) error {
+	query := `UPDATE users SET email = NULL, updated_at = $2
+		WHERE lower(email) = lower($1) AND email_verified_at IS NULL;`
+	_, err := tx.Exec(ctx, query, email, time.Now().UTC())
+	return err
+}
+
+// VerifyEmail marks the email as confirmed.
+func (ur *UserRepository) VerifyEmail(ctx context.Context, email string) error {
+	const op = "postgresql.UserRepository.VerifyEmail"
+
+	query := `UPDATE users SET email_verified_at = $2
+		WHERE lower(email) = lower($1) AND email_verified_at IS NULL AND deleted_at IS NULL;`
+	result, err := ur.db.Exec(ctx, query, email, time.Now().UTC())
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// UpdatePassword updates the password of a user in the database.
+// The replaced hash goes to the password history, which keeps up to keep hashes.
+func (ur *UserRepository) UpdatePassword(ctx context.Context, id int64, password string, keep int) error {
 	const op = "postgresql.UserRepository.UpdatePassword"
 
 	now := time.Now().UTC()
-	salt := tools.GenerateRandomSalt(tools.SaltSize)
-	hashPassword := tools.HashPassword(password, ur.secret, salt)
+	hashPassword, err := ur.passwords.Hash(password)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
 
 	tx, err := ur.db.Begin(ctx)
 	if err != nil {
 		return tvoerrors.Wrap(op, err)
 	}
 
-	query := "SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;"
+	var old models.PasswordHash
+	query := "SELECT password, salt FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;"
 
-	if err = tx.QueryRow(ctx, query, id).Scan(&id); err != nil {
+	if err = tx.QueryRow(ctx, query, id).Scan(&old.Hash, &old.Salt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
 				return tvoerrors.Wrap(op, rollbackErr)
@@ -126,9 +349,9 @@ func (ur *UserRepository) UpdatePassword(ctx context.Context, id int64, password
 		return tvoerrors.Wrap(op, err)
 	}
 
-	query = "UPDATE users SET password = $1, salt = $2, updated_at = $3 WHERE id = $4 AND deleted_at IS NULL;"
+	query = "UPDATE users SET password = $1, salt = NULL, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL;"
 
-	result, err := tx.Exec(ctx, query, hashPassword, salt, now, id)
+	result, err := tx.Exec(ctx, query, hashPassword, now, id)
 	if err != nil {
 		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
 			return tvoerrors.Wrap(op, rollbackErr)
@@ -143,6 +366,26 @@ func (ur *UserRepository) UpdatePassword(ctx context.Context, id int64, password
 		return tvoerrors.Wrap(op, tvoerrors.ErrUpdateFailed)
 	}
 
+	// у аккаунтов Telegram и OIDC вместо пароля заглушка, хранить ее незачем
+	if keep > 0 && old.Hash != noPassword {
+		query = "INSERT INTO user_password_history (user_id, password, salt, created_at) VALUES ($1, $2, $3, $4);"
+		if _, err = tx.Exec(ctx, query, id, old.Hash, old.Salt, now); err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				return tvoerrors.Wrap(op, rollbackErr)
+			}
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+
+	query = `DELETE FROM user_password_history WHERE user_id = $1 AND id NOT IN
+		(SELECT id FROM user_password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2);`
+	if _, err = tx.Exec(ctx, query, id, keep); err != nil {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			return tvoerrors.Wrap(op, rollbackErr)
+		}
+		return tvoerrors.Wrap(op, err)
+	}
+
 	query = "UPDATE user_tokens SET refresh_token = NULL WHERE user_id = $1;"
 
 	// ignore res, the user may have never logged in.
@@ -179,38 +422,117 @@ func (ur *UserRepository) UpdateLastVisit(ctx context.Context, id int64) error {
 	return nil
 }
 
-// ListUsers retrieves a paginated list of users with their roles and last visit time
-func (ur *UserRepository) ListUsers(ctx context.Context, limit, offset int) ([]models.User, int, error) {
+// UpdateLastVisits updates the last visit timestamps of several users at once, used to flush batched updates.
+func (ur *UserRepository) UpdateLastVisits(ctx context.Context, visits map[int64]time.Time) error {
+	const op = "postgresql.UserRepository.UpdateLastVisits"
+
+	ids := make([]int64, 0, len(visits))
+	times := make([]time.Time, 0, len(visits))
+	for id, at := range visits {
+		ids = append(ids, id)
+		times = append(times, at.UTC())
+	}
+
+	query := `UPDATE users u SET last_visited_at = v.at
+		FROM unnest($1::bigint[], $2::timestamp[]) AS v(id, at)
+		WHERE u.id = v.id AND (u.last_visited_at IS NULL OR u.last_visited_at < v.at);`
+	if _, err := ur.db.Exec(ctx, query, ids, times); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// userSortColumns maps models.UserSortFields to columns, missing last visits are sorted last in both directions
+var userSortColumns = map[string]string{
+	models.UserSortID:        "u.id",
+	models.UserSortCreatedAt: "u.created_at",
+	models.UserSortLastVisit: "u.last_visited_at",
+	models.UserSortPhone:     "u.phone",
+	models.UserSortEmail:     "u.email",
+}
+
+// usersWhere filters by the parameters $1..$8 of usersArgs, zero values don't filter.
+// created_at and last_visited_at are timestamps without time zone filled by now() of a database running in UTC,
+// so usersArgs passes the bounds in UTC.
+const usersWhere = `WHERE ($1 = 0 OR u.role_id = $1)
+	AND ($2 = '' OR u.phone LIKE '%' || $2 || '%') AND ($3 = '' OR u.email ILIKE '%' || $3 || '%')
+	AND ($4::timestamp IS NULL OR u.created_at >= $4) AND ($5::timestamp IS NULL OR u.created_at < $5)
+	AND ($6::timestamp IS NULL OR u.last_visited_at >= $6) AND ($7::timestamp IS NULL OR u.last_visited_at < $7)
+	AND ($8 = '` + models.UserStateAll + `' OR ($8 = '` + models.UserStateDeleted + `') = (u.deleted_at IS NOT NULL))`
+
+// likeEscaper makes wildcards of a search string match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func usersArgs(filter models.UserFilter) []any {
+	times := make([]*time.Time, 0, 4)
+	for _, t := range []*time.Time{filter.CreatedFrom, filter.CreatedTo, filter.VisitedFrom, filter.VisitedTo} {
+		if t != nil {
+			utc := t.UTC()
+			t = &utc
+		}
+		times = append(times, t)
+	}
+	return []any{int64(filter.RoleID), likeEscaper.Replace(filter.Phone), likeEscaper.Replace(filter.Email),
+		times[0], times[1], times[2], times[3], filter.State}
+}
+
+// ListUsers retrieves a page of users matching the filter with their role names, last visit time and profile,
+// and the total count of matching users.
+func (ur *UserRepository) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int, error) {
 	const op = "postgresql.UserRepository.ListUsers"
-	var users []models.User
-	var totalCount int
 
-	// First, get the total count of active users
-	countQuery := "SELECT COUNT(*) FROM users WHERE deleted_at IS NULL"
-	if err := ur.db.QueryRow(ctx, countQuery).Scan(&totalCount); err != nil {
+	args := usersArgs(filter)
+
+	var totalCount int
+	if err := ur.db.QueryRow(ctx, `SELECT COUNT(*) FROM users u `+usersWhere, args...).Scan(&totalCount); err != nil {
 		return nil, 0, tvoerrors.Wrap(op, err)
 	}
 
-	// Then get the paginated list of users
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		column = userSortColumns[models.UserSortID]
+	}
+	direction := "ASC"
+	if filter.Desc {
+		direction = "DESC"
+	}
+
+	// роль подтягивается тем же запросом, пользователь с неизвестной ролью не пропадает из списка
 	query := `
-		SELECT u.id, u.phone, u.role_id, u.last_visited_at
+		SELECT u.id, u.phone, COALESCE(u.email, ''), u.email_verified_at, u.role_id, COALESCE(r.name, ''),
+			u.created_at, u.last_visited_at, u.locked_until, u.deleted_at, COALESCE(u.telegram_id, 0), ` + profileColumns + `
 		FROM users u
-		WHERE u.deleted_at IS NULL
-		ORDER BY u.id ASC
-		LIMIT $1 OFFSET $2
+		LEFT JOIN roles r ON r.id = u.role_id
+		` + usersWhere + `
+		ORDER BY ` + column + ` ` + direction + ` NULLS LAST, u.id ` + direction + `
+		LIMIT $9 OFFSET $10
 	`
 
-	rows, err := ur.db.Query(ctx, query, limit, offset)
+	rows, err := ur.db.Query(ctx, query, append(args, filter.Limit, filter.Offset)...)
 	if err != nil {
 		return nil, 0, tvoerrors.Wrap(op, err)
 	}
 	defer rows.Close()
 
+	users := make([]models.User, 0)
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Phone, &user.RoleID, &user.LastVisitedAt); err != nil {
+		var createdAt, lastVisitedAt, deletedAt *time.Time
+		if err := rows.Scan(&user.ID, &user.Phone, &user.Email, &user.EmailVerifiedAt, &user.RoleID, &user.RoleName,
+			&createdAt, &lastVisitedAt, &user.LockedUntil, &deletedAt, &user.TelegramID, &user.Profile.DisplayName,
+			&user.Profile.AvatarCID, &user.Profile.Locale, &user.Profile.Wallets); err != nil {
 			return nil, 0, tvoerrors.Wrap(op, err)
 		}
+		if createdAt != nil {
+			user.CreatedAt = *createdAt
+		}
+		if lastVisitedAt != nil {
+			user.LastVisitedAt = *lastVisitedAt
+		}
+		if deletedAt != nil {
+			user.DeletedAt = *deletedAt
+		}
 		users = append(users, user)
 	}
 
@@ -221,14 +543,55 @@ func (ur *UserRepository) ListUsers(ctx context.Context, limit, offset int) ([]m
 	return users, totalCount, nil
 }
 
+// UpdateProfile changes the profile fields which are not nil, an empty value clears the field.
+func (ur *UserRepository) UpdateProfile(ctx context.Context, id int64, displayName, locale *string) error {
+	const op = "postgresql.UserRepository.UpdateProfile"
+
+	query := `UPDATE users SET updated_at = $2,
+		display_name = CASE WHEN $3::varchar IS NULL THEN display_name ELSE NULLIF($3, '') END,
+		locale = CASE WHEN $4::varchar IS NULL THEN locale ELSE NULLIF($4, '') END
+		WHERE id = $1 AND deleted_at IS NULL;`
+
+	result, err := ur.db.Exec(ctx, query, id, time.Now().UTC(), displayName, locale)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// SetAvatar replaces the avatar CID of the user, an empty CID removes the avatar.
+func (ur *UserRepository) SetAvatar(ctx context.Context, id int64, cid string) error {
+	const op = "postgresql.UserRepository.SetAvatar"
+
+	query := "UPDATE users SET updated_at = $2, avatar_cid = NULLIF($3, '') WHERE id = $1 AND deleted_at IS NULL;"
+
+	result, err := ur.db.Exec(ctx, query, id, time.Now().UTC(), cid)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// UpdateTelegramId links the Telegram account to the user, an account linked to another user is a conflict.
 func (ur *UserRepository) UpdateTelegramId(ctx context.Context, id, telegramId int64) error {
 	const op = "postgresql.UserRepository.UpdateTelegramId"
 
 	now := time.Now().UTC()
-	query := "UPDATE users SET updated_at = $1, telegram_id = $2 WHERE id = $3;"
+	query := "UPDATE users SET updated_at = $1, telegram_id = $2 WHERE id = $3 AND deleted_at IS NULL;"
 
 	result, err := ur.db.Exec(ctx, query, now, telegramId, id)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
 		return tvoerrors.Wrap(op, err)
 	}
 
@@ -299,7 +662,51 @@ func (ur *UserRepository) DeleteUser(ctx context.Context, id int64) error {
 	return nil
 }
 
+// PurgeDeleted hard-deletes up to limit users soft-deleted before deletedBefore and returns their ids.
+// Rows without a foreign key to users are deleted here, the others cascade. The audit log is kept.
+func (ur *UserRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time, limit int) ([]int64, error) {
+	const op = "postgresql.UserRepository.PurgeDeleted"
+
+	tx, err := ur.db.Begin(ctx)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// параллельный запуск на другой реплике пропускает уже выбранные строки
+	query := `SELECT id FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1 ORDER BY deleted_at
+		LIMIT $2 FOR UPDATE SKIP LOCKED;`
+	rows, err := tx.Query(ctx, query, deletedBefore.UTC(), limit)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	for _, query = range []string{
+		"DELETE FROM user_tokens WHERE user_id = ANY($1);",
+		"DELETE FROM nft_unlockable_access WHERE user_id = ANY($1);",
+		"DELETE FROM users WHERE id = ANY($1);",
+	} {
+		if _, err = tx.Exec(ctx, query, ids); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return ids, nil
+}
+
 // DigUpUser restores a previously deleted user record identified by the given ID.
+// It fails with ErrConflict when the phone, Telegram account or verified email was taken while the user was deleted.
 func (ur *UserRepository) DigUpUser(ctx context.Context, id int64) (*models.User, error) {
 	const op = "postgresql.UserRepository.DigUpUser"
 
@@ -314,30 +721,42 @@ func (ur *UserRepository) DigUpUser(ctx context.Context, id int64) (*models.User
 
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	query := "SELECT id, phone, role_id FROM users WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE;"
+	query := `SELECT id, phone, COALESCE(email, ''), email_verified_at, COALESCE(telegram_id, 0), role_id FROM users
+		WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE;`
 
-	if err = tx.QueryRow(ctx, query, id).Scan(&user.ID, &user.Phone, &user.RoleID); err != nil {
+	if err = tx.QueryRow(ctx, query, id).Scan(&user.ID, &user.Phone, &user.Email, &user.EmailVerifiedAt,
+		&user.TelegramID, &user.RoleID); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
 		}
 		return nil, tvoerrors.Wrap(op, err)
 	}
 
-	// check phone exists
-
-	query = "SELECT EXISTS (select id FROM users WHERE (phone = $1) AND deleted_at IS NULL);"
-	if err = tx.QueryRow(ctx, query, user.Phone).Scan(&exists); err != nil {
+	// пока пользователь был удален, его телефон, Telegram или подтвержденный email могли занять.
+	// Пустой телефон у пользователей, зарегистрированных по email или через Telegram, не конфликтует
+	verifiedEmail := ""
+	if user.EmailVerifiedAt != nil {
+		verifiedEmail = user.Email
+	}
+	query = `SELECT EXISTS (SELECT id FROM users WHERE deleted_at IS NULL AND (
+		($1 <> '' AND phone = $1) OR ($2 <> 0 AND telegram_id = $2) OR
+		($3 <> '' AND lower(email) = lower($3) AND email_verified_at IS NOT NULL)));`
+	if err = tx.QueryRow(ctx, query, user.Phone, user.TelegramID, verifiedEmail).Scan(&exists); err != nil {
 		return nil, tvoerrors.Wrap(op, err)
 	}
 
 	if exists {
-		return nil, tvoerrors.Wrap(op, tvoerrors.Wrap("Phone already exists", tvoerrors.ErrUpdateFailed))
+		return nil, tvoerrors.Wrap(op, tvoerrors.Wrap("phone, telegram or email already taken", tvoerrors.ErrConflict))
 	}
 
 	query = "UPDATE users SET deleted_at = NULL, updated_at = $1 WHERE id = $2;"
 
 	result, err := tx.Exec(ctx, query, now, id)
 	if err != nil {
+		// Telegram могли привязать параллельно после проверки
+		if isUniqueViolation(err) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+		}
 		return nil, tvoerrors.Wrap(op, err)
 	}
 
@@ -460,3 +879,131 @@ func (ur *UserRepository) ChangeRole(ctx context.Context, id, roleId int64) erro
 
 	return nil
 }
+
+// Referral returns the invite the user registered with, nil when the user registered without one.
+func (ur *UserRepository) Referral(ctx context.Context, id int64) (*models.ExportReferral, error) {
+	const op = "postgresql.UserRepository.Referral"
+	var referral models.ExportReferral
+
+	// код мог быть удален вместе с приглашением, тогда остается только пригласивший
+	query := `SELECT COALESCE(u.referrer_id, 0), COALESCE(u.invite_id, 0), COALESCE(i.code, '') FROM users u
+		LEFT JOIN invite_codes i ON i.id = u.invite_id WHERE u.id = $1;`
+	if err := ur.db.QueryRow(ctx, query, id).Scan(&referral.ReferrerID, &referral.InviteID,
+		&referral.InviteCode); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if referral == (models.ExportReferral{}) {
+		return nil, nil
+	}
+
+	return &referral, nil
+}
+
+// PasswordChanges returns the times previous passwords of the user were replaced, oldest first.
+func (ur *UserRepository) PasswordChanges(ctx context.Context, id int64) ([]time.Time, error) {
+	const op = "postgresql.UserRepository.PasswordChanges"
+
+	query := "SELECT created_at FROM user_password_history WHERE user_id = $1 ORDER BY id;"
+	rows, err := ur.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	changes, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return changes, nil
+}
+
+// PasswordHistory returns the current password hash of the user followed by up to limit previous ones.
+func (ur *UserRepository) PasswordHistory(ctx context.Context, id int64, limit int) ([]models.PasswordHash, error) {
+	const op = "postgresql.UserRepository.PasswordHistory"
+
+	// текущий хеш всегда первый, за ним предыдущие от новых к старым
+	query := `(SELECT password, salt, NULL::bigint AS n FROM users WHERE id = $1 AND deleted_at IS NULL)
+		UNION ALL
+		(SELECT password, salt, id FROM user_password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2)
+		ORDER BY n DESC NULLS FIRST;`
+	rows, err := ur.db.Query(ctx, query, id, limit)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	var history []models.PasswordHash
+	for rows.Next() {
+		var hash models.PasswordHash
+		var n *int64
+		if err = rows.Scan(&hash.Hash, &hash.Salt, &n); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		history = append(history, hash)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if len(history) == 0 {
+		return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return history, nil
+}
+
+// UpdatePasswordHash replaces the stored hash of the same password, used to upgrade hashes on login.
+// Unlike UpdatePassword it keeps the sessions of the user.
+func (ur *UserRepository) UpdatePasswordHash(ctx context.Context, id int64, hash string) error {
+	const op = "postgresql.UserRepository.UpdatePasswordHash"
+
+	query := "UPDATE users SET password = $1, salt = NULL WHERE id = $2 AND deleted_at IS NULL;"
+	result, err := ur.db.Exec(ctx, query, hash, id)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrUpdateFailed)
+	}
+
+	return nil
+}
+
+// LockUntil locks the account of the user after too many failed logins.
+func (ur *UserRepository) LockUntil(ctx context.Context, id int64, until time.Time) error {
+	const op = "postgresql.UserRepository.LockUntil"
+
+	query := "UPDATE users SET locked_until = $1 WHERE id = $2 AND deleted_at IS NULL;"
+	result, err := ur.db.Exec(ctx, query, until, id)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrUpdateFailed)
+	}
+
+	return nil
+}
+
+// Unlock removes the lockout of the user.
+func (ur *UserRepository) Unlock(ctx context.Context, id int64) error {
+	const op = "postgresql.UserRepository.Unlock"
+
+	query := "UPDATE users SET locked_until = NULL WHERE id = $1 AND deleted_at IS NULL;"
+	result, err := ur.db.Exec(ctx, query, id)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if result.RowsAffected() != 1 {
+		return tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether the error is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
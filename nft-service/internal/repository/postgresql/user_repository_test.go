@@ -0,0 +1,51 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"main/internal/models"
+)
+
+func TestLikeEscaper(t *testing.T) {
+	tests := []struct {
+		value, expected string
+	}{
+		{"", ""},
+		{"+7900", "+7900"},
+		{"100%", `100\%`},
+		{"first_last@example.com", `first\_last@example.com`},
+		{`a\b`, `a\\b`},
+		{`\%_`, `\\\%\_`},
+	}
+	for _, tt := range tests {
+		if got := likeEscaper.Replace(tt.value); got != tt.expected {
+			t.Errorf("likeEscaper.Replace(%q) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestUsersArgs(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	createdFrom := time.Date(2025, 11, 1, 3, 0, 0, 0, moscow)
+
+	args := usersArgs(models.UserFilter{RoleID: 2, Email: "a_b", CreatedFrom: &createdFrom,
+		State: models.UserStateActive})
+	if len(args) != 8 {
+		t.Fatalf("usersArgs() = %v, expected 8 parameters", args)
+	}
+	if args[0] != int64(2) || args[1] != "" || args[2] != `a\_b` || args[7] != models.UserStateActive {
+		t.Errorf("usersArgs() = %v", args)
+	}
+
+	// границы передаются в UTC, колонки timestamp хранят время в UTC
+	from, ok := args[3].(*time.Time)
+	if !ok || from.Location() != time.UTC || !from.Equal(createdFrom) {
+		t.Errorf("usersArgs() created_from = %v, expected %v in UTC", args[3], createdFrom)
+	}
+	for i := 4; i < 7; i++ {
+		if bound, ok := args[i].(*time.Time); !ok || bound != nil {
+			t.Errorf("usersArgs()[%d] = %v, expected a nil bound", i, args[i])
+		}
+	}
+}
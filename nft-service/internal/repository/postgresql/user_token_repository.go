@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"main/internal/auth/tools"
 	"main/internal/models"
 	tvoerrors "main/tools/pkg/tvo_errors"
 )
@@ -26,44 +28,32 @@ func NewUserTokenRepository(db *pgxpool.Pool, debug bool) *UserTokenRepository {
 	}
 }
 
-// Create saves a new user token to the database.
-func (utr *UserTokenRepository) Create(ctx context.Context, id int64, accessToken, refreshToken string, tokenTTL,
-	refreshTokenTTL time.Duration) (*models.UserToken, error) {
+// Create saves a new user token to the database as the first token of a new token family.
+// Only the hash of the refresh token is stored, the returned token contains the plain value.
+func (utr *UserTokenRepository) Create(ctx context.Context, id int64, familyId, accessToken, refreshToken string,
+	tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error) {
 	const op = "postgresql.UserTokenRepository.Create"
 
-	expiredAt := time.Now().UTC().Add(tokenTTL)
-	refreshExpiredAt := time.Now().UTC().Add(refreshTokenTTL)
+	userToken := newUserToken(id, accessToken, refreshToken, tokenTTL, refreshTokenTTL)
+	userToken.FamilyID = familyId
 
-	query := `INSERT INTO user_tokens (user_id, token, refresh_token, expired_at, refresh_expired_at) 
-		VALUES ($1, $2, $3, $4, $5);`
-
-	res, err := utr.db.Exec(ctx, query, id, accessToken, refreshToken, expiredAt, refreshExpiredAt)
-	if err != nil {
+	if err := insertUserToken(ctx, utr.db, userToken); err != nil {
 		return nil, tvoerrors.Wrap(op, err)
 	}
-	if res.RowsAffected() != 1 {
-		return nil, tvoerrors.Wrap(op, tvoerrors.ErrInsertFailed)
-	}
-
-	userToken := &models.UserToken{
-		UserID:           id,
-		Token:            accessToken,
-		ExpiredAt:        expiredAt,
-		RefreshToken:     refreshToken,
-		RefreshExpiredAt: refreshExpiredAt,
-	}
 
 	return userToken, nil
 }
 
-// GetRefreshToken retrieves a user token from the database based on the access token and refresh token.
+// GetRefreshToken retrieves a not expired user token by the refresh token, including already rotated ones.
 func (utr *UserTokenRepository) GetRefreshToken(ctx context.Context, refresh string) (*models.UserToken, error) {
 	const op = "postgresql.UserTokenRepository.GetRefreshToken"
 	var userToken models.UserToken
 	now := time.Now().UTC()
 
-	query := "SELECT user_id FROM user_tokens WHERE refresh_token = $1 AND refresh_expired_at >= $2;"
-	if err := utr.db.QueryRow(ctx, query, refresh, now).Scan(&userToken.UserID); err != nil {
+	query := `SELECT id, user_id, COALESCE(family_id, ''), rotated_at, refresh_expired_at FROM user_tokens
+		WHERE refresh_token = $1 AND refresh_expired_at >= $2;`
+	if err := utr.db.QueryRow(ctx, query, tools.HashRefreshToken(refresh), now).Scan(&userToken.ID,
+		&userToken.UserID, &userToken.FamilyID, &userToken.RotatedAt, &userToken.RefreshExpiredAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, tvoerrors.Wrap(op, tvoerrors.ErrNotFound)
 		}
@@ -73,6 +63,82 @@ func (utr *UserTokenRepository) GetRefreshToken(ctx context.Context, refresh str
 	return &userToken, nil
 }
 
+// Rotate marks the parent refresh token as used and saves the new pair in the same family.
+// Returns ErrConflict if the parent was rotated concurrently.
+func (utr *UserTokenRepository) Rotate(ctx context.Context, parent *models.UserToken, accessToken, refreshToken string,
+	tokenTTL, refreshTokenTTL time.Duration) (*models.UserToken, error) {
+	const op = "postgresql.UserTokenRepository.Rotate"
+
+	tx, err := utr.db.Begin(ctx)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	query := `UPDATE user_tokens SET rotated_at = $2
+		WHERE id = $1 AND rotated_at IS NULL AND refresh_token IS NOT NULL;`
+	res, err := tx.Exec(ctx, query, parent.ID, time.Now().UTC())
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if res.RowsAffected() != 1 {
+		return nil, tvoerrors.Wrap(op, tvoerrors.ErrConflict)
+	}
+
+	userToken := newUserToken(parent.UserID, accessToken, refreshToken, tokenTTL, refreshTokenTTL)
+	userToken.FamilyID = parent.FamilyID
+	userToken.ParentID = parent.ID
+
+	if err = insertUserToken(ctx, tx, userToken); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return userToken, nil
+}
+
+// RevokeFamily revokes every token issued from the same login.
+func (utr *UserTokenRepository) RevokeFamily(ctx context.Context, familyId string) error {
+	const op = "postgresql.UserTokenRepository.RevokeFamily"
+
+	query := "UPDATE user_tokens SET refresh_token = NULL WHERE family_id = $1;"
+	if _, err := utr.db.Exec(ctx, query, familyId); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// FamilyTokens retrieves the access tokens of the family which are not expired yet.
+func (utr *UserTokenRepository) FamilyTokens(ctx context.Context, familyId string) ([]string, error) {
+	const op = "postgresql.UserTokenRepository.FamilyTokens"
+
+	query := "SELECT token FROM user_tokens WHERE family_id = $1 AND expired_at > $2;"
+	rows, err := utr.db.Query(ctx, query, familyId, time.Now().UTC())
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	defer rows.Close()
+
+	tokens := make([]string, 0)
+	for rows.Next() {
+		var token string
+		if err = rows.Scan(&token); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return tokens, nil
+}
+
 // DeleteRefreshToken resets the token associated with a user in the database.
 func (utr *UserTokenRepository) DeleteRefreshToken(ctx context.Context, token string) error {
 	const op = "postgresql.UserTokenRepository.DeleteRefreshToken"
@@ -135,10 +201,45 @@ func (utr *UserTokenRepository) GetUserIdByToken(ctx context.Context, token stri
 	now := time.Now().UTC()
 
 	var t models.UserToken
-	query := `SELECT user_id, expired_at FROM user_tokens WHERE token = $1 AND expired_at > $2  AND refresh_token IS NOT NULL`
-	if err := utr.db.QueryRow(ctx, query, token, now).Scan(&t.UserID, &t.ExpiredAt); err != nil {
+	query := `SELECT user_id, expired_at, COALESCE(family_id, '') FROM user_tokens
+		WHERE token = $1 AND expired_at > $2  AND refresh_token IS NOT NULL`
+	if err := utr.db.QueryRow(ctx, query, token, now).Scan(&t.UserID, &t.ExpiredAt, &t.FamilyID); err != nil {
 		return nil, tvoerrors.Wrap(op, err)
 	}
 
 	return &t, nil
 }
+
+// execer is implemented by pgxpool.Pool and pgx.Tx
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func newUserToken(userId int64, accessToken, refreshToken string, tokenTTL, refreshTokenTTL time.Duration) *models.UserToken {
+	now := time.Now().UTC()
+	return &models.UserToken{
+		UserID:           userId,
+		Token:            accessToken,
+		ExpiredAt:        now.Add(tokenTTL),
+		RefreshToken:     refreshToken,
+		RefreshExpiredAt: now.Add(refreshTokenTTL),
+		CreatedAt:        now,
+	}
+}
+
+func insertUserToken(ctx context.Context, db execer, userToken *models.UserToken) error {
+	query := `INSERT INTO user_tokens (user_id, token, refresh_token, expired_at, refresh_expired_at, family_id,
+			parent_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8);`
+
+	res, err := db.Exec(ctx, query, userToken.UserID, userToken.Token, tools.HashRefreshToken(userToken.RefreshToken),
+		userToken.ExpiredAt, userToken.RefreshExpiredAt, userToken.FamilyID, userToken.ParentID, userToken.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 1 {
+		return tvoerrors.ErrInsertFailed
+	}
+
+	return nil
+}
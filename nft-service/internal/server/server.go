@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"log/slog"
+	"main/internal/config"
 	"main/internal/dto"
 	"time"
 
@@ -13,6 +14,9 @@ import (
 
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"main/internal/handlers"
+	"main/internal/models"
+	"main/internal/service"
+	"main/tools/pkg/cache"
 	httpmiddlewares "main/tools/pkg/http_middlewares"
 	httputils "main/tools/pkg/http_utils"
 	"main/tools/pkg/logger"
@@ -20,7 +24,7 @@ import (
 	tvomodels "main/tools/pkg/tvo_models"
 )
 
-func NewServer() *fiber.App {
+func NewServer(cfg *config.Config) *fiber.App {
 	app := fiber.New(fiber.Config{
 		StreamRequestBody: true,
 		WriteTimeout:      time.Second * 15,
@@ -31,20 +35,44 @@ func NewServer() *fiber.App {
 		ServerHeader:      "Apache 2.0",
 		AppName:           "API Gateway",
 		BodyLimit:         20 * 1024 * 1024,
+
+		// сервис стоит за nginx, адрес клиента берется из заголовка только от доверенного прокси,
+		// иначе c.IP() в лимитах и аудите можно подделать
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		ProxyHeader:             fiber.HeaderXForwardedFor,
+		EnableIPValidation:      true,
 	})
 
 	return app
 }
 
-func AddRoutes(app *fiber.App, authHandlers *handlers.AuthHandlers, kuboHandlers *handlers.KuboHandlers,
-	nftHandlers *handlers.NftHandlers, logger *logger.Logger) {
+// Handlers обработчики, которые регистрирует AddRoutes
+type Handlers struct {
+	Auth          *handlers.AuthHandlers
+	Kubo          *handlers.KuboHandlers
+	Nft           *handlers.NftHandlers
+	Unlockable    *handlers.UnlockableHandlers
+	Drift         *handlers.DriftHandlers
+	APIKey        *handlers.APIKeyHandlers
+	Audit         *handlers.AuditHandlers
+	Account       *handlers.AccountHandlers
+	Impersonation *handlers.ImpersonationHandlers
+	Invite        *handlers.InviteHandlers
+}
+
+func AddRoutes(app *fiber.App, cfg *config.Config, cacheClient cache.CacheClient, h *Handlers,
+	permissions *service.PermissionService, logger *logger.Logger) {
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost, http://45.140.147.83", // URL вашего фронтенда
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization", // Разрешаем необходимые заголовки
-		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",             // Разрешаем HTTP методы
+		AllowOrigins: "http://localhost, http://45.140.147.83",                 // URL вашего фронтенда
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-API-Key", // Разрешаем необходимые заголовки
+		AllowMethods: "GET, POST, PUT, PATCH, DELETE, OPTIONS",                 // Разрешаем HTTP методы
 	}))
 	app.Use(healthcheck.New())
 
+	// публичные ключи для проверки токенов другими сервисами
+	app.Get("/.well-known/jwks.json", httputils.FiberJSONWrapper(h.Auth.JWKS))
+
 	v1Router := app.Group("/v1", slogfiber.NewWithConfig(logger.Logger, slogfiber.Config{
 		DefaultLevel:     slog.LevelInfo,
 		ClientErrorLevel: slog.LevelWarn,
@@ -60,13 +88,19 @@ func AddRoutes(app *fiber.App, authHandlers *handlers.AuthHandlers, kuboHandlers
 		WithTraceID:        true,
 	}), recover.New())
 
-	addRoutesV1(v1Router, authHandlers, kuboHandlers, nftHandlers, logger)
+	addRoutesV1(v1Router, cfg, cacheClient, h, permissions, logger)
 }
 
 // checkAuthToken утилита для проверки токена
-func checkAuthToken(logger *logger.Logger) httpmiddlewares.CheckTokenCallback {
+func checkAuthToken(stateless bool, logger *logger.Logger) httpmiddlewares.CheckTokenCallback {
+	check := handlers.AuthHandler.CheckToken
+	if stateless {
+		// проверяем подпись токена локально, без обращения к БД
+		check = handlers.AuthHandler.VerifyToken
+	}
+
 	return func(ctx context.Context, token string) (*tvomodels.TokenData, error) {
-		res, err := handlers.AuthHandler.CheckToken(ctx, &dto.CheckTokenRequest{
+		res, err := check(ctx, &dto.CheckTokenRequest{
 			Token: token,
 		})
 
@@ -84,51 +118,115 @@ func checkAuthToken(logger *logger.Logger) httpmiddlewares.CheckTokenCallback {
 			UserID:     res.UserId,
 			UserRoleID: tvomodels.RoleId(res.RoleId),
 			UserPhone:  res.Phone,
+			UserEmail:  res.Email,
 			RawToken:   token,
+			ActorID:    res.ActorID,
 		}, nil
 	}
 }
 
 // addRoutesV1 добавляем роутинг для версии API v1
-func addRoutesV1(v1Router fiber.Router, authHandlers *handlers.AuthHandlers, kuboHandlers *handlers.KuboHandlers,
-	nftHandlers *handlers.NftHandlers, logger *logger.Logger) fiber.Router {
-	authMiddleware := httpmiddlewares.NewAuthMiddleware(checkAuthToken(logger), false, logger)
-	//guestMiddleware := httpmiddlewares.NewAuthMiddleware(checkAuthToken(logger), true, logger)
+func addRoutesV1(v1Router fiber.Router, cfg *config.Config, cacheClient cache.CacheClient, h *Handlers,
+	permissions *service.PermissionService, logger *logger.Logger) fiber.Router {
+	stateless := cfg.AuthMode == config.AuthModeStateless
+	authMiddleware := httpmiddlewares.NewAuthMiddleware(checkAuthToken(stateless, logger), nil, false, logger)
+	// keyMiddleware дополнительно пускает машинных клиентов по API ключу, каждый такой маршрут требует право
+	keyMiddleware := httpmiddlewares.NewAuthMiddleware(checkAuthToken(stateless, logger), h.APIKey.CheckAPIKey,
+		false, logger)
+	holderMiddleware := httpmiddlewares.NewOwnershipMiddleware(h.Nft.CheckOwnership, "id", cacheClient,
+		cfg.OwnershipTTL, logger)
+	guestMiddleware := httpmiddlewares.NewAuthMiddleware(checkAuthToken(stateless, logger), nil, true, logger)
+	// requirePermission пропускает запрос, только если роль пользователя дает право, ставится после authMiddleware
+	requirePermission := func(permission string) fiber.Handler {
+		return httpmiddlewares.RequirePermission(permissions.Can, permission, logger)
+	}
+	// denyImpersonated закрывает опасные действия для администратора под пользователем, ставится после authMiddleware.
+	// Закрыты и изменения профиля и контента: они выглядели бы как действия самого пользователя.
+	// Остальные методы с правами доступны, цель имперсонации не может иметь прав больше, чем у администратора,
+	// и каждый такой запрос пишется в аудит
+	denyImpersonated := httpmiddlewares.DenyImpersonated(logger)
+
+	// каждый запрос под чужим аккаунтом пишется в журнал аудита
+	v1Router.Use(httpmiddlewares.NewImpersonationMiddleware(h.Audit.ImpersonatedRequest))
 
 	auth := v1Router.Group("/auth")
 
 	// публичные методы
-	auth.Post("/registration/", httputils.FiberJSONWrapper(authHandlers.Registration))
-	auth.Post("/login/", httputils.FiberJSONWrapper(authHandlers.Login))
-	auth.Post("/refresh/", httputils.FiberJSONWrapper(authHandlers.Refresh))
-	auth.Post("/recovery/", httputils.FiberJSONWrapper(authHandlers.Recovery))
-	auth.Post("/ping/", httputils.FiberJSONWrapper(authHandlers.Ping))
+	auth.Post("/registration/", httputils.FiberJSONWrapper(h.Auth.Registration))
+	auth.Post("/login/", httputils.FiberJSONWrapper(h.Auth.Login))
+	auth.Post("/login/mfa/", httputils.FiberJSONWrapper(h.Auth.LoginMFA))
+	auth.Post("/login/mfa/enroll/", httputils.FiberJSONWrapper(h.Auth.EnrollMFAOnLogin))
+	auth.Post("/refresh/", httputils.FiberJSONWrapper(h.Auth.Refresh))
+	auth.Post("/recovery/", httputils.FiberJSONWrapper(h.Auth.Recovery))
+	auth.Post("/email/verify/", httputils.FiberJSONWrapper(h.Auth.VerifyEmail))
+	auth.Post("/telegram/", httputils.FiberJSONWrapper(h.Auth.LoginTelegram))
+	auth.Get("/oidc/:provider/", httputils.FiberJSONWrapper(h.Auth.StartOIDC))
+	auth.Post("/oidc/:provider/callback/", guestMiddleware, httputils.FiberJSONWrapper(h.Auth.OIDCCallback))
+	auth.Post("/ping/", httputils.FiberJSONWrapper(h.Auth.Ping))
+	auth.Post("/otp/", guestMiddleware, httputils.FiberJSONWrapper(h.Auth.SendOTP))
 
 	// методы под авторизацией
 	authProtected := auth.Group("")
 	authProtected = authProtected.Use(authMiddleware)
-	authProtected.Post("/logout/", httputils.FiberJSONWrapper(authHandlers.Logout))
-	authProtected.Post("/delete_user/", httputils.FiberJSONWrapper(authHandlers.DeleteUser))
-	authProtected.Post("/digup_user/", httputils.FiberJSONWrapper(authHandlers.DigupUser))
-	authProtected.Post("/update/", httputils.FiberJSONWrapper(authHandlers.UpdateUser))
-	authProtected.Post("/change_role/", httputils.FiberJSONWrapper(authHandlers.ChangeRole))
-	authProtected.Post("/reset_token/", httputils.FiberJSONWrapper(authHandlers.ResetToken))
-	authProtected.Get("/users/", httputils.FiberJSONWrapper(authHandlers.ListUsers))
+	authProtected.Post("/logout/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.Logout))
+	authProtected.Post("/delete_user/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.DeleteUser))
+	authProtected.Post("/digup_user/", requirePermission(models.PermUsersManage), httputils.FiberJSONWrapper(h.Auth.DigupUser))
+	authProtected.Post("/update/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.UpdateUser))
+	authProtected.Post("/change_role/", requirePermission(models.PermRolesChange), httputils.FiberJSONWrapper(h.Auth.ChangeRole))
+	authProtected.Post("/reset_token/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.ResetToken))
+	authProtected.Get("/users/", requirePermission(models.PermUsersList), httputils.FiberJSONWrapper(h.Auth.ListUsers))
+	authProtected.Get("/sessions/", httputils.FiberJSONWrapper(h.Auth.ListSessions))
+	authProtected.Delete("/sessions/:id", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.RevokeSession))
+	authProtected.Post("/users/:id/unlock", requirePermission(models.PermUsersUnlock), httputils.FiberJSONWrapper(h.Auth.UnlockUser))
+	authProtected.Post("/users/:id/impersonate", denyImpersonated, requirePermission(models.PermUsersImpersonate), httputils.FiberJSONWrapper(h.Impersonation.Impersonate))
+	authProtected.Get("/users/:id/sessions", requirePermission(models.PermUsersList), httputils.FiberJSONWrapper(h.Auth.ListUserSessions))
+	authProtected.Get("/me", httputils.FiberJSONWrapper(h.Auth.GetMe))
+	authProtected.Patch("/me", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.UpdateMe))
+	authProtected.Post("/me/avatar", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.UploadAvatar))
+	authProtected.Delete("/me/avatar", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.DeleteAvatar))
+	authProtected.Get("/me/export", denyImpersonated, h.Account.ExportMe)
+	authProtected.Post("/email/change/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.ChangeEmail))
+	authProtected.Post("/telegram/link/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.LinkTelegram))
+	authProtected.Post("/oidc/:provider/link/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.LinkOIDC))
+	authProtected.Post("/mfa/enroll/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.EnrollMFA))
+	authProtected.Post("/mfa/confirm/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.ConfirmMFA))
+	authProtected.Post("/mfa/disable/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.DisableMFA))
+	authProtected.Post("/mfa/recovery_codes/", denyImpersonated, httputils.FiberJSONWrapper(h.Auth.RegenerateRecoveryCodes))
+	authProtected.Delete("/users/:id/sessions/:sid", requirePermission(models.PermUsersManage), httputils.FiberJSONWrapper(h.Auth.RevokeUserSession))
+	authProtected.Post("/api_keys/", requirePermission(models.PermAPIKeysManage), httputils.FiberJSONWrapper(h.APIKey.CreateAPIKey))
+	authProtected.Get("/api_keys/", requirePermission(models.PermAPIKeysManage), httputils.FiberJSONWrapper(h.APIKey.ListAPIKeys))
+	authProtected.Delete("/api_keys/:id", requirePermission(models.PermAPIKeysManage), httputils.FiberJSONWrapper(h.APIKey.RevokeAPIKey))
+	authProtected.Get("/audit/", requirePermission(models.PermAuditRead), httputils.FiberJSONWrapper(h.Audit.ListAudit))
+	authProtected.Get("/audit/export", requirePermission(models.PermAuditRead), h.Audit.ExportAudit)
+	authProtected.Post("/invites/", requirePermission(models.PermInvitesManage), httputils.FiberJSONWrapper(h.Invite.CreateInvite))
+	authProtected.Get("/invites/", requirePermission(models.PermInvitesManage), httputils.FiberJSONWrapper(h.Invite.ListInvites))
+	authProtected.Delete("/invites/:id", requirePermission(models.PermInvitesManage), httputils.FiberJSONWrapper(h.Invite.RevokeInvite))
+	authProtected.Get("/referrals/", requirePermission(models.PermInvitesManage), httputils.FiberJSONWrapper(h.Invite.ReferralReport))
 
 	// методы сервиса API
 	api := v1Router.Group("/api")
 	api.Get("/pins", handlers.ListPinsHandler)
-	api.Get("/nft/:id", httputils.FiberJSONWrapper(nftHandlers.ReadNft))
-	api.Get("/nft/image/:id", nftHandlers.ReadNftImage)
-	api.Get("/nft/all/:limit", httputils.FiberJSONWrapper(nftHandlers.ReadAllNft))
-
-	apiProtected := v1Router.Group("", authMiddleware)
-	api.Post("/nft_data", httputils.FiberJSONWrapper(nftHandlers.CreateNftData))
-
-	apiProtected.Post("/files", handlers.UploadFileHandler)
+	api.Get("/nft/:id", httputils.FiberJSONWrapper(h.Nft.ReadNft))
+	api.Get("/nft/image/:id", h.Nft.ReadNftImage)
+	api.Get("/nft/all/:limit", guestMiddleware, httputils.FiberJSONWrapper(h.Nft.ReadAllNft))
+	api.Get("/nft/:id/chain", httputils.FiberJSONWrapper(h.Nft.ReadNftOnChain))
+
+	api.Post("/nft_data", keyMiddleware, denyImpersonated, requirePermission(models.PermNftCreate), httputils.FiberJSONWrapper(h.Nft.CreateNftData))
+	api.Post("/nft/:id/unlockable", authMiddleware, denyImpersonated, httputils.FiberJSONWrapper(h.Unlockable.SetUnlockable))
+	api.Post("/unlockable/rotate", authMiddleware, requirePermission(models.PermUnlockableRotate), httputils.FiberJSONWrapper(h.Unlockable.RotateUnlockableKey))
+	api.Get("/drift", keyMiddleware, requirePermission(models.PermDriftRead), httputils.FiberJSONWrapper(h.Drift.DriftReport))
+	api.Post("/drift/run", keyMiddleware, requirePermission(models.PermDriftRun), httputils.FiberJSONWrapper(h.Drift.RunDrift))
+
+	// группа с пустым префиксом повесила бы keyMiddleware на весь /v1, поэтому он ставится на каждый маршрут
+	v1Router.Post("/files", keyMiddleware, denyImpersonated, requirePermission(models.PermPinsWrite), handlers.UploadFileHandler)
 	// Маршруты для управления закреплением (pin)
-	apiProtected.Post("/pins/:cid", handlers.PinCidHandler)
-	apiProtected.Delete("/pins/:cid", handlers.UnpinCidHandler)
+	v1Router.Post("/pins/:cid", keyMiddleware, denyImpersonated, requirePermission(models.PermPinsWrite), h.Kubo.PinCidHandler)
+	v1Router.Delete("/pins/:cid", keyMiddleware, denyImpersonated, requirePermission(models.PermPinsWrite), h.Kubo.UnpinCidHandler)
+
+	// методы только для держателей токена
+	apiHolder := api.Group("/holder", keyMiddleware, requirePermission(models.PermNftRead))
+	apiHolder.Get("/nft/:id", holderMiddleware, httputils.FiberJSONWrapper(h.Nft.HolderCheck))
+	apiHolder.Get("/nft/:id/unlockable", denyImpersonated, holderMiddleware, httputils.FiberJSONWrapper(h.Unlockable.RevealUnlockable))
 
 	return v1Router
 }
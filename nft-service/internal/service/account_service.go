@@ -0,0 +1,179 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"main/internal/models"
+	"main/internal/repository"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// purgeBatchSize limits users deleted in one transaction
+const purgeBatchSize = 100
+
+// AccountStore loads and purges users, implemented by UserRepository
+type AccountStore interface {
+	UserById(ctx context.Context, id int64) (*models.User, error)
+	Referral(ctx context.Context, id int64) (*models.ExportReferral, error)
+	PasswordChanges(ctx context.Context, id int64) ([]time.Time, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time, limit int) ([]int64, error)
+}
+
+// AccountService exports all data tied to a user and purges users deleted longer than the retention window.
+type AccountService struct {
+	logger     *logger.Logger
+	users      AccountStore
+	sessions   repository.SessionRepository
+	identities repository.IdentityRepository
+	apiKeys    repository.APIKeyRepository
+	ownership  repository.OwnershipRepository
+	auditLog   *AuditLog
+	retention  time.Duration
+	now        func() time.Time
+}
+
+// NewAccountService creates a new instance of AccountService.
+func NewAccountService(logger *logger.Logger, users AccountStore, sessions repository.SessionRepository,
+	identities repository.IdentityRepository, apiKeys repository.APIKeyRepository,
+	ownership repository.OwnershipRepository, auditLog *AuditLog, retention time.Duration) *AccountService {
+	return &AccountService{
+		logger:     logger,
+		users:      users,
+		sessions:   sessions,
+		identities: identities,
+		apiKeys:    apiKeys,
+		ownership:  ownership,
+		auditLog:   auditLog,
+		retention:  retention,
+		now:        time.Now,
+	}
+}
+
+// Export collects the account, linked identities, sessions, API keys, audit entries, owned tokens,
+// the invite of the registration and the password change times of the user.
+func (s *AccountService) Export(ctx context.Context, userId int64) (*models.UserExport, error) {
+	const op = "service.AccountService.Export"
+
+	user, err := s.users.UserById(ctx, userId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	export := &models.UserExport{
+		ExportedAt: s.now().UTC(),
+		Account: models.ExportAccount{
+			ID:              user.ID,
+			Phone:           user.Phone,
+			Email:           user.Email,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			TelegramID:      user.TelegramID,
+			RoleID:          user.RoleID,
+			Profile:         user.Profile,
+		},
+	}
+
+	if export.Identities, err = s.identities.ByUser(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if export.Sessions, err = s.sessions.AllByUser(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if export.APIKeys, err = s.apiKeys.List(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if export.OwnedNfts, err = s.ownership.TokensByUser(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if export.AuditLog, err = s.auditEntries(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if export.Referral, err = s.users.Referral(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if export.PasswordChanges, err = s.users.PasswordChanges(ctx, userId); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return export, nil
+}
+
+// auditEntries returns entries with the user as actor or as target in chronological order
+func (s *AccountService) auditEntries(ctx context.Context, userId int64) ([]models.AuditEntry, error) {
+	entries := make([]models.AuditEntry, 0)
+	seen := make(map[int64]bool)
+	collect := func(entry *models.AuditEntry) error {
+		if !seen[entry.ID] {
+			seen[entry.ID] = true
+			entries = append(entries, *entry)
+		}
+		return nil
+	}
+
+	if err := s.auditLog.Each(ctx, models.AuditFilter{ActorID: userId}, collect); err != nil {
+		return nil, err
+	}
+	if err := s.auditLog.Each(ctx, models.AuditFilter{TargetType: models.AuditTargetUser,
+		TargetID: strconv.FormatInt(userId, 10)}, collect); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(entries, func(a, b models.AuditEntry) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return entries, nil
+}
+
+// Start purges deleted users every interval until the context is cancelled.
+func (s *AccountService) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Purge(ctx); err != nil {
+				s.logger.Error("deleted users purge failed", "error", err)
+			}
+		}
+	}
+}
+
+// Purge hard-deletes users deleted longer than the retention window ago, they can't be restored afterwards.
+func (s *AccountService) Purge(ctx context.Context) (int, error) {
+	const op = "service.AccountService.Purge"
+
+	deletedBefore := s.now().Add(-s.retention)
+	purged := 0
+	for {
+		ids, err := s.users.PurgeDeleted(ctx, deletedBefore, purgeBatchSize)
+		if err != nil {
+			return purged, tvoerrors.Wrap(op, err)
+		}
+		purged += len(ids)
+
+		// записи аудита о пользователе остаются, запись об удалении делается от имени системы
+		for _, id := range ids {
+			s.auditLog.Record(ctx, &models.AuditEntry{
+				Action:     models.AuditUserPurge,
+				TargetType: models.AuditTargetUser,
+				TargetID:   strconv.FormatInt(id, 10),
+			}, nil, nil)
+		}
+
+		if len(ids) < purgeBatchSize {
+			break
+		}
+	}
+
+	if purged > 0 {
+		s.logger.Info("deleted users purged", "count", purged, "deleted_before", deletedBefore)
+	}
+	return purged, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"main/internal/models"
+	"main/internal/repository"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// memoryAccounts is an AccountStore keeping deletion times, referrals and password changes of users
+type memoryAccounts struct {
+	deletedAt       map[int64]time.Time
+	referrals       map[int64]*models.ExportReferral
+	passwordChanges map[int64][]time.Time
+	batches         int
+}
+
+func (m *memoryAccounts) Referral(_ context.Context, id int64) (*models.ExportReferral, error) {
+	return m.referrals[id], nil
+}
+
+func (m *memoryAccounts) PasswordChanges(_ context.Context, id int64) ([]time.Time, error) {
+	return append([]time.Time{}, m.passwordChanges[id]...), nil
+}
+
+// noIdentities answers that the user has no linked identities
+type noIdentities struct {
+	repository.IdentityRepository
+}
+
+func (noIdentities) ByUser(context.Context, int64) ([]models.UserIdentity, error) {
+	return []models.UserIdentity{}, nil
+}
+
+// noSessions answers that the user has no sessions
+type noSessions struct {
+	repository.SessionRepository
+}
+
+func (noSessions) AllByUser(context.Context, int64) ([]models.UserSession, error) {
+	return []models.UserSession{}, nil
+}
+
+func (m *memoryAccounts) UserById(_ context.Context, id int64) (*models.User, error) {
+	if _, ok := m.deletedAt[id]; ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	return &models.User{ID: id}, nil
+}
+
+func (m *memoryAccounts) PurgeDeleted(_ context.Context, deletedBefore time.Time, limit int) ([]int64, error) {
+	m.batches++
+	ids := make([]int64, 0)
+	for id, deletedAt := range m.deletedAt {
+		if len(ids) == limit {
+			break
+		}
+		if deletedAt.Before(deletedBefore) {
+			ids = append(ids, id)
+			delete(m.deletedAt, id)
+		}
+	}
+	return ids, nil
+}
+
+func newTestAccountService(accounts *memoryAccounts, audit *memoryAudit) *AccountService {
+	l := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	return NewAccountService(l, accounts, nil, nil, nil, nil, NewAuditLog(l, audit), 30*24*time.Hour)
+}
+
+func TestAccountServicePurge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 11, 25, 12, 0, 0, 0, time.UTC)
+	accounts := &memoryAccounts{deletedAt: map[int64]time.Time{}}
+	for id := int64(1); id <= purgeBatchSize+1; id++ {
+		accounts.deletedAt[id] = now.Add(-31 * 24 * time.Hour)
+	}
+	// still within the retention window, can be restored
+	accounts.deletedAt[1000] = now.Add(-29 * 24 * time.Hour)
+
+	audit := &memoryAudit{}
+	s := newTestAccountService(accounts, audit)
+	s.now = func() time.Time { return now }
+
+	purged, err := s.Purge(ctx)
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if purged != purgeBatchSize+1 || accounts.batches != 2 {
+		t.Errorf("Purge() = %d in %d batches, expected %d in 2", purged, accounts.batches, purgeBatchSize+1)
+	}
+	if _, ok := accounts.deletedAt[1000]; !ok || len(accounts.deletedAt) != 1 {
+		t.Errorf("Purge() left %v, expected only the user within retention", accounts.deletedAt)
+	}
+	if len(audit.entries) != purged || audit.entries[0].Action != models.AuditUserPurge || audit.entries[0].ActorID != 0 {
+		t.Errorf("Purge() audit entries = %d, first %+v", len(audit.entries), audit.entries[0])
+	}
+}
+
+func TestAccountServiceAuditEntries(t *testing.T) {
+	audit := &memoryAudit{entries: []models.AuditEntry{
+		{ID: 2, ActorID: 7, Action: models.AuditPinAdd},
+		{ID: 1, ActorID: 1, Action: models.AuditRoleChange, TargetType: models.AuditTargetUser, TargetID: "7"},
+	}}
+	s := newTestAccountService(&memoryAccounts{}, audit)
+
+	// the fake returns all entries for both the actor and the target filter, each must be exported once
+	entries, err := s.auditEntries(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 {
+		t.Errorf("auditEntries() = %+v", entries)
+	}
+}
+
+func TestAccountServiceExport(t *testing.T) {
+	ctx := context.Background()
+	changedAt := time.Date(2025, 11, 20, 12, 0, 0, 0, time.UTC)
+	accounts := &memoryAccounts{
+		deletedAt:       map[int64]time.Time{},
+		referrals:       map[int64]*models.ExportReferral{7: {ReferrerID: 5, InviteID: 3, InviteCode: "spring-sale"}},
+		passwordChanges: map[int64][]time.Time{7: {changedAt}},
+	}
+	l := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ownership := &memoryOwnership{owners: map[int64]models.NftOwner{}, wallets: map[string]int64{}}
+	s := NewAccountService(l, accounts, noSessions{}, noIdentities{}, &memoryAPIKeys{keys: map[string]*models.APIKey{}},
+		ownership, NewAuditLog(l, &memoryAudit{}), 30*24*time.Hour)
+
+	export, err := s.Export(ctx, 7)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if export.Account.ID != 7 || export.Referral == nil || *export.Referral != *accounts.referrals[7] {
+		t.Errorf("Export() account = %+v, referral = %+v", export.Account, export.Referral)
+	}
+	if len(export.PasswordChanges) != 1 || !export.PasswordChanges[0].Equal(changedAt) {
+		t.Errorf("Export() password changes = %v, expected %v", export.PasswordChanges, changedAt)
+	}
+
+	// пользователь без приглашения и смен пароля
+	if export, err = s.Export(ctx, 8); err != nil || export.Referral != nil || export.PasswordChanges == nil {
+		t.Errorf("Export() without an invite = %+v, %v", export, err)
+	}
+
+	accounts.deletedAt[9] = changedAt
+	if _, err = s.Export(ctx, 9); err == nil {
+		t.Errorf("Export() of a deleted user succeeded")
+	}
+}
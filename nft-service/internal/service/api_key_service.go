@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"main/internal/models"
+	"main/internal/repository"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// apiKeyPrefix marks keys of the service, e.g. in secret scanners
+const apiKeyPrefix = "gads"
+
+// apiKeyTouchInterval limits last used updates to one per key and interval
+const apiKeyTouchInterval = time.Minute
+
+var ErrInvalidAPIKey = tvoerrors.Wrap("invalid api key", tvoerrors.ErrUnauthorized)
+
+// APIKeyParams describes a key to issue
+type APIKeyParams struct {
+	Name      string
+	UserID    int64
+	Scopes    []string
+	ExpiresAt *time.Time
+	CreatedBy int64
+}
+
+// APIKeyService issues and verifies API keys. A key looks like gads_<prefix>_<secret>,
+// the prefix finds the stored key and only an HMAC of the whole key is stored.
+type APIKeyService struct {
+	repo    repository.APIKeyRepository
+	hashKey []byte
+	now     func() time.Time
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService, secret is the application secret.
+func NewAPIKeyService(repo repository.APIKeyRepository, secret string) *APIKeyService {
+	hashKey := sha256.Sum256([]byte("api_key:" + secret))
+	return &APIKeyService{
+		repo:    repo,
+		hashKey: hashKey[:],
+		now:     time.Now,
+	}
+}
+
+// Issue creates a key and returns it in plain text, it can't be shown again.
+func (s *APIKeyService) Issue(ctx context.Context, params APIKeyParams) (string, *models.APIKey, error) {
+	const op = "service.APIKeyService.Issue"
+
+	prefix, err := randomToken(5)
+	if err != nil {
+		return "", nil, tvoerrors.Wrap(op, err)
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, tvoerrors.Wrap(op, err)
+	}
+	raw := apiKeyPrefix + "_" + prefix + "_" + secret
+
+	key := &models.APIKey{
+		Prefix:    prefix,
+		KeyHash:   s.hash(raw),
+		Name:      params.Name,
+		UserID:    params.UserID,
+		Scopes:    params.Scopes,
+		CreatedBy: params.CreatedBy,
+		ExpiresAt: params.ExpiresAt,
+	}
+	if err = s.repo.Create(ctx, key); err != nil {
+		return "", nil, tvoerrors.Wrap(op, err)
+	}
+
+	return raw, key, nil
+}
+
+// Verify checks the key and returns the token data of its user limited to the key scopes.
+func (s *APIKeyService) Verify(ctx context.Context, raw string) (*tvomodels.TokenData, error) {
+	const op = "service.APIKeyService.Verify"
+
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.ByPrefix(ctx, parts[1])
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	now := s.now()
+	if !hmac.Equal([]byte(key.KeyHash), []byte(s.hash(raw))) || !key.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	// ключ действует от имени пользователя и не должен обходить блокировку и удаление аккаунта
+	if !key.OwnerActive(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// время использования пишется не чаще раза в интервал, иначе каждый запрос бота обновлял бы строку
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err = s.repo.Touch(ctx, key.ID, now); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+	}
+
+	return &tvomodels.TokenData{
+		UserID:     key.UserID,
+		UserRoleID: tvomodels.RoleId(key.RoleID),
+		APIKeyID:   key.ID,
+		Scopes:     key.Scopes,
+	}, nil
+}
+
+// List returns keys of the user, or of all users when userId is 0.
+func (s *APIKeyService) List(ctx context.Context, userId int64) ([]models.APIKey, error) {
+	return s.repo.List(ctx, userId)
+}
+
+// Revoke disables the key immediately.
+func (s *APIKeyService) Revoke(ctx context.Context, id int64) error {
+	return s.repo.Revoke(ctx, id)
+}
+
+func (s *APIKeyService) hash(raw string) string {
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(raw))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomToken returns n random bytes as lowercase base32, it never contains the _ separator
+func randomToken(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return recoveryCodeEncoding.EncodeToString(raw), nil
+}
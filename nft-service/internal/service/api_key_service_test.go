@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// memoryAPIKeys is a repository.APIKeyRepository for one process
+type memoryAPIKeys struct {
+	keys    map[string]*models.APIKey
+	touches int
+}
+
+func (m *memoryAPIKeys) Create(_ context.Context, key *models.APIKey) error {
+	key.ID = int64(len(m.keys) + 1)
+	key.RoleID = models.RoleId(tvomodels.CREATOR)
+	m.keys[key.Prefix] = key
+	return nil
+}
+
+func (m *memoryAPIKeys) ByPrefix(_ context.Context, prefix string) (*models.APIKey, error) {
+	key, ok := m.keys[prefix]
+	if !ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (m *memoryAPIKeys) List(_ context.Context, _ int64) ([]models.APIKey, error) {
+	return nil, nil
+}
+
+func (m *memoryAPIKeys) Revoke(_ context.Context, id int64) error {
+	for _, key := range m.keys {
+		if key.ID == id {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return tvoerrors.ErrNotFound
+}
+
+func (m *memoryAPIKeys) Touch(_ context.Context, id int64, at time.Time) error {
+	for _, key := range m.keys {
+		if key.ID == id {
+			key.LastUsedAt = &at
+		}
+	}
+	m.touches++
+	return nil
+}
+
+func TestAPIKeyService(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryAPIKeys{keys: map[string]*models.APIKey{}}
+	s := NewAPIKeyService(repo, "secret")
+	now := time.Date(2025, 11, 22, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	expiresAt := now.Add(24 * time.Hour)
+	raw, key, err := s.Issue(ctx, APIKeyParams{Name: "shop bot", UserID: 7, Scopes: []string{models.PermNftRead},
+		ExpiresAt: &expiresAt, CreatedBy: 1})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !strings.HasPrefix(raw, "gads_"+key.Prefix+"_") || strings.Contains(key.KeyHash, raw) {
+		t.Fatalf("Issue() key = %q, stored %+v", raw, key)
+	}
+
+	tokenData, err := s.Verify(ctx, raw)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if tokenData.UserID != 7 || tokenData.APIKeyID != key.ID || tokenData.UserRoleID != tvomodels.CREATOR ||
+		len(tokenData.Scopes) != 1 {
+		t.Errorf("Verify() = %+v", tokenData)
+	}
+
+	// last used time is written once per interval
+	_, _ = s.Verify(ctx, raw)
+	if repo.touches != 1 {
+		t.Errorf("Touch() called %d times, expected 1", repo.touches)
+	}
+
+	for name, invalid := range map[string]string{
+		"other secret": raw[:len(raw)-1] + "a",
+		"unknown":      "gads_aaaaaaaa_" + strings.Repeat("a", 52),
+		"no prefix":    strings.TrimPrefix(raw, "gads_"),
+		"empty":        "",
+	} {
+		if invalid == raw {
+			invalid = raw[:len(raw)-1] + "b"
+		}
+		if _, err = s.Verify(ctx, invalid); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s: Verify() error = %v, expected %v", name, err, ErrInvalidAPIKey)
+		}
+	}
+
+	// ключ заблокированного или удаленного пользователя не действует
+	lockedUntil := now.Add(time.Hour)
+	repo.keys[key.Prefix].OwnerLockedUntil = &lockedUntil
+	if _, err = s.Verify(ctx, raw); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify() locked owner error = %v, expected %v", err, ErrInvalidAPIKey)
+	}
+	lockedUntil = now
+	if _, err = s.Verify(ctx, raw); err != nil {
+		t.Errorf("Verify() after lockout error = %v", err)
+	}
+	repo.keys[key.Prefix].OwnerLockedUntil = nil
+	repo.keys[key.Prefix].OwnerDeletedAt = &now
+	if _, err = s.Verify(ctx, raw); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify() deleted owner error = %v, expected %v", err, ErrInvalidAPIKey)
+	}
+	repo.keys[key.Prefix].OwnerDeletedAt = nil
+
+	now = expiresAt
+	if _, err = s.Verify(ctx, raw); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify() expired error = %v, expected %v", err, ErrInvalidAPIKey)
+	}
+
+	now = expiresAt.Add(-time.Hour)
+	if err = s.Revoke(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Verify(ctx, raw); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Verify() revoked error = %v, expected %v", err, ErrInvalidAPIKey)
+	}
+}
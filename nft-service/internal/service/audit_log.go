@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"main/internal/models"
+	"main/internal/repository"
+	"main/tools/pkg/logger"
+)
+
+// AuditLog records security-relevant and administrative actions to the append-only audit log.
+type AuditLog struct {
+	logger *logger.Logger
+	repo   repository.AuditRepository
+}
+
+// NewAuditLog creates a new instance of AuditLog.
+func NewAuditLog(logger *logger.Logger, repo repository.AuditRepository) *AuditLog {
+	return &AuditLog{
+		logger: logger,
+		repo:   repo,
+	}
+}
+
+// Record writes the entry with the state of the target before and after the action, nil states are omitted.
+// The action has already happened, so a failed write is logged with the whole entry and not returned.
+func (a *AuditLog) Record(ctx context.Context, entry *models.AuditEntry, before, after any) {
+	entry.Before = auditState(before)
+	entry.After = auditState(after)
+
+	if err := a.repo.Append(ctx, entry); err != nil {
+		a.logger.Error("Error writing audit log", "action", entry.Action, "actor_id", entry.ActorID,
+			"target_type", entry.TargetType, "target_id", entry.TargetID, "before", string(entry.Before),
+			"after", string(entry.After), "request_id", entry.RequestID, "error", err)
+	}
+}
+
+// List returns a page of entries matching the filter and their total count.
+func (a *AuditLog) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	return a.repo.List(ctx, filter)
+}
+
+// Each streams all entries matching the filter, e.g. for an export.
+func (a *AuditLog) Each(ctx context.Context, filter models.AuditFilter, fn func(entry *models.AuditEntry) error) error {
+	return a.repo.Each(ctx, filter, fn)
+}
+
+func auditState(state any) json.RawMessage {
+	if state == nil {
+		return nil
+	}
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"main/internal/models"
+	"main/tools/pkg/logger"
+)
+
+// memoryAudit is a repository.AuditRepository for one process
+type memoryAudit struct {
+	entries []models.AuditEntry
+	err     error
+}
+
+func (m *memoryAudit) Append(_ context.Context, entry *models.AuditEntry) error {
+	if m.err != nil {
+		return m.err
+	}
+	entry.ID = int64(len(m.entries) + 1)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *memoryAudit) List(_ context.Context, _ models.AuditFilter) ([]models.AuditEntry, int, error) {
+	return m.entries, len(m.entries), nil
+}
+
+func (m *memoryAudit) Each(_ context.Context, _ models.AuditFilter, fn func(entry *models.AuditEntry) error) error {
+	for i := range m.entries {
+		if err := fn(&m.entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryAudit{}
+	auditLog := NewAuditLog(&logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, repo)
+
+	auditLog.Record(ctx, &models.AuditEntry{ActorID: 1, Action: models.AuditRoleChange,
+		TargetType: models.AuditTargetUser, TargetID: "7"}, map[string]any{"role_id": 1}, map[string]any{"role_id": 2})
+	auditLog.Record(ctx, &models.AuditEntry{ActorID: 1, Action: models.AuditUserDelete,
+		TargetType: models.AuditTargetUser, TargetID: "7"}, nil, nil)
+
+	if len(repo.entries) != 2 {
+		t.Fatalf("Record() wrote %d entries, expected 2", len(repo.entries))
+	}
+	if string(repo.entries[0].Before) != `{"role_id":1}` || string(repo.entries[0].After) != `{"role_id":2}` {
+		t.Errorf("Record() before = %s, after = %s", repo.entries[0].Before, repo.entries[0].After)
+	}
+	if repo.entries[1].Before != nil || repo.entries[1].After != nil {
+		t.Errorf("Record() without states wrote before = %s, after = %s", repo.entries[1].Before, repo.entries[1].After)
+	}
+
+	// the audited action already happened, a failed write must not panic or block it
+	repo.err = errors.New("connection refused")
+	auditLog.Record(ctx, &models.AuditEntry{Action: models.AuditPinAdd}, nil, "cid")
+	if len(repo.entries) != 2 {
+		t.Errorf("Record() with failing repository wrote %d entries", len(repo.entries))
+	}
+}
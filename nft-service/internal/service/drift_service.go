@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"main/internal/lib/gads"
+	"main/internal/lib/tron"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/tools/pkg/helpers"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// metadataLimit limits the size of fetched token metadata
+const metadataLimit = 1 << 20
+
+var ErrDriftRunning = tvoerrors.Wrap("drift check is already running", tvoerrors.ErrConflict)
+
+// tokenMetadata contains the fields of TRC-721 metadata compared with nft_data.
+// cid_v0/cid_v1/ipfs_image_link are present when tokenURI points to ReadNft.
+type tokenMetadata struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Image         string `json:"image"`
+	CidV0         string `json:"cid_v0"`
+	CidV1         string `json:"cid_v1"`
+	IpfsImageLink string `json:"ipfs_image_link"`
+}
+
+// DriftDetector compares what the contract serves via tokenURI with the catalogue in Postgres.
+type DriftDetector struct {
+	logger     *logger.Logger
+	contract   *gads.Caller
+	nftData    repository.NftDataRepository
+	ownership  repository.OwnershipRepository
+	drift      repository.DriftRepository
+	gatewayURL string
+	httpClient *http.Client
+	running    atomic.Bool
+}
+
+// NewDriftDetector creates a new instance of DriftDetector.
+func NewDriftDetector(logger *logger.Logger, contract *gads.Caller, nftDataRepository repository.NftDataRepository,
+	ownershipRepository repository.OwnershipRepository, driftRepository repository.DriftRepository,
+	gatewayURL string) *DriftDetector {
+	return &DriftDetector{
+		logger:     logger,
+		contract:   contract,
+		nftData:    nftDataRepository,
+		ownership:  ownershipRepository,
+		drift:      driftRepository,
+		gatewayURL: strings.TrimRight(gatewayURL, "/"),
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Start runs the check every interval until the context is cancelled.
+func (d *DriftDetector) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.Run(ctx); err != nil && !errors.Is(err, ErrDriftRunning) {
+				d.logger.Error("metadata drift check failed", "error", err)
+			}
+		}
+	}
+}
+
+// Run checks every token known to the indexer or to the catalogue and stores the report.
+func (d *DriftDetector) Run(ctx context.Context) (*models.DriftRun, error) {
+	if !d.running.CompareAndSwap(false, true) {
+		return nil, ErrDriftRunning
+	}
+	defer d.running.Store(false)
+
+	return d.run(ctx)
+}
+
+// RunInBackground starts the check unless one is already running, errors of the check are logged.
+func (d *DriftDetector) RunInBackground() error {
+	if !d.running.CompareAndSwap(false, true) {
+		return ErrDriftRunning
+	}
+
+	go func() {
+		defer d.running.Store(false)
+		if _, err := d.run(context.Background()); err != nil {
+			d.logger.Error("metadata drift check failed", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (d *DriftDetector) run(ctx context.Context) (*models.DriftRun, error) {
+	const op = "service.DriftDetector.Run"
+
+	run, err := d.drift.CreateRun(ctx)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if err = d.check(ctx, run); err != nil {
+		run.Error = err.Error()
+	}
+
+	if finishErr := d.drift.FinishRun(ctx, run); finishErr != nil {
+		return nil, tvoerrors.Wrap(op, finishErr)
+	}
+
+	d.logger.Info("metadata drift check finished", "run_id", run.ID, "tokens", run.TokensChecked,
+		"issues", run.Issues, "error", run.Error)
+
+	return run, err
+}
+
+func (d *DriftDetector) check(ctx context.Context, run *models.DriftRun) error {
+	indexedIds, err := d.ownership.TokenIds(ctx)
+	if err != nil {
+		return err
+	}
+	serviceIds, err := d.nftData.TokenIds(ctx)
+	if err != nil {
+		return err
+	}
+
+	indexed := make(map[int64]bool, len(indexedIds))
+	for _, id := range indexedIds {
+		indexed[id] = true
+	}
+	inService := make(map[int64]bool, len(serviceIds))
+	for _, id := range serviceIds {
+		inService[id] = true
+	}
+
+	tokenIds := helpers.UniqueIds(append(indexedIds, serviceIds...))
+	slices.Sort(tokenIds)
+	for _, tokenId := range tokenIds {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		for _, issue := range d.checkToken(ctx, tokenId, indexed[tokenId], inService[tokenId]) {
+			issue.RunID = run.ID
+			if err = d.drift.AddIssue(ctx, &issue); err != nil {
+				return err
+			}
+			run.Issues++
+		}
+		run.TokensChecked++
+	}
+
+	return nil
+}
+
+func (d *DriftDetector) checkToken(ctx context.Context, tokenId int64, indexed, inService bool) []models.DriftIssue {
+	issues := make([]models.DriftIssue, 0)
+	add := func(kind models.DriftKind, uri, details string) {
+		issues = append(issues, models.DriftIssue{TokenId: tokenId, Kind: kind, OnChainURI: uri, Details: details})
+	}
+
+	uri, err := d.contract.TokenURI(ctx, tokenId)
+	if err != nil {
+		switch {
+		case errors.Is(err, tron.ErrReverted) && !indexed:
+			add(models.DriftOnlyInService, "", "token is not minted or burned")
+		case errors.Is(err, tron.ErrReverted):
+			add(models.DriftChainReadError, "", "indexed token does not exist on chain: "+err.Error())
+		default:
+			add(models.DriftChainReadError, "", err.Error())
+		}
+		return issues
+	}
+
+	if !inService {
+		add(models.DriftOnlyOnChain, uri, "token has no nft_data row")
+	}
+
+	if uri == "" {
+		add(models.DriftMissingURI, "", "setTokenURI was never called and base URI is empty")
+		return issues
+	}
+
+	metadata, err := d.fetchMetadata(ctx, uri)
+	if err != nil {
+		add(models.DriftUnreachable, uri, err.Error())
+		return issues
+	}
+
+	if !inService {
+		return issues
+	}
+
+	nft, err := d.nftData.ReadNftData(ctx, tokenId)
+	if err != nil {
+		d.logger.Error("can't read nft data", "token_id", tokenId, "error", err)
+		return issues
+	}
+
+	description := nft.Description
+	if description == "" {
+		description = models.DefaultNftDescription
+	}
+	if metadata.Description != description {
+		add(models.DriftDescription, uri, fmt.Sprintf("on chain %q, service %q", metadata.Description, description))
+	}
+
+	candidates := make([]string, 0, 4)
+	for _, link := range []string{metadata.Image, metadata.IpfsImageLink, metadata.CidV1, metadata.CidV0} {
+		if c := extractCID(link); c != "" {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return issues
+	}
+	for _, c := range candidates {
+		if sameCID(c, nft.CidV0) || sameCID(c, nft.CidV1) {
+			return issues
+		}
+	}
+	add(models.DriftStaleCID, uri, fmt.Sprintf("metadata references %s, service has %s", candidates[0], nft.CidV1))
+
+	return issues
+}
+
+// fetchMetadata downloads and parses the metadata referenced by tokenURI.
+func (d *DriftDetector) fetchMetadata(ctx context.Context, uri string) (*tokenMetadata, error) {
+	link, err := d.resolveURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request %s: %s", link, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, metadataLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata tokenMetadata
+	if err = json.NewDecoder(bytes.NewReader(body)).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata json: %w", err)
+	}
+
+	return &metadata, nil
+}
+
+// resolveURI turns ipfs:// links and bare CIDs into gateway links.
+func (d *DriftDetector) resolveURI(uri string) (string, error) {
+	switch {
+	case strings.HasPrefix(uri, "ipfs://"):
+		return d.gatewayURL + "/ipfs/" + strings.TrimPrefix(strings.TrimPrefix(uri, "ipfs://"), "ipfs/"), nil
+	case strings.HasPrefix(uri, "http://"), strings.HasPrefix(uri, "https://"):
+		return uri, nil
+	case extractCID(uri) != "":
+		return d.gatewayURL + "/ipfs/" + uri, nil
+	default:
+		return "", fmt.Errorf("unsupported token uri scheme: %s", uri)
+	}
+}
+
+// extractCID finds a CID in ipfs://, /ipfs/<cid> and <cid>.ipfs.<gateway> links or returns an empty string.
+func extractCID(link string) string {
+	candidate := ""
+	switch {
+	case strings.HasPrefix(link, "ipfs://"):
+		candidate = strings.TrimPrefix(strings.TrimPrefix(link, "ipfs://"), "ipfs/")
+	case strings.Contains(link, "/ipfs/"):
+		candidate = link[strings.Index(link, "/ipfs/")+len("/ipfs/"):]
+	case strings.Contains(link, ".ipfs."):
+		candidate = strings.TrimPrefix(strings.TrimPrefix(link, "https://"), "http://")
+		candidate = candidate[:strings.Index(candidate, ".ipfs.")]
+	default:
+		candidate = link
+	}
+
+	if i := strings.IndexAny(candidate, "/?#"); i >= 0 {
+		candidate = candidate[:i]
+	}
+
+	if _, err := cid.Decode(candidate); err != nil {
+		return ""
+	}
+	return candidate
+}
+
+// sameCID compares CIDs by multihash, so CIDv0 and CIDv1 of the same content are equal.
+func sameCID(a, b string) bool {
+	first, err := cid.Decode(a)
+	if err != nil {
+		return false
+	}
+	second, err := cid.Decode(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(first.Hash(), second.Hash())
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+const driftCidV0 = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+func driftCidV1(t *testing.T) string {
+	t.Helper()
+	v0, err := cid.Decode(driftCidV0)
+	if err != nil {
+		t.Fatalf("cid.Decode() error = %v", err)
+	}
+	return cid.NewCidV1(cid.DagProtobuf, v0.Hash()).String()
+}
+
+func TestExtractCID(t *testing.T) {
+	v1 := driftCidV1(t)
+
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{driftCidV0, driftCidV0},
+		{"ipfs://" + driftCidV0, driftCidV0},
+		{"ipfs://ipfs/" + driftCidV0 + "/metadata.json", driftCidV0},
+		{"https://gateway.example/ipfs/" + v1 + "?filename=a.png", v1},
+		{"https://" + v1 + ".ipfs.dweb.link/image.png", v1},
+		{"http://127.0.0.1:8080/ipfs/" + driftCidV0 + "#top", driftCidV0},
+		{"https://example.com/nft/7", ""},
+		{"ipfs://not-a-cid", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := extractCID(tt.link); got != tt.expected {
+			t.Errorf("extractCID(%q) = %q, expected %q", tt.link, got, tt.expected)
+		}
+	}
+}
+
+func TestSameCID(t *testing.T) {
+	v1 := driftCidV1(t)
+	other := "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{driftCidV0, driftCidV0, true},
+		{driftCidV0, v1, true},
+		{v1, driftCidV0, true},
+		{driftCidV0, other, false},
+		{driftCidV0, "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := sameCID(tt.a, tt.b); got != tt.expected {
+			t.Errorf("sameCID(%q, %q) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestResolveURI(t *testing.T) {
+	d := NewDriftDetector(nil, nil, nil, nil, nil, "http://gateway.local/")
+
+	tests := []struct {
+		uri      string
+		expected string
+		err      bool
+	}{
+		{"ipfs://" + driftCidV0, "http://gateway.local/ipfs/" + driftCidV0, false},
+		{"ipfs://ipfs/" + driftCidV0 + "/1.json", "http://gateway.local/ipfs/" + driftCidV0 + "/1.json", false},
+		{"https://example.com/nft/7", "https://example.com/nft/7", false},
+		{driftCidV0, "http://gateway.local/ipfs/" + driftCidV0, false},
+		{"ftp://example.com/7.json", "", true},
+	}
+	for _, tt := range tests {
+		got, err := d.resolveURI(tt.uri)
+		if (err != nil) != tt.err || got != tt.expected {
+			t.Errorf("resolveURI(%q) = %q, %v, expected %q", tt.uri, got, err, tt.expected)
+		}
+	}
+}
+
+func TestDriftRunInBackgroundConflict(t *testing.T) {
+	d := NewDriftDetector(nil, nil, nil, nil, nil, "")
+	d.running.Store(true)
+
+	if err := d.RunInBackground(); !errors.Is(err, ErrDriftRunning) || !errors.Is(err, tvoerrors.ErrConflict) {
+		t.Errorf("RunInBackground() = %v, expected a conflict", err)
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"main/internal/lib/gads"
+	"main/internal/lib/tron"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/tools/pkg/cache"
+	httpmiddlewares "main/tools/pkg/http_middlewares"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+const (
+	indexerCursorName = "gads_events"
+	indexerPageLimit  = 200
+	unpinBatchLimit   = 50
+)
+
+// EventSource returns decoded contract events, implemented by tron.Client
+type EventSource interface {
+	ContractEvents(ctx context.Context, contract tron.Address, minTimestamp int64, fingerprint string, limit int) (*tron.EventPage, error)
+}
+
+// Indexer applies Transfer and TokenBurned events of the collection to the ownership tables and the catalogue.
+type Indexer struct {
+	logger     *logger.Logger
+	events     EventSource
+	contract   tron.Address
+	ownership  repository.OwnershipRepository
+	burns      repository.BurnRepository
+	cursors    repository.IndexerRepository
+	unlockable *UnlockableService
+	cache      cache.CacheClient
+	unpinAfter time.Duration
+}
+
+// NewIndexer creates a new instance of Indexer. unlockable may be nil, cacheClient holds the ownership checks
+// of the holder middleware, unpinAfter <= 0 keeps the media of burned tokens pinned.
+func NewIndexer(logger *logger.Logger, events EventSource, contract tron.Address,
+	ownershipRepository repository.OwnershipRepository, burnRepository repository.BurnRepository,
+	indexerRepository repository.IndexerRepository, unlockable *UnlockableService, cacheClient cache.CacheClient,
+	unpinAfter time.Duration) *Indexer {
+	return &Indexer{
+		logger:     logger,
+		events:     events,
+		contract:   contract,
+		ownership:  ownershipRepository,
+		burns:      burnRepository,
+		cursors:    indexerRepository,
+		unlockable: unlockable,
+		cache:      cacheClient,
+		unpinAfter: unpinAfter,
+	}
+}
+
+// Start polls the contract events every interval until the context is cancelled.
+func (i *Indexer) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.Sync(ctx); err != nil {
+				i.logger.Error("contract events sync failed", "error", err)
+			}
+			if i.unpinAfter > 0 {
+				if err := i.UnpinBurned(ctx); err != nil {
+					i.logger.Error("unpin of burned tokens failed", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// Sync applies all confirmed events since the stored cursor. The cursor is inclusive,
+// so events of the last processed block are applied again, which is harmless.
+func (i *Indexer) Sync(ctx context.Context) error {
+	const op = "service.Indexer.Sync"
+
+	cursor, err := i.cursors.Cursor(ctx, indexerCursorName)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	last := cursor
+	defer func() {
+		if last == cursor {
+			return
+		}
+		if saveErr := i.cursors.SaveCursor(ctx, indexerCursorName, last); saveErr != nil {
+			i.logger.Error("can't save indexer cursor", "error", saveErr)
+		}
+	}()
+
+	fingerprint := ""
+	for {
+		page, err := i.events.ContractEvents(ctx, i.contract, cursor, fingerprint, indexerPageLimit)
+		if err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+
+		for _, event := range page.Events {
+			if err = i.apply(ctx, &event); err != nil {
+				return tvoerrors.Wrap(op, err)
+			}
+			last = max(last, event.BlockTimestamp)
+		}
+
+		if page.Fingerprint == "" || len(page.Events) == 0 {
+			return nil
+		}
+		fingerprint = page.Fingerprint
+	}
+}
+
+func (i *Indexer) apply(ctx context.Context, event *tron.Event) error {
+	switch event.EventName {
+	case gads.NameTransfer:
+		transfer, err := gads.DecodeTransfer(event)
+		if err != nil {
+			return err
+		}
+		if transfer.To.IsZero() {
+			return i.markBurned(ctx, event, transfer.TokenId, transfer.From)
+		}
+
+		err = i.ownership.UpsertOwner(ctx, &models.NftOwner{
+			TokenId:      transfer.TokenId,
+			OwnerAddress: transfer.To.Base58(),
+			BlockNumber:  event.BlockNumber,
+			TxId:         event.TxID,
+		})
+		if err != nil {
+			return err
+		}
+		i.forgetOwnership(ctx, transfer.TokenId, transfer.From, transfer.To)
+
+		if i.unlockable != nil && !transfer.From.IsZero() {
+			if err = i.unlockable.Rekey(ctx, transfer.TokenId); err != nil {
+				i.logger.Error("can't rekey unlockable content", "token_id", transfer.TokenId, "error", err)
+			}
+		}
+	case gads.NameTokenBurned:
+		burned, err := gads.DecodeTokenBurned(event)
+		if err != nil {
+			return err
+		}
+		return i.markBurned(ctx, event, burned.TokenId, burned.Owner)
+	}
+
+	return nil
+}
+
+func (i *Indexer) markBurned(ctx context.Context, event *tron.Event, tokenId int64, owner tron.Address) error {
+	err := i.burns.MarkBurned(ctx, &models.NftBurn{
+		TokenId:      tokenId,
+		OwnerAddress: owner.Base58(),
+		TxId:         event.TxID,
+		BlockNumber:  event.BlockNumber,
+		BurnedAt:     time.UnixMilli(event.BlockTimestamp).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	i.forgetOwnership(ctx, tokenId, owner)
+
+	i.logger.Info("token burned", "token_id", tokenId, "tx_id", event.TxID)
+	return nil
+}
+
+// forgetOwnership drops the cached ownership checks of the users the wallets are linked to,
+// so the new holder gets access and the previous one loses it without waiting for the cache to expire.
+func (i *Indexer) forgetOwnership(ctx context.Context, tokenId int64, wallets ...tron.Address) {
+	if i.cache == nil {
+		return
+	}
+
+	for _, wallet := range wallets {
+		if wallet.IsZero() {
+			continue
+		}
+		userId, err := i.ownership.UserByWallet(ctx, wallet.Base58())
+		if err != nil {
+			if !errors.Is(err, tvoerrors.ErrNotFound) {
+				i.logger.Error("can't get wallet user", "address", wallet.Base58(), "error", err)
+			}
+			continue
+		}
+
+		_, err = i.cache.Del(ctx, httpmiddlewares.OwnershipCacheKey(userId, tokenId),
+			httpmiddlewares.OwnershipCacheKey(userId, httpmiddlewares.AnyToken))
+		if err != nil {
+			i.logger.Error("can't drop cached ownership", "user_id", userId, "token_id", tokenId, "error", err)
+		}
+	}
+}
+
+// UnpinBurned unpins the media of tokens burned more than unpinAfter ago.
+// Failed unpins are recorded and retried on the next run.
+func (i *Indexer) UnpinBurned(ctx context.Context) error {
+	const op = "service.Indexer.UnpinBurned"
+
+	burns, err := i.burns.PendingUnpin(ctx, time.Now().UTC().Add(-i.unpinAfter), unpinBatchLimit)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	for _, burn := range burns {
+		unpinErr := ""
+		if burn.CidV0 != "" {
+			if _, err = UnpinCID(burn.CidV0); err != nil {
+				unpinErr = err.Error()
+				i.logger.Warn("can't unpin burned token media", "token_id", burn.TokenId, "cid", burn.CidV0, "error", err)
+			}
+		}
+
+		if err = i.burns.MarkUnpinned(ctx, burn.TokenId, unpinErr); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"main/internal/lib/gads"
+	"main/internal/lib/tron"
+	"main/internal/models"
+	"main/tools/pkg/cache"
+	httpmiddlewares "main/tools/pkg/http_middlewares"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+const (
+	aliceWallet = "0x1111111111111111111111111111111111111111"
+	bobWallet   = "0x2222222222222222222222222222222222222222"
+	zeroWallet  = "0x0000000000000000000000000000000000000000"
+)
+
+func walletBase58(t *testing.T, wallet string) string {
+	t.Helper()
+	address, err := tron.ParseAddress(wallet)
+	if err != nil {
+		t.Fatalf("ParseAddress(%q) error = %v", wallet, err)
+	}
+	return address.Base58()
+}
+
+// staticEvents returns all events on a single page
+type staticEvents struct {
+	events []tron.Event
+}
+
+func (s *staticEvents) ContractEvents(_ context.Context, _ tron.Address, minTimestamp int64, _ string, _ int) (*tron.EventPage, error) {
+	page := &tron.EventPage{}
+	for _, event := range s.events {
+		if event.BlockTimestamp >= minTimestamp {
+			page.Events = append(page.Events, event)
+		}
+	}
+	return page, nil
+}
+
+func transferEvent(block int64, from, to string, tokenId int64) tron.Event {
+	return tron.Event{
+		TxID:           "tx" + strconv.FormatInt(block, 10),
+		BlockNumber:    block,
+		BlockTimestamp: block * 1000,
+		EventName:      gads.NameTransfer,
+		Result:         map[string]string{"from": from, "to": to, "tokenId": strconv.FormatInt(tokenId, 10)},
+	}
+}
+
+// memoryOwnership keeps indexed owners and linked wallets, UpsertOwner keeps the newer block like the repository.
+// A burned token keeps an owner with an empty address as a tombstone.
+type memoryOwnership struct {
+	owners  map[int64]models.NftOwner
+	wallets map[string]int64
+}
+
+func (m *memoryOwnership) OwnerOf(_ context.Context, tokenId int64) (*models.NftOwner, error) {
+	owner, ok := m.owners[tokenId]
+	if !ok || owner.OwnerAddress == "" {
+		return nil, tvoerrors.ErrNotFound
+	}
+	return &owner, nil
+}
+
+func (m *memoryOwnership) UpsertOwner(_ context.Context, owner *models.NftOwner) error {
+	if current, ok := m.owners[owner.TokenId]; ok && current.BlockNumber > owner.BlockNumber {
+		return nil
+	}
+	m.owners[owner.TokenId] = *owner
+	return nil
+}
+
+func (m *memoryOwnership) TokenIds(context.Context) ([]int64, error) {
+	ids := make([]int64, 0, len(m.owners))
+	for id, owner := range m.owners {
+		if owner.OwnerAddress != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *memoryOwnership) UserOwnsToken(_ context.Context, userId, tokenId int64) (bool, error) {
+	owner, ok := m.owners[tokenId]
+	return ok && m.wallets[owner.OwnerAddress] == userId, nil
+}
+
+func (m *memoryOwnership) UserOwnsAny(_ context.Context, userId int64) (bool, error) {
+	for _, owner := range m.owners {
+		if m.wallets[owner.OwnerAddress] == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryOwnership) LinkWallet(_ context.Context, userId int64, address string) error {
+	m.wallets[address] = userId
+	return nil
+}
+
+func (m *memoryOwnership) UserByWallet(_ context.Context, address string) (int64, error) {
+	userId, ok := m.wallets[address]
+	if !ok {
+		return 0, tvoerrors.ErrNotFound
+	}
+	return userId, nil
+}
+
+func (m *memoryOwnership) WalletsByUser(context.Context, int64) ([]models.UserWallet, error) {
+	return nil, nil
+}
+
+func (m *memoryOwnership) TokensByUser(context.Context, int64) ([]models.NftOwner, error) {
+	return nil, nil
+}
+
+// memoryBurns records burns, MarkBurned leaves a tombstone of the indexed owner like the repository
+type memoryBurns struct {
+	ownership *memoryOwnership
+	burns     map[int64]models.NftBurn
+}
+
+func (m *memoryBurns) MarkBurned(_ context.Context, burn *models.NftBurn) error {
+	if _, ok := m.burns[burn.TokenId]; !ok {
+		m.burns[burn.TokenId] = *burn
+	}
+	return m.ownership.UpsertOwner(context.Background(), &models.NftOwner{
+		TokenId:     burn.TokenId,
+		BlockNumber: burn.BlockNumber,
+		TxId:        burn.TxId,
+	})
+}
+
+func (m *memoryBurns) PendingUnpin(context.Context, time.Time, int) ([]models.NftBurn, error) {
+	return nil, nil
+}
+
+func (m *memoryBurns) MarkUnpinned(context.Context, int64, string) error {
+	return nil
+}
+
+type memoryCursors map[string]int64
+
+func (m memoryCursors) Cursor(_ context.Context, name string) (int64, error) {
+	return m[name], nil
+}
+
+func (m memoryCursors) SaveCursor(_ context.Context, name string, blockTimestamp int64) error {
+	m[name] = blockTimestamp
+	return nil
+}
+
+func newTestIndexer(events []tron.Event, cacheClient cache.CacheClient) (*Indexer, *memoryOwnership, *memoryBurns, memoryCursors) {
+	ownership := &memoryOwnership{owners: map[int64]models.NftOwner{}, wallets: map[string]int64{}}
+	burns := &memoryBurns{ownership: ownership, burns: map[int64]models.NftBurn{}}
+	cursors := memoryCursors{}
+	l := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	indexer := NewIndexer(l, &staticEvents{events: events}, tron.Address{}, ownership, burns, cursors, nil, cacheClient, 0)
+	return indexer, ownership, burns, cursors
+}
+
+func burnedEvent(block int64, owner string, tokenId int64) tron.Event {
+	return tron.Event{
+		TxID:           "tx" + strconv.FormatInt(block, 10),
+		BlockNumber:    block,
+		BlockTimestamp: block * 1000,
+		EventName:      gads.NameTokenBurned,
+		Result:         map[string]string{"owner": owner, "tokenId": strconv.FormatInt(tokenId, 10)},
+	}
+}
+
+func TestIndexerSync(t *testing.T) {
+	ctx := context.Background()
+	indexer, ownership, _, cursors := newTestIndexer([]tron.Event{
+		transferEvent(10, zeroWallet, aliceWallet, 7),
+		transferEvent(10, zeroWallet, aliceWallet, 8),
+		transferEvent(12, aliceWallet, bobWallet, 7),
+		// событие из более старого блока, пришедшее позже, не перезаписывает владельца
+		transferEvent(11, bobWallet, aliceWallet, 7),
+	}, nil)
+
+	if err := indexer.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if cursors[indexerCursorName] != 12000 {
+		t.Errorf("cursor = %d, expected 12000", cursors[indexerCursorName])
+	}
+
+	// курсор включительный, повторное применение событий последнего блока ничего не меняет
+	if err := indexer.Sync(ctx); err != nil {
+		t.Fatalf("second Sync() error = %v", err)
+	}
+
+	expected := map[int64]string{7: walletBase58(t, bobWallet), 8: walletBase58(t, aliceWallet)}
+	for tokenId, address := range expected {
+		owner, err := ownership.OwnerOf(ctx, tokenId)
+		if err != nil || owner.OwnerAddress != address {
+			t.Errorf("OwnerOf(%d) = %+v, %v, expected %s", tokenId, owner, err, address)
+		}
+	}
+}
+
+func TestIndexerBurn(t *testing.T) {
+	ctx := context.Background()
+	indexer, ownership, burns, _ := newTestIndexer([]tron.Event{
+		transferEvent(10, zeroWallet, aliceWallet, 7),
+		transferEvent(10, zeroWallet, aliceWallet, 8),
+		transferEvent(12, aliceWallet, zeroWallet, 7),
+		burnedEvent(13, aliceWallet, 8),
+		// перевод из блока до сжигания, пришедший позже, не возвращает владельца
+		transferEvent(11, aliceWallet, bobWallet, 7),
+	}, nil)
+
+	if err := indexer.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, tokenId := range []int64{7, 8} {
+		if owner, err := ownership.OwnerOf(ctx, tokenId); !errors.Is(err, tvoerrors.ErrNotFound) {
+			t.Errorf("OwnerOf(%d) = %+v, %v, expected a burned token", tokenId, owner, err)
+		}
+		burn, ok := burns.burns[tokenId]
+		if !ok || burn.OwnerAddress != walletBase58(t, aliceWallet) {
+			t.Errorf("burn of %d = %+v, expected the burn by alice", tokenId, burn)
+		}
+	}
+	if ids, _ := ownership.TokenIds(ctx); len(ids) != 0 {
+		t.Errorf("TokenIds() = %v, expected burned tokens to be skipped", ids)
+	}
+
+	// повторная чеканка после сжигания снова индексируется
+	indexer.events = &staticEvents{events: []tron.Event{transferEvent(14, zeroWallet, bobWallet, 7)}}
+	if err := indexer.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if owner, err := ownership.OwnerOf(ctx, 7); err != nil || owner.OwnerAddress != walletBase58(t, bobWallet) {
+		t.Errorf("OwnerOf(7) = %+v, %v, expected bob after mint", owner, err)
+	}
+}
+
+func TestIndexerForgetsCachedOwnership(t *testing.T) {
+	ctx := context.Background()
+	ownershipCache := memoryCache{}
+	indexer, ownership, _, _ := newTestIndexer([]tron.Event{
+		transferEvent(10, aliceWallet, bobWallet, 7),
+	}, ownershipCache)
+	ownership.wallets[walletBase58(t, aliceWallet)] = 1
+	ownership.wallets[walletBase58(t, bobWallet)] = 2
+
+	// результаты проверок до перевода: alice держит токен, bob нет
+	cached := []struct {
+		key  string
+		kept bool
+	}{
+		{httpmiddlewares.OwnershipCacheKey(1, 7), false},
+		{httpmiddlewares.OwnershipCacheKey(1, httpmiddlewares.AnyToken), false},
+		{httpmiddlewares.OwnershipCacheKey(2, 7), false},
+		{httpmiddlewares.OwnershipCacheKey(2, httpmiddlewares.AnyToken), false},
+		{httpmiddlewares.OwnershipCacheKey(1, 8), true},
+		{httpmiddlewares.OwnershipCacheKey(3, httpmiddlewares.AnyToken), true},
+	}
+	for _, entry := range cached {
+		_ = ownershipCache.Set(ctx, entry.key, "1", time.Minute)
+	}
+
+	if err := indexer.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, entry := range cached {
+		if _, err := ownershipCache.Get(ctx, entry.key); (err == nil) != entry.kept {
+			t.Errorf("cache key %q kept = %v, expected %v", entry.key, err == nil, entry.kept)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"main/internal/models"
+	"main/internal/repository"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var (
+	ErrInvalidInvite = tvoerrors.Wrap("invite code is invalid, expired or used up", tvoerrors.ErrInvalidRequestData)
+	ErrInviteCode    = tvoerrors.Wrap("invite code must be 4 to 32 letters, digits or dashes", tvoerrors.ErrInvalidRequestData)
+	ErrInviteRole    = tvoerrors.Wrap("invites can't grant a role managing accounts or having more permissions than the issuer",
+		tvoerrors.ErrInvalidRequestData)
+)
+
+// inviteCodePattern limits custom codes to what can be typed and shared in a link, codes are case insensitive
+var inviteCodePattern = regexp.MustCompile(`^[a-z0-9-]{4,32}$`)
+
+// InviteParams describes an invite to issue
+type InviteParams struct {
+	Code       string // custom code, e.g. of a campaign; generated when empty
+	RoleID     models.RoleId
+	MaxUses    int
+	ExpiresAt  *time.Time
+	ReferrerID int64
+	CreatedBy  int64
+	IssuerRole tvomodels.RoleId // role of CreatedBy, the invite role can't grant more
+}
+
+// InviteService issues registration invite codes and checks them before registration.
+// Codes are redeemed by UserRepository together with creating the user.
+type InviteService struct {
+	repo        repository.InviteRepository
+	permissions *PermissionService
+	now         func() time.Time
+}
+
+// NewInviteService creates a new instance of InviteService.
+func NewInviteService(repo repository.InviteRepository, permissions *PermissionService) *InviteService {
+	return &InviteService{
+		repo:        repo,
+		permissions: permissions,
+		now:         time.Now,
+	}
+}
+
+// NormalizeInviteCode returns the code as stored, users may type it in any case.
+func NormalizeInviteCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// Issue creates an invite, a taken custom code is a conflict.
+func (s *InviteService) Issue(ctx context.Context, params InviteParams) (*models.Invite, error) {
+	const op = "service.InviteService.Issue"
+
+	code := NormalizeInviteCode(params.Code)
+	if code == "" {
+		var err error
+		if code, err = randomToken(5); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+	}
+	if !inviteCodePattern.MatchString(code) {
+		return nil, ErrInviteCode
+	}
+
+	// код может утечь, поэтому роли с правами на пользователей и роли выдаются только сменой роли
+	if params.RoleID != 0 {
+		allowed, err := s.permissions.CanGrant(ctx, params.IssuerRole, tvomodels.RoleId(params.RoleID))
+		if err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+		if !allowed {
+			return nil, ErrInviteRole
+		}
+	}
+	if params.MaxUses < 1 || (params.ExpiresAt != nil && !params.ExpiresAt.After(s.now())) {
+		return nil, tvoerrors.ErrInvalidRequestData
+	}
+
+	invite := &models.Invite{
+		Code:       code,
+		RoleID:     params.RoleID,
+		MaxUses:    params.MaxUses,
+		ReferrerID: params.ReferrerID,
+		CreatedBy:  params.CreatedBy,
+		ExpiresAt:  params.ExpiresAt,
+	}
+	if err := s.repo.Create(ctx, invite); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return invite, nil
+}
+
+// Check returns the invite if a user can register with the code now. The code is spent only
+// when the user is created, so it can still run out in between.
+func (s *InviteService) Check(ctx context.Context, code string) (*models.Invite, error) {
+	const op = "service.InviteService.Check"
+
+	invite, err := s.repo.ByCode(ctx, NormalizeInviteCode(code))
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, ErrInvalidInvite
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if !invite.Usable(s.now()) {
+		return nil, ErrInvalidInvite
+	}
+
+	return invite, nil
+}
+
+// List returns all invites, newest first.
+func (s *InviteService) List(ctx context.Context) ([]models.Invite, error) {
+	return s.repo.List(ctx)
+}
+
+// Revoke disables the invite immediately, users registered with it keep their role and referrer.
+func (s *InviteService) Revoke(ctx context.Context, id int64) error {
+	return s.repo.Revoke(ctx, id)
+}
+
+// Referrals counts users credited to each referrer registered in [from, to).
+func (s *InviteService) Referrals(ctx context.Context, from, to *time.Time) ([]models.ReferralStat, error) {
+	return s.repo.Referrals(ctx, from, to)
+}
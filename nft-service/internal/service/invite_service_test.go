@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// memoryInvites is a repository.InviteRepository for one process
+type memoryInvites struct {
+	invites map[string]*models.Invite
+}
+
+func (m *memoryInvites) Create(_ context.Context, invite *models.Invite) error {
+	if _, ok := m.invites[invite.Code]; ok {
+		return tvoerrors.ErrConflict
+	}
+	invite.ID = int64(len(m.invites) + 1)
+	m.invites[invite.Code] = invite
+	return nil
+}
+
+func (m *memoryInvites) ByCode(_ context.Context, code string) (*models.Invite, error) {
+	invite, ok := m.invites[code]
+	if !ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	copied := *invite
+	return &copied, nil
+}
+
+func (m *memoryInvites) List(_ context.Context) ([]models.Invite, error) {
+	return nil, nil
+}
+
+func (m *memoryInvites) Revoke(_ context.Context, id int64) error {
+	for _, invite := range m.invites {
+		if invite.ID == id {
+			now := time.Now()
+			invite.RevokedAt = &now
+			return nil
+		}
+	}
+	return tvoerrors.ErrNotFound
+}
+
+func (m *memoryInvites) Referrals(_ context.Context, _, _ *time.Time) ([]models.ReferralStat, error) {
+	return nil, nil
+}
+
+func TestInviteService(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryInvites{invites: map[string]*models.Invite{}}
+	const sponsor = tvomodels.RoleId(3)
+	permissions := NewPermissionService(&fakePermissionSource{byRole: map[models.RoleId][]string{
+		models.RoleId(tvomodels.CREATOR):   {models.PermNftCreate, models.PermNftManageOwn},
+		models.RoleId(sponsor):             {models.PermNftCreate, models.PermInvitesManage},
+		models.RoleId(tvomodels.MODERATOR): {models.PermUsersList, models.PermNftCreate},
+		models.RoleId(tvomodels.ADMIN): {models.PermUsersList, models.PermRolesChange, models.PermInvitesManage,
+			models.PermNftCreate, models.PermNftManageOwn},
+	}}, time.Hour)
+	s := NewInviteService(repo, permissions)
+	now := time.Date(2025, 11, 27, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	expiresAt := now.Add(7 * 24 * time.Hour)
+	invite, err := s.Issue(ctx, InviteParams{Code: " Spring-Sale ", RoleID: models.RoleId(tvomodels.CREATOR), MaxUses: 2,
+		ExpiresAt: &expiresAt, ReferrerID: 5, CreatedBy: 1, IssuerRole: tvomodels.ADMIN})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if invite.Code != "spring-sale" {
+		t.Errorf("Issue() code = %q, expected it lowercased", invite.Code)
+	}
+
+	if checked, err := s.Check(ctx, "SPRING-SALE"); err != nil || checked.ID != invite.ID || checked.ReferrerID != 5 {
+		t.Errorf("Check() = %+v, %v", checked, err)
+	}
+
+	generated, err := s.Issue(ctx, InviteParams{MaxUses: 1, CreatedBy: 1})
+	if err != nil || !inviteCodePattern.MatchString(generated.Code) {
+		t.Errorf("Issue() generated code = %+v, %v", generated, err)
+	}
+
+	// роль без прав сверх прав выдающего разрешена и не администратору
+	if _, err = s.Issue(ctx, InviteParams{RoleID: models.RoleId(tvomodels.USER), MaxUses: 1, CreatedBy: 2,
+		IssuerRole: sponsor}); err != nil {
+		t.Errorf("Issue() user role by sponsor error = %v", err)
+	}
+
+	for name, params := range map[string]InviteParams{
+		"admin role":     {RoleID: models.RoleId(tvomodels.ADMIN), MaxUses: 1, IssuerRole: tvomodels.ADMIN},
+		"moderator role": {RoleID: models.RoleId(tvomodels.MODERATOR), MaxUses: 1, IssuerRole: tvomodels.ADMIN},
+		"wider role":     {RoleID: models.RoleId(tvomodels.CREATOR), MaxUses: 1, IssuerRole: sponsor},
+		"short code":     {Code: "abc", MaxUses: 1},
+		"no uses":        {MaxUses: 0},
+		"expired":        {MaxUses: 1, ExpiresAt: &now},
+		"special char":   {Code: "sale_2025", MaxUses: 1},
+	} {
+		if _, err = s.Issue(ctx, params); !errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			t.Errorf("%s: Issue() error = %v, expected %v", name, err, tvoerrors.ErrInvalidRequestData)
+		}
+	}
+	if _, err = s.Issue(ctx, InviteParams{Code: "spring-sale", MaxUses: 1}); !errors.Is(err, tvoerrors.ErrConflict) {
+		t.Errorf("Issue() with taken code error = %v, expected %v", err, tvoerrors.ErrConflict)
+	}
+
+	// израсходованный, просроченный и отозванный коды не подходят
+	repo.invites["spring-sale"].Uses = 2
+	if _, err = s.Check(ctx, "spring-sale"); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Check() used up error = %v, expected %v", err, ErrInvalidInvite)
+	}
+	repo.invites["spring-sale"].Uses = 0
+	s.now = func() time.Time { return expiresAt }
+	if _, err = s.Check(ctx, "spring-sale"); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Check() expired error = %v, expected %v", err, ErrInvalidInvite)
+	}
+	s.now = func() time.Time { return now }
+	if err = s.Revoke(ctx, invite.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Check(ctx, "spring-sale"); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Check() revoked error = %v, expected %v", err, ErrInvalidInvite)
+	}
+	if _, err = s.Check(ctx, "unknown"); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Check() unknown error = %v, expected %v", err, ErrInvalidInvite)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/internal/config"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// Mailer delivers plain text emails
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// ConsoleMailer writes emails to the service log, for development only.
+type ConsoleMailer struct {
+	logger *logger.Logger
+}
+
+// NewConsoleMailer creates a new instance of ConsoleMailer.
+func NewConsoleMailer(logger *logger.Logger) *ConsoleMailer {
+	return &ConsoleMailer{logger: logger}
+}
+
+// Send implements Mailer.
+func (m *ConsoleMailer) Send(_ context.Context, to, subject, body string) error {
+	m.logger.Info("email", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP relay, STARTTLS is used when the server offers it.
+type SMTPMailer struct {
+	cfg *config.Mail
+}
+
+// NewSMTPMailer creates a new instance of SMTPMailer.
+func NewSMTPMailer(cfg *config.Mail) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send implements Mailer.
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	const op = "service.SMTPMailer.Send"
+
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return tvoerrors.Wrap(op, tvoerrors.ErrInvalidEmail)
+	}
+
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		m.cfg.From, to, subject, time.Now().Format(time.RFC1123Z), body)
+
+	// net/smtp does not take a context, the send runs in background and is abandoned on cancel
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.cfg.From, []string{to}, []byte(msg))
+	}()
+
+	select {
+	case <-ctx.Done():
+		return tvoerrors.Wrap(op, ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"main/internal/config"
+	"main/internal/lib/totp"
+	"main/internal/models"
+	"main/internal/repository"
+	"main/tools/pkg/cache"
+	"main/tools/pkg/constants"
+	"main/tools/pkg/helpers"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+var (
+	ErrMFAInvalidCode     = tvoerrors.Wrap("invalid two-factor code", tvoerrors.ErrUnauthorized)
+	ErrMFAAttempts        = tvoerrors.Wrap("too many attempts, log in again", tvoerrors.ErrTooManyRequests)
+	ErrMFAChallenge       = tvoerrors.Wrap("invalid or expired mfa token", tvoerrors.ErrUnauthorized)
+	ErrMFANotEnrolled     = tvoerrors.Wrap("two-factor authentication is not enrolled", tvoerrors.ErrInvalidRequestData)
+	ErrMFAAlreadyEnabled  = tvoerrors.Wrap("two-factor authentication is already enabled", tvoerrors.ErrConflict)
+	ErrMFARequiredForRole = tvoerrors.Wrap("two-factor authentication is mandatory for the role", tvoerrors.ErrForbidden)
+)
+
+// recoveryCodeEncoding is lowercase base32 without padding, easy to type from a printout
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFAEnrollment is returned once when a new TOTP secret is generated
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte // PNG
+}
+
+// mfaChallenge is stored in the cache while the user enters the second factor after the password.
+// Wrong codes are counted in a separate key with INCR, so parallel guesses can't share one count.
+type mfaChallenge struct {
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MFAService manages TOTP second factors, recovery codes and the login challenge between
+// the password and the second factor.
+type MFAService struct {
+	repo        repository.MFARepository
+	cache       cache.CacheClient
+	cfg         *config.MFA
+	secretKey   []byte // encrypts TOTP secrets at rest
+	recoveryKey []byte // hashes recovery codes
+	now         func() time.Time
+}
+
+// NewMFAService creates a new instance of MFAService, secret is the application secret.
+func NewMFAService(repo repository.MFARepository, cacheClient cache.CacheClient, secret string, cfg *config.MFA) *MFAService {
+	secretKey := sha256.Sum256([]byte("mfa_secret:" + secret))
+	recoveryKey := sha256.Sum256([]byte("mfa_recovery:" + secret))
+	return &MFAService{
+		repo:        repo,
+		cache:       cacheClient,
+		cfg:         cfg,
+		secretKey:   secretKey[:],
+		recoveryKey: recoveryKey[:],
+		now:         time.Now,
+	}
+}
+
+// Required reports whether the policy makes the second factor mandatory for the role.
+func (s *MFAService) Required(roleId models.RoleId) bool {
+	if !s.cfg.RequiredStaff {
+		return false
+	}
+	role := tvomodels.RoleId(roleId)
+	return role == tvomodels.ADMIN || role == tvomodels.MODERATOR
+}
+
+// Enabled reports whether the user has a confirmed second factor.
+func (s *MFAService) Enabled(ctx context.Context, userId int64) (bool, error) {
+	const op = "service.MFAService.Enabled"
+
+	mfa, err := s.repo.ByUser(ctx, userId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return false, nil
+		}
+		return false, tvoerrors.Wrap(op, err)
+	}
+
+	return mfa.Enabled(), nil
+}
+
+// Enroll generates a new secret for the user. The factor stays pending until Confirm.
+func (s *MFAService) Enroll(ctx context.Context, userId int64, account string) (*MFAEnrollment, error) {
+	const op = "service.MFAService.Enroll"
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	sealed, err := s.seal(secret)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if err = s.repo.SavePending(ctx, userId, sealed); err != nil {
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	uri := totp.URI(s.cfg.Issuer, account, secret)
+	qr, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: qr,
+	}, nil
+}
+
+// Confirm enables the pending factor with the first code from the app and returns recovery codes.
+func (s *MFAService) Confirm(ctx context.Context, userId int64, code string) ([]string, error) {
+	const op = "service.MFAService.Confirm"
+
+	mfa, err := s.factor(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err = s.checkCode(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if err = s.repo.Enable(ctx, userId, hashes); err != nil {
+		if errors.Is(err, tvoerrors.ErrConflict) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return codes, nil
+}
+
+// Verify checks a code of the enabled factor, a recovery code is accepted once instead of a TOTP code.
+func (s *MFAService) Verify(ctx context.Context, userId int64, code string) error {
+	const op = "service.MFAService.Verify"
+
+	mfa, err := s.factor(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !mfa.Enabled() {
+		return ErrMFANotEnrolled
+	}
+
+	err = s.checkCode(ctx, mfa, code)
+	if !errors.Is(err, ErrMFAInvalidCode) {
+		return err
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userId, s.hashRecoveryCode(code))
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if !used {
+		return ErrMFAInvalidCode
+	}
+
+	return nil
+}
+
+// Disable removes the factor after checking a current code.
+func (s *MFAService) Disable(ctx context.Context, userId int64, code string) error {
+	const op = "service.MFAService.Disable"
+
+	if err := s.Verify(ctx, userId, code); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, userId); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userId int64, code string) ([]string, error) {
+	const op = "service.MFAService.RegenerateRecoveryCodes"
+
+	if err := s.Verify(ctx, userId, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+	if err = s.repo.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return codes, nil
+}
+
+// StartChallenge issues the intermediate MFA token returned by login instead of access tokens.
+func (s *MFAService) StartChallenge(ctx context.Context, userId int64) (string, error) {
+	const op = "service.MFAService.StartChallenge"
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+	token := hex.EncodeToString(raw)
+
+	challenge := mfaChallenge{
+		UserID:    userId,
+		ExpiresAt: s.now().Add(s.cfg.ChallengeTTL),
+	}
+	if err := s.cache.Set(ctx, constants.MFA_CHALLENGE_CACHE_PREFIX+token, helpers.JsonEncodeString(challenge),
+		s.cfg.ChallengeTTL); err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+
+	return token, nil
+}
+
+// ChallengeUser returns the user of the MFA token without consuming it.
+func (s *MFAService) ChallengeUser(ctx context.Context, token string) (int64, error) {
+	challenge, err := s.challenge(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	return challenge.UserID, nil
+}
+
+// CompleteChallenge checks the second factor for the MFA token and consumes the token on success.
+// A pending factor is confirmed by the code, its recovery codes are returned then.
+func (s *MFAService) CompleteChallenge(ctx context.Context, token, code string) (int64, []string, error) {
+	const op = "service.MFAService.CompleteChallenge"
+	key := constants.MFA_CHALLENGE_CACHE_PREFIX + token
+	attemptsKey := constants.MFA_ATTEMPTS_CACHE_PREFIX + token
+
+	challenge, err := s.challenge(ctx, token)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// попытка занимается атомарно до проверки кода
+	attempts, err := s.cache.Incr(ctx, attemptsKey)
+	if err != nil {
+		return 0, nil, tvoerrors.Wrap(op, err)
+	}
+	if attempts == 1 {
+		if _, err = s.cache.Expire(ctx, attemptsKey, s.cfg.ChallengeTTL); err != nil {
+			return 0, nil, tvoerrors.Wrap(op, err)
+		}
+	}
+	if attempts > int64(s.cfg.MaxAttempts) {
+		if _, err = s.cache.Del(ctx, key); err != nil {
+			return 0, nil, tvoerrors.Wrap(op, err)
+		}
+		return 0, nil, ErrMFAAttempts
+	}
+
+	enabled, err := s.Enabled(ctx, challenge.UserID)
+	if err != nil {
+		return 0, nil, tvoerrors.Wrap(op, err)
+	}
+
+	var recoveryCodes []string
+	if enabled {
+		err = s.Verify(ctx, challenge.UserID, code)
+	} else {
+		recoveryCodes, err = s.Confirm(ctx, challenge.UserID, code)
+	}
+
+	if errors.Is(err, ErrMFAInvalidCode) {
+		if attempts == int64(s.cfg.MaxAttempts) {
+			if _, err = s.cache.Del(ctx, key); err != nil {
+				return 0, nil, tvoerrors.Wrap(op, err)
+			}
+			return 0, nil, ErrMFAAttempts
+		}
+		return 0, nil, ErrMFAInvalidCode
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// токен выдает только тот из параллельных запросов, кто удалил challenge
+	if _, err = s.cache.GetDel(ctx, key); err != nil {
+		return 0, nil, ErrMFAChallenge
+	}
+	if _, err = s.cache.Del(ctx, attemptsKey); err != nil {
+		return 0, nil, tvoerrors.Wrap(op, err)
+	}
+
+	return challenge.UserID, recoveryCodes, nil
+}
+
+func (s *MFAService) challenge(ctx context.Context, token string) (*mfaChallenge, error) {
+	if token == "" {
+		return nil, ErrMFAChallenge
+	}
+
+	data, err := s.cache.Get(ctx, constants.MFA_CHALLENGE_CACHE_PREFIX+token)
+	if err != nil {
+		return nil, ErrMFAChallenge
+	}
+
+	var challenge mfaChallenge
+	if err = helpers.JsonDecode(data, &challenge); err != nil || !challenge.ExpiresAt.After(s.now()) {
+		return nil, ErrMFAChallenge
+	}
+
+	return &challenge, nil
+}
+
+func (s *MFAService) factor(ctx context.Context, userId int64) (*models.UserMFA, error) {
+	const op = "service.MFAService.factor"
+
+	mfa, err := s.repo.ByUser(ctx, userId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return mfa, nil
+}
+
+// checkCode validates a TOTP code and burns its time step
+func (s *MFAService) checkCode(ctx context.Context, mfa *models.UserMFA, code string) error {
+	const op = "service.MFAService.checkCode"
+
+	secret, err := s.open(mfa.Secret)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	counter, ok := totp.Validate(secret, code, s.now(), s.cfg.Skew)
+	if !ok || counter <= mfa.LastCounter {
+		return ErrMFAInvalidCode
+	}
+
+	used, err := s.repo.UseCounter(ctx, mfa.UserID, counter)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if !used {
+		return ErrMFAInvalidCode
+	}
+
+	return nil
+}
+
+func (s *MFAService) generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, s.cfg.RecoveryCodes)
+	hashes := make([]string, 0, s.cfg.RecoveryCodes)
+
+	for range s.cfg.RecoveryCodes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		encoded := recoveryCodeEncoding.EncodeToString(raw)
+		code := encoded[:4] + "-" + encoded[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, s.hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case and separators, codes are high entropy so HMAC is enough
+func (s *MFAService) hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	mac := hmac.New(sha256.New, s.recoveryKey)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *MFAService) seal(secret string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (s *MFAService) open(sealed string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed totp secret")
+	}
+
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func (s *MFAService) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"main/internal/config"
+	"main/internal/lib/totp"
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// memoryMFA is a repository.MFARepository for one process
+type memoryMFA struct {
+	factors  map[int64]*models.UserMFA
+	recovery map[int64]map[string]bool // hash -> used
+}
+
+func newMemoryMFA() *memoryMFA {
+	return &memoryMFA{factors: map[int64]*models.UserMFA{}, recovery: map[int64]map[string]bool{}}
+}
+
+func (m *memoryMFA) ByUser(_ context.Context, userId int64) (*models.UserMFA, error) {
+	mfa, ok := m.factors[userId]
+	if !ok {
+		return nil, tvoerrors.ErrNotFound
+	}
+	copied := *mfa
+	return &copied, nil
+}
+
+func (m *memoryMFA) SavePending(_ context.Context, userId int64, secret string) error {
+	if mfa, ok := m.factors[userId]; ok && mfa.Enabled() {
+		return tvoerrors.ErrConflict
+	}
+	m.factors[userId] = &models.UserMFA{UserID: userId, Secret: secret}
+	return nil
+}
+
+func (m *memoryMFA) Enable(ctx context.Context, userId int64, codeHashes []string) error {
+	now := time.Now()
+	m.factors[userId].EnabledAt = &now
+	return m.ReplaceRecoveryCodes(ctx, userId, codeHashes)
+}
+
+func (m *memoryMFA) UseCounter(_ context.Context, userId, counter int64) (bool, error) {
+	mfa := m.factors[userId]
+	if mfa.LastCounter >= counter {
+		return false, nil
+	}
+	mfa.LastCounter = counter
+	return true, nil
+}
+
+func (m *memoryMFA) ReplaceRecoveryCodes(_ context.Context, userId int64, codeHashes []string) error {
+	m.recovery[userId] = map[string]bool{}
+	for _, hash := range codeHashes {
+		m.recovery[userId][hash] = false
+	}
+	return nil
+}
+
+func (m *memoryMFA) UseRecoveryCode(_ context.Context, userId int64, codeHash string) (bool, error) {
+	used, ok := m.recovery[userId][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recovery[userId][codeHash] = true
+	return true, nil
+}
+
+func (m *memoryMFA) Delete(_ context.Context, userId int64) error {
+	delete(m.factors, userId)
+	delete(m.recovery, userId)
+	return nil
+}
+
+func newTestMFA(repo *memoryMFA) *MFAService {
+	cfg := &config.MFA{Issuer: "test", RequiredStaff: true, Skew: 1, ChallengeTTL: time.Minute, MaxAttempts: 3, RecoveryCodes: 4}
+	return NewMFAService(repo, memoryCache{}, "secret", cfg)
+}
+
+func TestMFAEnrollAndVerify(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryMFA()
+	mfa := newTestMFA(repo)
+	now := time.Date(2025, 11, 18, 12, 0, 0, 0, time.UTC)
+	mfa.now = func() time.Time { return now }
+
+	enrollment, err := mfa.Enroll(ctx, 1, "79999999999")
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if len(enrollment.QRCode) == 0 || enrollment.URI == "" {
+		t.Fatal("Enroll() returned no QR code or URI")
+	}
+	if repo.factors[1].Secret == enrollment.Secret {
+		t.Error("secret is stored in plaintext")
+	}
+
+	if err = mfa.Verify(ctx, 1, "000000"); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("Verify() before confirm error = %v, expected %v", err, ErrMFANotEnrolled)
+	}
+
+	code, _ := totp.Code(enrollment.Secret, totp.Counter(now))
+	recoveryCodes, err := mfa.Confirm(ctx, 1, code)
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if len(recoveryCodes) != 4 {
+		t.Fatalf("Confirm() returned %d recovery codes, expected 4", len(recoveryCodes))
+	}
+
+	// the code of the confirmed step can't be replayed
+	if err = mfa.Verify(ctx, 1, code); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("Verify() replay error = %v, expected %v", err, ErrMFAInvalidCode)
+	}
+
+	now = now.Add(30 * time.Second)
+	code, _ = totp.Code(enrollment.Secret, totp.Counter(now))
+	if err = mfa.Verify(ctx, 1, code); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	if err = mfa.Verify(ctx, 1, recoveryCodes[0]); err != nil {
+		t.Errorf("Verify() with recovery code error = %v", err)
+	}
+	if err = mfa.Verify(ctx, 1, recoveryCodes[0]); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("Verify() with used recovery code error = %v, expected %v", err, ErrMFAInvalidCode)
+	}
+
+	if _, err = mfa.Enroll(ctx, 1, "79999999999"); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("Enroll() when enabled error = %v, expected %v", err, ErrMFAAlreadyEnabled)
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryMFA()
+	mfa := newTestMFA(repo)
+	now := time.Date(2025, 11, 18, 12, 0, 0, 0, time.UTC)
+	mfa.now = func() time.Time { return now }
+
+	enrollment, _ := mfa.Enroll(ctx, 7, "79999999999")
+
+	token, err := mfa.StartChallenge(ctx, 7)
+	if err != nil {
+		t.Fatalf("StartChallenge() error = %v", err)
+	}
+	if userId, err := mfa.ChallengeUser(ctx, token); err != nil || userId != 7 {
+		t.Fatalf("ChallengeUser() = %d, %v", userId, err)
+	}
+
+	if _, _, err = mfa.CompleteChallenge(ctx, token, "000000"); !errors.Is(err, ErrMFAInvalidCode) {
+		t.Errorf("CompleteChallenge() wrong code error = %v, expected %v", err, ErrMFAInvalidCode)
+	}
+
+	// a pending factor is confirmed by the challenge and recovery codes are returned
+	code, _ := totp.Code(enrollment.Secret, totp.Counter(now))
+	userId, recoveryCodes, err := mfa.CompleteChallenge(ctx, token, code)
+	if err != nil || userId != 7 || len(recoveryCodes) == 0 {
+		t.Fatalf("CompleteChallenge() = %d, %v, %v", userId, recoveryCodes, err)
+	}
+
+	if _, _, err = mfa.CompleteChallenge(ctx, token, code); !errors.Is(err, ErrMFAChallenge) {
+		t.Errorf("CompleteChallenge() reuse error = %v, expected %v", err, ErrMFAChallenge)
+	}
+
+	token, _ = mfa.StartChallenge(ctx, 7)
+	for range 2 {
+		if _, _, err = mfa.CompleteChallenge(ctx, token, "000000"); !errors.Is(err, ErrMFAInvalidCode) {
+			t.Fatalf("CompleteChallenge() error = %v, expected %v", err, ErrMFAInvalidCode)
+		}
+	}
+	if _, _, err = mfa.CompleteChallenge(ctx, token, "000000"); !errors.Is(err, ErrMFAAttempts) {
+		t.Errorf("CompleteChallenge() error = %v, expected %v", err, ErrMFAAttempts)
+	}
+	if _, err = mfa.ChallengeUser(ctx, token); !errors.Is(err, ErrMFAChallenge) {
+		t.Errorf("ChallengeUser() after attempts error = %v, expected %v", err, ErrMFAChallenge)
+	}
+}
+
+func TestMFAChallengeParallel(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryMFA()
+	mfa := newTestMFA(repo)
+	now := time.Date(2025, 11, 18, 12, 0, 0, 0, time.UTC)
+	mfa.now = func() time.Time { return now }
+
+	enrollment, _ := mfa.Enroll(ctx, 7, "79999999999")
+	code, _ := totp.Code(enrollment.Secret, totp.Counter(now))
+	if _, err := mfa.Confirm(ctx, 7, code); err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	now = now.Add(time.Minute)
+
+	// parallel wrong codes use up the attempts of the challenge together
+	token, _ := mfa.StartChallenge(ctx, 7)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _ = mfa.CompleteChallenge(ctx, token, "000000")
+		}()
+	}
+	wg.Wait()
+
+	code, _ = totp.Code(enrollment.Secret, totp.Counter(now))
+	if _, _, err := mfa.CompleteChallenge(ctx, token, code); !errors.Is(err, ErrMFAChallenge) {
+		t.Errorf("CompleteChallenge() after parallel guesses error = %v, expected %v", err, ErrMFAChallenge)
+	}
+}
+
+func TestMFARequired(t *testing.T) {
+	mfa := newTestMFA(newMemoryMFA())
+
+	for role, required := range map[tvomodels.RoleId]bool{
+		tvomodels.USER:      false,
+		tvomodels.CREATOR:   false,
+		tvomodels.MODERATOR: true,
+		tvomodels.ADMIN:     true,
+	} {
+		if got := mfa.Required(models.RoleId(role)); got != required {
+			t.Errorf("Required(%d) = %v, expected %v", role, got, required)
+		}
+	}
+
+	mfa.cfg.RequiredStaff = false
+	if mfa.Required(models.RoleId(tvomodels.ADMIN)) {
+		t.Error("Required() = true with the policy disabled")
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"main/internal/lib/oidc"
+	"main/tools/pkg/cache"
+	"main/tools/pkg/constants"
+	"main/tools/pkg/helpers"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+var (
+	ErrOIDCUnknownProvider = tvoerrors.Wrap("unknown identity provider", tvoerrors.ErrNotFound)
+	ErrOIDCState           = tvoerrors.Wrap("invalid or expired authorization state", tvoerrors.ErrUnauthorized)
+	ErrOIDCIdentity        = tvoerrors.Wrap("identity provider rejected the authorization", tvoerrors.ErrUnauthorized)
+	ErrOIDCLinkCaller      = tvoerrors.Wrap("identity can be linked only by the user who started linking", tvoerrors.ErrForbidden)
+)
+
+// oidcState is stored in the cache between the redirect to the provider and the callback
+type oidcState struct {
+	Provider  string    `json:"provider"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	UserID    int64     `json:"user_id"` // set when an identity is linked to a logged in user
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OIDCResult is the verified identity returned by the callback
+type OIDCResult struct {
+	Provider string
+	Claims   *oidc.Claims
+	UserID   int64 // user to link the identity to, 0 for a login
+}
+
+// OIDCService runs the authorization code flow with the configured OpenID providers.
+type OIDCService struct {
+	providers map[string]*oidc.Provider
+	cache     cache.CacheClient
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// NewOIDCService creates a new instance of OIDCService, providers are keyed by the name used in routes.
+func NewOIDCService(providers map[string]*oidc.Provider, cacheClient cache.CacheClient, stateTTL time.Duration) *OIDCService {
+	return &OIDCService{
+		providers: providers,
+		cache:     cacheClient,
+		ttl:       stateTTL,
+		now:       time.Now,
+	}
+}
+
+// Start returns the authorization URL of the provider, a non zero userId links the identity instead of logging in.
+func (s *OIDCService) Start(ctx context.Context, providerName string, userId int64) (string, error) {
+	const op = "service.OIDCService.Start"
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrOIDCUnknownProvider
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+
+	authURL, err := provider.AuthURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+
+	stored := oidcState{
+		Provider:  providerName,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		UserID:    userId,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	if err = s.cache.Set(ctx, constants.OIDC_STATE_CACHE_PREFIX+state, helpers.JsonEncodeString(stored), s.ttl); err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+
+	return authURL, nil
+}
+
+// Finish consumes the state, exchanges the code and verifies the ID token.
+// callerId is the logged in user completing the callback, 0 for a guest. A linking state is accepted only
+// from the user who started linking, otherwise the victim of a sent link would attach their identity to another account.
+func (s *OIDCService) Finish(ctx context.Context, providerName, state, code string, callerId int64) (*OIDCResult, error) {
+	const op = "service.OIDCService.Finish"
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrOIDCUnknownProvider
+	}
+	if state == "" || code == "" {
+		return nil, ErrOIDCState
+	}
+
+	key := constants.OIDC_STATE_CACHE_PREFIX + state
+	data, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, ErrOIDCState
+	}
+	// state одноразовый: из параллельных запросов с ним проходит только удаливший ключ
+	deleted, err := s.cache.Del(ctx, key)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	var stored oidcState
+	if err = helpers.JsonDecode(data, &stored); err != nil || deleted != 1 ||
+		stored.Provider != providerName || !stored.ExpiresAt.After(s.now()) {
+		return nil, ErrOIDCState
+	}
+	if stored.UserID != 0 && stored.UserID != callerId {
+		return nil, ErrOIDCLinkCaller
+	}
+
+	rawToken, err := provider.Exchange(ctx, code, stored.Verifier)
+	if err != nil {
+		if errors.Is(err, oidc.ErrExchange) {
+			return nil, tvoerrors.Wrap(err.Error(), ErrOIDCIdentity)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, rawToken, stored.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) || errors.Is(err, oidc.ErrNonce) {
+			return nil, tvoerrors.Wrap(err.Error(), ErrOIDCIdentity)
+		}
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return &OIDCResult{
+		Provider: providerName,
+		Claims:   claims,
+		UserID:   stored.UserID,
+	}, nil
+}
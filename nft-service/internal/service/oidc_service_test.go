@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"main/internal/lib/oidc"
+	"main/internal/lib/oidc/oidctest"
+)
+
+func TestOIDCServiceFlow(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider("client")
+	defer idp.Close()
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    "client",
+		RedirectURL: "https://app.example/oidc/google/callback",
+	}, idp.Server.Client())
+	s := NewOIDCService(map[string]*oidc.Provider{"google": provider}, memoryCache{}, time.Minute)
+
+	if _, err := s.Start(ctx, "github", 0); !errors.Is(err, ErrOIDCUnknownProvider) {
+		t.Errorf("Start() unknown provider error = %v, expected %v", err, ErrOIDCUnknownProvider)
+	}
+
+	authURL, err := s.Start(ctx, "google", 42)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	code, state := idp.Authorize(authURL, oidctest.Identity{Subject: "108", Email: "buyer@gmail.com", EmailVerified: true})
+
+	if _, err = s.Finish(ctx, "google", "forged", code, 42); !errors.Is(err, ErrOIDCState) {
+		t.Errorf("Finish() forged state error = %v, expected %v", err, ErrOIDCState)
+	}
+
+	result, err := s.Finish(ctx, "google", state, code, 42)
+	if err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	if result.UserID != 42 || result.Claims.Subject != "108" || !result.Claims.EmailVerified {
+		t.Errorf("Finish() = %+v, claims %+v", result, result.Claims)
+	}
+
+	// the state is single use
+	if _, err = s.Finish(ctx, "google", state, code, 42); !errors.Is(err, ErrOIDCState) {
+		t.Errorf("Finish() replay error = %v, expected %v", err, ErrOIDCState)
+	}
+
+	// a code without the matching PKCE verifier is rejected by the provider
+	authURL, _ = s.Start(ctx, "google", 0)
+	_, state = idp.Authorize(authURL, oidctest.Identity{Subject: "108"})
+	if _, err = s.Finish(ctx, "google", state, "stolen-code", 0); !errors.Is(err, ErrOIDCIdentity) {
+		t.Errorf("Finish() with other code error = %v, expected %v", err, ErrOIDCIdentity)
+	}
+
+	// a linking state sent to another user can't be completed by them or by a guest
+	for _, caller := range []int64{0, 7} {
+		authURL, _ = s.Start(ctx, "google", 42)
+		code, state = idp.Authorize(authURL, oidctest.Identity{Subject: "victim", Email: "victim@gmail.com", EmailVerified: true})
+		if _, err = s.Finish(ctx, "google", state, code, caller); !errors.Is(err, ErrOIDCLinkCaller) {
+			t.Errorf("Finish() link by user %d error = %v, expected %v", caller, err, ErrOIDCLinkCaller)
+		}
+		if _, err = s.Finish(ctx, "google", state, code, 42); !errors.Is(err, ErrOIDCState) {
+			t.Errorf("Finish() after a rejected link error = %v, expected the state to be consumed", err)
+		}
+	}
+}
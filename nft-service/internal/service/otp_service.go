@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"main/internal/config"
+	"main/tools/pkg/cache"
+	"main/tools/pkg/constants"
+	"main/tools/pkg/helpers"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// OTPPurpose separates codes of different flows, a code issued for one flow is not accepted by another
+type OTPPurpose string
+
+const (
+	OTPRegistration   OTPPurpose = "registration"
+	OTPRecovery       OTPPurpose = "recovery"
+	OTPPhoneChange    OTPPurpose = "phone_change"
+	OTPPasswordChange OTPPurpose = "password_change"
+	OTPEmailVerify    OTPPurpose = "email_verify" // confirms the email given at registration by phone
+	OTPEmailChange    OTPPurpose = "email_change"
+)
+
+var (
+	ErrOTPInvalid  = tvoerrors.Wrap("invalid or expired code", tvoerrors.ErrInvalidRequestData)
+	ErrOTPAttempts = tvoerrors.Wrap("too many attempts, request a new code", tvoerrors.ErrTooManyRequests)
+	ErrOTPCooldown = tvoerrors.Wrap("code was sent recently, try again later", tvoerrors.ErrTooManyRequests)
+)
+
+// otpRecord is stored in the cache, the code itself is never stored.
+// Wrong attempts are counted in a separate key with INCR, so parallel guesses can't share one count.
+type otpRecord struct {
+	Hash      string    `json:"hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OTPService issues and verifies one-time codes delivered by SMS or email.
+type OTPService struct {
+	cache  cache.CacheClient
+	sender SMSSender
+	mailer Mailer
+	secret string
+	cfg    *config.OTP
+}
+
+// NewOTPService creates a new instance of OTPService.
+func NewOTPService(cacheClient cache.CacheClient, sender SMSSender, mailer Mailer, secret string, cfg *config.OTP) *OTPService {
+	return &OTPService{
+		cache:  cacheClient,
+		sender: sender,
+		mailer: mailer,
+		secret: secret,
+		cfg:    cfg,
+	}
+}
+
+// Send generates a new code and delivers it to the phone. userId binds the code to the account
+// which requested it, 0 is used for anonymous flows (registration, recovery).
+func (s *OTPService) Send(ctx context.Context, purpose OTPPurpose, phone string, userId int64) error {
+	const op = "service.OTPService.Send"
+
+	code, err := s.issue(ctx, otpSubject(purpose, phone, userId))
+	if err != nil {
+		return err
+	}
+
+	if err = s.sender.Send(ctx, phone, fmt.Sprintf("Your verification code: %s", code)); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// SendEmail generates a new code and delivers it to the email, a verification link is added
+// for OTPEmailVerify when EMAIL_VERIFY_URL is set. Codes are verified by Verify with the email as the address.
+func (s *OTPService) SendEmail(ctx context.Context, purpose OTPPurpose, email string, userId int64) error {
+	const op = "service.OTPService.SendEmail"
+
+	code, err := s.issue(ctx, otpSubject(purpose, email, userId))
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Your verification code: %s", code)
+	if purpose == OTPEmailVerify && s.cfg.EmailVerifyURL != "" {
+		link := s.cfg.EmailVerifyURL + "?" + url.Values{"email": {email}, "code": {code}}.Encode()
+		body += "\n\nOr follow the link to confirm the address: " + link
+	}
+
+	if err = s.mailer.Send(ctx, email, "Verification code", body); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// issue stores the hash of a new code for the subject and starts the resend cooldown
+func (s *OTPService) issue(ctx context.Context, subject string) (string, error) {
+	const op = "service.OTPService.issue"
+
+	// SET NX: из параллельных запросов код отправляет только первый
+	ok, err := s.cache.SetNX(ctx, constants.OTP_COOLDOWN_CACHE_PREFIX+subject, "1", s.cfg.ResendCooldown)
+	if err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+	if !ok {
+		return "", ErrOTPCooldown
+	}
+
+	code, err := generateCode(s.cfg.Length)
+	if err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+
+	record := otpRecord{
+		Hash:      s.hash(subject, code),
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+	}
+	if err = s.cache.Set(ctx, constants.OTP_CACHE_PREFIX+subject, helpers.JsonEncodeString(record), s.cfg.TTL); err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+	// у нового кода свой счетчик попыток
+	if _, err = s.cache.Del(ctx, constants.OTP_ATTEMPTS_CACHE_PREFIX+subject); err != nil {
+		return "", tvoerrors.Wrap(op, err)
+	}
+
+	return code, nil
+}
+
+// Verify checks the code sent to the address (phone or email) and consumes it on success.
+// The code is dropped after too many wrong attempts.
+func (s *OTPService) Verify(ctx context.Context, purpose OTPPurpose, address string, userId int64, code string) error {
+	const op = "service.OTPService.Verify"
+	subject := otpSubject(purpose, address, userId)
+	key := constants.OTP_CACHE_PREFIX + subject
+	attemptsKey := constants.OTP_ATTEMPTS_CACHE_PREFIX + subject
+
+	if code == "" {
+		return ErrOTPInvalid
+	}
+
+	data, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return ErrOTPInvalid
+	}
+
+	var record otpRecord
+	if err = helpers.JsonDecode(data, &record); err != nil || !record.ExpiresAt.After(time.Now()) {
+		return ErrOTPInvalid
+	}
+
+	// каждая проверка, и верная тоже, сначала атомарно занимает попытку
+	attempts, err := s.cache.Incr(ctx, attemptsKey)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if attempts == 1 {
+		if _, err = s.cache.Expire(ctx, attemptsKey, s.cfg.TTL); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+	if attempts > int64(s.cfg.MaxAttempts) {
+		if _, err = s.cache.Del(ctx, key); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+		return ErrOTPAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(record.Hash), []byte(s.hash(subject, code))) != 1 {
+		if attempts == int64(s.cfg.MaxAttempts) {
+			if _, err = s.cache.Del(ctx, key); err != nil {
+				return tvoerrors.Wrap(op, err)
+			}
+			return ErrOTPAttempts
+		}
+		return ErrOTPInvalid
+	}
+
+	// GETDEL: верный код принимает только один из параллельных запросов, и только если его не перевыпустили
+	consumed, err := s.cache.GetDel(ctx, key)
+	if err != nil || !bytes.Equal(consumed, data) {
+		return ErrOTPInvalid
+	}
+	if _, err = s.cache.Del(ctx, attemptsKey); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+func (s *OTPService) hash(subject, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write([]byte(subject + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func otpSubject(purpose OTPPurpose, address string, userId int64) string {
+	return fmt.Sprintf("%s:%d:%s", purpose, userId, address)
+}
+
+// generateCode returns a random numeric code of the given length.
+func generateCode(length int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
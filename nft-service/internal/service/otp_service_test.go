@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"main/internal/config"
+)
+
+// memoryCache is a cache.CacheClient without expiration, each call is atomic like a Redis command
+type memoryCache map[string][]byte
+
+// memoryCacheMu guards all memoryCache maps, tests run parallel requests against them
+var memoryCacheMu sync.Mutex
+
+func (m memoryCache) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	m.set(key, value)
+	return nil
+}
+
+func (m memoryCache) set(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		m[key] = []byte(v)
+	case []byte:
+		m[key] = v
+	}
+}
+
+func (m memoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	if v, ok := m[key]; ok {
+		return v, nil
+	}
+	return nil, errors.New("redis: nil")
+}
+
+func (m memoryCache) GetDel(_ context.Context, key string) ([]byte, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	if v, ok := m[key]; ok {
+		delete(m, key)
+		return v, nil
+	}
+	return nil, errors.New("redis: nil")
+}
+
+func (m memoryCache) SetNX(_ context.Context, key string, value interface{}, _ time.Duration) (bool, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	if _, ok := m[key]; ok {
+		return false, nil
+	}
+	m.set(key, value)
+	return true, nil
+}
+
+func (m memoryCache) Exists(_ context.Context, keys ...string) (uint64, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	return m.exists(keys...), nil
+}
+
+func (m memoryCache) exists(keys ...string) uint64 {
+	var n uint64
+	for _, key := range keys {
+		if _, ok := m[key]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (m memoryCache) Del(_ context.Context, keys ...string) (uint64, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	n := m.exists(keys...)
+	for _, key := range keys {
+		delete(m, key)
+	}
+	return n, nil
+}
+
+func (m memoryCache) Incr(_ context.Context, key string) (int64, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	n, _ := strconv.ParseInt(string(m[key]), 10, 64)
+	n++
+	m[key] = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (m memoryCache) Expire(_ context.Context, key string, _ time.Duration) (bool, error) {
+	memoryCacheMu.Lock()
+	defer memoryCacheMu.Unlock()
+	_, ok := m[key]
+	return ok, nil
+}
+
+func (m memoryCache) Close() error { return nil }
+
+// lastSMS remembers the last sent message
+type lastSMS struct{ phone, message string }
+
+func (s *lastSMS) Send(_ context.Context, phone, message string) error {
+	s.phone, s.message = phone, message
+	return nil
+}
+
+func (s *lastSMS) code() string {
+	return s.message[strings.LastIndex(s.message, " ")+1:]
+}
+
+// lastMail remembers the last sent email
+type lastMail struct{ to, body string }
+
+func (m *lastMail) Send(_ context.Context, to, _, body string) error {
+	m.to, m.body = to, body
+	return nil
+}
+
+func TestOTPService(t *testing.T) {
+	ctx := context.Background()
+	sms := &lastSMS{}
+	cfg := &config.OTP{Length: 6, TTL: time.Minute, MaxAttempts: 3, ResendCooldown: time.Minute}
+	otp := NewOTPService(memoryCache{}, sms, &lastMail{}, "secret", cfg)
+
+	if err := otp.Send(ctx, OTPRegistration, "79990000000", 0); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(sms.code()) != 6 || sms.phone != "79990000000" {
+		t.Fatalf("unexpected sms %+v", sms)
+	}
+	if err := otp.Send(ctx, OTPRegistration, "79990000000", 0); !errors.Is(err, ErrOTPCooldown) {
+		t.Errorf("second Send() error = %v, expected %v", err, ErrOTPCooldown)
+	}
+
+	code := sms.code()
+	if err := otp.Verify(ctx, OTPRecovery, "79990000000", 0, code); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("Verify() with other purpose error = %v, expected %v", err, ErrOTPInvalid)
+	}
+	if err := otp.Verify(ctx, OTPRegistration, "79990000000", 0, code); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := otp.Verify(ctx, OTPRegistration, "79990000000", 0, code); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("Verify() of used code error = %v, expected %v", err, ErrOTPInvalid)
+	}
+}
+
+func TestOTPServiceAttempts(t *testing.T) {
+	ctx := context.Background()
+	sms := &lastSMS{}
+	cfg := &config.OTP{Length: 6, TTL: time.Minute, MaxAttempts: 3, ResendCooldown: time.Minute}
+	otp := NewOTPService(memoryCache{}, sms, &lastMail{}, "secret", cfg)
+
+	if err := otp.Send(ctx, OTPPhoneChange, "79990000000", 7); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	code := sms.code()
+
+	for i := 0; i < 2; i++ {
+		if err := otp.Verify(ctx, OTPPhoneChange, "79990000000", 7, "000000x"); !errors.Is(err, ErrOTPInvalid) {
+			t.Fatalf("Verify() attempt %d error = %v, expected %v", i, err, ErrOTPInvalid)
+		}
+	}
+	if err := otp.Verify(ctx, OTPPhoneChange, "79990000000", 7, "000000x"); !errors.Is(err, ErrOTPAttempts) {
+		t.Errorf("Verify() last attempt error = %v, expected %v", err, ErrOTPAttempts)
+	}
+	if err := otp.Verify(ctx, OTPPhoneChange, "79990000000", 7, code); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("Verify() after lockout error = %v, expected %v", err, ErrOTPInvalid)
+	}
+}
+
+func TestOTPServiceParallel(t *testing.T) {
+	ctx := context.Background()
+	sms := &lastSMS{}
+	cfg := &config.OTP{Length: 6, TTL: time.Minute, MaxAttempts: 3, ResendCooldown: time.Minute}
+	otp := NewOTPService(memoryCache{}, sms, &lastMail{}, "secret", cfg)
+
+	// parallel sends pass the cooldown once
+	var sent int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if otp.Send(ctx, OTPRecovery, "79990000000", 0) == nil {
+				mu.Lock()
+				sent++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if sent != 1 {
+		t.Fatalf("parallel Send() sent %d codes, expected 1", sent)
+	}
+
+	// parallel wrong guesses use up the attempts of the code together
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = otp.Verify(ctx, OTPRecovery, "79990000000", 0, strconv.Itoa(i)+"x")
+		}(i)
+	}
+	wg.Wait()
+	if err := otp.Verify(ctx, OTPRecovery, "79990000000", 0, sms.code()); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("Verify() after parallel guesses error = %v, expected the code to be dropped", err)
+	}
+}
+
+func TestOTPServiceSingleUse(t *testing.T) {
+	ctx := context.Background()
+	sms := &lastSMS{}
+	cfg := &config.OTP{Length: 6, TTL: time.Minute, MaxAttempts: 20, ResendCooldown: time.Minute}
+	otp := NewOTPService(memoryCache{}, sms, &lastMail{}, "secret", cfg)
+
+	if err := otp.Send(ctx, OTPRecovery, "79990000000", 0); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	var accepted int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if otp.Verify(ctx, OTPRecovery, "79990000000", 0, sms.code()) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("parallel Verify() accepted the code %d times, expected 1", accepted)
+	}
+}
+
+func TestOTPServiceEmail(t *testing.T) {
+	ctx := context.Background()
+	mail := &lastMail{}
+	cfg := &config.OTP{Length: 6, TTL: time.Minute, MaxAttempts: 3, ResendCooldown: time.Minute,
+		EmailVerifyURL: "https://example.com/verify"}
+	otp := NewOTPService(memoryCache{}, &lastSMS{}, mail, "secret", cfg)
+
+	if err := otp.SendEmail(ctx, OTPEmailVerify, "user@example.com", 0); err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+	if mail.to != "user@example.com" {
+		t.Fatalf("email sent to %q", mail.to)
+	}
+
+	code := strings.Fields(mail.body)[3]
+	link := "https://example.com/verify?code=" + code + "&email=user%40example.com"
+	if !strings.Contains(mail.body, link) {
+		t.Errorf("email body %q does not contain link %q", mail.body, link)
+	}
+
+	if err := otp.Verify(ctx, OTPEmailVerify, "user@example.com", 0, code); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
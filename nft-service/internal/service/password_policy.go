@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"main/internal/auth/tools"
+	"main/internal/config"
+	"main/internal/lib/pwned"
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+var (
+	ErrPasswordTooShort = tvoerrors.Wrap("password is too short", tvoerrors.ErrInvalidRequestData)
+	ErrPasswordTooLong  = tvoerrors.Wrap("password is too long", tvoerrors.ErrInvalidRequestData)
+	ErrPasswordWeak     = tvoerrors.Wrap("password must mix lowercase and uppercase letters, digits or symbols", tvoerrors.ErrInvalidRequestData)
+	ErrPasswordPhone    = tvoerrors.Wrap("password must not contain the phone number", tvoerrors.ErrInvalidRequestData)
+	ErrPasswordBreached = tvoerrors.Wrap("password appears in known data breaches, choose another one", tvoerrors.ErrInvalidRequestData)
+	ErrPasswordReused   = tvoerrors.Wrap("password was used recently, choose another one", tvoerrors.ErrInvalidRequestData)
+)
+
+// phoneTail is the subscriber part of the phone, it is recognizable without the country and area codes
+const phoneTail = 7
+
+// BreachedPasswords returns the hash suffixes of leaked passwords by the SHA-1 prefix, see pwned.Hash.
+// Only the prefix leaves the service, so a remote range API can replace the local list.
+type BreachedPasswords interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// PasswordPolicy checks new passwords on registration, recovery and change.
+type PasswordPolicy struct {
+	cfg      *config.Password
+	hasher   *tools.PasswordHasher
+	breached BreachedPasswords
+}
+
+// NewPasswordPolicy creates a new instance of PasswordPolicy, breached may be nil to skip the leak check.
+func NewPasswordPolicy(cfg *config.Password, hasher *tools.PasswordHasher, breached BreachedPasswords) *PasswordPolicy {
+	return &PasswordPolicy{
+		cfg:      cfg,
+		hasher:   hasher,
+		breached: breached,
+	}
+}
+
+// Check validates the password against the policy, phone is the phone of the account and may be empty.
+func (p *PasswordPolicy) Check(ctx context.Context, password, phone string) error {
+	const op = "service.PasswordPolicy.Check"
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength || length == 0 {
+		return ErrPasswordTooShort
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		return ErrPasswordTooLong
+	}
+	if characterClasses(password) < p.cfg.MinClasses {
+		return ErrPasswordWeak
+	}
+	if p.cfg.ForbidPhone && containsPhone(password, phone) {
+		return ErrPasswordPhone
+	}
+
+	if p.breached != nil {
+		prefix, suffix := pwned.Hash(password)
+		suffixes, err := p.breached.Range(ctx, prefix)
+		if err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+		for _, leaked := range suffixes {
+			if leaked == suffix {
+				return ErrPasswordBreached
+			}
+		}
+	}
+
+	return nil
+}
+
+// HistorySize is the number of previous passwords kept besides the current one.
+func (p *PasswordPolicy) HistorySize() int {
+	return max(p.cfg.History, 0)
+}
+
+// CheckReuse rejects the password matching one of the hashes, see UserRepository.PasswordHistory.
+func (p *PasswordPolicy) CheckReuse(password string, history []models.PasswordHash) error {
+	for _, old := range history {
+		if match, _ := p.hasher.Verify(old.Hash, password, old.Salt); match {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// characterClasses counts lowercase and uppercase letters, digits and symbols in the password.
+// Letters without case, e.g. of CJK scripts, count as lowercase.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsLetter(r):
+			lower = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsPhone tells whether the digits of the password include the subscriber part of the phone,
+// so separators or a different country code prefix don't hide it.
+func containsPhone(password, phone string) bool {
+	tail := onlyDigits(phone)
+	if tail == "" {
+		return false
+	}
+	if len(tail) > phoneTail {
+		tail = tail[len(tail)-phoneTail:]
+	}
+	return strings.Contains(onlyDigits(password), tail)
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"main/internal/auth/tools"
+	"main/internal/config"
+	"main/internal/lib/pwned"
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	// SHA-1 of "Password1"
+	breached, err := pwned.Load(strings.NewReader("70CCD9007338D6D81DD3B6271621B9CF9A97EA00:243071\n"))
+	if err != nil {
+		t.Fatalf("pwned.Load() error = %v", err)
+	}
+	cfg := &config.Password{MinLength: 8, MaxLength: 16, MinClasses: 3, ForbidPhone: true}
+	policy := NewPasswordPolicy(cfg, nil, breached)
+
+	tests := []struct {
+		password string
+		phone    string
+		err      error
+	}{
+		{"Secret-42", "79991234567", nil},
+		{"", "", ErrPasswordTooShort},
+		{"Sec-42", "", ErrPasswordTooShort},
+		{"Secret-42-Secret-42", "", ErrPasswordTooLong},
+		{"secret-password", "", ErrPasswordWeak},
+		{"Пароль-секрет", "", nil},
+		{"Me+999-123-45-67", "79991234567", ErrPasswordPhone},
+		{"Me+1234567", "+7 (999) 123-45-67", ErrPasswordPhone},
+		{"Me+1234567", "", nil},
+		{"Password1", "", ErrPasswordBreached},
+	}
+	for _, tt := range tests {
+		err := policy.Check(context.Background(), tt.password, tt.phone)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Check(%q, %q) = %v, expected %v", tt.password, tt.phone, err, tt.err)
+		}
+		if tt.err != nil && !errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			t.Errorf("Check(%q) = %v, expected a bad request", tt.password, err)
+		}
+	}
+
+	cfg.ForbidPhone = false
+	if err := policy.Check(context.Background(), "Me+1234567", "79991234567"); err != nil {
+		t.Errorf("Check() with the phone allowed = %v", err)
+	}
+}
+
+func TestPasswordPolicyCheckReuse(t *testing.T) {
+	hasher := tools.NewPasswordHasher(tools.PasswordParams{
+		Algorithm:     tools.AlgorithmArgon2id,
+		Argon2Time:    1,
+		Argon2Memory:  1024,
+		Argon2Threads: 1,
+		Argon2KeyLen:  16,
+	}, "secret")
+	policy := NewPasswordPolicy(&config.Password{History: -1}, hasher, nil)
+
+	current, _ := hasher.Hash("Current-1")
+	previous, _ := hasher.Hash("Previous-1")
+	legacy := []byte("salt")
+	history := []models.PasswordHash{
+		{Hash: current},
+		{Hash: previous},
+		{Hash: tools.HashPassword("Legacy-1", "secret", legacy), Salt: legacy},
+		{Hash: "$none"},
+	}
+
+	for _, password := range []string{"Current-1", "Previous-1", "Legacy-1"} {
+		if err := policy.CheckReuse(password, history); !errors.Is(err, ErrPasswordReused) {
+			t.Errorf("CheckReuse(%q) = %v, expected ErrPasswordReused", password, err)
+		}
+	}
+	if err := policy.CheckReuse("Brand-new-1", history); err != nil {
+		t.Errorf("CheckReuse() of a new password = %v", err)
+	}
+	if policy.HistorySize() != 0 {
+		t.Errorf("HistorySize() = %d, expected negative history to be 0", policy.HistorySize())
+	}
+}
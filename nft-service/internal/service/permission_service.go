@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"main/internal/models"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// RolePermissionSource loads permissions of all roles, implemented by RoleRepository
+type RolePermissionSource interface {
+	RolePermissions(ctx context.Context) (map[models.RoleId][]string, error)
+}
+
+// PermissionService answers whether a role grants a permission.
+// Role permissions change rarely, so they are kept in memory and reloaded after ttl.
+type PermissionService struct {
+	source RolePermissionSource
+	ttl    time.Duration
+
+	mu       sync.RWMutex
+	byRole   map[models.RoleId][]string
+	loadedAt time.Time
+}
+
+// NewPermissionService creates a new instance of PermissionService.
+func NewPermissionService(source RolePermissionSource, ttl time.Duration) *PermissionService {
+	return &PermissionService{
+		source: source,
+		ttl:    ttl,
+	}
+}
+
+// Can reports whether the role grants the permission.
+func (s *PermissionService) Can(ctx context.Context, roleId tvomodels.RoleId, permission string) (bool, error) {
+	permissions, err := s.Permissions(ctx, roleId)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(permissions, permission), nil
+}
+
+// Permissions returns the permissions granted to the role.
+func (s *PermissionService) Permissions(ctx context.Context, roleId tvomodels.RoleId) ([]string, error) {
+	const op = "service.PermissionService.Permissions"
+
+	s.mu.RLock()
+	byRole, loadedAt := s.byRole, s.loadedAt
+	s.mu.RUnlock()
+
+	if byRole == nil || time.Since(loadedAt) > s.ttl {
+		loaded, err := s.source.RolePermissions(ctx)
+		if err != nil {
+			if byRole == nil {
+				return nil, tvoerrors.Wrap(op, err)
+			}
+			// оставляем прежний набор прав, пока БД недоступна
+		} else {
+			byRole = loaded
+			s.mu.Lock()
+			s.byRole, s.loadedAt = loaded, time.Now()
+			s.mu.Unlock()
+		}
+	}
+
+	return byRole[models.RoleId(roleId)], nil
+}
+
+// CanGrant reports whether a user of the actor role may hand the role out, e.g. by an invite code.
+// The rule is the one of CanActAs: the role must not manage accounts or grant more than the actor has.
+func (s *PermissionService) CanGrant(ctx context.Context, actor, role tvomodels.RoleId) (bool, error) {
+	return s.CanActAs(ctx, actor, role)
+}
+
+// CanActAs reports whether a user of the actor role may act as a user of the target role.
+// The target must not manage accounts and the actor must hold every permission of the target,
+// so acting as the user grants the actor nothing it couldn't do itself.
+func (s *PermissionService) CanActAs(ctx context.Context, actor, target tvomodels.RoleId) (bool, error) {
+	actorPermissions, err := s.Permissions(ctx, actor)
+	if err != nil {
+		return false, err
+	}
+	targetPermissions, err := s.Permissions(ctx, target)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range targetPermissions {
+		if models.ManagesAccounts(permission) || !slices.Contains(actorPermissions, permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
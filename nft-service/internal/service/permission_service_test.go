@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"main/internal/models"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+type fakePermissionSource struct {
+	byRole map[models.RoleId][]string
+	err    error
+	loads  int
+}
+
+func (s *fakePermissionSource) RolePermissions(context.Context) (map[models.RoleId][]string, error) {
+	s.loads++
+	return s.byRole, s.err
+}
+
+func TestPermissionServiceCan(t *testing.T) {
+	ctx := context.Background()
+	source := &fakePermissionSource{byRole: map[models.RoleId][]string{
+		models.RoleId(tvomodels.CREATOR):   {models.PermNftCreate, models.PermNftManageOwn},
+		models.RoleId(tvomodels.MODERATOR): {models.PermUsersList, models.PermDriftRead},
+	}}
+	permissions := NewPermissionService(source, time.Hour)
+
+	tests := []struct {
+		name       string
+		roleId     tvomodels.RoleId
+		permission string
+		allowed    bool
+	}{
+		{"creator creates nft", tvomodels.CREATOR, models.PermNftCreate, true},
+		{"creator manages own nft", tvomodels.CREATOR, models.PermNftManageOwn, true},
+		{"creator can't manage any nft", tvomodels.CREATOR, models.PermNftManageAny, false},
+		{"moderator lists users", tvomodels.MODERATOR, models.PermUsersList, true},
+		{"moderator can't change roles", tvomodels.MODERATOR, models.PermRolesChange, false},
+		{"user has no permissions", tvomodels.USER, models.PermNftCreate, false},
+	}
+	for _, tt := range tests {
+		allowed, err := permissions.Can(ctx, tt.roleId, tt.permission)
+		if err != nil {
+			t.Fatalf("%s: Can() error = %v", tt.name, err)
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: Can() = %v, expected %v", tt.name, allowed, tt.allowed)
+		}
+	}
+
+	if source.loads != 1 {
+		t.Errorf("permissions loaded %d times, expected 1", source.loads)
+	}
+}
+
+func TestPermissionServiceCanActAs(t *testing.T) {
+	const support tvomodels.RoleId = 50
+	ctx := context.Background()
+	source := &fakePermissionSource{byRole: map[models.RoleId][]string{
+		models.RoleId(tvomodels.CREATOR):   {models.PermNftCreate, models.PermNftManageOwn},
+		models.RoleId(support):             {models.PermUsersImpersonate, models.PermNftCreate},
+		models.RoleId(tvomodels.MODERATOR): {models.PermUsersList, models.PermNftCreate, models.PermNftManageOwn},
+		models.RoleId(tvomodels.ADMIN): {models.PermUsersImpersonate, models.PermUsersList, models.PermNftCreate,
+			models.PermNftManageOwn, models.PermRolesChange},
+	}}
+	permissions := NewPermissionService(source, time.Hour)
+
+	tests := []struct {
+		name    string
+		actor   tvomodels.RoleId
+		target  tvomodels.RoleId
+		allowed bool
+	}{
+		{"admin acts as user", tvomodels.ADMIN, tvomodels.USER, true},
+		{"admin acts as creator", tvomodels.ADMIN, tvomodels.CREATOR, true},
+		{"support acts as user", support, tvomodels.USER, true},
+		{"support lacks creator permissions", support, tvomodels.CREATOR, false},
+		{"moderator lists users", tvomodels.ADMIN, tvomodels.MODERATOR, false},
+		{"admin changes roles", tvomodels.ADMIN, tvomodels.ADMIN, false},
+	}
+	for _, tt := range tests {
+		allowed, err := permissions.CanActAs(ctx, tt.actor, tt.target)
+		if err != nil {
+			t.Fatalf("%s: CanActAs() error = %v", tt.name, err)
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: CanActAs() = %v, expected %v", tt.name, allowed, tt.allowed)
+		}
+	}
+}
+
+func TestPermissionServiceReload(t *testing.T) {
+	ctx := context.Background()
+	source := &fakePermissionSource{byRole: map[models.RoleId][]string{
+		models.RoleId(tvomodels.CREATOR): {models.PermNftCreate},
+	}}
+	permissions := NewPermissionService(source, 0)
+
+	if allowed, _ := permissions.Can(ctx, tvomodels.CREATOR, models.PermNftCreate); !allowed {
+		t.Fatal("expected creator to create nft")
+	}
+
+	// прежний набор прав остается, пока источник недоступен
+	source.byRole, source.err = nil, errors.New("db is down")
+	time.Sleep(time.Millisecond)
+	allowed, err := permissions.Can(ctx, tvomodels.CREATOR, models.PermNftCreate)
+	if err != nil || !allowed {
+		t.Errorf("Can() = %v, %v, expected the cached permission", allowed, err)
+	}
+
+	// отзыв права виден после перезагрузки
+	source.byRole, source.err = map[models.RoleId][]string{}, nil
+	time.Sleep(time.Millisecond)
+	if allowed, _ = permissions.Can(ctx, tvomodels.CREATOR, models.PermNftCreate); allowed {
+		t.Error("expected the revoked permission to be denied")
+	}
+}
+
+func TestPermissionServiceSourceError(t *testing.T) {
+	permissions := NewPermissionService(&fakePermissionSource{err: errors.New("db is down")}, time.Minute)
+
+	if _, err := permissions.Can(context.Background(), tvomodels.ADMIN, models.PermRolesChange); err == nil {
+		t.Error("expected an error without loaded permissions")
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	go_jwt "github.com/golang-jwt/jwt/v5"
+
+	jwtManager "main/internal/lib/jwt"
+)
+
+func TestRevocationList(t *testing.T) {
+	ctx := context.Background()
+	revocations := NewRevocationList(memoryCache{}, time.Minute)
+	now := time.Date(2025, 11, 17, 12, 0, 0, 500*int(time.Millisecond), time.UTC)
+	revocations.now = func() time.Time { return now }
+
+	claims := func(userId int64, jti, sid string, issuedAt time.Time) *jwtManager.UserClaims {
+		return &jwtManager.UserClaims{
+			ID:               userId,
+			SessionID:        sid,
+			RegisteredClaims: go_jwt.RegisteredClaims{ID: jti, IssuedAt: go_jwt.NewNumericDate(issuedAt)},
+		}
+	}
+
+	if err := revocations.RevokeToken(ctx, "jti-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := revocations.RevokeSession(ctx, "sid-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := revocations.RevokeUser(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		claims  *jwtManager.UserClaims
+		revoked bool
+	}{
+		{"active", claims(1, "jti-2", "sid-2", now), false},
+		{"revoked token", claims(1, "jti-1", "sid-2", now), true},
+		{"revoked session", claims(2, "jti-3", "sid-1", now), true},
+		{"issued before user revocation", claims(3, "jti-4", "sid-3", now.Add(-time.Second)), true},
+		{"issued after user revocation", claims(3, "jti-5", "sid-3", now.Add(time.Second)), false},
+		{"issued earlier in the second of user revocation", claims(3, "jti-6", "sid-3", now.Add(-300*time.Millisecond)), true},
+		{"issued later in the second of user revocation", claims(3, "jti-7", "sid-3", now.Add(300*time.Millisecond)), false},
+		{"issued at user revocation", claims(3, "jti-8", "sid-3", now), false},
+		{"legacy token without jti", claims(4, "", "", now), false},
+	}
+	for _, tt := range tests {
+		revoked, err := revocations.Revoked(ctx, tt.claims)
+		if err != nil {
+			t.Fatalf("%s: Revoked() error = %v", tt.name, err)
+		}
+		if revoked != tt.revoked {
+			t.Errorf("%s: Revoked() = %v, expected %v", tt.name, revoked, tt.revoked)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// SMSSender delivers text messages to phone numbers
+type SMSSender interface {
+	Send(ctx context.Context, phone, message string) error
+}
+
+// ConsoleSMSSender writes messages to the service log, for development only.
+type ConsoleSMSSender struct {
+	logger *logger.Logger
+}
+
+// NewConsoleSMSSender creates a new instance of ConsoleSMSSender.
+func NewConsoleSMSSender(logger *logger.Logger) *ConsoleSMSSender {
+	return &ConsoleSMSSender{logger: logger}
+}
+
+// Send implements SMSSender.
+func (s *ConsoleSMSSender) Send(_ context.Context, phone, message string) error {
+	s.logger.Info("sms", "phone", phone, "message", message)
+	return nil
+}
+
+// FileSMSSender appends messages to a file, for development and tests.
+type FileSMSSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSMSSender creates a new instance of FileSMSSender.
+func NewFileSMSSender(path string) *FileSMSSender {
+	return &FileSMSSender{path: path}
+}
+
+// Send implements SMSSender.
+func (s *FileSMSSender) Send(_ context.Context, phone, message string) error {
+	const op = "service.FileSMSSender.Send"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	defer file.Close()
+
+	if _, err = fmt.Fprintf(file, "%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), phone, message); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
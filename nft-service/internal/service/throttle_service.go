@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"main/internal/config"
+	"main/tools/pkg/cache"
+	"main/tools/pkg/constants"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+var (
+	ErrRateLimited  = tvoerrors.Wrap("too many requests, try again later", tvoerrors.ErrTooManyRequests)
+	ErrLoginDelayed = tvoerrors.Wrap("too many failed attempts, try again later", tvoerrors.ErrTooManyRequests)
+)
+
+// Throttle limits the rate of public auth requests and slows down password guessing.
+// Counters live in the cache, so limits are shared by all instances of the service.
+type Throttle struct {
+	cache cache.CacheClient
+	cfg   *config.RateLimit
+	now   func() time.Time
+}
+
+// NewThrottle creates a new instance of Throttle.
+func NewThrottle(cacheClient cache.CacheClient, cfg *config.RateLimit) *Throttle {
+	return &Throttle{
+		cache: cacheClient,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Allow counts the request of the action from the IP and for the phone, phone may be empty.
+// ErrRateLimited is returned when either limit is exceeded.
+func (t *Throttle) Allow(ctx context.Context, action, ip, phone string) error {
+	const op = "service.Throttle.Allow"
+
+	if t.cfg.PerIP > 0 && ip != "" {
+		if err := t.allow(ctx, action+":ip:"+ip, t.cfg.PerIP); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+	if t.cfg.PerPhone > 0 && phone != "" {
+		if err := t.allow(ctx, action+":phone:"+phone, t.cfg.PerPhone); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+
+	return nil
+}
+
+// allow implements a sliding window counter: the count of the previous fixed window is weighted
+// by the part of it which still overlaps the sliding window.
+func (t *Throttle) allow(ctx context.Context, key string, limit int) error {
+	window := t.cfg.Window
+	now := t.now().UnixNano()
+	current := now / int64(window)
+	elapsed := float64(now%int64(window)) / float64(window)
+
+	currentKey := fmt.Sprintf("%s%s:%d", constants.RATE_LIMIT_CACHE_PREFIX, key, current)
+	count, err := t.cache.Incr(ctx, currentKey)
+	if err != nil {
+		return err
+	}
+	if count == 1 {
+		if _, err = t.cache.Expire(ctx, currentKey, 2*window); err != nil {
+			return err
+		}
+	}
+
+	var previous int64
+	if data, err := t.cache.Get(ctx, fmt.Sprintf("%s%s:%d", constants.RATE_LIMIT_CACHE_PREFIX, key, current-1)); err == nil {
+		previous, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+
+	if float64(previous)*(1-elapsed)+float64(count) > float64(limit) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// CheckDelay returns ErrLoginDelayed until the delay after the last failed login for the phone has passed.
+func (t *Throttle) CheckDelay(ctx context.Context, phone string) error {
+	const op = "service.Throttle.CheckDelay"
+
+	delayed, err := t.cache.Exists(ctx, constants.LOGIN_DELAY_CACHE_PREFIX+phone)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	if delayed > 0 {
+		return ErrLoginDelayed
+	}
+	return nil
+}
+
+// Failure records a failed login for the phone and starts the next delay, which doubles with every failure.
+// lock reports that the threshold is reached and the account has to be locked.
+func (t *Throttle) Failure(ctx context.Context, phone string) (lock bool, err error) {
+	const op = "service.Throttle.Failure"
+
+	key := constants.LOGIN_FAILURES_CACHE_PREFIX + phone
+	failures, err := t.cache.Incr(ctx, key)
+	if err != nil {
+		return false, tvoerrors.Wrap(op, err)
+	}
+	if failures == 1 {
+		if _, err = t.cache.Expire(ctx, key, t.cfg.FailureWindow); err != nil {
+			return false, tvoerrors.Wrap(op, err)
+		}
+	}
+
+	if delay := t.delay(failures); delay > 0 {
+		if err = t.cache.Set(ctx, constants.LOGIN_DELAY_CACHE_PREFIX+phone, "1", delay); err != nil {
+			return false, tvoerrors.Wrap(op, err)
+		}
+	}
+
+	return t.cfg.LockoutThreshold > 0 && failures >= int64(t.cfg.LockoutThreshold), nil
+}
+
+// Reset forgets failed logins of the phone, called after a successful login or an unlock.
+func (t *Throttle) Reset(ctx context.Context, phone string) error {
+	const op = "service.Throttle.Reset"
+
+	if _, err := t.cache.Del(ctx, constants.LOGIN_FAILURES_CACHE_PREFIX+phone,
+		constants.LOGIN_DELAY_CACHE_PREFIX+phone); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+	return nil
+}
+
+// LockoutUntil returns the end of a lockout starting now.
+func (t *Throttle) LockoutUntil() time.Time {
+	return t.now().UTC().Add(t.cfg.LockoutDuration)
+}
+
+func (t *Throttle) delay(failures int64) time.Duration {
+	if t.cfg.DelayBase <= 0 || failures < 1 {
+		return 0
+	}
+	delay := t.cfg.DelayBase
+	for i := int64(1); i < failures && delay < t.cfg.DelayMax; i++ {
+		delay *= 2
+	}
+	return min(delay, t.cfg.DelayMax)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"main/internal/config"
+)
+
+func TestThrottleAllow(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.RateLimit{Window: time.Minute, PerIP: 3, PerPhone: 2}
+	throttle := NewThrottle(memoryCache{}, cfg)
+	now := time.Date(2025, 11, 16, 12, 0, 0, 0, time.UTC)
+	throttle.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := throttle.Allow(ctx, "login", "10.0.0.1", "79990000000"); err != nil {
+			t.Fatalf("request %d: Allow() error = %v", i, err)
+		}
+	}
+	if err := throttle.Allow(ctx, "login", "10.0.0.1", "79990000000"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("phone limit: Allow() error = %v, expected %v", err, ErrRateLimited)
+	}
+	if err := throttle.Allow(ctx, "login", "10.0.0.1", "79990000001"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("ip limit: Allow() error = %v, expected %v", err, ErrRateLimited)
+	}
+	if err := throttle.Allow(ctx, "recovery", "10.0.0.1", "79990000000"); err != nil {
+		t.Errorf("other action: Allow() error = %v", err)
+	}
+
+	// three quarters of the previous window still count
+	now = now.Add(time.Minute + 15*time.Second)
+	if err := throttle.Allow(ctx, "login", "10.0.0.2", "79990000000"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("sliding window: Allow() error = %v, expected %v", err, ErrRateLimited)
+	}
+
+	now = now.Add(time.Minute)
+	if err := throttle.Allow(ctx, "login", "10.0.0.2", "79990000000"); err != nil {
+		t.Errorf("next window: Allow() error = %v", err)
+	}
+}
+
+func TestThrottleFailures(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.RateLimit{FailureWindow: time.Hour, DelayBase: time.Second, DelayMax: 4 * time.Second,
+		LockoutThreshold: 3, LockoutDuration: time.Hour}
+	throttle := NewThrottle(memoryCache{}, cfg)
+
+	if err := throttle.CheckDelay(ctx, "79990000000"); err != nil {
+		t.Fatalf("CheckDelay() error = %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		lock, err := throttle.Failure(ctx, "79990000000")
+		if err != nil {
+			t.Fatalf("Failure() error = %v", err)
+		}
+		if lock != (i == 3) {
+			t.Errorf("failure %d: lock = %v", i, lock)
+		}
+	}
+	if err := throttle.CheckDelay(ctx, "79990000000"); !errors.Is(err, ErrLoginDelayed) {
+		t.Errorf("CheckDelay() error = %v, expected %v", err, ErrLoginDelayed)
+	}
+
+	if err := throttle.Reset(ctx, "79990000000"); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if err := throttle.CheckDelay(ctx, "79990000000"); err != nil {
+		t.Errorf("CheckDelay() after Reset() error = %v", err)
+	}
+	if lock, _ := throttle.Failure(ctx, "79990000000"); lock {
+		t.Error("counter is not reset")
+	}
+
+	for failures, expected := range map[int64]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 4 * time.Second} {
+		if delay := throttle.delay(failures); delay != expected {
+			t.Errorf("delay(%d) = %v, expected %v", failures, delay, expected)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"main/internal/lib/envelope"
+	"main/internal/models"
+	"main/internal/repository"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+const rotateBatchSize = 100
+
+// UnlockableService encrypts token payloads (Google Ads account credentials) and reveals them to the holder.
+type UnlockableService struct {
+	repository repository.UnlockableRepository
+	ownership  repository.OwnershipRepository
+	keyring    *envelope.Keyring
+}
+
+// NewUnlockableService creates a new instance of UnlockableService.
+func NewUnlockableService(unlockableRepository repository.UnlockableRepository,
+	ownershipRepository repository.OwnershipRepository, keyring *envelope.Keyring) *UnlockableService {
+	return &UnlockableService{
+		repository: unlockableRepository,
+		ownership:  ownershipRepository,
+		keyring:    keyring,
+	}
+}
+
+// Set encrypts and stores the payload of the token.
+func (s *UnlockableService) Set(ctx context.Context, tokenId int64, content []byte) error {
+	const op = "service.UnlockableService.Set"
+
+	ownerAddress, err := s.currentOwner(ctx, tokenId)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	if err = s.save(ctx, tokenId, content, ownerAddress); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// Reveal decrypts the payload for the holder and records the access.
+// If the token changed hands since the payload was keyed, it is re-keyed first.
+func (s *UnlockableService) Reveal(ctx context.Context, access *models.NftUnlockableAccess) ([]byte, error) {
+	const op = "service.UnlockableService.Reveal"
+
+	unlockable, err := s.repository.GetByTokenID(ctx, access.TokenId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	ownerAddress, err := s.currentOwner(ctx, access.TokenId)
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	content, err := s.keyring.Open(toSealed(unlockable))
+	if err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	if ownerAddress != unlockable.OwnerAddress {
+		if err = s.save(ctx, access.TokenId, content, ownerAddress); err != nil {
+			return nil, tvoerrors.Wrap(op, err)
+		}
+	}
+
+	// без записи в журнал контент не выдаем
+	if err = s.repository.LogAccess(ctx, access); err != nil {
+		return nil, tvoerrors.Wrap(op, err)
+	}
+
+	return content, nil
+}
+
+// Rekey encrypts the payload with a new data key for the current owner.
+// Called when an on-chain transfer of the token is indexed.
+func (s *UnlockableService) Rekey(ctx context.Context, tokenId int64) error {
+	const op = "service.UnlockableService.Rekey"
+
+	unlockable, err := s.repository.GetByTokenID(ctx, tokenId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return nil
+		}
+		return tvoerrors.Wrap(op, err)
+	}
+
+	content, err := s.keyring.Open(toSealed(unlockable))
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	ownerAddress, err := s.currentOwner(ctx, tokenId)
+	if err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	if err = s.save(ctx, tokenId, content, ownerAddress); err != nil {
+		return tvoerrors.Wrap(op, err)
+	}
+
+	return nil
+}
+
+// RotateMasterKey rewraps all data keys with the active master key and returns the number of rewrapped payloads.
+func (s *UnlockableService) RotateMasterKey(ctx context.Context) (int, error) {
+	const op = "service.UnlockableService.RotateMasterKey"
+	total := 0
+
+	for {
+		batch, err := s.repository.ListByMasterKey(ctx, s.keyring.ActiveID(), rotateBatchSize)
+		if err != nil {
+			return total, tvoerrors.Wrap(op, err)
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		for i := range batch {
+			sealed, err := s.keyring.Rewrap(toSealed(&batch[i]))
+			if err != nil {
+				return total, tvoerrors.Wrap(op, err)
+			}
+
+			if err = s.repository.Save(ctx, fromSealed(batch[i].TokenId, batch[i].OwnerAddress, sealed)); err != nil {
+				return total, tvoerrors.Wrap(op, err)
+			}
+			total++
+		}
+	}
+}
+
+func (s *UnlockableService) save(ctx context.Context, tokenId int64, content []byte, ownerAddress string) error {
+	sealed, err := s.keyring.Seal(content)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.Save(ctx, fromSealed(tokenId, ownerAddress, sealed))
+}
+
+// currentOwner returns the indexed owner of the token or an empty string if the token is not indexed yet.
+func (s *UnlockableService) currentOwner(ctx context.Context, tokenId int64) (string, error) {
+	owner, err := s.ownership.OwnerOf(ctx, tokenId)
+	if err != nil {
+		if errors.Is(err, tvoerrors.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return owner.OwnerAddress, nil
+}
+
+func toSealed(u *models.NftUnlockable) *envelope.Sealed {
+	return &envelope.Sealed{
+		Ciphertext:  u.Ciphertext,
+		Nonce:       u.Nonce,
+		WrappedKey:  u.WrappedKey,
+		KeyNonce:    u.KeyNonce,
+		MasterKeyID: u.MasterKeyID,
+	}
+}
+
+func fromSealed(tokenId int64, ownerAddress string, sealed *envelope.Sealed) *models.NftUnlockable {
+	return &models.NftUnlockable{
+		TokenId:      tokenId,
+		Ciphertext:   sealed.Ciphertext,
+		Nonce:        sealed.Nonce,
+		WrappedKey:   sealed.WrappedKey,
+		KeyNonce:     sealed.KeyNonce,
+		MasterKeyID:  sealed.MasterKeyID,
+		OwnerAddress: ownerAddress,
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"main/internal/repository"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// VisitTracker collects last visit times of users and last use times of sessions in memory
+// and writes them in batches, so authenticated requests do not wait for Postgres.
+type VisitTracker struct {
+	logger   *logger.Logger
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+
+	mu            sync.Mutex
+	userVisits    map[int64]time.Time
+	sessionVisits map[string]time.Time
+}
+
+// NewVisitTracker creates a new instance of VisitTracker.
+func NewVisitTracker(logger *logger.Logger, userRepository repository.UserRepository,
+	sessionRepository repository.SessionRepository) *VisitTracker {
+	return &VisitTracker{
+		logger:        logger,
+		users:         userRepository,
+		sessions:      sessionRepository,
+		userVisits:    make(map[int64]time.Time),
+		sessionVisits: make(map[string]time.Time),
+	}
+}
+
+// Track remembers a visit of the user, sessionId may be empty when the session is unknown.
+func (t *VisitTracker) Track(userId int64, sessionId string) {
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.userVisits[userId] = now
+	if sessionId != "" {
+		t.sessionVisits[sessionId] = now
+	}
+}
+
+// Start flushes collected visits every interval until the context is cancelled, the rest is flushed on exit.
+func (t *VisitTracker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.Flush(context.Background()); err != nil {
+				t.logger.Error("last visit flush failed", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				t.logger.Error("last visit flush failed", "error", err)
+			}
+		}
+	}
+}
+
+// Flush writes collected visits. Visits of a failed batch are lost, the next request of the user tracks it again.
+func (t *VisitTracker) Flush(ctx context.Context) error {
+	const op = "service.VisitTracker.Flush"
+
+	t.mu.Lock()
+	userVisits, sessionVisits := t.userVisits, t.sessionVisits
+	t.userVisits = make(map[int64]time.Time, len(userVisits))
+	t.sessionVisits = make(map[string]time.Time, len(sessionVisits))
+	t.mu.Unlock()
+
+	if len(userVisits) > 0 {
+		if err := t.users.UpdateLastVisits(ctx, userVisits); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+	if len(sessionVisits) > 0 {
+		if err := t.sessions.TouchMany(ctx, sessionVisits); err != nil {
+			return tvoerrors.Wrap(op, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_wallets
+(
+    id         bigserial
+        constraint user_wallets_pk primary key,
+    user_id    bigint  not null
+        constraint user_wallets_users_id_fk
+            references users (id) ON DELETE CASCADE,
+    address    varchar not null
+        constraint user_wallets_address_unique unique,
+    created_at timestamp default now()
+);
+
+CREATE INDEX IF NOT EXISTS user_wallets_user_id_idx ON user_wallets (user_id);
+
+CREATE TABLE IF NOT EXISTS nft_owners
+(
+    token_id      bigint
+        constraint nft_owners_pk primary key,
+    owner_address varchar not null,
+    block_number  bigint  default 0,
+    tx_id         varchar default '',
+    updated_at    timestamp default now()
+);
+
+CREATE INDEX IF NOT EXISTS nft_owners_owner_address_idx ON nft_owners (owner_address);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS nft_owners;
+DROP TABLE IF EXISTS user_wallets;
+-- +goose StatementEnd
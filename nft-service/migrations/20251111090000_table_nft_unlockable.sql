@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS nft_unlockable
+(
+    token_id      bigint
+        constraint nft_unlockable_pk primary key
+        constraint nft_unlockable_nft_data_token_id_fk
+            references nft_data (token_id),
+    ciphertext    bytea   not null,
+    nonce         bytea   not null,
+    wrapped_key   bytea   not null,
+    key_nonce     bytea   not null,
+    master_key_id varchar not null,
+    owner_address varchar default '',
+    created_at    timestamp default now(),
+    updated_at    timestamp
+);
+
+CREATE TABLE IF NOT EXISTS nft_unlockable_access
+(
+    id         bigserial
+        constraint nft_unlockable_access_pk primary key,
+    token_id   bigint not null,
+    user_id    bigint not null,
+    ip         varchar default '',
+    user_agent varchar default '',
+    created_at timestamp default now()
+);
+
+CREATE INDEX IF NOT EXISTS nft_unlockable_access_token_id_idx ON nft_unlockable_access (token_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS nft_unlockable_access;
+DROP TABLE IF EXISTS nft_unlockable;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS nft_drift_runs
+(
+    id             bigserial
+        constraint nft_drift_runs_pk primary key,
+    tokens_checked integer default 0,
+    issues         integer default 0,
+    error          text    default '',
+    started_at     timestamp default now(),
+    finished_at    timestamp
+);
+
+CREATE TABLE IF NOT EXISTS nft_drift_issues
+(
+    id           bigserial
+        constraint nft_drift_issues_pk primary key,
+    run_id       bigint  not null
+        constraint nft_drift_issues_nft_drift_runs_id_fk
+            references nft_drift_runs (id) ON DELETE CASCADE,
+    token_id     bigint  not null,
+    kind         varchar not null,
+    on_chain_uri varchar default '',
+    details      text    default '',
+    created_at   timestamp default now()
+);
+
+CREATE INDEX IF NOT EXISTS nft_drift_issues_run_id_idx ON nft_drift_issues (run_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS nft_drift_issues;
+DROP TABLE IF EXISTS nft_drift_runs;
+-- +goose StatementEnd
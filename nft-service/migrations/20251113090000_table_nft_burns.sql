@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE nft_data ADD COLUMN IF NOT EXISTS burned_at timestamp;
+
+CREATE TABLE IF NOT EXISTS nft_burns
+(
+    token_id      bigint
+        constraint nft_burns_pk primary key,
+    owner_address varchar not null,
+    tx_id         varchar not null,
+    block_number  bigint  default 0,
+    burned_at     timestamp not null,
+    unpinned_at   timestamp,
+    unpin_error   text    default '',
+    created_at    timestamp default now()
+);
+
+CREATE TABLE IF NOT EXISTS indexer_cursors
+(
+    name            varchar
+        constraint indexer_cursors_pk primary key,
+    block_timestamp bigint default 0,
+    updated_at      timestamp default now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS indexer_cursors;
+DROP TABLE IF EXISTS nft_burns;
+ALTER TABLE nft_data DROP COLUMN IF EXISTS burned_at;
+-- +goose StatementEnd
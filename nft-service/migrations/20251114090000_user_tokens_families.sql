@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS family_id varchar;
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS parent_id bigint;
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS rotated_at timestamp;
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS created_at timestamp default now();
+
+-- refresh tokens are stored as sha256 hex, every existing token starts its own family
+UPDATE user_tokens SET refresh_token = encode(sha256(refresh_token::bytea), 'hex')
+    WHERE refresh_token IS NOT NULL;
+UPDATE user_tokens SET family_id = md5(id::text || random()::text) WHERE family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS user_tokens_refresh_token_idx ON user_tokens (refresh_token);
+CREATE INDEX IF NOT EXISTS user_tokens_family_id_idx ON user_tokens (family_id);
+CREATE INDEX IF NOT EXISTS user_tokens_token_idx ON user_tokens (token);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_tokens_token_idx;
+DROP INDEX IF EXISTS user_tokens_family_id_idx;
+DROP INDEX IF EXISTS user_tokens_refresh_token_idx;
+-- hashed refresh tokens can't be restored, all sessions are closed
+UPDATE user_tokens SET refresh_token = NULL;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS created_at;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS parent_id;
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS family_id;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_sessions
+(
+    id           bigserial
+        constraint user_sessions_pk primary key,
+    user_id      bigint  not null
+        constraint user_sessions_users_id_fk
+            references users (id) ON DELETE CASCADE,
+    family_id    varchar not null
+        constraint user_sessions_family_id_unique unique,
+    user_agent   varchar default '',
+    ip           varchar default '',
+    created_at   timestamp default now(),
+    last_used_at timestamp default now(),
+    revoked_at   timestamp
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_id_idx ON user_sessions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,66 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          serial
+        constraint permissions_pk primary key,
+    name        varchar not null
+        constraint permissions_name_unique unique,
+    description varchar default ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       smallint not null
+        constraint role_permissions_roles_id_fk
+            references roles (id) ON DELETE CASCADE,
+    permission_id integer not null
+        constraint role_permissions_permissions_id_fk
+            references permissions (id) ON DELETE CASCADE,
+    constraint role_permissions_pk primary key (role_id, permission_id)
+);
+
+INSERT INTO permissions (name, description)
+VALUES ('nft:create', 'Create nft data'),
+       ('nft:manage_own', 'Manage nft created by the user'),
+       ('nft:manage_any', 'Manage any nft'),
+       ('nft:read_burned', 'List burned tokens'),
+       ('unlockable:rotate', 'Rotate the unlockable master key'),
+       ('drift:read', 'Read the metadata drift report'),
+       ('drift:run', 'Start the metadata drift check'),
+       ('users:list', 'List users and their sessions'),
+       ('users:unlock', 'Unlock accounts locked after failed logins'),
+       ('users:manage', 'Delete, dig up and log out other users'),
+       ('roles:change', 'Change roles of other users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM (VALUES (2, 'nft:create'),
+             (2, 'nft:manage_own'),
+             (99, 'nft:read_burned'),
+             (99, 'drift:read'),
+             (99, 'users:list'),
+             (99, 'users:unlock'),
+             (100, 'nft:create'),
+             (100, 'nft:manage_any'),
+             (100, 'nft:read_burned'),
+             (100, 'unlockable:rotate'),
+             (100, 'drift:read'),
+             (100, 'drift:run'),
+             (100, 'users:list'),
+             (100, 'users:unlock'),
+             (100, 'users:manage'),
+             (100, 'roles:change')) AS v(role_id, name)
+         JOIN roles r ON r.id = v.role_id
+         JOIN permissions p ON p.name = v.name;
+
+ALTER TABLE nft_data ADD COLUMN IF NOT EXISTS created_by bigint
+    constraint nft_data_users_id_fk references users (id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE nft_data DROP COLUMN IF EXISTS created_by;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+-- +goose StatementEnd
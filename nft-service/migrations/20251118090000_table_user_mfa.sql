@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_mfa
+(
+    user_id      bigint  not null
+        constraint user_mfa_pk primary key
+        constraint user_mfa_users_id_fk
+            references users (id) ON DELETE CASCADE,
+    secret       varchar not null, -- encrypted TOTP secret
+    last_counter bigint  not null default 0,
+    created_at   timestamp default now(),
+    enabled_at   timestamp
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes
+(
+    id         bigserial
+        constraint user_recovery_codes_pk primary key,
+    user_id    bigint  not null
+        constraint user_recovery_codes_users_id_fk
+            references users (id) ON DELETE CASCADE,
+    code_hash  varchar not null,
+    created_at timestamp default now(),
+    used_at    timestamp
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the default '' made the unique constraint reject every second user without email
+ALTER TABLE users ALTER COLUMN email DROP DEFAULT;
+UPDATE users SET email = NULL WHERE email = '';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_unique;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email)) WHERE email IS NOT NULL;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+DROP INDEX IF EXISTS users_email_unique_idx;
+ALTER TABLE users ADD CONSTRAINT users_email_unique unique (email);
+ALTER TABLE users ALTER COLUMN email SET DEFAULT '';
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS telegram_id bigint;
+CREATE UNIQUE INDEX IF NOT EXISTS users_telegram_id_unique_idx ON users (telegram_id)
+    WHERE telegram_id IS NOT NULL AND deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_telegram_id_unique_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS telegram_id;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_identities
+(
+    id         bigserial
+        constraint user_identities_pk primary key,
+    user_id    bigint  not null
+        constraint user_identities_users_id_fk
+            references users (id) ON DELETE CASCADE,
+    provider   varchar not null, -- name of the configured OpenID provider, e.g. google
+    subject    varchar not null, -- sub claim, stable for the account within the provider
+    email      varchar,          -- email reported by the provider when the identity was linked
+    created_at timestamp default now(),
+    constraint user_identities_provider_subject_unique unique (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
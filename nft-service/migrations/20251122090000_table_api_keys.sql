@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           bigserial
+        constraint api_keys_pk primary key,
+    prefix       varchar   not null
+        constraint api_keys_prefix_unique unique, -- public part of the key, used to find it
+    key_hash     varchar   not null,              -- HMAC of the whole key, the key itself is never stored
+    name         varchar   not null,
+    user_id      bigint    not null               -- the key acts on behalf of this user
+        constraint api_keys_users_id_fk
+            references users (id) ON DELETE CASCADE,
+    scopes       varchar[] not null default '{}', -- permissions the key may use
+    created_by   bigint
+        constraint api_keys_created_by_fk
+            references users (id) ON DELETE SET NULL,
+    created_at   timestamp default now(),
+    expires_at   timestamp,
+    last_used_at timestamp,
+    revoked_at   timestamp
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+INSERT INTO permissions (name, description)
+VALUES ('nft:read', 'Read nft data and holder checks'),
+       ('pins:write', 'Upload files and manage IPFS pins'),
+       ('api_keys:manage', 'Issue and revoke API keys');
+
+-- nft:read и pins:write раньше были доступны любому авторизованному пользователю
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM (VALUES (1, 'nft:read'),
+             (1, 'pins:write'),
+             (2, 'nft:read'),
+             (2, 'pins:write'),
+             (99, 'nft:read'),
+             (99, 'pins:write'),
+             (100, 'nft:read'),
+             (100, 'pins:write'),
+             (100, 'api_keys:manage')) AS v(role_id, name)
+         JOIN roles r ON r.id = v.role_id
+         JOIN permissions p ON p.name = v.name;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name IN ('nft:read', 'pins:write', 'api_keys:manage');
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
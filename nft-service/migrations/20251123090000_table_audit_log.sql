@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          bigserial
+        constraint audit_log_pk primary key,
+    actor_id    bigint,            -- no foreign key, entries outlive the users
+    api_key_id  bigint,            -- set when the actor used an API key
+    action      varchar not null,
+    target_type varchar not null,
+    target_id   varchar not null,
+    before      jsonb,
+    after       jsonb,
+    ip          varchar not null default '',
+    request_id  varchar not null default '',
+    created_at  timestamp not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action, created_at);
+
+-- журнал только дополняется, изменить или удалить запись нельзя даже с доступом к БД сервиса
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT
+EXECUTE FUNCTION audit_log_append_only();
+
+INSERT INTO permissions (name, description)
+VALUES ('audit:read', 'Query and export the audit log');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.name = 'audit:read'
+WHERE r.id = 100;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'audit:read';
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name varchar,
+    ADD COLUMN IF NOT EXISTS avatar_cid   varchar, -- CIDv1 of the avatar uploaded to IPFS
+    ADD COLUMN IF NOT EXISTS locale       varchar; -- BCP 47 language tag, e.g. ru or en-US
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS display_name,
+    DROP COLUMN IF EXISTS avatar_cid,
+    DROP COLUMN IF EXISTS locale;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- admin user list filters and sorting
+CREATE INDEX IF NOT EXISTS users_role_id_idx ON users (role_id);
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (created_at);
+CREATE INDEX IF NOT EXISTS users_last_visited_at_idx ON users (last_visited_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_role_id_idx;
+DROP INDEX IF EXISTS users_created_at_idx;
+DROP INDEX IF EXISTS users_last_visited_at_idx;
+-- +goose StatementEnd
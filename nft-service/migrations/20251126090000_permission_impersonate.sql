@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (name, description)
+VALUES ('users:impersonate', 'Act as a user with a short-lived token');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.name = 'users:impersonate'
+WHERE r.id = 100;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'users:impersonate';
+-- +goose StatementEnd
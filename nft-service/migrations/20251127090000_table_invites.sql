@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS invite_codes
+(
+    id          bigserial
+        constraint invite_codes_pk primary key,
+    code        varchar   not null
+        constraint invite_codes_code_unique unique,
+    role_id     smallint, -- role of registered users, NULL - the default role
+    max_uses    integer   not null default 1,
+    uses        integer   not null default 0,
+    referrer_id bigint
+        constraint invite_codes_referrer_fk
+            references users (id) ON DELETE SET NULL,
+    created_by  bigint    not null,
+    created_at  timestamp not null default now(),
+    expires_at  timestamp,
+    revoked_at  timestamp
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS invite_id   bigint
+        constraint users_invite_fk references invite_codes (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS referrer_id bigint -- user credited for the registration, for commission reports
+        constraint users_referrer_fk references users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS users_referrer_id_idx ON users (referrer_id);
+
+INSERT INTO permissions (name, description)
+VALUES ('invites:manage', 'Issue and revoke invite codes, view referral reports');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         JOIN permissions p ON p.name = 'invites:manage'
+WHERE r.id = 100;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'invites:manage';
+DROP INDEX IF EXISTS users_referrer_id_idx;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS invite_id,
+    DROP COLUMN IF EXISTS referrer_id;
+DROP TABLE IF EXISTS invite_codes;
+-- +goose StatementEnd
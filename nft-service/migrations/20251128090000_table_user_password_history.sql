@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_password_history
+(
+    id         bigserial
+        constraint user_password_history_pk primary key,
+    user_id    bigint    not null
+        constraint user_password_history_user_fk
+            references users (id) ON DELETE CASCADE,
+    password   varchar   not null, -- hash of a replaced password
+    salt       bytea,              -- set only for the legacy hash format
+    created_at timestamp not null default now()
+);
+
+CREATE INDEX IF NOT EXISTS user_password_history_user_id_idx ON user_password_history (user_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_password_history;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- burned tokens keep their row as a tombstone, so replayed older transfers don't bring the owner back
+ALTER TABLE nft_owners ADD COLUMN IF NOT EXISTS burned_at timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM nft_owners WHERE burned_at IS NOT NULL;
+ALTER TABLE nft_owners DROP COLUMN IF EXISTS burned_at;
+-- +goose StatementEnd
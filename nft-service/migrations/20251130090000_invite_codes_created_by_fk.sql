@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- purged admins no longer leave a dangling id in the invites they issued
+ALTER TABLE invite_codes ALTER COLUMN created_by DROP NOT NULL;
+
+UPDATE invite_codes i SET created_by = NULL
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = i.created_by);
+
+ALTER TABLE invite_codes
+    ADD CONSTRAINT invite_codes_created_by_fk
+        FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE invite_codes DROP CONSTRAINT IF EXISTS invite_codes_created_by_fk;
+UPDATE invite_codes SET created_by = 0 WHERE created_by IS NULL;
+ALTER TABLE invite_codes ALTER COLUMN created_by SET NOT NULL;
+-- +goose StatementEnd
@@ -9,7 +9,11 @@ import (
 type CacheClient interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string) ([]byte, error)
+	GetDel(ctx context.Context, key string) ([]byte, error)
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
 	Exists(ctx context.Context, keys ...string) (uint64, error)
 	Del(ctx context.Context, keys ...string) (uint64, error)
+	Incr(ctx context.Context, key string) (int64, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
 	Close() error
 }
@@ -43,6 +43,18 @@ func (r *redisCache) Set(ctx context.Context, key string, value interface{}, exp
 	return err
 }
 
+// GetDel имплементация метода интерфейса, значение читается и удаляется атомарно
+func (r *redisCache) GetDel(ctx context.Context, key string) ([]byte, error) {
+	data, err := r.client.GetDel(ctx, key).Bytes()
+	return data, err
+}
+
+// SetNX имплементация метода интерфейса, false - ключ уже был
+func (r *redisCache) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	res, err := r.client.SetNX(ctx, key, value, expiration).Result()
+	return res, err
+}
+
 // Exists имплементация метода интерфейса
 func (r *redisCache) Exists(ctx context.Context, keys ...string) (uint64, error) {
 	exists, err := r.client.Exists(ctx, keys...).Uint64()
@@ -55,6 +67,18 @@ func (r *redisCache) Del(ctx context.Context, keys ...string) (uint64, error) {
 	return res, err
 }
 
+// Incr имплементация метода интерфейса
+func (r *redisCache) Incr(ctx context.Context, key string) (int64, error) {
+	res, err := r.client.Incr(ctx, key).Result()
+	return res, err
+}
+
+// Expire имплементация метода интерфейса
+func (r *redisCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	res, err := r.client.Expire(ctx, key, expiration).Result()
+	return res, err
+}
+
 // Close имплементация метода интерфейса
 func (r *redisCache) Close() error {
 	return r.client.Close()
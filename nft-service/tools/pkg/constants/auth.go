@@ -3,3 +3,29 @@ package constants
 const TOKEN_DATA_KEY = "token_data"
 
 const AUTH_SCHEMA = "Bearer"
+
+const OWNERSHIP_CACHE_PREFIX = "nft_owner:"
+
+const OTP_CACHE_PREFIX = "otp:"
+
+const OTP_COOLDOWN_CACHE_PREFIX = "otp_cooldown:"
+
+const OTP_ATTEMPTS_CACHE_PREFIX = "otp_attempts:"
+
+const RATE_LIMIT_CACHE_PREFIX = "rate_limit:"
+
+const LOGIN_FAILURES_CACHE_PREFIX = "login_failures:"
+
+const LOGIN_DELAY_CACHE_PREFIX = "login_delay:"
+
+const REVOKED_CACHE_PREFIX = "revoked:"
+
+const MFA_CHALLENGE_CACHE_PREFIX = "mfa_challenge:"
+
+const MFA_ATTEMPTS_CACHE_PREFIX = "mfa_attempts:"
+
+const OIDC_STATE_CACHE_PREFIX = "oidc_state:"
+
+const TELEGRAM_AUTH_CACHE_PREFIX = "telegram_auth:"
+
+const API_KEY_HEADER = "X-API-Key"
@@ -22,10 +22,12 @@ type Logging struct {
 
 // JWT конфигурация для работы с JWT
 type JWT struct {
-	Secret         string        `envconfig:"JWT_SECRET"`
-	Method         string        `envconfig:"JWT_METHOD"`
-	AuthExpired    time.Duration `envconfig:"JWT_AUTH_EXPIRED"`
-	RefreshExpired time.Duration `envconfig:"JWT_REFRESH_EXPIRED"`
+	Secret         string            `envconfig:"JWT_SECRET"`
+	Method         string            `envconfig:"JWT_METHOD"` // HS256/384/512, RS256/384/512, PS256/384/512, ES256/384/512 or EdDSA
+	AuthExpired    time.Duration     `envconfig:"JWT_AUTH_EXPIRED"`
+	RefreshExpired time.Duration     `envconfig:"JWT_REFRESH_EXPIRED"`
+	Keys           map[string]string `envconfig:"JWT_KEYS"`       // kid:path pairs of PEM keys, public keys are used only for verification
+	ActiveKeyID    string            `envconfig:"JWT_ACTIVE_KEY"` // kid of the private key signing new tokens
 }
 
 // Database конфигурация подключения к БД
@@ -16,8 +16,22 @@ import (
 type CheckTokenCallback func(ctx context.Context, token string) (*tvomodels.TokenData, error)
 
 // NewAuthMiddleware panic recover middleware
-func NewAuthMiddleware(checkFunc CheckTokenCallback, allowUnauth bool, logger *logger.Logger) fiber.Handler {
+// checkKeyFunc проверяет ключ из заголовка X-API-Key, nil запрещает вход по ключам
+func NewAuthMiddleware(checkFunc CheckTokenCallback, checkKeyFunc CheckTokenCallback, allowUnauth bool,
+	logger *logger.Logger) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if apiKey := c.Get(constants.API_KEY_HEADER); apiKey != "" && checkKeyFunc != nil {
+			tokenData, err := checkKeyFunc(c.Context(), apiKey)
+			if err != nil {
+				// сам ключ в лог не пишем, достаточно префикса
+				logger.Error("check api key error", "key_prefix", keyPrefix(apiKey), "error", err)
+				return httputils.HandleError(c, fiber.StatusUnauthorized, tvoerrors.ErrUnauthorized)
+			}
+
+			c.Locals(constants.TOKEN_DATA_KEY, *tokenData)
+			return c.Next()
+		}
+
 		// extract token from request
 		var token string
 		authHeader := c.Get(fiber.HeaderAuthorization)
@@ -43,6 +57,12 @@ func NewAuthMiddleware(checkFunc CheckTokenCallback, allowUnauth bool, logger *l
 
 		// check token
 		if tokenData, err = checkFunc(c.Context(), token); err != nil {
+			if allowUnauth {
+				// просроченный или отозванный токен не мешает открыть публичный метод, пользователь считается гостем
+				logger.Warn("invalid token treated as guest", "error", err)
+				c.Locals(constants.TOKEN_DATA_KEY, nil)
+				return c.Next()
+			}
 			logger.Error("check token error", "token", token, "error", err)
 			return httputils.HandleError(c, fiber.StatusUnauthorized, tvoerrors.ErrInvalidJWT)
 		}
@@ -56,3 +76,11 @@ func NewAuthMiddleware(checkFunc CheckTokenCallback, allowUnauth bool, logger *l
 		return c.Next()
 	}
 }
+
+// keyPrefix returns the public part of an API key
+func keyPrefix(apiKey string) string {
+	if i := strings.LastIndexByte(apiKey, '_'); i > 0 {
+		return apiKey[:i]
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package httpmiddlewares
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/tools/pkg/constants"
+	"main/tools/pkg/logger"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+func TestAuthMiddlewareGuest(t *testing.T) {
+	log := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	check := func(_ context.Context, token string) (*tvomodels.TokenData, error) {
+		if token == "valid" {
+			return &tvomodels.TokenData{UserID: 7}, nil
+		}
+		return nil, errors.New("token expired")
+	}
+	// отвечает id пользователя из токена, 0 для гостя
+	whoami := func(c *fiber.Ctx) error {
+		tokenData, _ := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		return c.JSON(tokenData.UserID)
+	}
+
+	app := fiber.New()
+	app.Get("/guest", NewAuthMiddleware(check, nil, true, log), whoami)
+	app.Get("/user", NewAuthMiddleware(check, nil, false, log), whoami)
+
+	tests := []struct {
+		path   string
+		header string
+		status int
+		body   string
+	}{
+		{"/guest", "", fiber.StatusOK, "0"},
+		{"/guest", "Bearer valid", fiber.StatusOK, "7"},
+		{"/guest", "Bearer expired", fiber.StatusOK, "0"},
+		{"/user", "", fiber.StatusForbidden, ""},
+		{"/user", "Bearer valid", fiber.StatusOK, "7"},
+		{"/user", "Bearer expired", fiber.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(fiber.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(fiber.HeaderAuthorization, tt.header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %q: request error = %v", tt.path, tt.header, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %q: status = %d, expected %d", tt.path, tt.header, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.body != "" {
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.body {
+				t.Errorf("%s %q: body = %s, expected %s", tt.path, tt.header, body, tt.body)
+			}
+		}
+	}
+}
+
+func TestAuthMiddlewareAPIKey(t *testing.T) {
+	log := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	checkKey := func(_ context.Context, key string) (*tvomodels.TokenData, error) {
+		if key == "gads_active_secret" {
+			return &tvomodels.TokenData{UserID: 7, APIKeyID: 1}, nil
+		}
+		// ключ отозван, истек или его пользователь заблокирован
+		return nil, errors.New("invalid api key")
+	}
+
+	app := fiber.New()
+	app.Get("/", NewAuthMiddleware(nil, checkKey, true, log), func(c *fiber.Ctx) error {
+		tokenData, _ := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		return c.JSON(tokenData.APIKeyID)
+	})
+
+	tests := []struct {
+		key    string
+		status int
+	}{
+		{"gads_active_secret", fiber.StatusOK},
+		{"gads_locked_secret", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(constants.API_KEY_HEADER, tt.key)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%q: request error = %v", tt.key, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%q: status = %d, expected %d", tt.key, resp.StatusCode, tt.status)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package httpmiddlewares
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+type ImpersonatedRequestCallback func(c *fiber.Ctx, tokenData *tvomodels.TokenData)
+
+// DenyImpersonated forbids the request while an admin impersonates the user,
+// used for logout, credential changes and other dangerous actions. Must be used after NewAuthMiddleware.
+func DenyImpersonated(logger *logger.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		if ok && tokenData.Impersonated() {
+			logger.Warn("action denied while impersonating", "user_id", tokenData.UserID, "actor_id", tokenData.ActorID,
+				"path", c.Path())
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		return c.Next()
+	}
+}
+
+// NewImpersonationMiddleware reports every request made with an impersonation token once it is handled.
+// It is used before the auth middlewares, the token data is read after the rest of the chain.
+func NewImpersonationMiddleware(recordFunc ImpersonatedRequestCallback) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		if tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData); ok && tokenData.Impersonated() {
+			recordFunc(c, &tokenData)
+		}
+
+		return err
+	}
+}
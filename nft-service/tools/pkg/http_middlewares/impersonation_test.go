@@ -0,0 +1,116 @@
+package httpmiddlewares
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/tools/pkg/logger"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// newImpersonationApp builds the chain used by the server: the audit middleware on the router,
+// the auth middleware and DenyImpersonated on dangerous routes
+func newImpersonationApp(t *testing.T, recorded *[]string) *fiber.App {
+	t.Helper()
+
+	log := &logger.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	check := func(_ context.Context, token string) (*tvomodels.TokenData, error) {
+		switch token {
+		case "user":
+			return &tvomodels.TokenData{UserID: 7}, nil
+		case "impersonated":
+			return &tvomodels.TokenData{UserID: 7, ActorID: 1}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+	auth := NewAuthMiddleware(check, nil, false, log)
+
+	app := fiber.New()
+	app.Use(NewImpersonationMiddleware(func(c *fiber.Ctx, tokenData *tvomodels.TokenData) {
+		if tokenData.UserID != 7 || tokenData.ActorID != 1 {
+			t.Errorf("recorded token data = %+v", tokenData)
+		}
+		*recorded = append(*recorded, c.Method()+" "+c.Path())
+	}))
+	app.Get("/me", auth, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Patch("/me", auth, DenyImpersonated(log), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/fail", auth, func(c *fiber.Ctx) error {
+		return fiber.ErrBadRequest
+	})
+
+	return app
+}
+
+func TestDenyImpersonated(t *testing.T) {
+	var recorded []string
+	app := newImpersonationApp(t, &recorded)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"user changes profile", fiber.MethodPatch, "/me", "user", fiber.StatusOK},
+		{"impersonated profile change is denied", fiber.MethodPatch, "/me", "impersonated", fiber.StatusForbidden},
+		{"impersonated read is allowed", fiber.MethodGet, "/me", "impersonated", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+tt.token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: request error = %v", tt.name, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, expected %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestImpersonationMiddleware(t *testing.T) {
+	var recorded []string
+	app := newImpersonationApp(t, &recorded)
+
+	requests := []struct {
+		method string
+		path   string
+		token  string
+	}{
+		{fiber.MethodGet, "/me", "user"},
+		{fiber.MethodGet, "/me", "impersonated"},
+		{fiber.MethodPatch, "/me", "impersonated"},
+		{fiber.MethodPost, "/fail", "impersonated"},
+		{fiber.MethodPost, "/fail", "user"},
+		{fiber.MethodGet, "/me", "invalid"},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+r.token)
+		if _, err := app.Test(req); err != nil {
+			t.Fatalf("%s %s: request error = %v", r.method, r.path, err)
+		}
+	}
+
+	// запись появляется для каждого запроса под чужим аккаунтом, в том числе отклоненного и завершенного ошибкой
+	expected := []string{"GET /me", "PATCH /me", "POST /fail"}
+	if len(recorded) != len(expected) {
+		t.Fatalf("recorded = %v, expected %v", recorded, expected)
+	}
+	for i := range expected {
+		if recorded[i] != expected[i] {
+			t.Errorf("recorded[%d] = %q, expected %q", i, recorded[i], expected[i])
+		}
+	}
+}
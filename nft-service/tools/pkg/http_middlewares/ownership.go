@@ -0,0 +1,81 @@
+package httpmiddlewares
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/tools/pkg/cache"
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+// AnyToken is passed to CheckOwnershipCallback when any token of the collection is enough
+const AnyToken int64 = 0
+
+type CheckOwnershipCallback func(ctx context.Context, userId, tokenId int64) (bool, error)
+
+// OwnershipCacheKey returns the key of the cached ownership check, the indexer drops it on transfers
+func OwnershipCacheKey(userId, tokenId int64) string {
+	return fmt.Sprintf("%s%d:%d", constants.OWNERSHIP_CACHE_PREFIX, userId, tokenId)
+}
+
+// NewOwnershipMiddleware allows the request only if the authorized user holds the token
+// taken from the route param tokenParam. An empty tokenParam means any token of the collection.
+// Must be used after NewAuthMiddleware.
+func NewOwnershipMiddleware(checkFunc CheckOwnershipCallback, tokenParam string, cacheClient cache.CacheClient,
+	ttl time.Duration, logger *logger.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		if !ok || tokenData.UserID == 0 {
+			logger.Error("ownership check without token data")
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		tokenId := AnyToken
+		if tokenParam != "" {
+			var err error
+			if tokenId, err = strconv.ParseInt(c.Params(tokenParam), 10, 64); err != nil || tokenId <= 0 {
+				logger.Error("invalid token id", "value", c.Params(tokenParam), "error", err)
+				return httputils.HandleError(c, fiber.StatusBadRequest, tvoerrors.ErrInvalidRequestData)
+			}
+		}
+
+		// проверяем результат в кеше
+		key := OwnershipCacheKey(tokenData.UserID, tokenId)
+		cached, err := cacheClient.Get(c.Context(), key)
+		if err == nil {
+			if string(cached) == "1" {
+				return c.Next()
+			}
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		owns, err := checkFunc(c.Context(), tokenData.UserID, tokenId)
+		if err != nil {
+			logger.Error("check ownership error", "user_id", tokenData.UserID, "token_id", tokenId, "error", err)
+			return httputils.HandleError(c, fiber.StatusInternalServerError, tvoerrors.ErrServerError)
+		}
+
+		value := "0"
+		if owns {
+			value = "1"
+		}
+		if err = cacheClient.Set(c.Context(), key, value, ttl); err != nil {
+			logger.Error("Error store ownership", "error", err)
+		}
+
+		if !owns {
+			logger.Warn("user is not a token holder", "user_id", tokenData.UserID, "token_id", tokenId)
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package httpmiddlewares
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"main/tools/pkg/constants"
+	httputils "main/tools/pkg/http_utils"
+	"main/tools/pkg/logger"
+	tvoerrors "main/tools/pkg/tvo_errors"
+	tvomodels "main/tools/pkg/tvo_models"
+)
+
+type CheckPermissionCallback func(ctx context.Context, roleId tvomodels.RoleId, permission string) (bool, error)
+
+// RequirePermission allows the request only if the role of the authorized user grants the permission.
+// A request with an API key also needs the permission in the key scopes.
+// Must be used after NewAuthMiddleware.
+func RequirePermission(checkFunc CheckPermissionCallback, permission string, logger *logger.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenData, ok := c.Locals(constants.TOKEN_DATA_KEY).(tvomodels.TokenData)
+		if !ok || tokenData.UserID == 0 {
+			logger.Error("permission check without token data", "permission", permission)
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		if tokenData.APIKeyID != 0 && !slices.Contains(tokenData.Scopes, permission) {
+			logger.Warn("permission out of api key scopes", "user_id", tokenData.UserID, "api_key_id", tokenData.APIKeyID,
+				"permission", permission)
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		allowed, err := checkFunc(c.Context(), tokenData.UserRoleID, permission)
+		if err != nil {
+			logger.Error("check permission error", "permission", permission, "error", err)
+			return httputils.HandleError(c, fiber.StatusInternalServerError, tvoerrors.ErrServerError)
+		}
+		if !allowed {
+			logger.Warn("permission denied", "user_id", tokenData.UserID, "role_id", tokenData.UserRoleID,
+				"permission", permission)
+			return httputils.HandleError(c, fiber.StatusForbidden, tvoerrors.ErrForbidden)
+		}
+
+		return c.Next()
+	}
+}
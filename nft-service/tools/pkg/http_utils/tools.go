@@ -88,13 +88,16 @@ func IsAuthorized(c *fiber.Ctx) bool {
 }
 
 // GetTokenDataFromCtx retrieves the authenticated user's token data from the context.
+// Fiber keeps locals as fasthttp user values, the auth middleware stores TokenData by value.
 func GetTokenDataFromCtx(ctx context.Context) (*tvomodels.TokenData, error) {
-	tokenData, ok := ctx.Value(constants.TOKEN_DATA_KEY).(*tvomodels.TokenData)
-	if !ok {
+	switch tokenData := ctx.Value(constants.TOKEN_DATA_KEY).(type) {
+	case tvomodels.TokenData:
+		return &tokenData, nil
+	case *tvomodels.TokenData:
+		return tokenData, nil
+	default:
 		return nil, tvoerrors.Wrap("invalid token", tvoerrors.ErrCastClaims)
 	}
-
-	return tokenData, nil
 }
 
 func GetTelegramSignatureFromCtx(ctx context.Context) (string, error) {
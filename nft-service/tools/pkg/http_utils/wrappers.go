@@ -34,6 +34,8 @@ func FiberStatusByErr(err error) int {
 		return fiber.StatusForbidden
 	case errors.Is(err, tvoerrors.ErrConflict):
 		return fiber.StatusConflict
+	case errors.Is(err, tvoerrors.ErrTooManyRequests):
+		return fiber.StatusTooManyRequests
 	default:
 		return fiber.StatusInternalServerError
 	}
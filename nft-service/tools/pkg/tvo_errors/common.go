@@ -29,6 +29,7 @@ var (
 	ErrInvalidJWT         = errors.New("invalid or expired JWT")
 	ErrMissingJWT         = errors.New("missing or malformed JWT")
 	ErrConflict           = errors.New("conflict")
+	ErrTooManyRequests    = errors.New("too many requests")
 
 	ErrInvalidEmail = errors.New("invalid email")
 	ErrInvalidPhone = errors.New("invalid phone number")
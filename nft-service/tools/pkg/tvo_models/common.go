@@ -17,9 +17,17 @@ const (
 
 // TokenData структура с данными из токена
 type TokenData struct {
-	UserID     int64  `json:"id"`
-	UserPhone  string `json:"phone"`
-	UserEmail  string `json:"email"`
-	UserRoleID RoleId `json:"role_id"`
-	RawToken   string `json:"raw_token"`
+	UserID     int64    `json:"id"`
+	UserPhone  string   `json:"phone"`
+	UserEmail  string   `json:"email"`
+	UserRoleID RoleId   `json:"role_id"`
+	RawToken   string   `json:"raw_token"`
+	APIKeyID   int64    `json:"api_key_id,omitempty"` // set when the request is authorized by an API key
+	Scopes     []string `json:"scopes,omitempty"`     // permissions the API key may use
+	ActorID    int64    `json:"actor_id,omitempty"`   // admin impersonating the user, see Impersonated
+}
+
+// Impersonated reports whether an admin acts as the user, such requests can't do dangerous actions
+func (t *TokenData) Impersonated() bool {
+	return t.ActorID != 0
 }
@@ -0,0 +1,37 @@
+package validator
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+// MaxDisplayNameLength limits display names in characters
+const MaxDisplayNameLength = 64
+
+// localeRegexp accepts a language with an optional region, e.g. ru or en-US
+var localeRegexp = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// ValidDisplayName function validates the given display name.
+// The name must be trimmed, not longer than MaxDisplayNameLength and without control characters.
+func ValidDisplayName(name string) error {
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		return tvoerrors.Wrap("invalid display name", tvoerrors.ErrInvalidRequestData)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return tvoerrors.Wrap("invalid display name", tvoerrors.ErrInvalidRequestData)
+		}
+	}
+	return nil
+}
+
+// ValidLocale function validates the given BCP 47 language tag.
+func ValidLocale(locale string) error {
+	if !localeRegexp.MatchString(locale) {
+		return tvoerrors.Wrap("invalid locale", tvoerrors.ErrInvalidRequestData)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tvoerrors "main/tools/pkg/tvo_errors"
+)
+
+func TestValidDisplayName(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"empty clears the name", "", true},
+		{"latin", "Alice", true},
+		{"cyrillic with emoji", "Алиса 🦊", true},
+		{"max length in characters", strings.Repeat("я", MaxDisplayNameLength), true},
+		{"too long", strings.Repeat("a", MaxDisplayNameLength+1), false},
+		{"newline", "Alice\nBob", false},
+		{"tab", "Alice\tBob", false},
+		{"right-to-left override", "Alice\u202eboB", false},
+		{"zero width space", "Ali\u200bce", false},
+		{"invalid utf-8", "Alice\xff", false},
+	}
+	for _, tt := range tests {
+		err := ValidDisplayName(tt.value)
+		if tt.valid && err != nil {
+			t.Errorf("%s: ValidDisplayName(%q) error = %v", tt.name, tt.value, err)
+		}
+		if !tt.valid && !errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			t.Errorf("%s: ValidDisplayName(%q) error = %v, expected %v", tt.name, tt.value, err,
+				tvoerrors.ErrInvalidRequestData)
+		}
+	}
+}
+
+func TestValidLocale(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"ru", true},
+		{"en-US", true},
+		{"fil", true},
+		{"", false},
+		{"EN", false},
+		{"en-us", false},
+		{"en_US", false},
+		{"en-USA", false},
+		{"english", false},
+		{"zh-Hans-CN", false},
+	}
+	for _, tt := range tests {
+		err := ValidLocale(tt.value)
+		if tt.valid && err != nil {
+			t.Errorf("ValidLocale(%q) error = %v", tt.value, err)
+		}
+		if !tt.valid && !errors.Is(err, tvoerrors.ErrInvalidRequestData) {
+			t.Errorf("ValidLocale(%q) error = %v, expected %v", tt.value, err, tvoerrors.ErrInvalidRequestData)
+		}
+	}
+}